@@ -7,6 +7,8 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"github.com/lncapital/torq/internal/channel_backups"
+	"github.com/lncapital/torq/internal/invoices"
 	"github.com/lncapital/torq/pkg/lnd"
 	// "github.com/rs/zerolog/log"
 	"golang.org/x/sync/errgroup"
@@ -91,7 +93,7 @@ func Start(ctx context.Context, conn *grpc.ClientConn, db *sqlx.DB, localNodeId
 
 	// Transactions
 	errs.Go(func() error {
-		err := lnd.SubscribeAndStoreTransactions(ctx, client, db)
+		err := lnd.SubscribeAndStoreTransactions(ctx, client, db, localNodeId)
 		if err != nil {
 			return errors.Wrapf(err, "Start->SubscribeAndStoreTransactions(%v, %v, %v)", ctx, client, db)
 		}
@@ -100,7 +102,7 @@ func Start(ctx context.Context, conn *grpc.ClientConn, db *sqlx.DB, localNodeId
 
 	// // HTLC events
 	errs.Go(func() error {
-		err := lnd.SubscribeAndStoreHtlcEvents(ctx, router, db)
+		err := lnd.SubscribeAndStoreHtlcEvents(ctx, router, db, localNodeId)
 		if err != nil {
 			return errors.Wrapf(err, "Start->SubscribeAndStoreHtlcEvents(%v, %v, %v)", ctx, router, db)
 		}
@@ -118,7 +120,7 @@ func Start(ctx context.Context, conn *grpc.ClientConn, db *sqlx.DB, localNodeId
 
 	// Graph (Node updates, fee updates etc.)
 	errs.Go(func() error {
-		err := lnd.SubscribeAndStoreChannelGraph(ctx, client, db, ourNodePubKeys)
+		err := lnd.SubscribeAndStoreChannelGraph(ctx, client, db, ourNodePubKeys, localNodeId)
 		if err != nil {
 			return errors.Wrapf(err, "Start->SubscribeAndStoreChannelGraph(%v, %v, %v)", ctx, client, db)
 		}
@@ -127,7 +129,7 @@ func Start(ctx context.Context, conn *grpc.ClientConn, db *sqlx.DB, localNodeId
 
 	// Forwarding history
 	errs.Go(func() error {
-		err := lnd.SubscribeForwardingEvents(ctx, client, db, nil)
+		err := lnd.SubscribeForwardingEvents(ctx, client, db, localNodeId, nil)
 		if err != nil {
 			return errors.Wrapf(err, "Start->SubscribeForwardingEvents(%v, %v, %v, %v)", ctx,
 				client, db, nil)
@@ -137,7 +139,7 @@ func Start(ctx context.Context, conn *grpc.ClientConn, db *sqlx.DB, localNodeId
 
 	// Invoices
 	errs.Go(func() error {
-		err := lnd.SubscribeAndStoreInvoices(ctx, client, db)
+		err := lnd.SubscribeAndStoreInvoices(ctx, client, db, localNodeId)
 		if err != nil {
 			return errors.Wrapf(err, "Start->SubscribeAndStoreInvoices(%v, %v, %v)", ctx,
 				client, db)
@@ -145,9 +147,27 @@ func Start(ctx context.Context, conn *grpc.ClientConn, db *sqlx.DB, localNodeId
 		return nil
 	})
 
+	// Channel backups
+	errs.Go(func() error {
+		err := channel_backups.SubscribeAndStoreChannelBackups(ctx, client, db, localNodeId)
+		if err != nil {
+			return errors.Wrapf(err, "Start->SubscribeAndStoreChannelBackups(%v, %v, %v)", ctx, client, db)
+		}
+		return nil
+	})
+
+	// Hold invoices
+	errs.Go(func() error {
+		err := invoices.WatchHoldInvoices(ctx, conn, db, localNodeId)
+		if err != nil {
+			return errors.Wrapf(err, "Start->WatchHoldInvoices(%v, %v)", ctx, db)
+		}
+		return nil
+	})
+
 	// Payments
 	errs.Go(func() error {
-		err := lnd.SubscribeAndStorePayments(ctx, client, db, nil)
+		err := lnd.SubscribeAndStorePayments(ctx, client, db, localNodeId, nil)
 		if err != nil {
 			return errors.Wrapf(err, "Start->SubscribeAndStorePayments(%v, %v, %v)", ctx,
 				client, db)
@@ -157,7 +177,7 @@ func Start(ctx context.Context, conn *grpc.ClientConn, db *sqlx.DB, localNodeId
 
 	// Update in flight payments
 	errs.Go(func() error {
-		err := lnd.SubscribeAndUpdatePayments(ctx, client, db, nil)
+		err := lnd.SubscribeAndUpdatePayments(ctx, client, db, localNodeId, nil)
 		if err != nil {
 			return errors.Wrapf(err, "Start->SubscribeAndUpdatePayments(%v, %v, %v)", ctx,
 				client, db)
@@ -0,0 +1,79 @@
+package torqcli
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+	"github.com/lncapital/torq/pkg/torqrpc"
+	"github.com/urfave/cli/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// client is a connection to the gRPC API of a running Torq.
+type client struct {
+	torqrpc.TorqClient
+	conn *grpc.ClientConn
+}
+
+func (cl *client) Close() error {
+	return cl.conn.Close()
+}
+
+// connect connects to the gRPC API configured with torq.grpc-host and torq.grpc-port and logs in with the Torq
+// password. The returned context carries the session token and must be used for all calls.
+func connect(c *cli.Context) (context.Context, *client, error) {
+	if err := checkOutputFormat(c.String("output")); err != nil {
+		return nil, nil, err
+	}
+
+	port := c.Int("torq.grpc-port")
+	if port == 0 {
+		return nil, nil, errors.New("torq.grpc-port is not set, the client commands use the gRPC API of Torq")
+	}
+	address := net.JoinHostPort(c.String("torq.grpc-host"), strconv.Itoa(port))
+
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Connecting to %s", address)
+	}
+	cl := &client{TorqClient: torqrpc.NewTorqClient(conn), conn: conn}
+
+	resp, err := cl.Login(c.Context, &torqrpc.LoginRequest{Password: c.String("torq.password")})
+	if err != nil {
+		cl.Close()
+		return nil, nil, errors.Wrapf(err, "Logging in to %s", address)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(c.Context, "authorization", "Bearer "+resp.Token)
+	return ctx, cl, nil
+}
+
+// localNodeId returns the given node id, or the id of the only enabled local node when it's 0.
+func localNodeId(ctx context.Context, cl *client, nodeId int) (int32, error) {
+	if nodeId != 0 {
+		return int32(nodeId), nil
+	}
+
+	resp, err := cl.ListNodes(ctx, &torqrpc.ListNodesRequest{})
+	if err != nil {
+		return 0, errors.Wrap(err, "Listing local nodes")
+	}
+	var enabled []*torqrpc.LocalNode
+	for _, n := range resp.Nodes {
+		if !n.Disabled {
+			enabled = append(enabled, n)
+		}
+	}
+	switch len(enabled) {
+	case 0:
+		return 0, errors.New("No enabled local node found")
+	case 1:
+		return enabled[0].LocalNodeId, nil
+	default:
+		return 0, errors.New("Torq has more than one local node, select one with --node")
+	}
+}
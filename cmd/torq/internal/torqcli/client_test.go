@@ -0,0 +1,46 @@
+package torqcli
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lncapital/torq/pkg/torqrpc"
+	"google.golang.org/grpc"
+)
+
+type mockTorqClient_ListNodes struct {
+	torqrpc.TorqClient
+	nodes []*torqrpc.LocalNode
+}
+
+func (c *mockTorqClient_ListNodes) ListNodes(ctx context.Context, in *torqrpc.ListNodesRequest,
+	opts ...grpc.CallOption) (*torqrpc.ListNodesResponse, error) {
+	return &torqrpc.ListNodesResponse{Nodes: c.nodes}, nil
+}
+
+func Test_localNodeId(t *testing.T) {
+	tests := []struct {
+		name    string
+		nodeId  int
+		nodes   []*torqrpc.LocalNode
+		want    int32
+		wantErr bool
+	}{
+		{"Selected node", 3, nil, 3, false},
+		{"Only enabled node", 0, []*torqrpc.LocalNode{{LocalNodeId: 1, Disabled: true}, {LocalNodeId: 2}}, 2, false},
+		{"No enabled node", 0, []*torqrpc.LocalNode{{LocalNodeId: 1, Disabled: true}}, 0, true},
+		{"More than one node", 0, []*torqrpc.LocalNode{{LocalNodeId: 1}, {LocalNodeId: 2}}, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cl := &client{TorqClient: &mockTorqClient_ListNodes{nodes: test.nodes}}
+			got, err := localNodeId(context.Background(), cl, test.nodeId)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("localNodeId() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("localNodeId() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
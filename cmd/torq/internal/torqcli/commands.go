@@ -0,0 +1,400 @@
+package torqcli
+
+import (
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/lncapital/torq/pkg/torqrpc"
+	"github.com/urfave/cli/v2"
+)
+
+// Commands returns the client commands. They talk to a running Torq over its gRPC API, using the Torq password
+// and gRPC port of the config.
+func Commands() cli.Commands {
+	return cli.Commands{
+		{
+			Name:  "channels",
+			Usage: "Channels of the local nodes",
+			Subcommands: cli.Commands{
+				{
+					Name:   "list",
+					Usage:  "List the channels of all local nodes",
+					Flags:  []cli.Flag{outputFlag, &cli.BoolFlag{Name: "all", Usage: "Include closed channels"}},
+					Action: listChannels,
+				},
+			},
+		},
+		{
+			Name:  "forwards",
+			Usage: "Forwarding statistics",
+			Subcommands: cli.Commands{
+				{
+					Name:  "summary",
+					Usage: "Forwarding totals per channel for a date range",
+					Flags: []cli.Flag{
+						outputFlag,
+						&cli.StringFlag{Name: "from", Usage: "Start date (YYYY-MM-DD), defaults to 7 days ago"},
+						&cli.StringFlag{Name: "to", Usage: "End date (YYYY-MM-DD), defaults to today"},
+					},
+					Action: forwardsSummary,
+				},
+			},
+		},
+		{
+			Name:  "fees",
+			Usage: "Channel fees",
+			Subcommands: cli.Commands{
+				{
+					Name:  "set",
+					Usage: "Set the routing policy of a channel",
+					Flags: []cli.Flag{
+						outputFlag,
+						&cli.StringFlag{Name: "channel", Required: true,
+							Usage: "Channel point, short channel id (BOLT format) or LND short channel id"},
+						&cli.UintFlag{Name: "ppm", Required: true, Usage: "Fee rate in parts per million"},
+						&cli.Int64Flag{Name: "base-fee-msat", Usage: "Base fee in millisatoshis, unchanged when not set"},
+						&cli.UintFlag{Name: "time-lock-delta", Usage: "CLTV delta, unchanged when not set"},
+					},
+					Action: setFees,
+				},
+			},
+		},
+		{
+			Name:      "pay",
+			Usage:     "Pay an invoice",
+			ArgsUsage: "<invoice>",
+			Flags: []cli.Flag{
+				outputFlag,
+				&cli.IntFlag{Name: "node", Usage: "Local node id, required when Torq has more than one node"},
+				&cli.IntFlag{Name: "timeout", Value: 60, Usage: "Seconds to try paying before giving up"},
+				&cli.Int64Flag{Name: "amt-msat", Usage: "Amount to pay, only for invoices without an amount"},
+				&cli.Int64Flag{Name: "fee-limit-msat", Usage: "Maximum routing fee"},
+			},
+			Action: pay,
+		},
+		{
+			Name:  "invoice",
+			Usage: "Invoices",
+			Subcommands: cli.Commands{
+				{
+					Name:  "new",
+					Usage: "Create an invoice",
+					Flags: []cli.Flag{
+						outputFlag,
+						&cli.IntFlag{Name: "node", Usage: "Local node id, required when Torq has more than one node"},
+						&cli.Int64Flag{Name: "amt-msat", Usage: "Amount, any amount can be paid when not set"},
+						&cli.StringFlag{Name: "memo", Usage: "Description of the invoice"},
+						&cli.Int64Flag{Name: "expiry", Usage: "Expiry in seconds"},
+						&cli.BoolFlag{Name: "private", Usage: "Include routing hints for private channels"},
+					},
+					Action: newInvoice,
+				},
+			},
+		},
+		{
+			Name:  "node",
+			Usage: "Local nodes",
+			Subcommands: cli.Commands{
+				{
+					Name:   "list",
+					Usage:  "List the local nodes Torq is connected to",
+					Flags:  []cli.Flag{outputFlag},
+					Action: listNodes,
+				},
+			},
+		},
+	}
+}
+
+func listChannels(c *cli.Context) error {
+	ctx, cl, err := connect(c)
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+
+	resp, err := cl.ListChannels(ctx, &torqrpc.ListChannelsRequest{})
+	if err != nil {
+		return err
+	}
+
+	r := result{
+		message: resp,
+		header: []string{"Node", "Alias", "Short channel id", "LND short channel id", "Channel point",
+			"Capacity", "Open"},
+	}
+	var channels []*torqrpc.Channel
+	for _, ch := range resp.Channels {
+		if !ch.Open && !c.Bool("all") {
+			continue
+		}
+		channels = append(channels, ch)
+		r.rows = append(r.rows, []string{
+			strconv.Itoa(int(ch.LocalNodeId)),
+			ch.Alias,
+			ch.ShortChannelId,
+			strconv.FormatUint(ch.LndShortChannelId, 10),
+			ch.ChannelPoint,
+			strconv.FormatUint(ch.Capacity, 10),
+			strconv.FormatBool(ch.Open),
+		})
+	}
+	resp.Channels = channels
+	return printResult(c, r)
+}
+
+func forwardsSummary(c *cli.Context) error {
+	from := c.String("from")
+	if from == "" {
+		from = time.Now().AddDate(0, 0, -7).Format("2006-01-02")
+	}
+	to := c.String("to")
+	if to == "" {
+		to = time.Now().Format("2006-01-02")
+	}
+
+	ctx, cl, err := connect(c)
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+
+	resp, err := cl.ListForwards(ctx, &torqrpc.ListForwardsRequest{
+		From:  from,
+		To:    to,
+		Order: []*torqrpc.Order{{Key: "revenue_out", Direction: "desc"}},
+	})
+	if err != nil {
+		return err
+	}
+
+	r := result{
+		message: resp,
+		header: []string{"Alias", "Short channel id", "Capacity", "Amount out", "Amount in", "Revenue out",
+			"Revenue in", "Count out", "Count in", "Turnover"},
+	}
+	for _, f := range resp.Channels {
+		r.rows = append(r.rows, []string{
+			f.Alias,
+			f.ShortChannelId,
+			strconv.FormatUint(f.Capacity, 10),
+			strconv.FormatUint(f.AmountOut, 10),
+			strconv.FormatUint(f.AmountIn, 10),
+			strconv.FormatUint(f.RevenueOut, 10),
+			strconv.FormatUint(f.RevenueIn, 10),
+			strconv.FormatUint(f.CountOut, 10),
+			strconv.FormatUint(f.CountIn, 10),
+			strconv.FormatFloat(float64(f.TurnoverTotal), 'f', 2, 32),
+		})
+	}
+	return printResult(c, r)
+}
+
+func setFees(c *cli.Context) error {
+	ctx, cl, err := connect(c)
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+
+	chans, err := cl.ListChannels(ctx, &torqrpc.ListChannelsRequest{})
+	if err != nil {
+		return err
+	}
+	ch := findChannel(chans.Channels, c.String("channel"))
+	if ch == nil {
+		return errors.Newf("No open channel found for %s", c.String("channel"))
+	}
+
+	// Torq keeps the current base fee and time lock delta of the channel when they aren't sent.
+	feeRatePpm := uint32(c.Uint("ppm"))
+	req := &torqrpc.UpdateChannelPolicyRequest{
+		NodeId:       ch.LocalNodeId,
+		ChannelPoint: &ch.ChannelPoint,
+		FeeRatePpm:   &feeRatePpm,
+	}
+	baseFee := "unchanged"
+	if c.IsSet("base-fee-msat") {
+		baseFeeMsat := c.Int64("base-fee-msat")
+		req.BaseFeeMsat = &baseFeeMsat
+		baseFee = strconv.FormatInt(baseFeeMsat, 10)
+	}
+	if c.IsSet("time-lock-delta") {
+		req.TimeLockDelta = uint32(c.Uint("time-lock-delta"))
+	}
+	resp, err := cl.UpdateChannelPolicy(ctx, req)
+	if err != nil {
+		return err
+	}
+	if len(resp.FailedUpdates) != 0 {
+		f := resp.FailedUpdates[0]
+		return errors.Newf("Updating the policy of %s failed: %s %s", ch.ChannelPoint, f.Reason, f.UpdateError)
+	}
+
+	return printResult(c, result{
+		message: resp,
+		header:  []string{"Channel point", "Fee rate ppm", "Base fee msat", "Status"},
+		rows: [][]string{{
+			ch.ChannelPoint,
+			strconv.FormatUint(uint64(feeRatePpm), 10),
+			baseFee,
+			resp.Status,
+		}},
+	})
+}
+
+// findChannel returns the open channel with the given channel point, short channel id or LND short channel id.
+func findChannel(channels []*torqrpc.Channel, id string) *torqrpc.Channel {
+	for _, ch := range channels {
+		if !ch.Open {
+			continue
+		}
+		if ch.ChannelPoint == id || ch.ShortChannelId == id || strconv.FormatUint(ch.LndShortChannelId, 10) == id {
+			return ch
+		}
+	}
+	return nil
+}
+
+func pay(c *cli.Context) error {
+	invoice := c.Args().First()
+	if invoice == "" {
+		return errors.New("Missing the invoice to pay")
+	}
+
+	ctx, cl, err := connect(c)
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+
+	nodeId, err := localNodeId(ctx, cl, c.Int("node"))
+	if err != nil {
+		return err
+	}
+
+	req := &torqrpc.SendPaymentRequest{
+		NodeId:      nodeId,
+		Invoice:     invoice,
+		TimeoutSecs: int32(c.Int("timeout")),
+	}
+	if c.IsSet("amt-msat") {
+		amtMsat := c.Int64("amt-msat")
+		req.AmtMsat = &amtMsat
+	}
+	if c.IsSet("fee-limit-msat") {
+		feeLimitMsat := c.Int64("fee-limit-msat")
+		req.FeeLimitMsat = &feeLimitMsat
+	}
+
+	stream, err := cl.SendPayment(ctx, req)
+	if err != nil {
+		return err
+	}
+	// Only the final status of the payment is printed.
+	var last *torqrpc.PaymentUpdate
+	for {
+		update, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		last = update
+	}
+	if last == nil {
+		return errors.New("No payment status received")
+	}
+
+	err = printResult(c, result{
+		message: last,
+		header:  []string{"Status", "Hash", "Preimage", "Amount msat", "Failure reason"},
+		rows: [][]string{{
+			last.Status,
+			last.Hash,
+			last.Preimage,
+			strconv.FormatInt(last.AmountMsat, 10),
+			last.FailureReason,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	if last.Status != "SUCCEEDED" {
+		return errors.Newf("Payment %s", last.Status)
+	}
+	return nil
+}
+
+func newInvoice(c *cli.Context) error {
+	ctx, cl, err := connect(c)
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+
+	nodeId, err := localNodeId(ctx, cl, c.Int("node"))
+	if err != nil {
+		return err
+	}
+
+	req := &torqrpc.NewInvoiceRequest{
+		NodeId:  nodeId,
+		Memo:    c.String("memo"),
+		Private: c.Bool("private"),
+	}
+	if c.IsSet("amt-msat") {
+		valueMsat := c.Int64("amt-msat")
+		req.ValueMsat = &valueMsat
+	}
+	if c.IsSet("expiry") {
+		expiry := c.Int64("expiry")
+		req.Expiry = &expiry
+	}
+
+	resp, err := cl.NewInvoice(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	return printResult(c, result{
+		message: resp,
+		header:  []string{"Payment request", "Add index", "Payment address"},
+		rows: [][]string{{
+			resp.PaymentRequest,
+			strconv.FormatUint(resp.AddIndex, 10),
+			resp.PaymentAddress,
+		}},
+	})
+}
+
+func listNodes(c *cli.Context) error {
+	ctx, cl, err := connect(c)
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+
+	resp, err := cl.ListNodes(ctx, &torqrpc.ListNodesRequest{})
+	if err != nil {
+		return err
+	}
+
+	r := result{
+		message: resp,
+		header:  []string{"Id", "Implementation", "gRPC address", "Public key", "Disabled"},
+	}
+	for _, n := range resp.Nodes {
+		r.rows = append(r.rows, []string{
+			strconv.Itoa(int(n.LocalNodeId)),
+			n.Implementation,
+			n.GrpcAddress,
+			n.PubKey,
+			strconv.FormatBool(n.Disabled),
+		})
+	}
+	return printResult(c, r)
+}
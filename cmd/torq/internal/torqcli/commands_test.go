@@ -0,0 +1,32 @@
+package torqcli
+
+import (
+	"testing"
+
+	"github.com/lncapital/torq/pkg/torqrpc"
+)
+
+func Test_findChannel(t *testing.T) {
+	channels := []*torqrpc.Channel{
+		{ChannelPoint: "aa:0", ShortChannelId: "700000x1x0", LndShortChannelId: 769658139222016000, Open: false},
+		{ChannelPoint: "bb:1", ShortChannelId: "700000x2x1", LndShortChannelId: 769658139222081537, Open: true},
+	}
+	tests := []struct {
+		name string
+		id   string
+		want *torqrpc.Channel
+	}{
+		{"Channel point", "bb:1", channels[1]},
+		{"Short channel id", "700000x2x1", channels[1]},
+		{"LND short channel id", "769658139222081537", channels[1]},
+		{"Closed channel", "aa:0", nil},
+		{"Unknown channel", "cc:0", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := findChannel(channels, test.id); got != test.want {
+				t.Errorf("findChannel() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
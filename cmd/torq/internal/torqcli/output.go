@@ -0,0 +1,75 @@
+package torqcli
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// The output formats of the client commands.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+var outputFlag = &cli.StringFlag{
+	Name:    "output",
+	Aliases: []string{"o"},
+	Value:   formatTable,
+	Usage:   "Output format: table, json or csv",
+}
+
+func checkOutputFormat(format string) error {
+	switch format {
+	case formatTable, formatJSON, formatCSV:
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q, use table, json or csv", format)
+	}
+}
+
+// result is the output of a command. JSON output prints the response message as is, the table and CSV output
+// print the rows.
+type result struct {
+	message proto.Message
+	header  []string
+	rows    [][]string
+}
+
+func printResult(c *cli.Context, r result) error {
+	return writeResult(c.App.Writer, c.String("output"), r)
+}
+
+func writeResult(w io.Writer, format string, r result) error {
+	switch format {
+	case formatJSON:
+		b, err := protojson.MarshalOptions{Multiline: true, Indent: "  ", EmitUnpopulated: true}.Marshal(r.message)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(r.header); err != nil {
+			return err
+		}
+		return cw.WriteAll(r.rows)
+	case formatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(r.header, "\t")))
+		for _, row := range r.rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	default:
+		return checkOutputFormat(format)
+	}
+}
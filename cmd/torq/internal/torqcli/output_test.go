@@ -0,0 +1,58 @@
+package torqcli
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/lncapital/torq/pkg/torqrpc"
+)
+
+func Test_writeResult(t *testing.T) {
+	r := result{
+		message: &torqrpc.LocalNode{LocalNodeId: 1, PubKey: "02ab"},
+		header:  []string{"id", "pub_key"},
+		rows:    [][]string{{"1", "02ab"}, {"22", "03cd,ef"}},
+	}
+	tests := []struct {
+		name    string
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{"Table", formatTable, "ID  PUB_KEY\n1   02ab\n22  03cd,ef\n", false},
+		{"CSV", formatCSV, "id,pub_key\n1,02ab\n22,\"03cd,ef\"\n", false},
+		{"Unknown format", "yaml", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var b bytes.Buffer
+			err := writeResult(&b, test.format, r)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("writeResult() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if b.String() != test.want {
+				t.Errorf("writeResult() =\n%q\nwant\n%q", b.String(), test.want)
+			}
+		})
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		var b bytes.Buffer
+		if err := writeResult(&b, formatJSON, r); err != nil {
+			t.Fatal(err)
+		}
+		// The JSON output is the message itself, including the fields that aren't set. protojson varies its
+		// whitespace, so the fields are compared instead of the bytes.
+		var got map[string]interface{}
+		if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+			t.Fatalf("writeResult() = %s, not JSON: %v", b.String(), err)
+		}
+		want := map[string]interface{}{"localNodeId": float64(1), "pubKey": "02ab", "disabled": false}
+		for k, v := range want {
+			if got[k] != v {
+				t.Errorf("writeResult() %s = %v, want %v", k, got[k], v)
+			}
+		}
+	})
+}
@@ -0,0 +1,248 @@
+package torqgrpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/lncapital/torq/internal/channels"
+	"github.com/lncapital/torq/internal/invoices"
+	"github.com/lncapital/torq/internal/payments"
+	"github.com/lncapital/torq/pkg/torqrpc"
+	"google.golang.org/grpc/status"
+)
+
+func (s *server) UpdateChannelPolicy(ctx context.Context,
+	req *torqrpc.UpdateChannelPolicyRequest) (*torqrpc.UpdateChannelPolicyResponse, error) {
+	resp, err := channels.UpdateChannels(s.db, channels.UpdateChanRequestBody{
+		NodeId:        int(req.NodeId),
+		ChannelPoint:  req.ChannelPoint,
+		FeeRatePpm:    req.FeeRatePpm,
+		BaseFeeMsat:   req.BaseFeeMsat,
+		MaxHtlcMsat:   req.MaxHtlcMsat,
+		MinHtlcMsat:   req.MinHtlcMsat,
+		TimeLockDelta: req.TimeLockDelta,
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	r := &torqrpc.UpdateChannelPolicyResponse{Status: resp.Status}
+	for _, f := range resp.FailedUpdates {
+		r.FailedUpdates = append(r.FailedUpdates, &torqrpc.FailedPolicyUpdate{
+			Txid:        f.OutPoint.Txid,
+			OutputIndex: f.OutPoint.OutIndx,
+			Reason:      f.Reason,
+			UpdateError: f.UpdateError,
+		})
+	}
+	return r, nil
+}
+
+func (s *server) NewInvoice(ctx context.Context, req *torqrpc.NewInvoiceRequest) (*torqrpc.NewInvoiceResponse,
+	error) {
+	invReq := invoices.NewInvoiceRequest{
+		NodeId:    int(req.NodeId),
+		Memo:      &req.Memo,
+		ValueMsat: req.ValueMsat,
+		Expiry:    req.Expiry,
+		Private:   &req.Private,
+		IsAmp:     &req.IsAmp,
+	}
+	if req.RPreimage != "" {
+		invReq.RPreImage = &req.RPreimage
+	}
+	if req.FallbackAddress != "" {
+		invReq.FallBackAddress = &req.FallbackAddress
+	}
+
+	resp, err := invoices.NewInvoice(s.db, invReq)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &torqrpc.NewInvoiceResponse{
+		PaymentRequest: resp.PaymentRequest,
+		AddIndex:       resp.AddIndex,
+		PaymentAddress: resp.PaymentAddress,
+	}, nil
+}
+
+func (s *server) SendPayment(req *torqrpc.SendPaymentRequest, stream torqrpc.Torq_SendPaymentServer) error {
+	npReq := payments.NewPaymentRequest{
+		NodeId:           int(req.NodeId),
+		Invoice:          &req.Invoice,
+		TimeOutSecs:      req.TimeoutSecs,
+		AmtMSat:          req.AmtMsat,
+		FeeLimitMsat:     req.FeeLimitMsat,
+		AllowSelfPayment: &req.AllowSelfPayment,
+	}
+	return runStreamed(stream.Context(),
+		func(ctx context.Context, wChan chan interface{}) error {
+			return payments.SendNewPayment(ctx, wChan, s.db, nil, npReq, "")
+		},
+		func(msg interface{}) error {
+			p, ok := msg.(payments.NewPaymentResponse)
+			if !ok {
+				return nil
+			}
+			return stream.Send(rpcPaymentUpdate(p))
+		})
+}
+
+func (s *server) OpenChannel(req *torqrpc.OpenChannelRequest, stream torqrpc.Torq_OpenChannelServer) error {
+	ocReq := channels.OpenChannelRequest{
+		NodeId:             int(req.NodeId),
+		SatPerVbyte:        req.SatPerVbyte,
+		NodePubKey:         req.NodePubKey,
+		LocalFundingAmount: req.LocalFundingAmount,
+		PushSat:            req.PushSat,
+		TargetConf:         req.TargetConf,
+		Private:            &req.Private,
+		MinHtlcMsat:        req.MinHtlcMsat,
+		RemoteCsvDelay:     req.RemoteCsvDelay,
+		MinConfs:           req.MinConfs,
+		SpendUnconfirmed:   &req.SpendUnconfirmed,
+	}
+	if req.CloseAddress != "" {
+		ocReq.CloseAddress = &req.CloseAddress
+	}
+	return runStreamed(stream.Context(),
+		func(ctx context.Context, wChan chan interface{}) error {
+			return channels.OpenChannel(ctx, s.db, wChan, ocReq, "")
+		},
+		func(msg interface{}) error {
+			oc, ok := msg.(*channels.OpenChannelResponse)
+			if !ok || oc == nil {
+				return nil
+			}
+			return stream.Send(&torqrpc.OpenChannelUpdate{
+				Status:              oc.Status,
+				ChannelPoint:        oc.ChannelPoint,
+				PendingChannelPoint: oc.PendingChannelPoint,
+			})
+		})
+}
+
+func (s *server) CloseChannel(req *torqrpc.CloseChannelRequest, stream torqrpc.Torq_CloseChannelServer) error {
+	ccReq := channels.CloseChannelRequest{
+		NodeId:       int(req.NodeId),
+		ChannelPoint: req.ChannelPoint,
+		Force:        &req.Force,
+		TargetConf:   req.TargetConf,
+		SatPerVbyte:  req.SatPerVbyte,
+	}
+	if req.DeliveryAddress != "" {
+		ccReq.DeliveryAddress = &req.DeliveryAddress
+	}
+	return runStreamed(stream.Context(),
+		func(ctx context.Context, wChan chan interface{}) error {
+			return channels.CloseChannel(ctx, wChan, s.db, nil, ccReq, "")
+		},
+		func(msg interface{}) error {
+			cc, ok := msg.(*channels.CloseChannelResponse)
+			if !ok || cc == nil {
+				return nil
+			}
+			return stream.Send(&torqrpc.CloseChannelUpdate{
+				Status:             cc.Status,
+				PendingTxid:        txidString(cc.ClosePending.TxId),
+				PendingOutputIndex: cc.ClosePending.OutputIndex,
+				ClosingTxid:        txidString(cc.ChanClose.ClosingTxId),
+				Success:            cc.ChanClose.Success,
+			})
+		})
+}
+
+// runStreamed runs an action that writes its status updates to a channel, the same actions the websocket
+// runs, and passes every update to send until the action returns. The action is canceled when the client
+// goes away or send fails.
+func runStreamed(ctx context.Context, action func(ctx context.Context, wChan chan interface{}) error,
+	send func(msg interface{}) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wChan := make(chan interface{})
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- action(ctx, wChan)
+		close(wChan)
+	}()
+
+	var sendErr error
+	for msg := range wChan {
+		if sendErr != nil {
+			// Keep reading until the action sees the canceled context and returns.
+			continue
+		}
+		if sendErr = send(msg); sendErr != nil {
+			cancel()
+		}
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+
+	err := <-errChan
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	return statusError(err)
+}
+
+func rpcPaymentUpdate(p payments.NewPaymentResponse) *torqrpc.PaymentUpdate {
+	a := p.Attempt
+	attempt := &torqrpc.PaymentAttempt{
+		AttemptId:          a.AttemptId,
+		Status:             a.Status,
+		TotalTimeLock:      a.Route.TotalTimeLock,
+		TotalAmtMsat:       a.Route.TotalAmtMsat,
+		AttemptTime:        timeValue(a.AttemptTimeNs),
+		ResolveTime:        timeValue(a.ResolveTimeNs),
+		Preimage:           a.Preimage,
+		FailureReason:      a.Failure.Reason,
+		FailureSourceIndex: a.Failure.FailureSourceIndex,
+		FailureHeight:      a.Failure.Height,
+	}
+	for _, h := range a.Route.Hops {
+		attempt.Hops = append(attempt.Hops, &torqrpc.PaymentHop{
+			ChanId:           h.ChanId,
+			Expiry:           h.Expiry,
+			AmtToForwardMsat: h.AmtToForwardMsat,
+			PubKey:           h.PubKey,
+		})
+	}
+
+	return &torqrpc.PaymentUpdate{
+		Status:         p.Status,
+		FailureReason:  p.FailureReason,
+		Hash:           p.Hash,
+		Preimage:       p.Preimage,
+		PaymentRequest: p.PaymentRequest,
+		AmountMsat:     p.AmountMsat,
+		FeeLimitMsat:   p.FeeLimitMsat,
+		CreationDate:   timeValue(p.CreationDate),
+		Attempt:        attempt,
+	}
+}
+
+// txidString formats a txid the way block explorers show it, LND returns the bytes in reverse order.
+func txidString(txid []byte) string {
+	if len(txid) == 0 {
+		return ""
+	}
+	h, err := chainhash.NewHash(txid)
+	if err != nil {
+		return ""
+	}
+	return h.String()
+}
+
+func timeValue(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,52 @@
+package torqgrpc
+
+import (
+	"encoding/json"
+
+	"github.com/cockroachdb/errors"
+	"github.com/lncapital/torq/internal/pubsub"
+	"github.com/lncapital/torq/pkg/torqrpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Number of events queued for the stream before events are dropped for a slow client, the same as for
+// websocket subscriptions.
+const subscriptionBuffer = 100
+
+func (s *server) SubscribeEvents(req *torqrpc.SubscribeEventsRequest, stream torqrpc.Torq_SubscribeEventsServer) error {
+	if !pubsub.IsValidTopic(req.Topic) {
+		return status.Errorf(codes.InvalidArgument, "Unknown subscription topic: %s", req.Topic)
+	}
+
+	sub := pubsub.DefaultBus.Subscribe(pubsub.Filter{
+		Topic:       req.Topic,
+		LocalNodeId: int(req.LocalNodeId),
+		ChannelId:   req.ChannelId,
+	}, subscriptionBuffer)
+	defer pubsub.DefaultBus.Unsubscribe(sub)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e, ok := <-sub.Events:
+			if !ok {
+				return nil
+			}
+			data, err := json.Marshal(e.Data)
+			if err != nil {
+				return statusError(errors.Wrapf(err, "Marshalling %s event", e.Topic))
+			}
+			err = stream.Send(&torqrpc.Event{
+				Topic:       e.Topic,
+				LocalNodeId: int32(e.LocalNodeId),
+				ChannelIds:  e.ChannelIds,
+				Data:        data,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package torqgrpc
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/lncapital/torq/internal/channel_history"
+	"github.com/lncapital/torq/internal/forwards"
+	"github.com/lncapital/torq/internal/invoices"
+	"github.com/lncapital/torq/internal/on_chain_tx"
+	"github.com/lncapital/torq/internal/payments"
+	qp "github.com/lncapital/torq/internal/query_parser"
+	"github.com/lncapital/torq/internal/settings"
+	"github.com/lncapital/torq/internal/tags"
+	"github.com/lncapital/torq/pkg/torqrpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *server) ListNodes(ctx context.Context, req *torqrpc.ListNodesRequest) (*torqrpc.ListNodesResponse, error) {
+	nodes, err := settings.GetLocalNodes(s.db)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	r := &torqrpc.ListNodesResponse{}
+	for _, n := range nodes {
+		r.Nodes = append(r.Nodes, &torqrpc.LocalNode{
+			LocalNodeId:    int32(n.LocalNodeId),
+			Implementation: n.Implementation,
+			GrpcAddress:    stringValue(n.GRPCAddress),
+			PubKey:         stringValue(n.PubKey),
+			Disabled:       n.Disabled,
+		})
+	}
+	return r, nil
+}
+
+func (s *server) ListChannels(ctx context.Context, req *torqrpc.ListChannelsRequest) (*torqrpc.ListChannelsResponse,
+	error) {
+	// "1" selects all channels
+	chans, err := channel_history.GetChannels(s.db, []string{"1"})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &torqrpc.ListChannelsResponse{Channels: rpcChannels(chans)}, nil
+}
+
+func (s *server) ListForwards(ctx context.Context, req *torqrpc.ListForwardsRequest) (*torqrpc.ListForwardsResponse,
+	error) {
+	from, err := parseDate("from", req.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseDate("to", req.To)
+	if err != nil {
+		return nil, err
+	}
+	filters, err := parseFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := forwards.QueryForwards(s.db, from, to, filters, parseOrder(req.Order))
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	r := &torqrpc.ListForwardsResponse{}
+	for _, f := range rows {
+		r.Channels = append(r.Channels, &torqrpc.ChannelForwards{
+			Alias:             f.Alias.String,
+			ChannelDbId:       f.ChannelDBID.Int64,
+			ChannelPoint:      f.LNDChannelPoint.String,
+			PubKey:            f.PubKey.String,
+			ShortChannelId:    f.ShortChannelID.String,
+			LndShortChannelId: f.LNDShortChannelId.String,
+			Color:             f.Color.String,
+			Open:              f.Open.Int64 == 1,
+			Capacity:          f.Capacity,
+			AmountOut:         f.AmountOut,
+			AmountIn:          f.AmountIn,
+			AmountTotal:       f.AmountTotal,
+			RevenueOut:        f.RevenueOut,
+			RevenueIn:         f.RevenueIn,
+			RevenueTotal:      f.RevenueTotal,
+			CountOut:          f.CountOut,
+			CountIn:           f.CountIn,
+			CountTotal:        f.CountTotal,
+			TurnoverOut:       f.TurnoverOut,
+			TurnoverIn:        f.TurnoverIn,
+			TurnoverTotal:     f.TurnoverTotal,
+			Tags:              f.Tags,
+		})
+	}
+	return r, nil
+}
+
+func (s *server) ListPayments(ctx context.Context, req *torqrpc.ListPaymentsRequest) (*torqrpc.ListPaymentsResponse,
+	error) {
+	filters, err := parseFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, total, err := payments.QueryPayments(s.db, filters, parseOrder(req.Order), req.Limit, req.Offset)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	r := &torqrpc.ListPaymentsResponse{Total: total}
+	for _, p := range rows {
+		var secondsInFlight float32
+		if p.SecondsInFlight != nil {
+			secondsInFlight = *p.SecondsInFlight
+		}
+		r.Payments = append(r.Payments, &torqrpc.Payment{
+			PaymentIndex:            p.PaymentIndex,
+			Date:                    p.Date.Unix(),
+			DestinationPubKey:       stringValue(p.DestinationPubKey),
+			Status:                  p.Status,
+			Value:                   p.Value,
+			Fee:                     p.Fee,
+			Ppm:                     p.PPM,
+			FailureReason:           p.FailureReason,
+			PaymentHash:             p.PaymentHash,
+			PaymentPreimage:         p.PaymentPreimage,
+			PaymentRequest:          stringValue(p.PaymentRequest),
+			IsRebalance:             boolValue(p.IsRebalance),
+			IsMpp:                   p.IsMPP,
+			CountSuccessfulAttempts: int32(p.CountSuccessfulAttempts),
+			CountFailedAttempts:     int32(p.CountFailedAttempts),
+			SecondsInFlight:         secondsInFlight,
+			Tags:                    p.Tags,
+		})
+	}
+	return r, nil
+}
+
+func (s *server) ListInvoices(ctx context.Context, req *torqrpc.ListInvoicesRequest) (*torqrpc.ListInvoicesResponse,
+	error) {
+	filters, err := parseFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, total, err := invoices.QueryInvoices(s.db, filters, parseOrder(req.Order), req.Limit, req.Offset)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	r := &torqrpc.ListInvoicesResponse{Total: total}
+	for _, i := range rows {
+		r.Invoices = append(r.Invoices, &torqrpc.Invoice{
+			CreationDate:      unixValue(i.CreationDate),
+			SettleDate:        unixValue(i.SettleDate),
+			AddIndex:          i.AddIndex,
+			SettleIndex:       uint64Value(i.SettleIndex),
+			PaymentRequest:    stringValue(i.PaymentRequest),
+			DestinationPubKey: stringValue(i.DestinationPubKey),
+			RHash:             stringValue(i.RHash),
+			RPreimage:         stringValue(i.RPreimage),
+			Memo:              stringValue(i.Memo),
+			Value:             float64Value(i.Value),
+			AmtPaid:           float64Value(i.AmountPaid),
+			InvoiceState:      stringValue(i.InvoiceState),
+			IsRebalance:       boolValue(i.IsRebalance),
+			IsKeysend:         boolValue(i.IsKeysend),
+			IsAmp:             boolValue(i.IsAmp),
+			PaymentAddr:       stringValue(i.PaymentAddr),
+			FallbackAddr:      stringValue(i.FallbackAddr),
+			UpdatedOn:         unixValue(i.UpdatedOn),
+			Expiry:            uint32Value(i.Expiry),
+			CltvExpiry:        uint32Value(i.CltvExpiry),
+			Private:           boolValue(i.Private),
+			Tags:              i.Tags,
+		})
+	}
+	return r, nil
+}
+
+func (s *server) ListOnChainTransactions(ctx context.Context,
+	req *torqrpc.ListOnChainTransactionsRequest) (*torqrpc.ListOnChainTransactionsResponse, error) {
+	filters, err := parseFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, total, err := on_chain_tx.QueryOnChainTxs(s.db, filters, parseOrder(req.Order), req.Limit, req.Offset)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	r := &torqrpc.ListOnChainTransactionsResponse{Total: total}
+	for _, t := range rows {
+		r.Transactions = append(r.Transactions, &torqrpc.OnChainTransaction{
+			Date:           t.Date.Unix(),
+			TxHash:         t.TxHash,
+			DestAddresses:  t.DestAddresses,
+			Amount:         t.AmountMsat,
+			TotalFees:      t.TotalFeesMsat,
+			Label:          stringValue(t.Label),
+			LndTxTypeLabel: stringValue(t.LndTxTypeLabel),
+			LndShortChanId: stringValue(t.LndShortChannelId),
+			Tags:           t.Tags,
+		})
+	}
+	return r, nil
+}
+
+func (s *server) GetChannelHistory(ctx context.Context,
+	req *torqrpc.ChannelHistoryRequest) (*torqrpc.ChannelHistoryResponse, error) {
+	from, err := parseDate("from", req.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseDate("to", req.To)
+	if err != nil {
+		return nil, err
+	}
+
+	chanIds := req.ChanIds
+	// When a tag is given the history is for all channels the tag applies to.
+	if req.Tag != "" {
+		chanIds, err = tags.GetTagChannelIds(s.db, req.Tag)
+		switch err.(type) {
+		case nil:
+			break
+		case tags.ErrTagNotFound:
+			return nil, status.Error(codes.NotFound, err.Error())
+		default:
+			return nil, statusError(err)
+		}
+		if len(chanIds) == 0 {
+			return nil, status.Errorf(codes.NotFound, "No channels found for tag %s", req.Tag)
+		}
+	}
+	if len(chanIds) == 0 {
+		// "1" selects all channels
+		chanIds = []string{"1"}
+	}
+
+	h, err := channel_history.QueryChannelHistory(s.db, chanIds, from, to)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	if req.Tag != "" {
+		h.Label = req.Tag
+	}
+
+	r := &torqrpc.ChannelHistoryResponse{
+		Label:           h.Label,
+		OnChainCost:     uint64Value(h.OnChainCost),
+		RebalancingCost: uint64Value(h.RebalancingCost),
+		AmountOut:       uint64Value(h.AmountOut),
+		AmountIn:        uint64Value(h.AmountIn),
+		AmountTotal:     uint64Value(h.AmountTotal),
+		RevenueOut:      uint64Value(h.RevenueOut),
+		RevenueIn:       uint64Value(h.RevenueIn),
+		RevenueTotal:    uint64Value(h.RevenueTotal),
+		CountOut:        uint64Value(h.CountOut),
+		CountIn:         uint64Value(h.CountIn),
+		CountTotal:      uint64Value(h.CountTotal),
+		Channels:        rpcChannels(h.Channels),
+	}
+	for _, d := range h.History {
+		r.History = append(r.History, &torqrpc.ChannelHistoryRecord{
+			Date:         d.Date.Unix(),
+			AmountOut:    uint64Value(d.AmountOut),
+			AmountIn:     uint64Value(d.AmountIn),
+			AmountTotal:  uint64Value(d.AmountTotal),
+			RevenueOut:   uint64Value(d.RevenueOut),
+			RevenueIn:    uint64Value(d.RevenueIn),
+			RevenueTotal: uint64Value(d.RevenueTotal),
+			CountOut:     uint64Value(d.CountOut),
+			CountIn:      uint64Value(d.CountIn),
+			CountTotal:   uint64Value(d.CountTotal),
+		})
+	}
+	for _, e := range h.Events {
+		r.Events = append(r.Events, &torqrpc.ChannelEvent{
+			Datetime:         e.Datetime.Unix(),
+			ChannelPoint:     stringValue(e.LNDChannelPoint),
+			ShortChannelId:   stringValue(e.ShortChannelId),
+			Type:             stringValue(e.Type),
+			Outbound:         boolValue(e.Outbound),
+			AnnouncingPubKey: stringValue(e.AnnouncingPubKey),
+			Value:            uint64Value(e.Value),
+			PreviousValue:    uint64Value(e.PreviousValue),
+		})
+	}
+	return r, nil
+}
+
+func rpcChannels(chans []*channel_history.Channel) (r []*torqrpc.Channel) {
+	for _, c := range chans {
+		lndShortChannelId, _ := strconv.ParseUint(c.LNDShortChannelId.String, 10, 64)
+		r = append(r, &torqrpc.Channel{
+			Alias:             c.Alias.String,
+			ChannelDbId:       c.ChannelDBID.Int64,
+			ChannelPoint:      c.LNDChannelPoint.String,
+			PubKey:            c.PubKey.String,
+			ShortChannelId:    c.ShortChannelID.String,
+			LndShortChannelId: lndShortChannelId,
+			Open:              c.Open.Bool,
+			Capacity:          uint64Value(c.Capacity),
+			LocalNodeId:       int32(c.LocalNodeId.Int64),
+		})
+	}
+	return r
+}
+
+// parseFilter decodes the JSON encoded filter clauses of a request, an empty filter matches everything.
+func parseFilter(filter string) (*qp.FilterClauses, error) {
+	if filter == "" {
+		return nil, nil
+	}
+	f := &qp.FilterClauses{}
+	if err := json.Unmarshal([]byte(filter), f); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid filter: %v", err)
+	}
+	return f, nil
+}
+
+func parseOrder(order []*torqrpc.Order) (r []qp.Order) {
+	for _, o := range order {
+		r = append(r, qp.Order{Key: o.Key, Direction: o.Direction})
+	}
+	return r
+}
+
+func parseDate(name string, value string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return t, status.Errorf(codes.InvalidArgument, "invalid %s date %q, expected YYYY-MM-DD", name, value)
+	}
+	return t, nil
+}
+
+func stringValue(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
+
+func boolValue(v *bool) bool {
+	return v != nil && *v
+}
+
+func uint64Value(v *uint64) uint64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+func uint32Value(v *uint32) uint32 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+func float64Value(v *float64) float64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+func unixValue(v *time.Time) int64 {
+	if v == nil {
+		return 0
+	}
+	return v.Unix()
+}
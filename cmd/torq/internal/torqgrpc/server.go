@@ -0,0 +1,177 @@
+package torqgrpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lncapital/torq/internal/auth"
+	qp "github.com/lncapital/torq/internal/query_parser"
+	"github.com/lncapital/torq/internal/settings"
+	"github.com/lncapital/torq/pkg/torqrpc"
+	"github.com/rs/zerolog/log"
+	"github.com/ulule/limiter/v3"
+	"github.com/ulule/limiter/v3/drivers/store/memory"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// loginMethod is the only method that can be called without a session token.
+const loginMethod = "/torqrpc.Torq/Login"
+
+// readOnlyMethods are the methods that are still served in read-only mode.
+var readOnlyMethods = map[string]bool{
+	loginMethod:                             true,
+	"/torqrpc.Torq/ListNodes":               true,
+	"/torqrpc.Torq/ListChannels":            true,
+	"/torqrpc.Torq/ListForwards":            true,
+	"/torqrpc.Torq/ListPayments":            true,
+	"/torqrpc.Torq/ListInvoices":            true,
+	"/torqrpc.Torq/ListOnChainTransactions": true,
+	"/torqrpc.Torq/GetChannelHistory":       true,
+	"/torqrpc.Torq/SubscribeEvents":         true,
+}
+
+type server struct {
+	torqrpc.UnimplementedTorqServer
+	db      *sqlx.DB
+	apiPswd string
+	// loginLimiter limits login attempts to 10 per minute, the same as the HTTP API.
+	loginLimiter *limiter.Limiter
+}
+
+func newServer(apiPswd string, db *sqlx.DB) *server {
+	rate, err := limiter.NewRateFromFormatted("10-M")
+	if err != nil {
+		log.Fatal().Err(err).Send()
+	}
+	return &server{
+		db:           db,
+		apiPswd:      apiPswd,
+		loginLimiter: limiter.New(memory.NewStore(), rate),
+	}
+}
+
+// Start serves the Torq gRPC API on the given port.
+func Start(port int, apiPswd string, db *sqlx.DB) {
+	lis, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		log.Error().Err(err).Msgf("Listening on gRPC port %d", port)
+		return
+	}
+
+	s := newServer(apiPswd, db)
+	gs := grpc.NewServer(
+		grpc.UnaryInterceptor(s.unaryAuthInterceptor),
+		grpc.StreamInterceptor(s.streamAuthInterceptor),
+	)
+	torqrpc.RegisterTorqServer(gs, s)
+
+	fmt.Println("Serving gRPC on port " + strconv.Itoa(port))
+
+	err = gs.Serve(lis)
+	if err != nil {
+		log.Error().Err(err).Msg("gRPC server stopped")
+	}
+}
+
+func (s *server) unaryAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	if info.FullMethod != loginMethod {
+		if err := s.authorize(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkReadOnly(info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *server) streamAuthInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	if err := s.authorize(ss.Context()); err != nil {
+		return err
+	}
+	if err := checkReadOnly(info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// checkReadOnly refuses the methods that change the state of Torq or the nodes in read-only mode.
+func checkReadOnly(method string) error {
+	if settings.IsReadOnly() && !readOnlyMethods[method] {
+		return status.Error(codes.PermissionDenied, "Torq is running in read-only mode")
+	}
+	return nil
+}
+
+// authorize checks the session token in the authorization metadata ("Bearer <token>"), falling back to the
+// session cookie of the HTTP API.
+func (s *server) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var token string
+	for _, v := range md.Get("authorization") {
+		if strings.HasPrefix(v, "Bearer ") {
+			token = strings.TrimPrefix(v, "Bearer ")
+			break
+		}
+	}
+	if token == "" {
+		token = auth.SessionTokenFromCookies(md.Get("cookie"))
+	}
+	if token == "" {
+		return status.Error(codes.Unauthenticated, "missing session token")
+	}
+
+	if err := auth.ValidateSessionToken(s.apiPswd, token); err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	return nil
+}
+
+func (s *server) Login(ctx context.Context, req *torqrpc.LoginRequest) (*torqrpc.LoginResponse, error) {
+	limit, err := s.loginLimiter.Get(ctx, "login_limiter")
+	if err != nil {
+		return nil, statusError(err)
+	}
+	if limit.Reached {
+		return nil, status.Error(codes.ResourceExhausted, "too many login attempts")
+	}
+
+	if strings.TrimSpace(req.Password) == "" {
+		return nil, status.Error(codes.InvalidArgument, "password can't be empty")
+	}
+	if req.Password != s.apiPswd {
+		return nil, status.Error(codes.Unauthenticated, "authentication failed")
+	}
+
+	// The HTTP API only has the admin user as well.
+	token, err := auth.NewSessionToken(s.apiPswd, "admin")
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &torqrpc.LoginResponse{Token: token}, nil
+}
+
+// statusError converts invalid filters and sorting to InvalidArgument errors. Other errors are logged and
+// returned as Internal errors.
+func statusError(err error) error {
+	switch err.(type) {
+	case qp.ErrInvalidFilter, qp.ErrInvalidOrder:
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.As(err, &settings.ErrActionNotPermitted{}) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	log.Error().Err(err).Send()
+	return status.Error(codes.Internal, err.Error())
+}
@@ -0,0 +1,66 @@
+package torqgrpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lncapital/torq/internal/settings"
+	"github.com/lncapital/torq/pkg/torqrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_checkReadOnly(t *testing.T) {
+	refused := map[string]bool{
+		"/torqrpc.Torq/UpdateChannelPolicy": true,
+		"/torqrpc.Torq/SendPayment":         true,
+		"/torqrpc.Torq/NewInvoice":          true,
+		"/torqrpc.Torq/OpenChannel":         true,
+		"/torqrpc.Torq/CloseChannel":        true,
+	}
+
+	// All the methods of the service, so a new method that isn't added to readOnlyMethods is refused.
+	var methods []string
+	for _, m := range torqrpc.Torq_ServiceDesc.Methods {
+		methods = append(methods, "/"+torqrpc.Torq_ServiceDesc.ServiceName+"/"+m.MethodName)
+	}
+	for _, s := range torqrpc.Torq_ServiceDesc.Streams {
+		methods = append(methods, "/"+torqrpc.Torq_ServiceDesc.ServiceName+"/"+s.StreamName)
+	}
+
+	for _, method := range methods {
+		if err := checkReadOnly(method); err != nil {
+			t.Errorf("checkReadOnly(%s) error = %v when not read-only", method, err)
+		}
+	}
+
+	settings.SetReadOnly(true)
+	t.Cleanup(func() { settings.SetReadOnly(false) })
+	for _, method := range methods {
+		err := checkReadOnly(method)
+		if refused[method] && status.Code(err) != codes.PermissionDenied {
+			t.Errorf("checkReadOnly(%s) error = %v, want PermissionDenied", method, err)
+		}
+		if !refused[method] && err != nil {
+			t.Errorf("checkReadOnly(%s) error = %v, want nil", method, err)
+		}
+	}
+}
+
+func Test_unaryAuthInterceptorReadOnly(t *testing.T) {
+	settings.SetReadOnly(true)
+	t.Cleanup(func() { settings.SetReadOnly(false) })
+
+	s := &server{}
+	handled := false
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		handled = true
+		return nil, nil
+	}
+	_, err := s.unaryAuthInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: loginMethod},
+		handler)
+	if err != nil || !handled {
+		t.Errorf("unaryAuthInterceptor(Login) error = %v, handled %v", err, handled)
+	}
+}
@@ -13,26 +13,45 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/jmoiron/sqlx"
 	"github.com/lncapital/torq/internal/auth"
+	"github.com/lncapital/torq/internal/channel_backups"
 	"github.com/lncapital/torq/internal/channel_history"
 	"github.com/lncapital/torq/internal/channels"
 	"github.com/lncapital/torq/internal/flow"
 	"github.com/lncapital/torq/internal/forwards"
 	"github.com/lncapital/torq/internal/invoices"
 	"github.com/lncapital/torq/internal/messages"
+	"github.com/lncapital/torq/internal/metrics"
 	"github.com/lncapital/torq/internal/on_chain_tx"
 	"github.com/lncapital/torq/internal/payments"
+	"github.com/lncapital/torq/internal/payouts"
+	"github.com/lncapital/torq/internal/retention"
 	"github.com/lncapital/torq/internal/settings"
+	"github.com/lncapital/torq/internal/tags"
 	"github.com/lncapital/torq/internal/views"
+	"github.com/lncapital/torq/pkg/server_errors"
 	"github.com/ulule/limiter/v3"
 	mgin "github.com/ulule/limiter/v3/drivers/middleware/gin"
 	"github.com/ulule/limiter/v3/drivers/store/memory"
 )
 
-func Start(port int, apiPswd string, db *sqlx.DB, restartLNDSub func() error) {
+func Start(port int, apiPswd string, metricsPort int, metricsUser string, metricsPswd string, db *sqlx.DB,
+	restartLNDSub func() error) {
 	r := gin.Default()
 
 	auth.CreateSession(r, apiPswd)
 
+	// Prometheus uses basic auth, fall back to the Torq password when no metrics password is set.
+	if metricsPswd == "" {
+		metricsPswd = apiPswd
+	}
+	metrics.RegisterNodeCollector(db)
+	r.Use(metrics.Middleware())
+	if metricsPort == 0 || metricsPort == port {
+		r.GET("/metrics", metrics.Handler(metricsUser, metricsPswd))
+	} else {
+		go startMetricsServer(metricsPort, metricsUser, metricsPswd)
+	}
+
 	registerRoutes(r, db, apiPswd, restartLNDSub)
 
 	fmt.Println("Listening on port " + strconv.Itoa(port))
@@ -40,6 +59,21 @@ func Start(port int, apiPswd string, db *sqlx.DB, restartLNDSub func() error) {
 	r.Run(":" + strconv.Itoa(port))
 }
 
+// startMetricsServer serves /metrics on a separate port, so it can be exposed to Prometheus without
+// exposing the API.
+func startMetricsServer(port int, user string, pswd string) {
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.GET("/metrics", metrics.Handler(user, pswd))
+
+	fmt.Println("Serving metrics on port " + strconv.Itoa(port))
+
+	err := r.Run(":" + strconv.Itoa(port))
+	if err != nil {
+		log.Error().Err(err).Msg("Metrics server stopped")
+	}
+}
+
 func applyCors(r *gin.Engine) {
 	corsConfig := cors.DefaultConfig()
 	//hot reload CORS
@@ -65,6 +99,39 @@ func NewLoginRateLimitMiddleware() gin.HandlerFunc {
 	return mgin.NewMiddleware(limiter.New(store, rate), mgin.WithKeyGetter(loginKeyGetter))
 }
 
+// readOnlyAllowedRoutes don't change any state although they aren't GET requests.
+var readOnlyAllowedRoutes = map[string]bool{
+	"/api/settings/retention/preview":              true,
+	"/api/on-chain-tx/sendmany/preview":            true,
+	"/api/payments/estimate":                       true,
+	"/api/channel-backups/:channelBackupId/verify": true,
+}
+
+// readOnlyRefusedRoutes are GET requests that are refused in read-only mode, signing a message uses the key of
+// the node.
+var readOnlyRefusedRoutes = map[string]bool{
+	"/api/messages/sign": true,
+}
+
+// readOnlyRequired refuses the requests that change the state of Torq or the nodes.
+func readOnlyRequired(c *gin.Context) {
+	route := c.FullPath()
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		if !readOnlyRefusedRoutes[route] {
+			c.Next()
+			return
+		}
+	default:
+		if readOnlyAllowedRoutes[route] {
+			c.Next()
+			return
+		}
+	}
+	server_errors.SendForbidden(c, "Torq is running in read-only mode")
+	c.Abort()
+}
+
 var wsUpgrade = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -101,6 +168,9 @@ func registerRoutes(r *gin.Engine, db *sqlx.DB, apiPwd string, restartLNDSub fun
 	}
 
 	api.Use(auth.AuthRequired)
+	if settings.IsReadOnly() {
+		api.Use(readOnlyRequired)
+	}
 	{
 
 		tableViewRoutes := api.Group("/table-views")
@@ -108,16 +178,21 @@ func registerRoutes(r *gin.Engine, db *sqlx.DB, apiPwd string, restartLNDSub fun
 			views.RegisterTableViewRoutes(tableViewRoutes, db)
 		}
 
-		//channelTagRoutes := api.Group("/tags")
-		//{
-		//	tags.RegisterTagRoutes(channelTagRoutes, db)
-		//}
+		tagRoutes := api.Group("/tags")
+		{
+			tags.RegisterTagRoutes(tagRoutes, db)
+		}
 
 		paymentRoutes := api.Group("/payments")
 		{
 			payments.RegisterPaymentsRoutes(paymentRoutes, db)
 		}
 
+		payoutRoutes := api.Group("/payouts")
+		{
+			payouts.RegisterPayoutRoutes(payoutRoutes, db)
+		}
+
 		invoiceRoutes := api.Group("/invoices")
 		{
 			invoices.RegisterInvoicesRoutes(invoiceRoutes, db)
@@ -128,6 +203,11 @@ func registerRoutes(r *gin.Engine, db *sqlx.DB, apiPwd string, restartLNDSub fun
 			on_chain_tx.RegisterOnChainTxsRoutes(onChainTx, db)
 		}
 
+		channelBackupRoutes := api.Group("/channel-backups")
+		{
+			channel_backups.RegisterChannelBackupRoutes(channelBackupRoutes, db)
+		}
+
 		channelRoutes := api.Group("/channels")
 		{
 			channel_history.RegisterChannelHistoryRoutes(channelRoutes, db)
@@ -152,6 +232,7 @@ func registerRoutes(r *gin.Engine, db *sqlx.DB, apiPwd string, restartLNDSub fun
 		settingRoutes := api.Group("settings")
 		{
 			settings.RegisterSettingRoutes(settingRoutes, db, restartLNDSub)
+			retention.RegisterRetentionRoutes(settingRoutes, db)
 		}
 
 		api.GET("/ping", func(c *gin.Context) {
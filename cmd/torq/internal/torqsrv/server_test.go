@@ -0,0 +1,102 @@
+package torqsrv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lncapital/torq/internal/payments"
+	"github.com/lncapital/torq/internal/settings"
+)
+
+func setReadOnly(t *testing.T) {
+	settings.SetReadOnly(true)
+	t.Cleanup(func() { settings.SetReadOnly(false) })
+}
+
+func Test_readOnlyRequired(t *testing.T) {
+	setReadOnly(t)
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		method string
+		route  string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/api/forwards", "/api/forwards", http.StatusOK},
+		{http.MethodGet, "/api/table-views", "/api/table-views", http.StatusOK},
+		{http.MethodPost, "/api/payments/estimate", "/api/payments/estimate", http.StatusOK},
+		{http.MethodPost, "/api/on-chain-tx/sendmany/preview", "/api/on-chain-tx/sendmany/preview", http.StatusOK},
+		{http.MethodPost, "/api/channel-backups/:channelBackupId/verify", "/api/channel-backups/1/verify",
+			http.StatusOK},
+		{http.MethodGet, "/api/messages/sign", "/api/messages/sign", http.StatusForbidden},
+		{http.MethodPost, "/api/table-views", "/api/table-views", http.StatusForbidden},
+		{http.MethodPut, "/api/table-views", "/api/table-views", http.StatusForbidden},
+		{http.MethodPatch, "/api/table-views/order", "/api/table-views/order", http.StatusForbidden},
+		{http.MethodDelete, "/api/table-views/:viewId", "/api/table-views/1", http.StatusForbidden},
+		{http.MethodPost, "/api/channels/update", "/api/channels/update", http.StatusForbidden},
+		{http.MethodPost, "/api/on-chain-tx/sendmany", "/api/on-chain-tx/sendmany", http.StatusForbidden},
+		{http.MethodPost, "/api/payouts/:payoutJobId/confirm", "/api/payouts/1/confirm", http.StatusForbidden},
+		{http.MethodPut, "/api/settings/retention", "/api/settings/retention", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			r := gin.New()
+			r.Use(readOnlyRequired)
+			r.Handle(test.method, test.route, func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+			if w.Code != test.want {
+				t.Errorf("%s %s = %d, want %d", test.method, test.path, w.Code, test.want)
+			}
+		})
+	}
+}
+
+func Test_processWsReqReadOnly(t *testing.T) {
+	setReadOnly(t)
+
+	tests := []struct {
+		req         wsRequest
+		wantRefused bool
+	}{
+		{wsRequest{Type: "newPayment", NewPaymentRequest: &payments.NewPaymentRequest{}}, true},
+		{wsRequest{Type: "lnurlPay", LnurlPayRequest: &payments.LnurlPayRequest{}}, true},
+		{wsRequest{Type: "newAddress"}, true},
+		{wsRequest{Type: "sendMany"}, true},
+		{wsRequest{Type: "openChannel"}, true},
+		{wsRequest{Type: "closeChannel"}, true},
+		{wsRequest{Type: "subscribe"}, false},
+		{wsRequest{Type: "unsubscribe"}, false},
+		{wsRequest{Type: "cancel"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.req.Type, func(t *testing.T) {
+			wsc := newWsConnection(context.Background())
+			test.req.ReqId = "1"
+			go wsc.processWsReq(nil, nil, test.req)
+
+			// The requests that are still accepted fail for another reason, their subscription or request is missing.
+			msg := <-wsc.wChan
+			wsErr, ok := msg.(wsError)
+			if !ok {
+				t.Fatalf("processWsReq() sent %#v, want an error", msg)
+			}
+			refused := strings.Contains(wsErr.Error, "read-only")
+			if refused != test.wantRefused {
+				t.Errorf("processWsReq() error = %q, want refused %v", wsErr.Error, test.wantRefused)
+			}
+		})
+	}
+
+	wsc := newWsConnection(context.Background())
+	go wsc.processWsReq(nil, nil, wsRequest{Type: "ping"})
+	if _, ok := (<-wsc.wChan).(Pong); !ok {
+		t.Errorf("processWsReq() didn't answer a ping in read-only mode")
+	}
+}
@@ -0,0 +1,103 @@
+package torqsrv
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/lncapital/torq/internal/pubsub"
+)
+
+// Number of events queued per subscription before events are dropped for a slow client.
+const subscriptionBuffer = 100
+
+type wsSubscribed struct {
+	ReqId  string        `json:"reqId"`
+	Type   string        `json:"type"`
+	Topic  string        `json:"topic"`
+	Filter pubsub.Filter `json:"filter"`
+}
+
+type wsUnsubscribed struct {
+	ReqId string `json:"reqId"`
+	Type  string `json:"type"`
+}
+
+type wsEvent struct {
+	ReqId       string      `json:"reqId"`
+	Type        string      `json:"type"`
+	Topic       string      `json:"topic"`
+	LocalNodeId int         `json:"localNodeId"`
+	Data        interface{} `json:"data"`
+}
+
+// wsSubscriptions holds the event subscriptions of one websocket connection keyed by the reqId of the
+// subscribe request.
+type wsSubscriptions struct {
+	mu   sync.Mutex
+	subs map[string]*pubsub.Subscription
+	// wg tracks the goroutines forwarding events to the connection.
+	wg *sync.WaitGroup
+}
+
+func newWsSubscriptions(wg *sync.WaitGroup) *wsSubscriptions {
+	return &wsSubscriptions{subs: make(map[string]*pubsub.Subscription), wg: wg}
+}
+
+// subscribe adds a subscription on the default bus and forwards its events to the client until the
+// subscription is removed.
+func (ws *wsSubscriptions) subscribe(wChan chan interface{}, reqId string, filter pubsub.Filter) error {
+	if !pubsub.IsValidTopic(filter.Topic) {
+		return fmt.Errorf("Unknown subscription topic: %s", filter.Topic)
+	}
+
+	ws.mu.Lock()
+	if _, exists := ws.subs[reqId]; exists {
+		ws.mu.Unlock()
+		return fmt.Errorf("Subscription with reqId %s already exists", reqId)
+	}
+	sub := pubsub.DefaultBus.Subscribe(filter, subscriptionBuffer)
+	ws.subs[reqId] = sub
+	ws.mu.Unlock()
+
+	wChan <- wsSubscribed{ReqId: reqId, Type: "subscribed", Topic: filter.Topic, Filter: filter}
+
+	ws.wg.Add(1)
+	go func() {
+		defer ws.wg.Done()
+		for e := range sub.Events {
+			wChan <- wsEvent{
+				ReqId:       reqId,
+				Type:        "event",
+				Topic:       e.Topic,
+				LocalNodeId: e.LocalNodeId,
+				Data:        e.Data,
+			}
+		}
+	}()
+	return nil
+}
+
+// unsubscribe removes the subscription that was created by the subscribe request with the given reqId.
+func (ws *wsSubscriptions) unsubscribe(wChan chan interface{}, reqId string) error {
+	ws.mu.Lock()
+	sub, exists := ws.subs[reqId]
+	delete(ws.subs, reqId)
+	ws.mu.Unlock()
+	if !exists {
+		return fmt.Errorf("No subscription found for reqId: %s", reqId)
+	}
+
+	pubsub.DefaultBus.Unsubscribe(sub)
+	wChan <- wsUnsubscribed{ReqId: reqId, Type: "unsubscribed"}
+	return nil
+}
+
+// unsubscribeAll removes all subscriptions, used when the connection is closed.
+func (ws *wsSubscriptions) unsubscribeAll() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	for reqId, sub := range ws.subs {
+		pubsub.DefaultBus.Unsubscribe(sub)
+		delete(ws.subs, reqId)
+	}
+}
@@ -1,24 +1,69 @@
 package torqsrv
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/jmoiron/sqlx"
 	"github.com/lncapital/torq/internal/channels"
+	"github.com/lncapital/torq/internal/metrics"
 	"github.com/lncapital/torq/internal/on_chain_tx"
 	"github.com/lncapital/torq/internal/payments"
+	"github.com/lncapital/torq/internal/pubsub"
+	"github.com/lncapital/torq/internal/settings"
 	"github.com/lncapital/torq/pkg/server_errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// Time allowed to write a message to the client.
+	wsWriteWait = 10 * time.Second
+	// Time allowed between messages or pongs from the client before the connection is considered dead.
+	wsPongWait = 60 * time.Second
+	// Interval of the pings sent to the client, must be less than wsPongWait.
+	wsPingPeriod = (wsPongWait * 9) / 10
+	// Maximum number of requests in progress per connection. Subscriptions are not counted.
+	wsMaxConcurrentRequests = 10
 )
 
+// wsRequestTimeouts are the deadlines of the request types. Opening and closing a channel wait for the
+// funding or closing transaction to confirm. The deadline only ends the updates sent to the client, the
+// channel is still opened or closed by LND.
+var wsRequestTimeouts = map[string]time.Duration{
+	"newAddress":   30 * time.Second,
+	"sendMany":     5 * time.Minute,
+	"newPayment":   10 * time.Minute,
+	"lnurlPay":     10 * time.Minute,
+	"openChannel":  2 * time.Hour,
+	"closeChannel": 2 * time.Hour,
+}
+
+// wsReadOnlyRequestTypes are the request types that are still accepted in read-only mode.
+var wsReadOnlyRequestTypes = map[string]bool{
+	"cancel":      true,
+	"subscribe":   true,
+	"unsubscribe": true,
+}
+
 type wsRequest struct {
 	ReqId               string                         `json:"reqId"`
 	Type                string                         `json:"type"`
 	NewPaymentRequest   *payments.NewPaymentRequest    `json:"newPaymentRequest"`
+	LnurlPayRequest     *payments.LnurlPayRequest      `json:"lnurlPayRequest"`
 	OpenChannelRequest  *channels.OpenChannelRequest   `json:"openChannelRequest"`
 	CloseChannelRequest *channels.CloseChannelRequest  `json:"closeChannelRequest"`
 	Password            *string                        `json:"password"`
 	NewAddressRequest   *on_chain_tx.NewAddressRequest `json:"newAddressRequest"`
+	SendManyRequest     *on_chain_tx.SendManyRequest   `json:"sendManyRequest"`
+	// SubscriptionRequest is used by subscribe requests. Unsubscribe and cancel requests use the reqId of
+	// the request they stop.
+	SubscriptionRequest *pubsub.Filter `json:"subscriptionRequest"`
 }
 
 type Pong struct {
@@ -35,104 +80,266 @@ type wsError struct {
 	Error string `json:"error"`
 }
 
-func processWsReq(db *sqlx.DB, c *gin.Context, wChan chan interface{}, req wsRequest) {
+type wsCanceled struct {
+	ReqId string `json:"reqId"`
+	Type  string `json:"type"`
+}
+
+// wsConnection holds the work started from one websocket connection. All of it is stopped when the
+// connection is closed.
+type wsConnection struct {
+	ctx   context.Context
+	wChan chan interface{}
+	subs  *wsSubscriptions
+	// wg tracks every goroutine that writes to wChan so that wChan is only closed once they are done.
+	wg sync.WaitGroup
+	// slots limits the number of requests in progress.
+	slots chan struct{}
+
+	mu       sync.Mutex
+	requests map[string]context.CancelFunc
+}
+
+func newWsConnection(ctx context.Context) *wsConnection {
+	wsc := &wsConnection{
+		ctx:      ctx,
+		wChan:    make(chan interface{}),
+		slots:    make(chan struct{}, wsMaxConcurrentRequests),
+		requests: make(map[string]context.CancelFunc),
+	}
+	wsc.subs = newWsSubscriptions(&wsc.wg)
+	return wsc
+}
+
+func wsRequestTimeout(req wsRequest) time.Duration {
+	// Payments have their own timeout, give LND some time to report the final status after it.
+	if req.Type == "newPayment" && req.NewPaymentRequest != nil && req.NewPaymentRequest.TimeOutSecs > 0 {
+		return time.Duration(req.NewPaymentRequest.TimeOutSecs)*time.Second + time.Minute
+	}
+	return wsRequestTimeouts[req.Type]
+}
+
+func (wsc *wsConnection) sendError(reqId string, err error) {
+	wsc.wChan <- wsError{
+		ReqId: reqId,
+		Type:  "Error",
+		Error: err.Error(),
+	}
+}
+
+// startRequest runs process in the background with a context that's canceled by a cancel request, the
+// request deadline or the closing of the connection.
+func (wsc *wsConnection) startRequest(req wsRequest, process func(ctx context.Context) error) {
+	select {
+	case wsc.slots <- struct{}{}:
+	default:
+		wsc.sendError(req.ReqId, fmt.Errorf("Too many requests in progress, the maximum is %d",
+			wsMaxConcurrentRequests))
+		return
+	}
+
+	wsc.mu.Lock()
+	if _, exists := wsc.requests[req.ReqId]; exists {
+		wsc.mu.Unlock()
+		<-wsc.slots
+		wsc.sendError(req.ReqId, fmt.Errorf("Request with reqId %s is already in progress", req.ReqId))
+		return
+	}
+	ctx, cancel := context.WithTimeout(wsc.ctx, wsRequestTimeout(req))
+	wsc.requests[req.ReqId] = cancel
+	wsc.mu.Unlock()
+
+	wsc.wg.Add(1)
+	go func() {
+		defer wsc.wg.Done()
+		defer func() { <-wsc.slots }()
+		defer wsc.finishRequest(req.ReqId)
+
+		err := process(ctx)
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			wsc.sendError(req.ReqId, errors.New("Request timed out"))
+		case ctx.Err() != nil:
+			// Canceled by the client or the connection was closed, nothing to report.
+		case err != nil:
+			wsc.sendError(req.ReqId, err)
+		}
+	}()
+}
+
+func (wsc *wsConnection) finishRequest(reqId string) {
+	wsc.mu.Lock()
+	defer wsc.mu.Unlock()
+	if cancel, exists := wsc.requests[reqId]; exists {
+		cancel()
+		delete(wsc.requests, reqId)
+	}
+}
+
+// cancelRequest stops the request or subscription that was started with the reqId.
+func (wsc *wsConnection) cancelRequest(reqId string) error {
+	wsc.mu.Lock()
+	cancel, exists := wsc.requests[reqId]
+	wsc.mu.Unlock()
+	if exists {
+		cancel()
+		wsc.wChan <- wsCanceled{ReqId: reqId, Type: "canceled"}
+		return nil
+	}
+
+	err := wsc.subs.unsubscribe(wsc.wChan, reqId)
+	if err != nil {
+		return fmt.Errorf("No request in progress with reqId: %s", reqId)
+	}
+	return nil
+}
+
+// close stops all requests and subscriptions and waits for them before closing the write channel.
+func (wsc *wsConnection) close(cancel context.CancelFunc) {
+	cancel()
+	wsc.subs.unsubscribeAll()
+	wsc.wg.Wait()
+	close(wsc.wChan)
+}
+
+// write sends the responses and pings to the client. It's the only writer of the connection. After a
+// failed write the connection is closed, which ends the read loop, and responses are dropped until the
+// write channel is closed.
+func (wsc *wsConnection) write(conn *websocket.Conn, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	var err error
+	for {
+		select {
+		case msg, ok := <-wsc.wChan:
+			if !ok {
+				return
+			}
+			if err != nil {
+				continue
+			}
+			metrics.WebsocketMessage("out", fmt.Sprintf("%T", msg))
+			err = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err == nil {
+				err = conn.WriteJSON(msg)
+			}
+		case <-ticker.C:
+			if err != nil {
+				continue
+			}
+			err = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err == nil {
+				err = conn.WriteMessage(websocket.PingMessage, nil)
+			}
+		}
+		if err != nil {
+			log.Debug().Err(err).Msg("Writing to websocket")
+			conn.Close()
+		}
+	}
+}
+
+func (wsc *wsConnection) processWsReq(db *sqlx.DB, c *gin.Context, req wsRequest) {
 	if req.Type == "ping" {
-		wChan <- Pong{Message: "pong"}
+		wsc.wChan <- Pong{Message: "pong"}
 		return
 	}
 
 	// Validate request
 	if req.ReqId == "" {
-		wChan <- wsError{
-			ReqId: req.ReqId,
-			Type:  "Error",
-			Error: "ReqId cannot be empty",
-		}
+		wsc.sendError(req.ReqId, errors.New("ReqId cannot be empty"))
+		return
+	}
+
+	if settings.IsReadOnly() && !wsReadOnlyRequestTypes[req.Type] {
+		wsc.sendError(req.ReqId, fmt.Errorf("Torq is running in read-only mode, %s requests are refused", req.Type))
 		return
 	}
 
 	switch req.Type {
 	case "newPayment":
 		if req.NewPaymentRequest == nil {
-			wChan <- wsError{
-				ReqId: req.ReqId,
-				Type:  "Error",
-				Error: "newPaymentRequest cannot be empty",
-			}
+			wsc.sendError(req.ReqId, errors.New("newPaymentRequest cannot be empty"))
 			break
 		}
 		// Process a valid payment request
-		err := payments.SendNewPayment(wChan, db, c, *req.NewPaymentRequest, req.ReqId)
-		if err != nil {
-			wChan <- wsError{
-				ReqId: req.ReqId,
-				Type:  "Error",
-				Error: err.Error(),
-			}
+		wsc.startRequest(req, func(ctx context.Context) error {
+			return payments.SendNewPayment(ctx, wsc.wChan, db, c, *req.NewPaymentRequest, req.ReqId)
+		})
+	case "lnurlPay":
+		if req.LnurlPayRequest == nil {
+			wsc.sendError(req.ReqId, errors.New("lnurlPayRequest cannot be empty"))
+			break
 		}
-		break
+		wsc.startRequest(req, func(ctx context.Context) error {
+			return payments.PayLnurl(ctx, wsc.wChan, db, c, *req.LnurlPayRequest, req.ReqId)
+		})
 	case "newAddress":
 		if req.NewAddressRequest == nil {
-			wChan <- wsError{
-				ReqId: req.ReqId,
-				Type:  "Error",
-				Error: "newAddressRequest cannot be empty",
-			}
+			wsc.sendError(req.ReqId, errors.New("newAddressRequest cannot be empty"))
 			break
 		}
-		// Process a valid payment request
-		err := on_chain_tx.NewAddress(wChan, db, c, *req.NewAddressRequest, req.ReqId)
-		if err != nil {
-			wChan <- wsError{
-				ReqId: req.ReqId,
-				Type:  "Error",
-				Error: err.Error(),
-			}
+		wsc.startRequest(req, func(ctx context.Context) error {
+			return on_chain_tx.NewAddress(ctx, wsc.wChan, db, c, *req.NewAddressRequest, req.ReqId)
+		})
+	case "sendMany":
+		if req.SendManyRequest == nil {
+			wsc.sendError(req.ReqId, errors.New("sendManyRequest cannot be empty"))
+			break
 		}
-		break
+		wsc.startRequest(req, func(ctx context.Context) error {
+			return on_chain_tx.SendManyWs(ctx, wsc.wChan, db, *req.SendManyRequest, req.ReqId)
+		})
 	case "closeChannel":
 		if req.CloseChannelRequest == nil {
-			wChan <- wsError{
-				ReqId: req.ReqId,
-				Type:  "Error",
-				Error: "Close Channel request cannot be empty",
-			}
+			wsc.sendError(req.ReqId, errors.New("Close Channel request cannot be empty"))
 			break
 		}
-		// Process a valid payment request
-		err := channels.CloseChannel(wChan, db, c, *req.CloseChannelRequest, req.ReqId)
-		if err != nil {
-			wChan <- wsError{
-				ReqId: req.ReqId,
-				Type:  "Error",
-				Error: err.Error(),
-			}
-		}
+		wsc.startRequest(req, func(ctx context.Context) error {
+			return channels.CloseChannel(ctx, wsc.wChan, db, c, *req.CloseChannelRequest, req.ReqId)
+		})
 	case "openChannel":
 		if req.OpenChannelRequest == nil {
-			wChan <- wsError{
-				ReqId: req.ReqId,
-				Type:  "Error",
-				Error: "OpenChannelRequest cannot be empty",
-			}
+			wsc.sendError(req.ReqId, errors.New("OpenChannelRequest cannot be empty"))
 			break
 		}
-		err := channels.OpenChannel(db, wChan, *req.OpenChannelRequest, req.ReqId)
+		wsc.startRequest(req, func(ctx context.Context) error {
+			return channels.OpenChannel(ctx, db, wsc.wChan, *req.OpenChannelRequest, req.ReqId)
+		})
+	case "cancel":
+		err := wsc.cancelRequest(req.ReqId)
 		if err != nil {
-			wChan <- wsError{
-				ReqId: req.ReqId,
-				Type:  "Error",
-				Error: err.Error(),
-			}
+			wsc.sendError(req.ReqId, err)
 		}
-		break
-	default:
-		err := fmt.Errorf("Unknown request type: %s", req.Type)
-		wChan <- wsError{
-			ReqId: req.ReqId,
-			Type:  "Error",
-			Error: err.Error(),
+	case "subscribe":
+		if req.SubscriptionRequest == nil {
+			wsc.sendError(req.ReqId, errors.New("subscriptionRequest cannot be empty"))
+			break
 		}
+		err := wsc.subs.subscribe(wsc.wChan, req.ReqId, *req.SubscriptionRequest)
+		if err != nil {
+			wsc.sendError(req.ReqId, err)
+		}
+	case "unsubscribe":
+		err := wsc.subs.unsubscribe(wsc.wChan, req.ReqId)
+		if err != nil {
+			wsc.sendError(req.ReqId, err)
+		}
+	default:
+		wsc.sendError(req.ReqId, fmt.Errorf("Unknown request type: %s", req.Type))
+	}
+}
+
+// wsRequestTypeLabel limits the request type metric label to the known request types.
+func wsRequestTypeLabel(t string) string {
+	switch t {
+	case "ping", "newPayment", "lnurlPay", "newAddress", "sendMany", "closeChannel", "openChannel", "cancel",
+		"subscribe", "unsubscribe":
+		return t
+	default:
+		return "unknown"
 	}
 }
 
@@ -145,38 +352,50 @@ func WebsocketHandler(c *gin.Context, db *sqlx.DB) {
 	}
 	defer conn.Close()
 
-	// Channel for writing responses to the client safely
-	wc := make(chan interface{})
-	go func(c *gin.Context) {
-		for {
-			err := conn.WriteJSON(<-wc)
-			if err != nil {
-				server_errors.LogAndSendServerError(c, err)
-			}
-		}
-	}(c)
+	metrics.WebsocketOpened()
+	defer metrics.WebsocketClosed()
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	wsc := newWsConnection(ctx)
+
+	// All writes to the client go through wChan, the writer stops once all work of the connection is done.
+	writerDone := make(chan struct{})
+	go wsc.write(conn, writerDone)
+	defer func() {
+		wsc.close(cancel)
+		<-writerDone
+	}()
+
+	// The client has to send a message or answer a ping within wsPongWait.
+	err = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	if err != nil {
+		return
+	}
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
 
 	for {
-		req := wsRequest{}
-		err := conn.ReadJSON(&req)
-		switch err.(type) {
-		case *websocket.CloseError:
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Debug().Err(err).Msg("Reading from websocket")
+			}
 			return
-		case *websocket.HandshakeError:
-			server_errors.LogAndSendServerError(c, err)
+		}
+		err = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		if err != nil {
 			return
-		case nil:
-			go processWsReq(db, c, wc, req)
-			continue
-		default:
-			wsr := wsError{
-				ReqId: req.ReqId,
-				Type:  "Error",
-				Error: fmt.Sprintf("Could not parse request, please check that your JSON is correctly formated"),
-			}
-			wc <- wsr
-			continue
 		}
 
+		req := wsRequest{}
+		err = json.Unmarshal(msg, &req)
+		if err != nil {
+			wsc.sendError(req.ReqId,
+				errors.New("Could not parse request, please check that your JSON is correctly formated"))
+			continue
+		}
+		metrics.WebsocketMessage("in", wsRequestTypeLabel(req.Type))
+		wsc.processWsReq(db, c, req)
 	}
 }
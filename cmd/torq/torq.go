@@ -11,8 +11,14 @@ import (
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/lncapital/torq/build"
 	"github.com/lncapital/torq/cmd/torq/internal/subscribe"
+	"github.com/lncapital/torq/cmd/torq/internal/torqcli"
+	"github.com/lncapital/torq/cmd/torq/internal/torqgrpc"
 	"github.com/lncapital/torq/cmd/torq/internal/torqsrv"
+	"github.com/lncapital/torq/internal/channel_backups"
 	"github.com/lncapital/torq/internal/database"
+	"github.com/lncapital/torq/internal/on_chain_tx"
+	"github.com/lncapital/torq/internal/payouts"
+	"github.com/lncapital/torq/internal/retention"
 	"github.com/lncapital/torq/internal/settings"
 	"github.com/lncapital/torq/pkg/lnd_connect"
 	"github.com/rs/zerolog/log"
@@ -102,11 +108,43 @@ func main() {
 			Value: "8080",
 			Usage: "Port to serve the HTTP API",
 		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:  "torq.metrics-port",
+			Usage: "Port to serve the Prometheus /metrics endpoint on. Defaults to the HTTP API port.",
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:  "torq.metrics-user",
+			Value: "torq",
+			Usage: "Basic auth user for the /metrics endpoint.",
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:  "torq.metrics-password",
+			Usage: "Basic auth password for the /metrics endpoint. Defaults to the Torq password.",
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:  "torq.grpc-port",
+			Usage: "Port to serve the gRPC API on. The gRPC API is disabled when not set.",
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:  "torq.grpc-host",
+			Value: "localhost",
+			Usage: "Host of the gRPC API used by the client commands.",
+		}),
 		altsrc.NewBoolFlag(&cli.BoolFlag{
 			Name:  "torq.no-sub",
 			Value: false,
 			Usage: "Start the server without subscribing to node data.",
 		}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{
+			Name:  "torq.read-only",
+			Value: false,
+			Usage: "Refuse all requests that change the state of Torq or the nodes.",
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name: "torq.backup-dir",
+			Usage: "Directory every new channel backup is also written to. " +
+				"Backups are only stored in the database when not set.",
+		}),
 
 		// Torq database
 		altsrc.NewStringFlag(&cli.StringFlag{
@@ -178,7 +216,11 @@ func main() {
 				return err
 			}
 
+			settings.SetReadOnly(c.Bool("torq.read-only"))
+
 			if !c.Bool("torq.no-sub") {
+				channel_backups.SetMirrorDir(c.String("torq.backup-dir"))
+
 				// initialise package level var for keeping state of subsciptions
 				runningSubscriptions = subscriptions{}
 
@@ -266,6 +308,9 @@ func main() {
 				// starts LND subscription when Torq starts
 				startchan <- struct{}{}
 
+				// The on-chain transactions of all nodes are categorised together, not per subscription.
+				go on_chain_tx.ClassifyTransactions(context.Background(), db)
+
 				// go routine that looks for stop signals and cancels the context(s)
 				go (func() {
 					for {
@@ -280,7 +325,18 @@ func main() {
 
 			}
 
-			torqsrv.Start(c.Int("torq.port"), c.String("torq.password"), db, RestartLNDSubscription)
+			// Retention of the time series doesn't depend on the nodes, it also runs without subscriptions.
+			go retention.Start(context.Background(), db)
+
+			// Payout jobs that were running when Torq stopped are finished, before new jobs can be confirmed.
+			payouts.ResumeJobs(context.Background(), db)
+
+			if c.Int("torq.grpc-port") != 0 {
+				go torqgrpc.Start(c.Int("torq.grpc-port"), c.String("torq.password"), db)
+			}
+
+			torqsrv.Start(c.Int("torq.port"), c.String("torq.password"), c.Int("torq.metrics-port"),
+				c.String("torq.metrics-user"), c.String("torq.metrics-password"), db, RestartLNDSubscription)
 
 			return nil
 		},
@@ -312,6 +368,102 @@ func main() {
 		},
 	}
 
+	passphraseFlag := &cli.StringFlag{
+		Name:    "passphrase",
+		EnvVars: []string{"TORQ_ARCHIVE_PASSPHRASE"},
+		Usage:   "Passphrase of the TLS certificates and macaroons of the local nodes in the archive",
+	}
+
+	dbCommand := &cli.Command{
+		Name:  "db",
+		Usage: "Export and import the Torq database",
+		Subcommands: cli.Commands{
+			{
+				Name:      "export",
+				Usage:     "Export settings, local nodes, table views, tags and channels to an archive",
+				ArgsUsage: "<file>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "time-series", Usage: "Include forwards, events, payments, invoices " +
+						"and on-chain transactions"},
+					passphraseFlag,
+				},
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() != 1 {
+						return errors.New("The archive file is required")
+					}
+					db, err := database.PgConnect(c.String("db.name"), c.String("db.user"),
+						c.String("db.password"), c.String("db.host"), c.String("db.port"))
+					if err != nil {
+						return err
+					}
+					defer db.Close()
+
+					f, err := os.OpenFile(c.Args().First(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+					if err != nil {
+						return errors.Wrap(err, "Creating archive file")
+					}
+					manifest, err := database.ExportArchive(db, f, database.ExportOptions{
+						TorqVersion: build.Version(),
+						TimeSeries:  c.Bool("time-series"),
+						Passphrase:  c.String("passphrase"),
+					})
+					if cerr := f.Close(); err == nil && cerr != nil {
+						err = errors.Wrap(cerr, "Closing archive file")
+					}
+					if err != nil {
+						os.Remove(c.Args().First())
+						return err
+					}
+					if manifest.Encryption == nil {
+						fmt.Println("The archive contains the unencrypted credentials of the local nodes, " +
+							"use --passphrase to encrypt them.")
+					}
+					for _, t := range manifest.Tables {
+						fmt.Printf("Exported %d rows of %s\n", t.Rows, t.Name)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "import",
+				Usage:     "Import an archive written by db export, importing it again changes nothing",
+				ArgsUsage: "<file>",
+				Flags:     []cli.Flag{passphraseFlag},
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() != 1 {
+						return errors.New("The archive file is required")
+					}
+					f, err := os.Open(c.Args().First())
+					if err != nil {
+						return errors.Wrap(err, "Opening archive file")
+					}
+					defer f.Close()
+					info, err := f.Stat()
+					if err != nil {
+						return errors.Wrap(err, "Opening archive file")
+					}
+
+					db, err := database.PgConnect(c.String("db.name"), c.String("db.user"),
+						c.String("db.password"), c.String("db.host"), c.String("db.port"))
+					if err != nil {
+						return err
+					}
+					defer db.Close()
+
+					manifest, err := database.ImportArchive(db, f, info.Size(),
+						database.ImportOptions{Passphrase: c.String("passphrase")})
+					if err != nil {
+						return err
+					}
+					for _, t := range manifest.Tables {
+						fmt.Printf("Imported %d rows of %s\n", t.Rows, t.Name)
+					}
+					return nil
+				},
+			},
+		},
+	}
+
 	app.Flags = cmdFlags
 
 	app.Before = altsrc.InitInputSourceWithContext(cmdFlags, loadFlags())
@@ -319,7 +471,9 @@ func main() {
 	app.Commands = cli.Commands{
 		start,
 		migrateUp,
+		dbCommand,
 	}
+	app.Commands = append(app.Commands, torqcli.Commands()...)
 
 	err = app.Run(os.Args)
 	if err != nil {
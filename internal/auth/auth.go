@@ -9,10 +9,13 @@ import (
 
 const Userkey = "user"
 
+// sessionName is the name of the session cookie.
+const sessionName = "torq_session"
+
 func CreateSession(r *gin.Engine, apiPwd string) {
 	store := sessions.NewCookieStore([]byte(apiPwd))
 	store.Options(sessions.Options{MaxAge: 86400, Path: "/"})
-	r.Use(sessions.Sessions("torq_session", store))
+	r.Use(sessions.Sessions(sessionName, store))
 }
 
 // AuthRequired is a simple middleware to check the session
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gorilla/securecookie"
+)
+
+// Session tokens are encoded the same way as the session cookie, so the value of the torq_session cookie can
+// be used as token and a token can be used as cookie value.
+const sessionMaxAge = 86400
+
+var ErrInvalidToken = errors.New("invalid session token")
+
+func sessionCodecs(apiPwd string) []securecookie.Codec {
+	codecs := securecookie.CodecsFromPairs([]byte(apiPwd))
+	for _, codec := range codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(sessionMaxAge)
+		}
+	}
+	return codecs
+}
+
+// NewSessionToken returns a session token for the user, used by API clients that don't keep cookies.
+func NewSessionToken(apiPwd string, user string) (string, error) {
+	values := map[interface{}]interface{}{Userkey: user}
+	token, err := securecookie.EncodeMulti(sessionName, values, sessionCodecs(apiPwd)...)
+	if err != nil {
+		return "", errors.Wrap(err, "Encoding session token")
+	}
+	return token, nil
+}
+
+// ValidateSessionToken checks that the token was created with the Torq password, has not expired and
+// belongs to a user. It returns ErrInvalidToken otherwise.
+func ValidateSessionToken(apiPwd string, token string) error {
+	values := make(map[interface{}]interface{})
+	err := securecookie.DecodeMulti(sessionName, token, &values, sessionCodecs(apiPwd)...)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if user, ok := values[Userkey].(string); !ok || user == "" {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// SessionTokenFromCookies returns the value of the session cookie in the given Cookie headers.
+func SessionTokenFromCookies(cookieHeaders []string) string {
+	r := http.Request{Header: http.Header{"Cookie": cookieHeaders}}
+	cookie, err := r.Cookie(sessionName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
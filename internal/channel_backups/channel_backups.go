@@ -0,0 +1,242 @@
+package channel_backups
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/cockroachdb/errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lncapital/torq/internal/metrics"
+	"github.com/lncapital/torq/internal/settings"
+	"github.com/lncapital/torq/pkg/lnd_connect"
+	"github.com/rs/zerolog/log"
+	"go.uber.org/ratelimit"
+	"google.golang.org/grpc"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// mirrorDir is the directory every new backup is written to as well. Mirroring is disabled when it's empty.
+var mirrorDir string
+
+// SetMirrorDir sets the directory new backups are mirrored to.
+func SetMirrorDir(dir string) {
+	mirrorDir = dir
+}
+
+type ChannelBackup struct {
+	ChannelBackupId int            `json:"channelBackupId" db:"channel_backup_id"`
+	LocalNodeId     int            `json:"localNodeId" db:"local_node_id"`
+	Version         int            `json:"version" db:"version"`
+	MultiChanBackup []byte         `json:"-" db:"multi_chan_backup"`
+	Checksum        string         `json:"checksum" db:"checksum"`
+	ChannelPoints   pq.StringArray `json:"channelPoints" db:"channel_points"`
+	CreatedOn       time.Time      `json:"createdOn" db:"created_on"`
+}
+
+type VerifyResponse struct {
+	ChannelBackupId int     `json:"channelBackupId"`
+	ChecksumValid   bool    `json:"checksumValid"`
+	LndValid        bool    `json:"lndValid"`
+	Error           *string `json:"error"`
+}
+
+type lndClientChannelBackups interface {
+	ExportAllChannelBackups(ctx context.Context, in *lnrpc.ChanBackupExportRequest,
+		opts ...grpc.CallOption) (*lnrpc.ChanBackupSnapshot, error)
+	SubscribeChannelBackups(ctx context.Context, in *lnrpc.ChannelBackupSubscription,
+		opts ...grpc.CallOption) (lnrpc.Lightning_SubscribeChannelBackupsClient, error)
+}
+
+type lndClientVerifyChanBackup interface {
+	VerifyChanBackup(ctx context.Context, in *lnrpc.ChanBackupSnapshot,
+		opts ...grpc.CallOption) (*lnrpc.VerifyChanBackupResponse, error)
+}
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func channelPointString(cp *lnrpc.ChannelPoint) string {
+	txid := cp.GetFundingTxidStr()
+	if txid == "" {
+		if hash, err := chainhash.NewHash(cp.GetFundingTxidBytes()); err == nil {
+			txid = hash.String()
+		}
+	}
+	return fmt.Sprintf("%s:%d", txid, cp.OutputIndex)
+}
+
+func snapshotToBackup(localNodeId int, snapshot *lnrpc.ChanBackupSnapshot) (ChannelBackup, error) {
+	multi := snapshot.GetMultiChanBackup()
+	if multi == nil || len(multi.MultiChanBackup) == 0 {
+		return ChannelBackup{}, errors.New("Snapshot has no multi-channel backup")
+	}
+	r := ChannelBackup{
+		LocalNodeId:     localNodeId,
+		MultiChanBackup: multi.MultiChanBackup,
+		Checksum:        checksum(multi.MultiChanBackup),
+		ChannelPoints:   pq.StringArray{},
+	}
+	for _, cp := range multi.ChanPoints {
+		r.ChannelPoints = append(r.ChannelPoints, channelPointString(cp))
+	}
+	return r, nil
+}
+
+func backupFileName(backup ChannelBackup) string {
+	return fmt.Sprintf("channel-node-%d-v%d.backup", backup.LocalNodeId, backup.Version)
+}
+
+// writeFileAtomic writes the file through a temporary file, so a crash never leaves a partial backup behind.
+func writeFileAtomic(path string, b []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// mirrorBackup writes the backup to the directory, versioned and as the latest backup of the node. The latest file
+// has the format of LND's channel.backup file and can be used with lncli restorechanbackup --multi_file.
+func mirrorBackup(dir string, backup ChannelBackup) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrap(err, "Creating backup directory")
+	}
+	if err := writeFileAtomic(filepath.Join(dir, backupFileName(backup)), backup.MultiChanBackup); err != nil {
+		return errors.Wrap(err, "Writing backup file")
+	}
+	latest := filepath.Join(dir, fmt.Sprintf("channel-node-%d.backup", backup.LocalNodeId))
+	if err := writeFileAtomic(latest, backup.MultiChanBackup); err != nil {
+		return errors.Wrap(err, "Writing backup file")
+	}
+	return nil
+}
+
+func storeSnapshot(db *sqlx.DB, localNodeId int, snapshot *lnrpc.ChanBackupSnapshot) error {
+	backup, err := snapshotToBackup(localNodeId, snapshot)
+	if err != nil {
+		return err
+	}
+	backup, stored, err := insertBackup(db, backup)
+	if err != nil {
+		return err
+	}
+	if !stored {
+		return nil
+	}
+	log.Info().Msgf("Stored channel backup version %d of node %d with %d channels", backup.Version,
+		localNodeId, len(backup.ChannelPoints))
+	if mirrorDir != "" {
+		if err = mirrorBackup(mirrorDir, backup); err != nil {
+			// The backup is stored, a failing mirror shouldn't stop the subscription.
+			log.Error().Err(err).Msgf("Mirroring channel backup version %d of node %d", backup.Version,
+				localNodeId)
+		}
+	}
+	return nil
+}
+
+// SubscribeAndStoreChannelBackups stores a new version of the multi-channel backup every time a channel is opened
+// or closed. The current backup is stored on startup when it differs from the latest stored version.
+func SubscribeAndStoreChannelBackups(ctx context.Context, client lndClientChannelBackups, db *sqlx.DB,
+	localNodeId int) error {
+
+	snapshot, err := client.ExportAllChannelBackups(ctx, &lnrpc.ChanBackupExportRequest{})
+	if err != nil {
+		return errors.Wrap(err, "Exporting channel backups")
+	}
+	if err = storeSnapshot(db, localNodeId, snapshot); err != nil {
+		return errors.Wrap(err, "Storing channel backup")
+	}
+
+	req := lnrpc.ChannelBackupSubscription{}
+	stream, err := client.SubscribeChannelBackups(ctx, &req)
+	if err != nil {
+		return errors.Wrap(err, "Subscribing to channel backups")
+	}
+	rl := ratelimit.New(1) // 1 per second maximum rate limit
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		snapshot, err := stream.Recv()
+		if err != nil {
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return nil
+			}
+			log.Error().Err(err).Msg("Subscribe channel backups stream receive")
+			for {
+				rl.Take()
+				stream, err = client.SubscribeChannelBackups(ctx, &req)
+				if err == nil || ctx.Err() != nil {
+					break
+				}
+				log.Error().Err(err).Msg("Reconnecting to channel backups")
+			}
+			continue
+		}
+
+		metrics.SubscriptionEvents("channel_backups", 1)
+
+		if err = storeSnapshot(db, localNodeId, snapshot); err != nil {
+			log.Error().Err(err).Msgf("Storing channel backup of node %d", localNodeId)
+			rl.Take()
+		}
+	}
+}
+
+// verifyBackup checks the backup against its checksum and lets LND verify it can decrypt and decode it.
+func verifyBackup(ctx context.Context, client lndClientVerifyChanBackup, backup ChannelBackup) VerifyResponse {
+	r := VerifyResponse{
+		ChannelBackupId: backup.ChannelBackupId,
+		ChecksumValid:   checksum(backup.MultiChanBackup) == backup.Checksum,
+	}
+	_, err := client.VerifyChanBackup(ctx, &lnrpc.ChanBackupSnapshot{
+		MultiChanBackup: &lnrpc.MultiChanBackup{MultiChanBackup: backup.MultiChanBackup},
+	})
+	if err != nil {
+		msg := err.Error()
+		r.Error = &msg
+		return r
+	}
+	r.LndValid = true
+	return r
+}
+
+// VerifyBackup verifies a stored backup with the node it belongs to.
+func VerifyBackup(ctx context.Context, db *sqlx.DB, backupId int) (VerifyResponse, error) {
+	backup, err := getBackup(db, backupId)
+	if err != nil {
+		return VerifyResponse{}, err
+	}
+
+	if err = settings.CheckNodePermission(db, backup.LocalNodeId, settings.ActionBackupChannels); err != nil {
+		return VerifyResponse{}, err
+	}
+
+	connectionDetails, err := settings.GetNodeConnectionDetailsById(db, backup.LocalNodeId)
+	if err != nil {
+		return VerifyResponse{}, errors.Wrap(err, "Getting node connection details from the db")
+	}
+	conn, err := lnd_connect.Connect(
+		connectionDetails.GRPCAddress,
+		connectionDetails.TLSFileBytes,
+		connectionDetails.MacaroonFileBytes)
+	if err != nil {
+		return VerifyResponse{}, errors.Wrap(err, "Connecting to LND")
+	}
+	defer conn.Close()
+
+	return verifyBackup(ctx, lnrpc.NewLightningClient(conn), backup), nil
+}
@@ -0,0 +1,82 @@
+package channel_backups
+
+import (
+	"bytes"
+	"context"
+	"github.com/cockroachdb/errors"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"google.golang.org/grpc"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type mockLightningClient_VerifyChanBackup struct {
+	err error
+}
+
+func (c *mockLightningClient_VerifyChanBackup) VerifyChanBackup(ctx context.Context, in *lnrpc.ChanBackupSnapshot,
+	opts ...grpc.CallOption) (*lnrpc.VerifyChanBackupResponse, error) {
+	return &lnrpc.VerifyChanBackupResponse{}, c.err
+}
+
+const testTxid = "9a9f5f8a6f1c3b1e2d4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d"
+
+func Test_snapshotToBackup(t *testing.T) {
+	hash := make([]byte, 32)
+	hash[0] = 1
+	snapshot := &lnrpc.ChanBackupSnapshot{MultiChanBackup: &lnrpc.MultiChanBackup{
+		ChanPoints: []*lnrpc.ChannelPoint{
+			{FundingTxid: &lnrpc.ChannelPoint_FundingTxidStr{FundingTxidStr: testTxid}, OutputIndex: 1},
+			{FundingTxid: &lnrpc.ChannelPoint_FundingTxidBytes{FundingTxidBytes: hash}, OutputIndex: 0},
+		},
+		MultiChanBackup: []byte("backup"),
+	}}
+
+	r, err := snapshotToBackup(1, snapshot)
+	if err != nil {
+		t.Fatalf("snapshotToBackup() error = %v", err)
+	}
+	// Txid bytes are in the reversed byte order of the string.
+	want := []string{testTxid + ":1", "0000000000000000000000000000000000000000000000000000000000000001:0"}
+	if len(r.ChannelPoints) != 2 || r.ChannelPoints[0] != want[0] || r.ChannelPoints[1] != want[1] {
+		t.Errorf("snapshotToBackup() channel points = %v, want %v", r.ChannelPoints, want)
+	}
+	if r.Checksum != "54d00d867758cef816bc4685f58e327b949712b07ebd17c3485f3ffc9e9f5133" {
+		t.Errorf("snapshotToBackup() checksum = %v", r.Checksum)
+	}
+
+	if _, err = snapshotToBackup(1, &lnrpc.ChanBackupSnapshot{}); err == nil {
+		t.Errorf("snapshotToBackup() expected an error for an empty snapshot")
+	}
+}
+
+func Test_mirrorBackup(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backups")
+	backup := ChannelBackup{LocalNodeId: 2, Version: 3, MultiChanBackup: []byte("backup")}
+
+	if err := mirrorBackup(dir, backup); err != nil {
+		t.Fatalf("mirrorBackup() error = %v", err)
+	}
+	for _, name := range []string{"channel-node-2-v3.backup", "channel-node-2.backup"} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || !bytes.Equal(b, backup.MultiChanBackup) {
+			t.Errorf("mirrorBackup() %s = %q, %v", name, b, err)
+		}
+	}
+}
+
+func Test_verifyBackup(t *testing.T) {
+	backup := ChannelBackup{ChannelBackupId: 1, MultiChanBackup: []byte("backup"), Checksum: checksum([]byte("backup"))}
+
+	r := verifyBackup(context.Background(), &mockLightningClient_VerifyChanBackup{}, backup)
+	if !r.ChecksumValid || !r.LndValid || r.Error != nil {
+		t.Errorf("verifyBackup() = %+v", r)
+	}
+
+	backup.Checksum = "invalid"
+	r = verifyBackup(context.Background(), &mockLightningClient_VerifyChanBackup{err: errors.New("invalid")}, backup)
+	if r.ChecksumValid || r.LndValid || r.Error == nil {
+		t.Errorf("verifyBackup() = %+v", r)
+	}
+}
@@ -0,0 +1,116 @@
+package channel_backups
+
+import (
+	"database/sql"
+	"github.com/cockroachdb/errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"time"
+)
+
+type ErrChannelBackupNotFound struct {
+	Identifier int
+}
+
+func (e ErrChannelBackupNotFound) Error() string {
+	return "Channel backup not found"
+}
+
+const backupColumns = `channel_backup_id, local_node_id, version, checksum, channel_points, created_on`
+
+func getBackups(db *sqlx.DB, nodeId int) (r []ChannelBackup, err error) {
+	err = db.Select(&r, `
+SELECT `+backupColumns+`
+FROM channel_backup
+WHERE ($1 = 0 OR local_node_id = $1)
+ORDER BY local_node_id, version DESC;`, nodeId)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return r, nil
+}
+
+func getBackup(db *sqlx.DB, backupId int) (r ChannelBackup, err error) {
+	err = db.Get(&r, `
+SELECT `+backupColumns+`, multi_chan_backup
+FROM channel_backup
+WHERE channel_backup_id = $1;`, backupId)
+	switch {
+	case err == nil:
+		return r, nil
+	case errors.Is(err, sql.ErrNoRows):
+		return r, ErrChannelBackupNotFound{Identifier: backupId}
+	default:
+		return r, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+}
+
+// insertBackup stores the backup as the next version of the node. Nothing is stored when the backup covers the same
+// channels as the latest version, as LND sends the current backup again on every subscribe. The backups can't be
+// compared byte for byte, LND encrypts every backup with a new nonce.
+func insertBackup(db *sqlx.DB, backup ChannelBackup) (r ChannelBackup, stored bool, err error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return r, false, errors.Wrap(err, "Unable to start transaction")
+	}
+	defer tx.Rollback()
+
+	// Lock the node so concurrent backups get consecutive versions.
+	_, err = tx.Exec(`SELECT local_node_id FROM local_node WHERE local_node_id = $1 FOR UPDATE;`, backup.LocalNodeId)
+	if err != nil {
+		return r, false, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+
+	var latest struct {
+		Version       int            `db:"version"`
+		ChannelPoints pq.StringArray `db:"channel_points"`
+	}
+	err = tx.Get(&latest, `
+SELECT version, channel_points
+FROM channel_backup
+WHERE local_node_id = $1
+ORDER BY version DESC
+LIMIT 1;`, backup.LocalNodeId)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		break
+	case err != nil:
+		return r, false, errors.Wrap(err, "Unable to execute SQL statement")
+	case sameChannelPoints(latest.ChannelPoints, backup.ChannelPoints):
+		return r, false, nil
+	}
+
+	backup.Version = latest.Version + 1
+	backup.CreatedOn = time.Now().UTC()
+	err = tx.QueryRowx(`
+INSERT INTO channel_backup (local_node_id, version, multi_chan_backup, checksum, channel_points, created_on)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING channel_backup_id;`,
+		backup.LocalNodeId, backup.Version, backup.MultiChanBackup, backup.Checksum,
+		pq.Array(backup.ChannelPoints), backup.CreatedOn).Scan(&backup.ChannelBackupId)
+	if err != nil {
+		return r, false, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	if err = tx.Commit(); err != nil {
+		return r, false, errors.Wrap(err, "Unable to commit transaction")
+	}
+	return backup, true, nil
+}
+
+// sameChannelPoints returns true when both backups cover the same channels, in any order.
+func sameChannelPoints(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	count := make(map[string]int)
+	for _, cp := range a {
+		count[cp]++
+	}
+	for _, cp := range b {
+		if count[cp] == 0 {
+			return false
+		}
+		count[cp]--
+	}
+	return true
+}
@@ -0,0 +1,29 @@
+package channel_backups
+
+import "testing"
+
+func Test_sameChannelPoints(t *testing.T) {
+	a, b, c := testTxid+":0", testTxid+":1", testTxid+":2"
+
+	tests := []struct {
+		name   string
+		latest []string
+		backup []string
+		want   bool
+	}{
+		{"No channels", []string{}, []string{}, true},
+		{"Same order", []string{a, b}, []string{a, b}, true},
+		{"Other order", []string{a, b}, []string{b, a}, true},
+		{"Channel opened", []string{a}, []string{a, b}, false},
+		{"Channel closed", []string{a, b}, []string{a}, false},
+		{"Channel replaced", []string{a, b}, []string{a, c}, false},
+		{"Duplicates", []string{a, a}, []string{a, b}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := sameChannelPoints(test.latest, test.backup); got != test.want {
+				t.Errorf("sameChannelPoints() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
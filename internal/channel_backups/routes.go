@@ -0,0 +1,84 @@
+package channel_backups
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lncapital/torq/pkg/server_errors"
+	"net/http"
+	"strconv"
+)
+
+func RegisterChannelBackupRoutes(r *gin.RouterGroup, db *sqlx.DB) {
+	r.GET("", func(c *gin.Context) { getBackupsHandler(c, db) })
+	r.GET(":channelBackupId/download", func(c *gin.Context) { downloadBackupHandler(c, db) })
+	r.POST(":channelBackupId/verify", func(c *gin.Context) { verifyBackupHandler(c, db) })
+}
+
+func getBackupsHandler(c *gin.Context, db *sqlx.DB) {
+	nodeId := 0
+	if c.Query("nodeId") != "" {
+		var err error
+		nodeId, err = strconv.Atoi(c.Query("nodeId"))
+		if err != nil {
+			server_errors.SendBadRequest(c, "Node id must be a number")
+			return
+		}
+	}
+	r, err := getBackups(db, nodeId)
+	if err != nil {
+		server_errors.LogAndSendServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+func getBackupFromParam(c *gin.Context, db *sqlx.DB) (ChannelBackup, bool) {
+	backupId, err := strconv.Atoi(c.Param("channelBackupId"))
+	if err != nil {
+		server_errors.SendBadRequest(c, "Channel backup id must be a number")
+		return ChannelBackup{}, false
+	}
+	r, err := getBackup(db, backupId)
+	switch err.(type) {
+	case nil:
+		return r, true
+	case ErrChannelBackupNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"Error": err.Error(), "Identifier": c.Param("channelBackupId")})
+		return r, false
+	default:
+		server_errors.LogAndSendServerError(c, err)
+		return r, false
+	}
+}
+
+// downloadBackupHandler serves the backup in the format of LND's channel.backup file.
+func downloadBackupHandler(c *gin.Context, db *sqlx.DB) {
+	backup, ok := getBackupFromParam(c, db)
+	if !ok {
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", backupFileName(backup)))
+	c.Header("X-Checksum-Sha256", backup.Checksum)
+	c.Data(http.StatusOK, "application/octet-stream", backup.MultiChanBackup)
+}
+
+func verifyBackupHandler(c *gin.Context, db *sqlx.DB) {
+	backupId, err := strconv.Atoi(c.Param("channelBackupId"))
+	if err != nil {
+		server_errors.SendBadRequest(c, "Channel backup id must be a number")
+		return
+	}
+	r, err := VerifyBackup(c.Request.Context(), db, backupId)
+	switch err.(type) {
+	case nil:
+		break
+	case ErrChannelBackupNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"Error": err.Error(), "Identifier": c.Param("channelBackupId")})
+		return
+	default:
+		server_errors.LogAndSendServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
@@ -34,6 +34,9 @@ type ChannelHistoryRecords struct {
 	CountTotal *uint64 `json:"count_total"`
 }
 
+// getChannelHistory returns the totals per day of the preferred time zone. Whole hours are read from the hourly
+// forward aggregate, the hours in which a local day starts from the forwards, so the daily totals are exact for
+// offsets like +05:30 as well.
 func getChannelHistory(db *sqlx.DB, chanIds []string, from time.Time,
 	to time.Time) (r []*ChannelHistoryRecords,
 	err error) {
@@ -56,27 +59,25 @@ func getChannelHistory(db *sqlx.DB, chanIds []string, from time.Time,
 			sum(coalesce(o.count,0)) as count_out,
 			sum(coalesce((coalesce(i.count,0) + coalesce(o.count,0)), 0)) as count_total
 		from settings, (
-			select time_bucket_gapfill('1 days', time::timestamp AT TIME ZONE (table tz), ?, ?) as date,
+			select time_bucket_gapfill('1 days', time AT TIME ZONE (table tz), ?::timestamp, ?::timestamp) as date,
 				   lnd_outgoing_short_channel_id lnd_short_channel_id,
 				   floor(sum(outgoing_amount_msat)/1000) as amount,
 				   floor(sum(fee_msat)/1000) as revenue,
-				   count(time) as count
-			from forward, settings
+				   sum(count) as count
+			from forwards_between((table fromDate)::timestamp AT TIME ZONE (table tz),
+				(table toDate)::timestamp AT TIME ZONE (table tz), (table tz), 'day')
 			where ((table allChannels)::boolean or lnd_outgoing_short_channel_id in (?))
-				and time::timestamp AT TIME ZONE (table tz) >= (table fromDate)::timestamp
-				and time::timestamp AT TIME ZONE (table tz) <= (table toDate)::timestamp
 			group by date, lnd_outgoing_short_channel_id
 			) as o
 		full outer join (
-			select time_bucket_gapfill('1 days', time::timestamp AT TIME ZONE (table tz), ?, ?) as date,
+			select time_bucket_gapfill('1 days', time AT TIME ZONE (table tz), ?::timestamp, ?::timestamp) as date,
 				   lnd_incoming_short_channel_id as lnd_short_channel_id,
 				   floor(sum(incoming_amount_msat)/1000) as amount,
 				   floor(sum(fee_msat)/1000) as revenue,
-				   count(time) as count
-			from forward, settings
+				   sum(count) as count
+			from forwards_between((table fromDate)::timestamp AT TIME ZONE (table tz),
+				(table toDate)::timestamp AT TIME ZONE (table tz), (table tz), 'day')
 			where ((table allChannels)::boolean or lnd_incoming_short_channel_id in (?))
-				and time::timestamp AT TIME ZONE (table tz) >= (table fromDate)::timestamp
-				and time::timestamp AT TIME ZONE (table tz) <= (table toDate)::timestamp
 			group by date, lnd_incoming_short_channel_id)  as i
 		on (i.lnd_short_channel_id = o.lnd_short_channel_id) and (i.date = o.date)
 		group by (coalesce(i.date, o.date)), (table tz)
@@ -0,0 +1,57 @@
+package channel_history
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lncapital/torq/testutil"
+)
+
+// The aggregated hours are UTC hours, in India a local day starts in the middle of one.
+func TestGetChannelHistoryHalfHourTimeZone(t *testing.T) {
+	srv, err := testutil.InitTestDBConn()
+	if err != nil {
+		panic(err)
+	}
+
+	db, err := srv.NewTestDatabase(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := srv.Cleanup(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	db.MustExec(`UPDATE settings SET preferred_timezone = 'Asia/Kolkata';`)
+	// 23:45 on October 10 and 00:15 on October 11 in India.
+	for _, fw := range []time.Time{
+		time.Date(2022, 10, 10, 18, 15, 0, 0, time.UTC),
+		time.Date(2022, 10, 10, 18, 45, 0, 0, time.UTC),
+	} {
+		db.MustExec(`
+			INSERT INTO forward (time, time_ns, fee_msat, lnd_incoming_short_channel_id, lnd_outgoing_short_channel_id,
+				incoming_short_channel_id, outgoing_short_channel_id, incoming_amount_msat, outgoing_amount_msat)
+			VALUES ($1, $2, 1000, 1, 2, '0x0x1', '0x0x2', 101000, 100000);`, fw, fw.UnixNano())
+	}
+	db.MustExec(`CALL refresh_continuous_aggregate('forward_hourly', NULL, NULL);`)
+
+	r, err := getChannelHistory(db, []string{"1"}, time.Date(2022, 10, 10, 0, 0, 0, 0, time.UTC),
+		time.Date(2022, 10, 12, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("getChannelHistory() error = %v", err)
+	}
+	ist := time.FixedZone("IST", 5*60*60+30*60)
+	got := make(map[string]uint64)
+	for _, record := range r {
+		if record.CountOut != nil && *record.CountOut != 0 {
+			got[record.Date.In(ist).Format("2006-01-02 15:04")] = *record.CountOut
+		}
+	}
+	want := map[string]uint64{"2022-10-10 00:00": 1, "2022-10-11 00:00": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getChannelHistory() outbound counts = %v, want %v", got, want)
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"gopkg.in/guregu/null.v4"
 )
 
-type channel struct {
+type Channel struct {
 	// Node Alias
 	Alias null.String `json:"alias"`
 	// Database primary key of channel
@@ -24,9 +24,12 @@ type channel struct {
 
 	// The channels total capacity (as created)
 	Capacity *uint64 `json:"capacity"`
+	// The local node the channel belongs to
+	LocalNodeId null.Int `json:"localNodeId"`
 }
 
-func getChannels(db *sqlx.DB, chanIds []string) (r []*channel, err error) {
+// GetChannels returns the details of the channels with the given LND short channel ids, "1" returns all channels.
+func GetChannels(db *sqlx.DB, chanIds []string) (r []*Channel, err error) {
 
 	sql := `
 		select ne.alias,
@@ -36,7 +39,8 @@ func getChannels(db *sqlx.DB, chanIds []string) (r []*channel, err error) {
 		       capacity,
 		       open,
 		       c.short_channel_id,
-		       channel_db_id
+		       channel_db_id,
+		       c.local_node_id
 		from (select
 				last(lnd_short_channel_id, time) as lnd_short_channel_id,
 				last(lnd_channel_point, time) as lnd_channel_point,
@@ -75,7 +79,7 @@ func getChannels(db *sqlx.DB, chanIds []string) (r []*channel, err error) {
 	}
 
 	for rows.Next() {
-		c := &channel{}
+		c := &Channel{}
 		err = rows.Scan(
 			&c.Alias,
 			&c.LNDShortChannelId,
@@ -85,6 +89,7 @@ func getChannels(db *sqlx.DB, chanIds []string) (r []*channel, err error) {
 			&c.Open,
 			&c.ShortChannelID,
 			&c.ChannelDBID,
+			&c.LocalNodeId,
 		)
 		if err != nil {
 			return r, err
@@ -25,22 +25,18 @@ func getChannelTotal(db *sqlx.DB, chanIds []string, from time.Time, to time.Time
 			select lnd_outgoing_short_channel_id,
 				   floor(sum(outgoing_amount_msat)/1000) as amount,
 				   floor(sum(fee_msat)/1000) as revenue,
-				   count(time) as count
-			from forward, settings
+				   sum(count) as count
+			from forwards_between(?::timestamp, ?::timestamp)
 			where (? or lnd_outgoing_short_channel_id in (?))
-			and time >= ?::timestamp
-			and time <= ?::timestamp
 			group by lnd_outgoing_short_channel_id
 			) as o
 		full outer join (
 			select lnd_incoming_short_channel_id,
 				   floor(sum(outgoing_amount_msat)/1000) as amount,
 				   floor(sum(fee_msat)/1000) as revenue,
-				   count(time) as count
-			from forward, settings
+				   sum(count) as count
+			from forwards_between(?::timestamp, ?::timestamp)
 			where (? or lnd_incoming_short_channel_id in (?))
-			and time >= ?::timestamp
-			and time <= ?::timestamp
 			group by lnd_incoming_short_channel_id
 			) as i
 		on (i.lnd_incoming_short_channel_id = o.lnd_outgoing_short_channel_id);
@@ -53,7 +49,7 @@ func getChannelTotal(db *sqlx.DB, chanIds []string, from time.Time, to time.Time
 		getAll = true
 	}
 
-	qs, args, err := sqlx.In(sql, getAll, chanIds, from, to, getAll, chanIds, from, to)
+	qs, args, err := sqlx.In(sql, from, to, getAll, chanIds, from, to, getAll, chanIds)
 	if err != nil {
 		return r, errors.Wrapf(err, "sqlx.In(%s, %v, %v, %v, %v, %v, %v)", sql, from, to, chanIds, from, to, chanIds)
 	}
@@ -3,6 +3,7 @@ package channel_history
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
+	"github.com/lncapital/torq/internal/tags"
 	"github.com/lncapital/torq/pkg/server_errors"
 	"net/http"
 	"strings"
@@ -49,7 +50,7 @@ type ChannelHistory struct {
 	ChannelBalances []*ChannelBalance `json:"channel_balance"`
 
 	// A list of channels included in this response
-	Channels []*channel               `json:"channels"`
+	Channels []*Channel               `json:"channels"`
 	History  []*ChannelHistoryRecords `json:"history"`
 	Events   []*ChannelEvent          `json:"events"`
 }
@@ -68,33 +69,64 @@ func getChannelHistoryHandler(c *gin.Context, db *sqlx.DB) {
 
 	chanIds := strings.Split(c.Param("chanIds"), ",")
 
-	// Get the total values for the whole requested time range (from - to)
-	r, err := getChannelTotal(db, chanIds, from, to)
+	// When a tag is given the history is for all channels the tag applies to.
+	tag := c.Query("tag")
+	if tag != "" {
+		chanIds, err = tags.GetTagChannelIds(db, tag)
+		switch err.(type) {
+		case nil:
+			break
+		case tags.ErrTagNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"Error": err.Error(), "Identifier": tag})
+			return
+		default:
+			server_errors.LogAndSendServerError(c, err)
+			return
+		}
+		if len(chanIds) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "No channels found for tag", "Identifier": tag})
+			return
+		}
+	}
+
+	r, err := QueryChannelHistory(db, chanIds, from, to)
 	if err != nil {
 		server_errors.LogAndSendServerError(c, err)
 		return
 	}
+	if tag != "" {
+		r.Label = tag
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+// QueryChannelHistory returns the totals, daily history, events, costs and balances of the given channels
+// for the date range. Use "1" as the only channel id to get the history of all channels.
+func QueryChannelHistory(db *sqlx.DB, chanIds []string, from time.Time, to time.Time) (r ChannelHistory, err error) {
+	// Get the total values for the whole requested time range (from - to)
+	r, err = getChannelTotal(db, chanIds, from, to)
+	if err != nil {
+		return ChannelHistory{}, err
+	}
 
 	// Get the details for the requested channels
-	channels, err := getChannels(db, chanIds)
+	channels, err := GetChannels(db, chanIds)
 	if err != nil {
-		server_errors.LogAndSendServerError(c, err)
-		return
+		return ChannelHistory{}, err
 	}
 	r.Channels = channels
 
 	// Get the daily values
 	chanHistory, err := getChannelHistory(db, chanIds, from, to)
 	if err != nil {
-		server_errors.LogAndSendServerError(c, err)
-		return
+		return ChannelHistory{}, err
 	}
 	r.History = chanHistory
 
 	chanEventHistory, err := getChannelEventHistory(db, chanIds, from, to)
 	if err != nil {
-		server_errors.LogAndSendServerError(c, err)
-		return
+		return ChannelHistory{}, err
 	}
 	r.Events = chanEventHistory
 
@@ -104,8 +136,7 @@ func getChannelHistoryHandler(c *gin.Context, db *sqlx.DB) {
 		r.OnChainCost, err = getChannelOnChainCost(db, chanIds)
 	}
 	if err != nil {
-		server_errors.LogAndSendServerError(c, err)
-		return
+		return ChannelHistory{}, err
 	}
 
 	if chanIds[0] == "1" {
@@ -113,8 +144,7 @@ func getChannelHistoryHandler(c *gin.Context, db *sqlx.DB) {
 		r.RebalancingCost = &reb.TotalCostMsat
 		r.RebalancingDetails = reb
 		if err != nil {
-			server_errors.LogAndSendServerError(c, err)
-			return
+			return ChannelHistory{}, err
 		}
 	} else {
 		r.OnChainCost, err = getChannelOnChainCost(db, chanIds)
@@ -122,8 +152,7 @@ func getChannelHistoryHandler(c *gin.Context, db *sqlx.DB) {
 		r.RebalancingCost = &reb.SplitCostMsat
 		r.RebalancingDetails = reb
 		if err != nil {
-			server_errors.LogAndSendServerError(c, err)
-			return
+			return ChannelHistory{}, err
 		}
 	}
 
@@ -132,8 +161,7 @@ func getChannelHistoryHandler(c *gin.Context, db *sqlx.DB) {
 		for _, chanId := range chanIds {
 			cb, err := getChannelBalance(db, string(chanId), from, to)
 			if err != nil {
-				server_errors.LogAndSendServerError(c, err)
-				return
+				return ChannelHistory{}, err
 			}
 
 			if len(r.ChannelBalances) == 0 {
@@ -146,5 +174,5 @@ func getChannelHistoryHandler(c *gin.Context, db *sqlx.DB) {
 
 	}
 
-	c.JSON(http.StatusOK, r)
+	return r, nil
 }
@@ -28,11 +28,13 @@ func getTotalOnChainCost(db *sqlx.DB, from time.Time, to time.Time) (*uint64, er
 
 func getChannelOnChainCost(db *sqlx.DB, chanIds []string) (cost *uint64, err error) {
 
+	// Transactions are matched by their category, LND's labels only cover the transactions it created itself.
 	q := `select coalesce(sum(total_fees), 0) as on_chain_cost
 		from tx
-		where split_part(label, '-', 2) in (?)`
+		where split_part(label, '-', 2) in (?)
+			or tx_hash in (select tx_hash from tx_category where lnd_short_channel_ids && array[?]::text[])`
 
-	qs, args, err := sqlx.In(q, chanIds)
+	qs, args, err := sqlx.In(q, chanIds, chanIds)
 	if err != nil {
 		return nil, errors.Wrapf(err, "sqlx.In(%s, %v)", q, chanIds)
 	}
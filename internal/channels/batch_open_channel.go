@@ -17,6 +17,10 @@ func batchOpenChannels(db *sqlx.DB, req BatchOpenRequest) (r BatchOpenResponse,
 		return BatchOpenResponse{}, err
 	}
 
+	if err = settings.CheckNodePermission(db, req.NodeId, settings.ActionOpenChannel); err != nil {
+		return BatchOpenResponse{}, err
+	}
+
 	connectionDetails, err := settings.GetNodeConnectionDetailsById(db, req.NodeId)
 	if err != nil {
 		return BatchOpenResponse{}, errors.Wrap(err, "Getting node connection details from the db")
@@ -44,7 +44,14 @@ type CloseChannelResponse struct {
 	ChanClose    channelCloseUpdate `json:"chanClose"`
 }
 
-func CloseChannel(wChan chan interface{}, db *sqlx.DB, c *gin.Context, ccReq CloseChannelRequest, reqId string) (err error) {
+// CloseChannel closes the channel and writes the status updates to wChan until the channel is closed or ctx is
+// canceled. Canceling ctx only stops the updates, LND continues closing the channel.
+func CloseChannel(ctx context.Context, wChan chan interface{}, db *sqlx.DB, c *gin.Context, ccReq CloseChannelRequest,
+	reqId string) (err error) {
+	if err = settings.CheckNodePermission(db, ccReq.NodeId, settings.ActionCloseChannel); err != nil {
+		return err
+	}
+
 	connectionDetails, err := settings.GetNodeConnectionDetailsById(db, ccReq.NodeId)
 	if err != nil {
 		return errors.New("Getting node connection details from the db")
@@ -65,7 +72,7 @@ func CloseChannel(wChan chan interface{}, db *sqlx.DB, c *gin.Context, ccReq Clo
 		return errors.Wrap(err, "Preparing close request")
 	}
 
-	return closeChannelResp(client, &closeChanReq, wChan, reqId)
+	return closeChannelResp(ctx, client, &closeChanReq, wChan, reqId)
 }
 
 func prepareCloseRequest(ccReq CloseChannelRequest) (r lnrpc.CloseChannelRequest, err error) {
@@ -107,9 +114,9 @@ func prepareCloseRequest(ccReq CloseChannelRequest) (r lnrpc.CloseChannelRequest
 	return closeChanReq, nil
 }
 
-func closeChannelResp(client lndClientCloseChannel, closeChanReq *lnrpc.CloseChannelRequest, wChan chan interface{}, reqId string) error {
+func closeChannelResp(ctx context.Context, client lndClientCloseChannel, closeChanReq *lnrpc.CloseChannelRequest,
+	wChan chan interface{}, reqId string) error {
 
-	ctx := context.Background()
 	closeChanRes, err := client.CloseChannel(ctx, closeChanReq)
 	if err != nil {
 		return errors.Wrap(err, "Closing channel")
@@ -128,6 +135,9 @@ func closeChannelResp(client lndClientCloseChannel, closeChanReq *lnrpc.CloseCha
 			//log.Debug().Msgf("Close channel EOF")
 			return nil
 		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if err != nil {
 			return errors.Wrap(err, "Close channel request receive")
 		}
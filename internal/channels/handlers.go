@@ -8,7 +8,7 @@ import (
 	"net/http"
 )
 
-type failedUpdate struct {
+type FailedUpdate struct {
 	OutPoint struct {
 		Txid    string
 		OutIndx uint32
@@ -17,12 +17,15 @@ type failedUpdate struct {
 	UpdateError string
 }
 
-type updateResponse struct {
+type UpdateResponse struct {
 	Status        string         `json:"status"`
-	FailedUpdates []failedUpdate `json:"failedUpdates"`
+	FailedUpdates []FailedUpdate `json:"failedUpdates"`
 }
 
-type updateChanRequestBody struct {
+// UpdateChanRequestBody updates the policy of a channel, or of all channels of the node when ChannelPoint is not set.
+// For a single channel the fee rate, base fee and time lock delta that aren't set (0 for TimeLockDelta) keep their
+// current value.
+type UpdateChanRequestBody struct {
 	NodeId        int     `json:"nodeId"`
 	ChannelPoint  *string `json:"channelPoint"`
 	FeeRatePpm    *uint32 `json:"feeRatePpm"`
@@ -36,7 +39,7 @@ type pendingChannel struct {
 }
 
 func updateChannelsHandler(c *gin.Context, db *sqlx.DB) {
-	requestBody := updateChanRequestBody{}
+	requestBody := UpdateChanRequestBody{}
 
 	if err := c.BindJSON(&requestBody); err != nil {
 		log.Error().Msgf("JSON binding the request body")
@@ -45,7 +48,7 @@ func updateChannelsHandler(c *gin.Context, db *sqlx.DB) {
 	}
 	//log.Debug().Msgf("Received request body: %v", requestBody)
 
-	response, err := updateChannels(db, requestBody)
+	response, err := UpdateChannels(db, requestBody)
 	if err != nil {
 		server_errors.WrapLogAndSendServerError(c, err, "Update channel/s policy")
 		return
@@ -8,6 +8,8 @@ import (
 	"github.com/cockroachdb/errors"
 	"github.com/jmoiron/sqlx"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/walletrpc"
+	"github.com/lncapital/torq/internal/on_chain_tx"
 	"github.com/lncapital/torq/internal/settings"
 	"github.com/lncapital/torq/pkg/lnd_connect"
 	"github.com/rs/zerolog/log"
@@ -27,6 +29,8 @@ type OpenChannelRequest struct {
 	MinConfs           *int32  `json:"minConfs"`
 	SpendUnconfirmed   *bool   `json:"spendUnconfirmed"`
 	CloseAddress       *string `json:"closeAddress"`
+	// Outpoints are the only outputs LND may fund the channel with, formatted as txid:index.
+	Outpoints []string `json:"outpoints"`
 }
 
 type OpenChannelResponse struct {
@@ -42,7 +46,10 @@ type PsbtDetails struct {
 	Psbt           []byte `json:"psbt,omitempty"`
 }
 
-func OpenChannel(db *sqlx.DB, wChan chan interface{}, req OpenChannelRequest, reqId string) (err error) {
+// OpenChannel opens the channel and writes the status updates to wChan until the channel is open or ctx is
+// canceled. Canceling ctx only stops the updates, LND continues opening the channel.
+func OpenChannel(ctx context.Context, db *sqlx.DB, wChan chan interface{}, req OpenChannelRequest,
+	reqId string) (err error) {
 	// TODO: Add support for batch opening channels
 
 	openChanReq, err := prepareOpenRequest(req)
@@ -50,6 +57,10 @@ func OpenChannel(db *sqlx.DB, wChan chan interface{}, req OpenChannelRequest, re
 		return errors.Wrap(err, "Preparing open request")
 	}
 
+	if err = settings.CheckNodePermission(db, req.NodeId, settings.ActionOpenChannel); err != nil {
+		return err
+	}
+
 	connectionDetails, err := settings.GetNodeConnectionDetailsById(db, req.NodeId)
 	if err != nil {
 		return errors.Wrap(err, "Getting node connection details from the db")
@@ -66,7 +77,15 @@ func OpenChannel(db *sqlx.DB, wChan chan interface{}, req OpenChannelRequest, re
 
 	client := lnrpc.NewLightningClient(conn)
 
-	ctx := context.Background()
+	// LND selects the funding inputs before the channel is pending, the other outputs are released after that.
+	release := func() {}
+	if len(req.Outpoints) != 0 {
+		release, err = on_chain_tx.LeaseOtherUtxos(ctx, walletrpc.NewWalletKitClient(conn), req.Outpoints)
+		if err != nil {
+			return errors.Wrap(err, "Selecting outpoints")
+		}
+	}
+	defer release()
 
 	//Send open channel request
 	openChanRes, err := client.OpenChannel(ctx, &openChanReq)
@@ -87,12 +106,17 @@ func OpenChannel(db *sqlx.DB, wChan chan interface{}, req OpenChannelRequest, re
 		}
 
 		resp, err := openChanRes.Recv()
+		release()
 
 		if err == io.EOF {
 			//log.Info().Msgf("Open channel EOF")
 			return nil
 		}
 
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
 		if err != nil {
 			log.Error().Msgf("could not open channel: %v", err)
 			wChan <- errors.Newf("could not open channel: %v", err)
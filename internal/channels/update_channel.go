@@ -8,23 +8,35 @@ import (
 	"github.com/lncapital/torq/internal/settings"
 	"github.com/lncapital/torq/pkg/lnd_connect"
 	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
 	"strconv"
 	"strings"
 )
 
+type lndClientChannelPolicy interface {
+	GetInfo(ctx context.Context, in *lnrpc.GetInfoRequest, opts ...grpc.CallOption) (*lnrpc.GetInfoResponse, error)
+	ListChannels(ctx context.Context, in *lnrpc.ListChannelsRequest,
+		opts ...grpc.CallOption) (*lnrpc.ListChannelsResponse, error)
+	GetChanInfo(ctx context.Context, in *lnrpc.ChanInfoRequest, opts ...grpc.CallOption) (*lnrpc.ChannelEdge, error)
+}
+
 //UpdateChannel
 //Returns status, failed updates array
-func updateChannels(db *sqlx.DB, req updateChanRequestBody) (r updateResponse, err error) {
+func UpdateChannels(db *sqlx.DB, req UpdateChanRequestBody) (r UpdateResponse, err error) {
 
 	policyReq, err := createPolicyRequest(req)
 	if err != nil {
-		return updateResponse{}, errors.Wrap(err, "Create policy request")
+		return UpdateResponse{}, errors.Wrap(err, "Create policy request")
+	}
+
+	if err = settings.CheckNodePermission(db, req.NodeId, settings.ActionUpdateChannel); err != nil {
+		return UpdateResponse{}, err
 	}
 
 	connectionDetails, err := settings.GetNodeConnectionDetailsById(db, req.NodeId)
 
 	if err != nil {
-		return updateResponse{}, errors.Wrap(err, "Getting node connection details from the db")
+		return UpdateResponse{}, errors.Wrap(err, "Getting node connection details from the db")
 	}
 
 	conn, err := lnd_connect.Connect(
@@ -32,7 +44,7 @@ func updateChannels(db *sqlx.DB, req updateChanRequestBody) (r updateResponse, e
 		connectionDetails.TLSFileBytes,
 		connectionDetails.MacaroonFileBytes)
 	if err != nil {
-		return updateResponse{}, errors.Wrap(err, "Getting node connection details from the db")
+		return UpdateResponse{}, errors.Wrap(err, "Getting node connection details from the db")
 	}
 
 	defer conn.Close()
@@ -40,9 +52,13 @@ func updateChannels(db *sqlx.DB, req updateChanRequestBody) (r updateResponse, e
 	ctx := context.Background()
 	client := lnrpc.NewLightningClient(conn)
 
+	if err = keepCurrentPolicy(ctx, client, req, &policyReq); err != nil {
+		return UpdateResponse{}, err
+	}
+
 	resp, err := client.UpdateChannelPolicy(ctx, &policyReq)
 	if err != nil {
-		return updateResponse{}, errors.Wrap(err, "Updating channel policy")
+		return UpdateResponse{}, errors.Wrap(err, "Updating channel policy")
 	}
 
 	r = processUpdateResponse(resp)
@@ -50,7 +66,7 @@ func updateChannels(db *sqlx.DB, req updateChanRequestBody) (r updateResponse, e
 	return r, nil
 }
 
-func createPolicyRequest(req updateChanRequestBody) (r lnrpc.PolicyUpdateRequest, err error) {
+func createPolicyRequest(req UpdateChanRequestBody) (r lnrpc.PolicyUpdateRequest, err error) {
 
 	updChanReq := lnrpc.PolicyUpdateRequest{}
 
@@ -93,6 +109,58 @@ func createPolicyRequest(req updateChanRequestBody) (r lnrpc.PolicyUpdateRequest
 	return updChanReq, nil
 }
 
+// keepCurrentPolicy sets the fee rate, base fee and time lock delta the request leaves out to the current policy of
+// the channel. LND replaces the whole policy, without this setting only the fee rate would reset the others.
+func keepCurrentPolicy(ctx context.Context, client lndClientChannelPolicy, req UpdateChanRequestBody,
+	policyReq *lnrpc.PolicyUpdateRequest) error {
+
+	if req.ChannelPoint == nil || (req.FeeRatePpm != nil && req.BaseFeeMsat != nil && req.TimeLockDelta != 0) {
+		return nil
+	}
+
+	info, err := client.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+	if err != nil {
+		return errors.Wrap(err, "Getting node info")
+	}
+	chans, err := client.ListChannels(ctx, &lnrpc.ListChannelsRequest{})
+	if err != nil {
+		return errors.Wrap(err, "Listing channels")
+	}
+	var chanId uint64
+	for _, c := range chans.Channels {
+		if c.ChannelPoint == *req.ChannelPoint {
+			chanId = c.ChanId
+			break
+		}
+	}
+	if chanId == 0 {
+		return errors.Newf("No open channel found for %s", *req.ChannelPoint)
+	}
+
+	edge, err := client.GetChanInfo(ctx, &lnrpc.ChanInfoRequest{ChanId: chanId})
+	if err != nil {
+		return errors.Wrap(err, "Getting channel info")
+	}
+	policy := edge.Node2Policy
+	if edge.Node1Pub == info.IdentityPubkey {
+		policy = edge.Node1Policy
+	}
+	if policy == nil {
+		return errors.Newf("No policy found for %s", *req.ChannelPoint)
+	}
+
+	if req.FeeRatePpm == nil {
+		policyReq.FeeRatePpm = uint32(policy.FeeRateMilliMsat)
+	}
+	if req.BaseFeeMsat == nil {
+		policyReq.BaseFeeMsat = policy.FeeBaseMsat
+	}
+	if req.TimeLockDelta == 0 {
+		policyReq.TimeLockDelta = policy.TimeLockDelta
+	}
+	return nil
+}
+
 //processChannelPoint
 //Split received channel point string into fundingtxid and outputindex
 //Build PolicyUpdateRequest_ChanPoint: ChannelPoint_FundingTxidStr, ChannelPoint,
@@ -124,13 +192,13 @@ func processChannelPoint(chanPoint string) (cp *lnrpc.PolicyUpdateRequest_ChanPo
 	return cp, nil
 }
 
-func processUpdateResponse(resp *lnrpc.PolicyUpdateResponse) (r updateResponse) {
-	var failedUpdSlice []failedUpdate
+func processUpdateResponse(resp *lnrpc.PolicyUpdateResponse) (r UpdateResponse) {
+	var failedUpdSlice []FailedUpdate
 	//log.Debug().Msgf("There are failed updates")
 	if len(resp.GetFailedUpdates()) > 0 {
 		for _, failUpdate := range resp.GetFailedUpdates() {
 			//log.Debug().Msgf("txid byte: %v", failUpdate.Outpoint.TxidBytes)
-			failedUpd := failedUpdate{}
+			failedUpd := FailedUpdate{}
 			failedUpd.Reason = failUpdate.UpdateError
 			failedUpd.UpdateError = failUpdate.UpdateError
 			failedUpd.OutPoint.OutIndx = failUpdate.Outpoint.OutputIndex
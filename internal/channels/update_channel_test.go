@@ -1,7 +1,10 @@
 package channels
 
 import (
+	"context"
+	"github.com/cockroachdb/errors"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"google.golang.org/grpc"
 	"reflect"
 	"testing"
 )
@@ -68,13 +71,13 @@ func Test_createPolicyRequest(t *testing.T) {
 
 	tests := []struct {
 		name    string
-		input   updateChanRequestBody
+		input   UpdateChanRequestBody
 		want    lnrpc.PolicyUpdateRequest
 		wantErr bool
 	}{
 		{
 			"Missing node Id",
-			updateChanRequestBody{
+			UpdateChanRequestBody{
 				NodeId:        1,
 				ChannelPoint:  noChanPoint,
 				TimeLockDelta: 18,
@@ -87,7 +90,7 @@ func Test_createPolicyRequest(t *testing.T) {
 		},
 		{
 			"Channel point not provided - update all",
-			updateChanRequestBody{
+			UpdateChanRequestBody{
 				NodeId:        1,
 				ChannelPoint:  noChanPoint,
 				TimeLockDelta: 18,
@@ -100,7 +103,7 @@ func Test_createPolicyRequest(t *testing.T) {
 		},
 		{
 			"Channel point provided - update one",
-			updateChanRequestBody{
+			UpdateChanRequestBody{
 				NodeId:        1,
 				ChannelPoint:  &chanPoint,
 				TimeLockDelta: 18,
@@ -120,7 +123,7 @@ func Test_createPolicyRequest(t *testing.T) {
 		},
 		{
 			"TimeLockDelta < 18",
-			updateChanRequestBody{
+			UpdateChanRequestBody{
 				NodeId:        1,
 				ChannelPoint:  noChanPoint,
 				TimeLockDelta: 0,
@@ -133,7 +136,7 @@ func Test_createPolicyRequest(t *testing.T) {
 		},
 		{
 			"All params provided",
-			updateChanRequestBody{
+			UpdateChanRequestBody{
 				NodeId:        1,
 				ChannelPoint:  &chanPoint,
 				FeeRatePpm:    &feeRatePpm,
@@ -178,10 +181,10 @@ func Test_createPolicyRequest(t *testing.T) {
 }
 
 func Test_processUpdateResponse(t *testing.T) {
-	var noFailedUpdSlice []failedUpdate
+	var noFailedUpdSlice []FailedUpdate
 	txidByte := []byte{206, 199, 33, 7, 91, 12, 79, 57, 217, 192, 219, 244, 131, 232, 102, 160, 188,
 		3, 67, 142, 26, 122, 16, 45, 156, 23, 62, 240, 213, 240, 59, 228}
-	failedUpdSlice := []failedUpdate{
+	failedUpdSlice := []FailedUpdate{
 		{
 			OutPoint: struct {
 				Txid    string
@@ -195,12 +198,12 @@ func Test_processUpdateResponse(t *testing.T) {
 	tests := []struct {
 		name  string
 		input *lnrpc.PolicyUpdateResponse
-		want  updateResponse
+		want  UpdateResponse
 	}{
 		{
 			"Update succeeded",
 			&lnrpc.PolicyUpdateResponse{FailedUpdates: []*lnrpc.FailedUpdate{}},
-			updateResponse{
+			UpdateResponse{
 				Status:        "Channel/s updated",
 				FailedUpdates: noFailedUpdSlice,
 			},
@@ -216,7 +219,7 @@ func Test_processUpdateResponse(t *testing.T) {
 				Reason:      2,
 				UpdateError: "not found",
 			}}},
-			updateResponse{
+			UpdateResponse{
 				Status:        "Channel/s update failed",
 				FailedUpdates: failedUpdSlice,
 			},
@@ -232,3 +235,100 @@ func Test_processUpdateResponse(t *testing.T) {
 		})
 	}
 }
+
+type mockLndClientChannelPolicy struct {
+	pubKey   string
+	channels []*lnrpc.Channel
+	edge     *lnrpc.ChannelEdge
+}
+
+func (c *mockLndClientChannelPolicy) GetInfo(ctx context.Context, in *lnrpc.GetInfoRequest,
+	opts ...grpc.CallOption) (*lnrpc.GetInfoResponse, error) {
+	return &lnrpc.GetInfoResponse{IdentityPubkey: c.pubKey}, nil
+}
+
+func (c *mockLndClientChannelPolicy) ListChannels(ctx context.Context, in *lnrpc.ListChannelsRequest,
+	opts ...grpc.CallOption) (*lnrpc.ListChannelsResponse, error) {
+	return &lnrpc.ListChannelsResponse{Channels: c.channels}, nil
+}
+
+func (c *mockLndClientChannelPolicy) GetChanInfo(ctx context.Context, in *lnrpc.ChanInfoRequest,
+	opts ...grpc.CallOption) (*lnrpc.ChannelEdge, error) {
+	if in.ChanId != c.edge.ChannelId {
+		return nil, errors.New("edge not found")
+	}
+	return c.edge, nil
+}
+
+func Test_keepCurrentPolicy(t *testing.T) {
+	chanPoint := "e43bf0d5f03e179c2d107a1a8e4303bca066e883f4dbc0d9394f0c5b0721c7ce:0"
+	otherChanPoint := "e43bf0d5f03e179c2d107a1a8e4303bca066e883f4dbc0d9394f0c5b0721c7ce:1"
+	var feeRatePpm uint32 = 11
+	var baseFeeMsat int64 = 12
+
+	client := &mockLndClientChannelPolicy{
+		pubKey:   "local",
+		channels: []*lnrpc.Channel{{ChannelPoint: chanPoint, ChanId: 5}},
+		edge: &lnrpc.ChannelEdge{
+			ChannelId:   5,
+			Node1Pub:    "remote",
+			Node2Pub:    "local",
+			Node1Policy: &lnrpc.RoutingPolicy{FeeRateMilliMsat: 1, FeeBaseMsat: 2, TimeLockDelta: 3},
+			Node2Policy: &lnrpc.RoutingPolicy{FeeRateMilliMsat: 100, FeeBaseMsat: 1000, TimeLockDelta: 40},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		input   UpdateChanRequestBody
+		want    lnrpc.PolicyUpdateRequest
+		wantErr bool
+	}{
+		{
+			"Only the fee rate",
+			UpdateChanRequestBody{NodeId: 1, ChannelPoint: &chanPoint, FeeRatePpm: &feeRatePpm},
+			lnrpc.PolicyUpdateRequest{FeeRatePpm: 11, BaseFeeMsat: 1000, TimeLockDelta: 40},
+			false,
+		},
+		{
+			"Only the base fee and time lock delta",
+			UpdateChanRequestBody{NodeId: 1, ChannelPoint: &chanPoint, BaseFeeMsat: &baseFeeMsat, TimeLockDelta: 50},
+			lnrpc.PolicyUpdateRequest{FeeRatePpm: 100, BaseFeeMsat: 12, TimeLockDelta: 50},
+			false,
+		},
+		{
+			"All channels aren't read",
+			UpdateChanRequestBody{NodeId: 1, FeeRatePpm: &feeRatePpm},
+			lnrpc.PolicyUpdateRequest{FeeRatePpm: 11, TimeLockDelta: 18},
+			false,
+		},
+		{
+			"Unknown channel",
+			UpdateChanRequestBody{NodeId: 1, ChannelPoint: &otherChanPoint, FeeRatePpm: &feeRatePpm},
+			lnrpc.PolicyUpdateRequest{},
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policyReq, err := createPolicyRequest(test.input)
+			if err != nil {
+				t.Fatalf("createPolicyRequest error: %v", err)
+			}
+			err = keepCurrentPolicy(context.Background(), client, test.input, &policyReq)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("keepCurrentPolicy() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if policyReq.FeeRatePpm != test.want.FeeRatePpm || policyReq.BaseFeeMsat != test.want.BaseFeeMsat ||
+				policyReq.TimeLockDelta != test.want.TimeLockDelta {
+				t.Errorf("keepCurrentPolicy() got fee rate %d, base fee %d, time lock delta %d, want %d, %d, %d",
+					policyReq.FeeRatePpm, policyReq.BaseFeeMsat, policyReq.TimeLockDelta,
+					test.want.FeeRatePpm, test.want.BaseFeeMsat, test.want.TimeLockDelta)
+			}
+		})
+	}
+}
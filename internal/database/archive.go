@@ -0,0 +1,695 @@
+package database
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/cockroachdb/errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/scrypt"
+	"io"
+	"strings"
+	"time"
+)
+
+// archiveFormatVersion is the version of the archive layout. It changes when the layout changes, not when the
+// schema changes, the schema is covered by the migration version in the manifest.
+const archiveFormatVersion = 1
+
+const (
+	manifestFileName = "manifest.json"
+	// importBatchSize is the number of rows inserted per statement on import.
+	importBatchSize = 1000
+	encryptedPrefix = "enc:"
+)
+
+// configTables are the tables always exported, in an order that satisfies their foreign keys.
+var configTables = []string{"settings", "local_node", "table_view", "tag", "channel", "tagged_entity",
+	"retention_policy"}
+
+// timeSeriesTables are the tables only exported on request. They can be large.
+var timeSeriesTables = []string{"channel_event", "routing_policy", "node_event", "forward", "htlc_event",
+	"htlc_event_daily", "tx", "invoice", "payment"}
+
+// credentialColumns are the columns encrypted when the archive is exported with a passphrase.
+var credentialColumns = map[string][]string{
+	"local_node": {"tls_data", "macaroon_data"},
+}
+
+type ArchiveManifest struct {
+	FormatVersion    int                `json:"formatVersion"`
+	TorqVersion      string             `json:"torqVersion"`
+	MigrationVersion uint               `json:"migrationVersion"`
+	CreatedOn        time.Time          `json:"createdOn"`
+	TimeSeries       bool               `json:"timeSeries"`
+	Encryption       *archiveEncryption `json:"encryption"`
+	Tables           []ArchiveTable     `json:"tables"`
+}
+
+type ArchiveTable struct {
+	Name string `json:"name"`
+	Rows int    `json:"rows"`
+}
+
+type archiveEncryption struct {
+	Kdf    string `json:"kdf"`
+	Cipher string `json:"cipher"`
+	Salt   []byte `json:"salt"`
+	// Check is a known value encrypted with the key, to tell a wrong passphrase apart from a damaged archive.
+	Check string `json:"check"`
+}
+
+type ExportOptions struct {
+	TorqVersion string
+	TimeSeries  bool
+	// Passphrase encrypts the TLS certificates and macaroons of the local nodes when set.
+	Passphrase string
+}
+
+type ImportOptions struct {
+	Passphrase string
+}
+
+const encryptionCheck = "torq"
+
+type archiveCipher struct {
+	aead cipher.AEAD
+}
+
+func newArchiveCipher(passphrase string, salt []byte) (*archiveCipher, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "Deriving key")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "Creating cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "Creating cipher")
+	}
+	return &archiveCipher{aead: aead}, nil
+}
+
+func (c *archiveCipher) encrypt(plaintext []byte) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err, "Generating nonce")
+	}
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(c.aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+func (c *archiveCipher) decrypt(s string) ([]byte, error) {
+	if !strings.HasPrefix(s, encryptedPrefix) {
+		return nil, errors.New("Value is not encrypted")
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, encryptedPrefix))
+	if err != nil {
+		return nil, errors.Wrap(err, "Decoding encrypted value")
+	}
+	if len(b) < c.aead.NonceSize() {
+		return nil, errors.New("Encrypted value is too short")
+	}
+	plaintext, err := c.aead.Open(nil, b[:c.aead.NonceSize()], b[c.aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Decrypting value")
+	}
+	return plaintext, nil
+}
+
+// transformColumns replaces the given string columns of a JSON row with the result of f. Null values are kept.
+func transformColumns(row []byte, columns []string, f func(string) (string, error)) ([]byte, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(row, &m); err != nil {
+		return nil, errors.Wrap(err, "Decoding row")
+	}
+	for _, column := range columns {
+		raw, ok := m[column]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, errors.Wrapf(err, "Decoding column %s", column)
+		}
+		s, err := f(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Column %s", column)
+		}
+		if m[column], err = json.Marshal(s); err != nil {
+			return nil, errors.Wrapf(err, "Encoding column %s", column)
+		}
+	}
+	return json.Marshal(m)
+}
+
+// ExportArchive writes the Torq tables to w as a zip archive. Every table is stored as a file of JSON rows, one row
+// per line, next to a manifest with the migration version the rows belong to.
+func ExportArchive(db *sqlx.DB, w io.Writer, opts ExportOptions) (ArchiveManifest, error) {
+	version, dirty, err := MigrationVersion(db)
+	if err != nil {
+		return ArchiveManifest{}, err
+	}
+	if dirty {
+		return ArchiveManifest{}, errors.Newf("Database migration version %d is dirty", version)
+	}
+
+	manifest := ArchiveManifest{
+		FormatVersion:    archiveFormatVersion,
+		TorqVersion:      opts.TorqVersion,
+		MigrationVersion: version,
+		CreatedOn:        time.Now().UTC(),
+		TimeSeries:       opts.TimeSeries,
+	}
+
+	var c *archiveCipher
+	if opts.Passphrase != "" {
+		salt := make([]byte, 16)
+		if _, err = rand.Read(salt); err != nil {
+			return manifest, errors.Wrap(err, "Generating salt")
+		}
+		if c, err = newArchiveCipher(opts.Passphrase, salt); err != nil {
+			return manifest, err
+		}
+		check, err := c.encrypt([]byte(encryptionCheck))
+		if err != nil {
+			return manifest, err
+		}
+		manifest.Encryption = &archiveEncryption{Kdf: "scrypt", Cipher: "aes-256-gcm", Salt: salt, Check: check}
+	}
+
+	tables := configTables
+	if opts.TimeSeries {
+		tables = append(append([]string{}, configTables...), timeSeriesTables...)
+	}
+
+	// Export all tables from the same snapshot.
+	tx, err := db.BeginTxx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return manifest, errors.Wrap(err, "Unable to start transaction")
+	}
+	defer tx.Rollback()
+
+	zw := zip.NewWriter(w)
+	for _, table := range tables {
+		f, err := zw.Create(table + ".jsonl")
+		if err != nil {
+			return manifest, errors.Wrapf(err, "Creating archive file of %s", table)
+		}
+		rows, err := exportTable(tx, table, f, c)
+		if err != nil {
+			return manifest, errors.Wrapf(err, "Exporting %s", table)
+		}
+		manifest.Tables = append(manifest.Tables, ArchiveTable{Name: table, Rows: rows})
+	}
+
+	f, err := zw.Create(manifestFileName)
+	if err != nil {
+		return manifest, errors.Wrap(err, "Creating archive manifest")
+	}
+	if err = json.NewEncoder(f).Encode(manifest); err != nil {
+		return manifest, errors.Wrap(err, "Writing archive manifest")
+	}
+	if err = zw.Close(); err != nil {
+		return manifest, errors.Wrap(err, "Closing archive")
+	}
+	return manifest, nil
+}
+
+func exportTable(tx *sqlx.Tx, table string, w io.Writer, c *archiveCipher) (int, error) {
+	rows, err := tx.Query(`SELECT row_to_json(t)::text FROM ` + pq.QuoteIdentifier(table) + ` t;`)
+	if err != nil {
+		return 0, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var row []byte
+		if err = rows.Scan(&row); err != nil {
+			return count, errors.Wrap(err, "Unable to scan SQL row")
+		}
+		if columns, ok := credentialColumns[table]; ok && c != nil {
+			row, err = transformColumns(row, columns, func(s string) (string, error) {
+				return c.encrypt([]byte(s))
+			})
+			if err != nil {
+				return count, err
+			}
+		}
+		if _, err = w.Write(append(row, '\n')); err != nil {
+			return count, errors.Wrap(err, "Writing row")
+		}
+		count++
+	}
+	return count, rows.Err()
+}
+
+func readManifest(zr *zip.Reader) (manifest ArchiveManifest, err error) {
+	f, err := zr.Open(manifestFileName)
+	if err != nil {
+		return manifest, errors.Wrap(err, "Archive has no manifest")
+	}
+	defer f.Close()
+	if err = json.NewDecoder(f).Decode(&manifest); err != nil {
+		return manifest, errors.Wrap(err, "Reading archive manifest")
+	}
+	if manifest.FormatVersion != archiveFormatVersion {
+		return manifest, errors.Newf("Archive format version %d is not supported", manifest.FormatVersion)
+	}
+	return manifest, nil
+}
+
+// ImportArchive restores an archive written by ExportArchive. A database at an older migration version is migrated
+// to the version of the archive first, a newer database is refused. Importing the same archive again changes
+// nothing: rows are matched on their primary key or unique constraints, and tables without either are only
+// imported when they are empty. A row matching an existing row on a unique constraint, e.g. a tag with the same
+// name, takes the id of the existing row, and the references of later tables to it are rewritten.
+func ImportArchive(db *sqlx.DB, r io.ReaderAt, size int64, opts ImportOptions) (ArchiveManifest, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return ArchiveManifest{}, errors.Wrap(err, "Opening archive")
+	}
+	manifest, err := readManifest(zr)
+	if err != nil {
+		return manifest, err
+	}
+
+	var c *archiveCipher
+	if manifest.Encryption != nil {
+		if opts.Passphrase == "" {
+			return manifest, errors.New("Archive is encrypted, a passphrase is required")
+		}
+		if c, err = newArchiveCipher(opts.Passphrase, manifest.Encryption.Salt); err != nil {
+			return manifest, err
+		}
+		if check, err := c.decrypt(manifest.Encryption.Check); err != nil || string(check) != encryptionCheck {
+			return manifest, errors.New("Wrong passphrase")
+		}
+	}
+
+	version, dirty, err := MigrationVersion(db)
+	if err != nil {
+		return manifest, err
+	}
+	switch {
+	case dirty:
+		return manifest, errors.Newf("Database migration version %d is dirty", version)
+	case version > manifest.MigrationVersion:
+		return manifest, errors.Newf("Database is at migration version %d, newer than the archive's version %d",
+			version, manifest.MigrationVersion)
+	case version < manifest.MigrationVersion:
+		if err = MigrateTo(db, manifest.MigrationVersion); err != nil {
+			return manifest, err
+		}
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return manifest, errors.Wrap(err, "Unable to start transaction")
+	}
+	defer tx.Rollback()
+
+	ids := make(idMap)
+	for _, table := range manifest.Tables {
+		if !isArchiveTable(table.Name) {
+			return manifest, errors.Newf("Archive contains unknown table %s", table.Name)
+		}
+		f, err := zr.Open(table.Name + ".jsonl")
+		if err != nil {
+			return manifest, errors.Wrapf(err, "Archive has no rows of %s", table.Name)
+		}
+		err = importTable(tx, table.Name, f, c, ids)
+		f.Close()
+		if err != nil {
+			return manifest, errors.Wrapf(err, "Importing %s", table.Name)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return manifest, errors.Wrap(err, "Unable to commit transaction")
+	}
+	return manifest, nil
+}
+
+func isArchiveTable(table string) bool {
+	for _, t := range append(append([]string{}, configTables...), timeSeriesTables...) {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+type tableInfo struct {
+	columns    []string
+	primaryKey []string
+	hasUnique  bool
+	// serialColumn is the primary key column backed by a sequence, empty when there is none.
+	serialColumn string
+	// uniqueIndexes are the unique constraints and indexes besides the primary key.
+	uniqueIndexes []uniqueIndex
+	foreignKeys   []foreignKey
+}
+
+type uniqueIndex struct {
+	Columns pq.StringArray `db:"columns"`
+	// Predicate is the WHERE clause of a partial index, empty otherwise.
+	Predicate string `db:"predicate"`
+}
+
+type foreignKey struct {
+	Column   string `db:"column"`
+	RefTable string `db:"ref_table"`
+}
+
+// idMap holds the new ids of archive rows per table, for rows matched with an existing row on a unique constraint
+// or renumbered because their id was taken. The ids are JSON values like in the archive rows.
+type idMap map[string]map[string]json.RawMessage
+
+// remap rewrites the references of a row to archive rows that got a new id.
+func (ids idMap) remap(row []byte, foreignKeys []foreignKey) ([]byte, error) {
+	var remapped []foreignKey
+	for _, fk := range foreignKeys {
+		if len(ids[fk.RefTable]) != 0 {
+			remapped = append(remapped, fk)
+		}
+	}
+	if len(remapped) == 0 {
+		return row, nil
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(row, &m); err != nil {
+		return nil, errors.Wrap(err, "Decoding row")
+	}
+	for _, fk := range remapped {
+		if id, ok := ids[fk.RefTable][string(m[fk.Column])]; ok {
+			m[fk.Column] = id
+		}
+	}
+	return json.Marshal(m)
+}
+
+func getTableInfo(tx *sqlx.Tx, table string) (r tableInfo, err error) {
+	// Generated columns can't be inserted.
+	err = tx.Select(&r.columns, `
+		SELECT attname
+		FROM pg_attribute
+		WHERE attrelid = $1::regclass AND attnum > 0 AND NOT attisdropped AND attgenerated = ''
+		ORDER BY attnum;`, table)
+	if err != nil {
+		return r, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	err = tx.Select(&r.primaryKey, `
+		SELECT a.attname
+		FROM pg_index i
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+		WHERE i.indrelid = $1::regclass AND i.indisprimary
+		ORDER BY a.attnum;`, table)
+	if err != nil {
+		return r, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	err = tx.Get(&r.hasUnique, `SELECT EXISTS (SELECT 1 FROM pg_index WHERE indrelid = $1::regclass AND indisunique);`,
+		table)
+	if err != nil {
+		return r, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	err = tx.Select(&r.uniqueIndexes, `
+		SELECT array_agg(a.attname ORDER BY k.n) AS columns,
+			coalesce(pg_get_expr(i.indpred, i.indrelid), '') AS predicate
+		FROM pg_index i
+		CROSS JOIN LATERAL unnest(i.indkey::int2[]) WITH ORDINALITY AS k(attnum, n)
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+		WHERE i.indrelid = $1::regclass AND i.indisunique AND NOT i.indisprimary AND i.indexprs IS NULL
+		GROUP BY i.indexrelid, i.indpred, i.indrelid
+		ORDER BY i.indexrelid;`, table)
+	if err != nil {
+		return r, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	err = tx.Select(&r.foreignKeys, `
+		SELECT a.attname AS column, c.confrelid::regclass::text AS ref_table
+		FROM pg_constraint c
+		JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = c.conkey[1]
+		WHERE c.conrelid = $1::regclass AND c.contype = 'f' AND cardinality(c.conkey) = 1;`, table)
+	if err != nil {
+		return r, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	if len(r.primaryKey) == 1 {
+		var sequence *string
+		err = tx.Get(&sequence, `SELECT pg_get_serial_sequence($1, $2);`, table, r.primaryKey[0])
+		if err != nil {
+			return r, errors.Wrap(err, "Unable to execute SQL statement")
+		}
+		if sequence != nil {
+			r.serialColumn = r.primaryKey[0]
+		}
+	}
+	return r, nil
+}
+
+// matchesNaturalKeys is true when archive rows are matched with existing rows on the unique constraints besides the
+// primary key. Matching needs a sequence for the archive rows whose id is taken by a matched row.
+func (ti tableInfo) matchesNaturalKeys() bool {
+	return ti.serialColumn != "" && len(ti.uniqueIndexes) != 0
+}
+
+// setClause assigns the columns besides the primary key from the row source.
+func (ti tableInfo) setClause(source string) string {
+	var set []string
+	for _, column := range ti.columns {
+		isKey := false
+		for _, key := range ti.primaryKey {
+			isKey = isKey || key == column
+		}
+		if !isKey {
+			set = append(set, fmt.Sprintf("%s = %s.%s", pq.QuoteIdentifier(column), source,
+				pq.QuoteIdentifier(column)))
+		}
+	}
+	return strings.Join(set, ", ")
+}
+
+// conflictClause updates rows with the same primary key, so settings of the database are replaced by the ones of
+// the archive. Rows of tables with other unique constraints are matched on them before they are inserted, when the
+// table can't be matched the existing rows are kept.
+func (ti tableInfo) conflictClause() string {
+	if len(ti.primaryKey) == 0 || (len(ti.uniqueIndexes) != 0 && !ti.matchesNaturalKeys()) {
+		return `ON CONFLICT DO NOTHING`
+	}
+	set := ti.setClause("EXCLUDED")
+	if set == "" {
+		return `ON CONFLICT DO NOTHING`
+	}
+	return fmt.Sprintf(`ON CONFLICT (%s) DO UPDATE SET %s`, quoteIdentifiers(ti.primaryKey), set)
+}
+
+func quoteIdentifiers(identifiers []string) string {
+	quoted := make([]string, len(identifiers))
+	for i, identifier := range identifiers {
+		quoted[i] = pq.QuoteIdentifier(identifier)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func importTable(tx *sqlx.Tx, table string, r io.Reader, c *archiveCipher, ids idMap) error {
+	ti, err := getTableInfo(tx, table)
+	if err != nil {
+		return err
+	}
+	if len(ti.primaryKey) == 0 && !ti.hasUnique {
+		var hasRows bool
+		err = tx.Get(&hasRows, `SELECT EXISTS (SELECT 1 FROM `+pq.QuoteIdentifier(table)+`);`)
+		if err != nil {
+			return errors.Wrap(err, "Unable to execute SQL statement")
+		}
+		if hasRows {
+			log.Warn().Msgf("Skipping %s, rows can't be matched and the table already has rows.", table)
+			return nil
+		}
+	}
+
+	columns := quoteIdentifiers(ti.columns)
+	stmt := fmt.Sprintf(`INSERT INTO %s (%s) SELECT %s FROM json_populate_recordset(NULL::%s, $1::json) %s;`,
+		pq.QuoteIdentifier(table), columns, columns, pq.QuoteIdentifier(table), ti.conflictClause())
+	if ti.matchesNaturalKeys() {
+		// The rows are collected first, the ids of rows inserted by an earlier batch could be taken otherwise.
+		_, err = tx.Exec(fmt.Sprintf(`
+			DROP TABLE IF EXISTS archive_import;
+			CREATE TEMPORARY TABLE archive_import AS SELECT %s FROM %s WITH NO DATA;`,
+			columns, pq.QuoteIdentifier(table)))
+		if err != nil {
+			return errors.Wrap(err, "Unable to execute SQL statement")
+		}
+		stmt = fmt.Sprintf(`
+			INSERT INTO archive_import (%s) SELECT %s FROM json_populate_recordset(NULL::%s, $1::json);`,
+			columns, columns, pq.QuoteIdentifier(table))
+	}
+
+	var batch bytes.Buffer
+	count := 0
+	flush := func() error {
+		if count == 0 {
+			return nil
+		}
+		batch.WriteByte(']')
+		if _, err := tx.Exec(stmt, batch.String()); err != nil {
+			return errors.Wrap(err, "Unable to execute SQL statement")
+		}
+		batch.Reset()
+		count = 0
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		row := scanner.Bytes()
+		if len(row) == 0 {
+			continue
+		}
+		if columns, ok := credentialColumns[table]; ok && c != nil {
+			row, err = transformColumns(row, columns, func(s string) (string, error) {
+				b, err := c.decrypt(s)
+				return string(b), err
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if row, err = ids.remap(row, ti.foreignKeys); err != nil {
+			return err
+		}
+		if count == 0 {
+			batch.WriteByte('[')
+		} else {
+			batch.WriteByte(',')
+		}
+		batch.Write(row)
+		count++
+		if count == importBatchSize {
+			if err = flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return errors.Wrap(err, "Reading rows")
+	}
+	if err = flush(); err != nil {
+		return err
+	}
+
+	if ti.matchesNaturalKeys() {
+		if err = matchNaturalKeys(tx, table, ti, ids); err != nil {
+			return err
+		}
+		_, err = tx.Exec(fmt.Sprintf(`
+			INSERT INTO %s (%s) SELECT %s FROM archive_import %s;
+			DROP TABLE archive_import;`,
+			pq.QuoteIdentifier(table), columns, columns, ti.conflictClause()))
+		if err != nil {
+			return errors.Wrap(err, "Unable to execute SQL statement")
+		}
+	}
+
+	if ti.serialColumn != "" {
+		// Continue the sequence after the imported ids.
+		column := pq.QuoteIdentifier(ti.serialColumn)
+		_, err = tx.Exec(fmt.Sprintf(`
+			SELECT setval(pg_get_serial_sequence($1, $2), max(%s))
+			FROM %s
+			HAVING max(%s) IS NOT NULL;`, column, pq.QuoteIdentifier(table), column), table, ti.serialColumn)
+		if err != nil {
+			return errors.Wrap(err, "Unable to execute SQL statement")
+		}
+	}
+	return nil
+}
+
+// matchNaturalKeys updates the existing rows matching a row of archive_import on a unique constraint with the row of
+// the archive and drops the archive row. Archive rows whose id is now taken by a matched row are given a new id.
+// The new ids of both are added to ids.
+func matchNaturalKeys(tx *sqlx.Tx, table string, ti tableInfo, ids idMap) error {
+	if ids[table] == nil {
+		ids[table] = make(map[string]json.RawMessage)
+	}
+	id := pq.QuoteIdentifier(ti.serialColumn)
+	var matched []string
+
+	for _, index := range ti.uniqueIndexes {
+		var on []string
+		for _, column := range index.Columns {
+			on = append(on, fmt.Sprintf("t.%s = s.%s", pq.QuoteIdentifier(column), pq.QuoteIdentifier(column)))
+		}
+		where := ""
+		if index.Predicate != "" {
+			where = "WHERE " + index.Predicate
+		}
+		var matches []struct {
+			ArchiveId string `db:"archive_id"`
+			Id        string `db:"id"`
+		}
+		err := tx.Select(&matches, fmt.Sprintf(`
+			WITH matched AS (
+				SELECT s.%[1]s AS archive_id, t.%[1]s AS id
+				FROM (SELECT * FROM archive_import %[2]s) s
+				JOIN (SELECT * FROM %[3]s %[2]s) t ON %[4]s
+				WHERE s.%[1]s IS DISTINCT FROM t.%[1]s
+			), updated AS (
+				UPDATE %[3]s t SET %[5]s
+				FROM matched m JOIN archive_import s ON s.%[1]s = m.archive_id
+				WHERE t.%[1]s = m.id
+			), deleted AS (
+				DELETE FROM archive_import s USING matched m WHERE s.%[1]s = m.archive_id
+			)
+			SELECT to_json(archive_id)::text AS archive_id, to_json(id)::text AS id FROM matched;`,
+			id, where, pq.QuoteIdentifier(table), strings.Join(on, " AND "), ti.setClause("s")))
+		if err != nil {
+			return errors.Wrap(err, "Unable to execute SQL statement")
+		}
+		for _, m := range matches {
+			ids[table][m.ArchiveId] = json.RawMessage(m.Id)
+			matched = append(matched, m.Id)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+
+	// The ids handed out must not be taken by existing or archive rows.
+	_, err := tx.Exec(fmt.Sprintf(`
+		SELECT setval(pg_get_serial_sequence($1, $2), greatest(
+			(SELECT max(%[1]s) FROM %[2]s), (SELECT max(%[1]s) FROM archive_import)));`,
+		id, pq.QuoteIdentifier(table)), table, ti.serialColumn)
+	if err != nil {
+		return errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	var renumbered []struct {
+		ArchiveId string `db:"archive_id"`
+		Id        string `db:"id"`
+	}
+	err = tx.Select(&renumbered, fmt.Sprintf(`
+		UPDATE archive_import s SET %[1]s = nextval(pg_get_serial_sequence($1, $2))
+		FROM (SELECT %[1]s AS archive_id FROM archive_import WHERE to_json(%[1]s)::text = ANY($3)) taken
+		WHERE s.%[1]s = taken.archive_id
+		RETURNING to_json(taken.archive_id)::text AS archive_id, to_json(s.%[1]s)::text AS id;`, id),
+		table, ti.serialColumn, pq.Array(matched))
+	if err != nil {
+		return errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	for _, r := range renumbered {
+		ids[table][r.ArchiveId] = json.RawMessage(r.Id)
+	}
+	return nil
+}
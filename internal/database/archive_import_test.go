@@ -0,0 +1,78 @@
+package database_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lncapital/torq/internal/database"
+	"github.com/lncapital/torq/testutil"
+)
+
+// The test database has to be created with testutil, which depends on this package.
+func TestImportArchiveConflictingRows(t *testing.T) {
+	srv, err := testutil.InitTestDBConn()
+	if err != nil {
+		panic(err)
+	}
+
+	db, err := srv.NewTestDatabase(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := srv.Cleanup(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	var localNodeId int
+	if err = db.Get(&localNodeId, "SELECT local_node_id FROM local_node LIMIT 1;"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The archive has the tags 1 sink and 2 source, the node is tagged as sink.
+	db.MustExec(`INSERT INTO tag (tag_id, name, created_on) VALUES (1, 'sink', now()), (2, 'source', now());`)
+	db.MustExec(`INSERT INTO tagged_entity (tag_id, local_node_id, created_on) VALUES (1, $1, now());`, localNodeId)
+	var archive bytes.Buffer
+	if _, err = database.ExportArchive(db, &archive, database.ExportOptions{}); err != nil {
+		t.Fatalf("ExportArchive() error = %v", err)
+	}
+
+	// In the database sink has another id, which the archive uses for source, and the node is tagged already.
+	db.MustExec(`DELETE FROM tag;`)
+	db.MustExec(`INSERT INTO tag (tag_id, name, created_on) VALUES (1, 'other', now()), (2, 'sink', now());`)
+	db.MustExec(`INSERT INTO tagged_entity (tag_id, local_node_id, created_on) VALUES (2, $1, now());`, localNodeId)
+
+	for i := 0; i < 2; i++ {
+		_, err = database.ImportArchive(db, bytes.NewReader(archive.Bytes()), int64(archive.Len()),
+			database.ImportOptions{})
+		if err != nil {
+			t.Fatalf("ImportArchive() error = %v", err)
+		}
+
+		var tags []struct {
+			TagId int    `db:"tag_id"`
+			Name  string `db:"name"`
+		}
+		if err = db.Select(&tags, "SELECT tag_id, name FROM tag ORDER BY tag_id;"); err != nil {
+			t.Fatal(err)
+		}
+		if len(tags) != 3 || tags[0].Name != "other" || tags[1].TagId != 2 || tags[1].Name != "sink" ||
+			tags[2].Name != "source" {
+			t.Errorf("ImportArchive() tags = %+v", tags)
+		}
+
+		var tagged []string
+		err = db.Select(&tagged, `
+			SELECT t.name
+			FROM tagged_entity te
+			JOIN tag t ON t.tag_id = te.tag_id
+			WHERE te.local_node_id = $1;`, localNodeId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tagged) != 1 || tagged[0] != "sink" {
+			t.Errorf("ImportArchive() node tags = %v", tagged)
+		}
+	}
+}
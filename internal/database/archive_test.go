@@ -0,0 +1,138 @@
+package database
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func Test_archiveCipher(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	c, err := newArchiveCipher("passphrase", salt)
+	if err != nil {
+		t.Fatalf("newArchiveCipher() error = %v", err)
+	}
+
+	row := []byte(`{"local_node_id":1,"tls_data":"\\x0102","macaroon_data":null,"grpc_address":"localhost:10009"}`)
+	encrypted, err := transformColumns(row, credentialColumns["local_node"], func(s string) (string, error) {
+		return c.encrypt([]byte(s))
+	})
+	if err != nil {
+		t.Fatalf("transformColumns() error = %v", err)
+	}
+	if bytes.Contains(encrypted, []byte(`\\x0102`)) {
+		t.Errorf("transformColumns() didn't encrypt tls_data: %s", encrypted)
+	}
+
+	wrong, err := newArchiveCipher("wrong", salt)
+	if err != nil {
+		t.Fatalf("newArchiveCipher() error = %v", err)
+	}
+	_, err = transformColumns(encrypted, credentialColumns["local_node"], func(s string) (string, error) {
+		b, err := wrong.decrypt(s)
+		return string(b), err
+	})
+	if err == nil {
+		t.Errorf("decrypt() with the wrong passphrase expected an error")
+	}
+
+	decrypted, err := transformColumns(encrypted, credentialColumns["local_node"], func(s string) (string, error) {
+		b, err := c.decrypt(s)
+		return string(b), err
+	})
+	if err != nil {
+		t.Fatalf("transformColumns() error = %v", err)
+	}
+	var got, want map[string]interface{}
+	if err = json.Unmarshal(decrypted, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(row, &want); err != nil {
+		t.Fatal(err)
+	}
+	if got["tls_data"] != want["tls_data"] || got["macaroon_data"] != nil || got["grpc_address"] != want["grpc_address"] {
+		t.Errorf("transformColumns() = %s, want %s", decrypted, row)
+	}
+}
+
+func Test_readManifest(t *testing.T) {
+	archive := func(manifest ArchiveManifest) *zip.Reader {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		f, err := zw.Create(manifestFileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = json.NewEncoder(f).Encode(manifest); err != nil {
+			t.Fatal(err)
+		}
+		if err = zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return zr
+	}
+
+	manifest, err := readManifest(archive(ArchiveManifest{FormatVersion: archiveFormatVersion, MigrationVersion: 50,
+		Tables: []ArchiveTable{{Name: "settings", Rows: 1}}}))
+	if err != nil || manifest.MigrationVersion != 50 || len(manifest.Tables) != 1 {
+		t.Errorf("readManifest() = %+v, %v", manifest, err)
+	}
+
+	if _, err = readManifest(archive(ArchiveManifest{FormatVersion: archiveFormatVersion + 1})); err == nil {
+		t.Errorf("readManifest() expected an error for an unsupported format version")
+	}
+}
+
+func Test_conflictClause(t *testing.T) {
+	tests := []struct {
+		name string
+		ti   tableInfo
+		want string
+	}{
+		{"Primary key", tableInfo{columns: []string{"tag_id", "name"}, primaryKey: []string{"tag_id"}},
+			`ON CONFLICT ("tag_id") DO UPDATE SET "name" = EXCLUDED."name"`},
+		{"Unique constraint", tableInfo{columns: []string{"timestamp", "tx_hash"}, hasUnique: true},
+			`ON CONFLICT DO NOTHING`},
+		{"Only key columns", tableInfo{columns: []string{"id"}, primaryKey: []string{"id"}},
+			`ON CONFLICT DO NOTHING`},
+		{"Natural key", tableInfo{columns: []string{"tag_id", "name"}, primaryKey: []string{"tag_id"},
+			serialColumn: "tag_id", uniqueIndexes: []uniqueIndex{{Columns: []string{"name"}}}},
+			`ON CONFLICT ("tag_id") DO UPDATE SET "name" = EXCLUDED."name"`},
+		{"Unique constraint without a sequence", tableInfo{columns: []string{"id", "name"}, primaryKey: []string{"id"},
+			uniqueIndexes: []uniqueIndex{{Columns: []string{"name"}}}},
+			`ON CONFLICT DO NOTHING`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.ti.conflictClause(); got != test.want {
+				t.Errorf("conflictClause() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func Test_idMap_remap(t *testing.T) {
+	ids := idMap{"tag": {"1": json.RawMessage("4")}}
+	foreignKeys := []foreignKey{{Column: "tag_id", RefTable: "tag"}, {Column: "channel_db_id", RefTable: "channel"}}
+
+	got, err := ids.remap([]byte(`{"tagged_entity_id":1,"tag_id":1,"channel_db_id":1}`), foreignKeys)
+	if err != nil || string(got) != `{"channel_db_id":1,"tag_id":4,"tagged_entity_id":1}` {
+		t.Errorf("remap() = %s, %v", got, err)
+	}
+
+	// Rows referencing rows that kept their id are left as they are.
+	row := []byte(`{"tagged_entity_id":2,"tag_id":2,"channel_db_id":null}`)
+	got, err = ids.remap(row, foreignKeys)
+	if err != nil || string(got) != `{"channel_db_id":null,"tag_id":2,"tagged_entity_id":2}` {
+		t.Errorf("remap() = %s, %v", got, err)
+	}
+	got, err = ids.remap(row, foreignKeys[1:])
+	if err != nil || !bytes.Equal(got, row) {
+		t.Errorf("remap() = %s, %v", got, err)
+	}
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"database/sql"
 	"fmt"
 	"github.com/cockroachdb/errors"
 	"github.com/jmoiron/sqlx"
@@ -36,13 +37,18 @@ func PgConnect(dbName, user, password, host, port string) (db *sqlx.DB, err erro
 			return nil, errors.Wrap(err, "pg connect")
 		}
 	}
-	db, err = sqlx.Connect("postgres",
+	connector, err := newInstrumentedConnector(
 		fmt.Sprintf("postgresql://%s:%s@%s:%s/%s?sslmode=disable", user, password, host, port,
 			dbName))
-
 	if err != nil {
 		return nil, errors.Wrap(err, "database connect")
 	}
+
+	db = sqlx.NewDb(sql.OpenDB(connector), "postgres")
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "database connect")
+	}
 	return db, nil
 }
 
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/lncapital/torq/internal/metrics"
+)
+
+// instrumentedConnector wraps the pq connector so that the latency of every query and statement is
+// recorded in the torq_db_query_duration_seconds metric.
+type instrumentedConnector struct {
+	driver.Connector
+}
+
+func newInstrumentedConnector(dsn string) (driver.Connector, error) {
+	c, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return instrumentedConnector{c}, nil
+}
+
+func (ic instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := ic.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{conn}, nil
+}
+
+// instrumentedConn passes everything on to the pq connection. Queries and statements that don't go
+// through QueryContext or ExecContext (prepared statements) are not timed.
+type instrumentedConn struct {
+	driver.Conn
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	defer metrics.ObserveDBQuery("query", time.Now())
+	return q.QueryContext(ctx, query, args)
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	defer metrics.ObserveDBQuery("exec", time.Now())
+	return e.ExecContext(ctx, query, args)
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
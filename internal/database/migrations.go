@@ -49,3 +49,39 @@ func MigrateUp(db *sqlx.DB) error {
 
 	return nil
 }
+
+// MigrationVersion returns the migration version of the database, 0 when no migration has run yet.
+func MigrationVersion(db *sqlx.DB) (version uint, dirty bool, err error) {
+	m, err := newMigrationInstance(db.DB)
+	if err != nil {
+		return 0, false, err
+	}
+
+	version, dirty, err = m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, errors.Wrap(err, "Getting migration version")
+	}
+	return version, dirty, nil
+}
+
+// MigrateTo migrates up or down to the given migration version.
+func MigrateTo(db *sqlx.DB, version uint) error {
+	m, err := newMigrationInstance(db.DB)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Migrations might take a while. Please be patient.")
+
+	err = m.Migrate(version)
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return errors.Wrapf(err, "Migrating database to version %d", version)
+	}
+
+	log.Println("Migration done.")
+
+	return nil
+}
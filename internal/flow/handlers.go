@@ -4,6 +4,7 @@ import (
 	"github.com/cockroachdb/errors"
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
+	"github.com/lncapital/torq/internal/tags"
 	"github.com/lncapital/torq/pkg/server_errors"
 	"gopkg.in/guregu/null.v4"
 	"net/http"
@@ -53,9 +54,23 @@ func getFlowHandler(c *gin.Context, db *sqlx.DB) {
 	// TODO: Correct this to chand_ids here and in the frontend
 	chanIds := strings.Split(c.Query("chan_id"), ",")
 
-	if err != nil {
-		server_errors.LogAndSendServerError(c, err)
-		return
+	// When a tag is given the flow is for all channels the tag applies to.
+	if tag := c.Query("tag"); tag != "" {
+		chanIds, err = tags.GetTagChannelIds(db, tag)
+		switch err.(type) {
+		case nil:
+			break
+		case tags.ErrTagNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"Error": err.Error(), "Identifier": tag})
+			return
+		default:
+			server_errors.LogAndSendServerError(c, err)
+			return
+		}
+		if len(chanIds) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "No channels found for tag", "Identifier": tag})
+			return
+		}
 	}
 
 	r, err := getFlow(db, chanIds, from, to)
@@ -98,22 +113,18 @@ func getFlow(db *sqlx.DB, chanIds []string, fromTime time.Time,
 					lnd_outgoing_short_channel_id,
 					floor(sum(outgoing_amount_msat)/1000) as amount,
 					floor(sum(fee_msat)/1000) as revenue,
-					count(time) as count
-				from forward as fw
-				where time >= ?
-            		and time <= ?
-					and ((?) or (lnd_incoming_short_channel_id in (?)))
+					sum(count) as count
+				from forwards_between(?, ?) as fw
+				where ((?) or (lnd_incoming_short_channel_id in (?)))
 				group by lnd_outgoing_short_channel_id) as o
 				full outer join (
 				select
 					lnd_incoming_short_channel_id,
 					floor(sum(outgoing_amount_msat)/1000) as amount,
 					floor(sum(fee_msat)/1000) as revenue,
-					count(time) as count
-				from forward as fw
-				where time >= ?
-            		and time <= ?
-					and ((?) or (lnd_outgoing_short_channel_id in (?)))
+					sum(count) as count
+				from forwards_between(?, ?) as fw
+				where ((?) or (lnd_outgoing_short_channel_id in (?)))
 				group by lnd_incoming_short_channel_id) as i on o.lnd_outgoing_short_channel_id = i.lnd_incoming_short_channel_id) as fw
 			left join (
 			select
@@ -0,0 +1,248 @@
+package flow
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/lncapital/torq/pkg/server_errors"
+)
+
+// pairFlow is the forwarded volume from a source to a target. The source and target are channels,
+// peers or tags depending on the rollup. The format can be used directly as the links of a Sankey
+// or chord chart.
+type pairFlow struct {
+	// Identifier of the incoming side (LND short channel id, public key or tag name)
+	Source string `json:"source"`
+	// Display name of the incoming side (alias or tag name)
+	SourceLabel string `json:"source_label"`
+	// Identifier of the outgoing side (LND short channel id, public key or tag name)
+	Target string `json:"target"`
+	// Display name of the outgoing side (alias or tag name)
+	TargetLabel string `json:"target_label"`
+
+	// The amount forwarded in sats (Satoshis)
+	Amount uint64 `json:"amount"`
+	// The fees earned in sats
+	Revenue uint64 `json:"revenue"`
+	// Number of forwards
+	Count uint64 `json:"count"`
+}
+
+// corridor is one of the most valuable channel pairs.
+type corridor struct {
+	pairFlow
+	// The share of the total revenue in the date range earned by this corridor (0-1).
+	RevenueShare float64 `json:"revenue_share"`
+}
+
+type forwardPairMatrix struct {
+	Channels     []*pairFlow `json:"channels"`
+	Peers        []*pairFlow `json:"peers"`
+	Tags         []*pairFlow `json:"tags"`
+	TopCorridors []*corridor `json:"top_corridors"`
+}
+
+// channelPair is a row of the aggregated forward table with the details needed for the rollups.
+type channelPair struct {
+	IncomingChanId string
+	IncomingPubKey string
+	IncomingAlias  string
+	IncomingTags   pq.StringArray
+	OutgoingChanId string
+	OutgoingPubKey string
+	OutgoingAlias  string
+	OutgoingTags   pq.StringArray
+	Amount         uint64
+	Revenue        uint64
+	Count          uint64
+}
+
+const defaultCorridorLimit = 10
+
+func getForwardPairsHandler(c *gin.Context, db *sqlx.DB) {
+	from, err := time.Parse("2006-01-02", c.Query("from"))
+	if err != nil {
+		server_errors.SendBadRequest(c, "from is required (YYYY-MM-DD)")
+		return
+	}
+	to, err := time.Parse("2006-01-02", c.Query("to"))
+	if err != nil {
+		server_errors.SendBadRequest(c, "to is required (YYYY-MM-DD)")
+		return
+	}
+
+	limit := defaultCorridorLimit
+	if c.Query("limit") != "" {
+		limit, err = strconv.Atoi(c.Query("limit"))
+		if err != nil || limit <= 0 {
+			server_errors.SendBadRequest(c, "Limit must be a positive number")
+			return
+		}
+	}
+
+	pairs, err := getChannelPairs(db, from, to)
+	if err != nil {
+		server_errors.LogAndSendServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, buildForwardPairMatrix(pairs, limit))
+}
+
+func getChannelPairs(db *sqlx.DB, fromTime time.Time, toTime time.Time) (r []channelPair, err error) {
+	const sql = `
+		select
+			fw.lnd_incoming_short_channel_id::text,
+			coalesce(ci.destination_pub_key, ''),
+			coalesce(nei.alias, ci.destination_pub_key, fw.lnd_incoming_short_channel_id::text),
+			channel_tags(fw.lnd_incoming_short_channel_id),
+			fw.lnd_outgoing_short_channel_id::text,
+			coalesce(co.destination_pub_key, ''),
+			coalesce(neo.alias, co.destination_pub_key, fw.lnd_outgoing_short_channel_id::text),
+			channel_tags(fw.lnd_outgoing_short_channel_id),
+			fw.amount,
+			fw.revenue,
+			fw.count
+		from (
+			select
+				lnd_incoming_short_channel_id,
+				lnd_outgoing_short_channel_id,
+				floor(sum(outgoing_amount_msat)/1000) as amount,
+				floor(sum(fee_msat)/1000) as revenue,
+				sum(count) as count
+			from forwards_between($1, $2)
+			group by lnd_incoming_short_channel_id, lnd_outgoing_short_channel_id
+		) as fw
+		left join channel ci on ci.lnd_short_channel_id = fw.lnd_incoming_short_channel_id
+		left join channel co on co.lnd_short_channel_id = fw.lnd_outgoing_short_channel_id
+		left join (
+			select pub_key, last(alias, timestamp) as alias
+			from node_event
+			group by pub_key
+		) as nei on nei.pub_key = ci.destination_pub_key
+		left join (
+			select pub_key, last(alias, timestamp) as alias
+			from node_event
+			group by pub_key
+		) as neo on neo.pub_key = co.destination_pub_key
+		order by fw.revenue desc, fw.amount desc
+	`
+
+	rows, err := db.Query(sql, fromTime, toTime)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error running forward pair query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p := channelPair{}
+		err = rows.Scan(
+			&p.IncomingChanId,
+			&p.IncomingPubKey,
+			&p.IncomingAlias,
+			&p.IncomingTags,
+			&p.OutgoingChanId,
+			&p.OutgoingPubKey,
+			&p.OutgoingAlias,
+			&p.OutgoingTags,
+			&p.Amount,
+			&p.Revenue,
+			&p.Count,
+		)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, p)
+	}
+	return r, rows.Err()
+}
+
+// buildForwardPairMatrix rolls the channel pairs up to peer and tag pairs and picks the top corridors.
+// The channel pairs are expected to be ordered by revenue. A forward between two tagged channels is
+// counted once for every combination of their tags. Forwards with an untagged side are left out of
+// the tag rollup.
+func buildForwardPairMatrix(pairs []channelPair, limit int) forwardPairMatrix {
+	m := forwardPairMatrix{
+		Channels:     make([]*pairFlow, 0, len(pairs)),
+		Peers:        make([]*pairFlow, 0),
+		Tags:         make([]*pairFlow, 0),
+		TopCorridors: make([]*corridor, 0),
+	}
+
+	peers := map[[2]string]*pairFlow{}
+	tags := map[[2]string]*pairFlow{}
+	var totalRevenue uint64
+
+	for _, p := range pairs {
+		totalRevenue += p.Revenue
+
+		m.Channels = append(m.Channels, &pairFlow{
+			Source:      p.IncomingChanId,
+			SourceLabel: p.IncomingAlias,
+			Target:      p.OutgoingChanId,
+			TargetLabel: p.OutgoingAlias,
+			Amount:      p.Amount,
+			Revenue:     p.Revenue,
+			Count:       p.Count,
+		})
+
+		// Channels we no longer know about are grouped by their channel id.
+		inPeer, outPeer := p.IncomingPubKey, p.OutgoingPubKey
+		if inPeer == "" {
+			inPeer = p.IncomingChanId
+		}
+		if outPeer == "" {
+			outPeer = p.OutgoingChanId
+		}
+		addToRollup(peers, &m.Peers, inPeer, p.IncomingAlias, outPeer, p.OutgoingAlias, p)
+
+		for _, inTag := range p.IncomingTags {
+			for _, outTag := range p.OutgoingTags {
+				addToRollup(tags, &m.Tags, inTag, inTag, outTag, outTag, p)
+			}
+		}
+	}
+
+	sortByRevenue(m.Peers)
+	sortByRevenue(m.Tags)
+
+	for i := 0; i < len(m.Channels) && i < limit; i++ {
+		c := &corridor{pairFlow: *m.Channels[i]}
+		if totalRevenue > 0 {
+			c.RevenueShare = float64(c.Revenue) / float64(totalRevenue)
+		}
+		m.TopCorridors = append(m.TopCorridors, c)
+	}
+
+	return m
+}
+
+func addToRollup(index map[[2]string]*pairFlow, list *[]*pairFlow, source string, sourceLabel string,
+	target string, targetLabel string, p channelPair) {
+
+	key := [2]string{source, target}
+	f, exists := index[key]
+	if !exists {
+		f = &pairFlow{Source: source, SourceLabel: sourceLabel, Target: target, TargetLabel: targetLabel}
+		index[key] = f
+		*list = append(*list, f)
+	}
+	f.Amount += p.Amount
+	f.Revenue += p.Revenue
+	f.Count += p.Count
+}
+
+func sortByRevenue(flows []*pairFlow) {
+	sort.SliceStable(flows, func(i, j int) bool {
+		if flows[i].Revenue != flows[j].Revenue {
+			return flows[i].Revenue > flows[j].Revenue
+		}
+		return flows[i].Amount > flows[j].Amount
+	})
+}
@@ -0,0 +1,66 @@
+package flow
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_buildForwardPairMatrix(t *testing.T) {
+	pairs := []channelPair{
+		{
+			IncomingChanId: "1", IncomingPubKey: "peerA", IncomingAlias: "A", IncomingTags: []string{"exchanges"},
+			OutgoingChanId: "3", OutgoingPubKey: "peerC", OutgoingAlias: "C", OutgoingTags: []string{"sinks", "lsp"},
+			Amount: 1000, Revenue: 6, Count: 2,
+		},
+		{
+			IncomingChanId: "2", IncomingPubKey: "peerA", IncomingAlias: "A", IncomingTags: []string{"exchanges"},
+			OutgoingChanId: "3", OutgoingPubKey: "peerC", OutgoingAlias: "C", OutgoingTags: []string{"sinks", "lsp"},
+			Amount: 500, Revenue: 3, Count: 1,
+		},
+		{
+			IncomingChanId: "4", IncomingAlias: "4",
+			OutgoingChanId: "1", OutgoingPubKey: "peerA", OutgoingAlias: "A", OutgoingTags: []string{"exchanges"},
+			Amount: 200, Revenue: 1, Count: 1,
+		},
+	}
+
+	m := buildForwardPairMatrix(pairs, 2)
+
+	if len(m.Channels) != 3 {
+		t.Fatalf("expected 3 channel pairs, got %d", len(m.Channels))
+	}
+
+	wantPeers := []pairFlow{
+		{Source: "peerA", SourceLabel: "A", Target: "peerC", TargetLabel: "C", Amount: 1500, Revenue: 9, Count: 3},
+		{Source: "4", SourceLabel: "4", Target: "peerA", TargetLabel: "A", Amount: 200, Revenue: 1, Count: 1},
+	}
+	if len(m.Peers) != len(wantPeers) {
+		t.Fatalf("expected %d peer pairs, got %d", len(wantPeers), len(m.Peers))
+	}
+	for i, want := range wantPeers {
+		if !reflect.DeepEqual(*m.Peers[i], want) {
+			t.Errorf("peer pair %d: got %+v, want %+v", i, *m.Peers[i], want)
+		}
+	}
+
+	// The untagged incoming channel is left out, the two outgoing tags are both counted.
+	wantTags := []pairFlow{
+		{Source: "exchanges", SourceLabel: "exchanges", Target: "sinks", TargetLabel: "sinks", Amount: 1500, Revenue: 9, Count: 3},
+		{Source: "exchanges", SourceLabel: "exchanges", Target: "lsp", TargetLabel: "lsp", Amount: 1500, Revenue: 9, Count: 3},
+	}
+	if len(m.Tags) != len(wantTags) {
+		t.Fatalf("expected %d tag pairs, got %d", len(wantTags), len(m.Tags))
+	}
+	for i, want := range wantTags {
+		if !reflect.DeepEqual(*m.Tags[i], want) {
+			t.Errorf("tag pair %d: got %+v, want %+v", i, *m.Tags[i], want)
+		}
+	}
+
+	if len(m.TopCorridors) != 2 {
+		t.Fatalf("expected 2 corridors, got %d", len(m.TopCorridors))
+	}
+	if m.TopCorridors[0].Source != "1" || m.TopCorridors[0].RevenueShare != 0.6 {
+		t.Errorf("unexpected top corridor: %+v", *m.TopCorridors[0])
+	}
+}
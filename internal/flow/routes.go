@@ -7,4 +7,5 @@ import (
 
 func RegisterFlowRoutes(r *gin.RouterGroup, db *sqlx.DB) {
 	r.GET("", func(c *gin.Context) { getFlowHandler(c, db) })
+	r.GET("pairs", func(c *gin.Context) { getForwardPairsHandler(c, db) })
 }
@@ -1,9 +1,12 @@
 package forwards
 
 import (
+	sq "github.com/Masterminds/squirrel"
 	"github.com/cockroachdb/errors"
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	qp "github.com/lncapital/torq/internal/query_parser"
 	"github.com/lncapital/torq/pkg/server_errors"
 	"gopkg.in/guregu/null.v4"
 	"net/http"
@@ -21,7 +24,7 @@ func getForwardsTableHandler(c *gin.Context, db *sqlx.DB) {
 		server_errors.LogAndSendServerError(c, err)
 		return
 	}
-	r, err := getForwardsTableData(db, from, to)
+	r, err := getForwardsTableData(db, from, to, nil, nil)
 	if err != nil {
 		server_errors.LogAndSendServerError(c, err)
 		return
@@ -76,9 +79,59 @@ type forwardsTableRow struct {
 	TurnoverOut   float32 `json:"turnover_out"`
 	TurnoverIn    float32 `json:"turnover_in"`
 	TurnoverTotal float32 `json:"turnover_total"`
+
+	// Tags of the channel, its peer and the local node it belongs to
+	Tags pq.StringArray `json:"tags"`
+}
+
+// forwardsTableColumns are the columns of the forwards table that can be filtered and sorted by.
+var forwardsTableColumns = qp.ColumnSchema{
+	"alias":                qp.StringColumn,
+	"channel_db_id":        qp.NumberColumn,
+	"lnd_channel_point":    qp.StringColumn,
+	"pub_key":              qp.StringColumn,
+	"short_channel_id":     qp.StringColumn,
+	"lnd_short_channel_id": qp.StringColumn,
+	"open":                 qp.NumberColumn,
+	"capacity":             qp.NumberColumn,
+	"amount_out":           qp.NumberColumn,
+	"amount_in":            qp.NumberColumn,
+	"amount_total":         qp.NumberColumn,
+	"revenue_out":          qp.NumberColumn,
+	"revenue_in":           qp.NumberColumn,
+	"revenue_total":        qp.NumberColumn,
+	"count_out":            qp.NumberColumn,
+	"count_in":             qp.NumberColumn,
+	"count_total":          qp.NumberColumn,
+	"turnover_out":         qp.NumberColumn,
+	"turnover_in":          qp.NumberColumn,
+	"turnover_total":       qp.NumberColumn,
+	"tags":                 qp.ArrayColumn,
+}
+
+// QueryForwards parses the filter clauses and sort order against the forwards table columns and
+// runs the query for the given date range. It is used to run saved table views on the server.
+func QueryForwards(db *sqlx.DB, fromTime time.Time, toTime time.Time, filters *qp.FilterClauses,
+	order []qp.Order) (r []*forwardsTableRow, err error) {
+
+	var filter sq.Sqlizer
+	if filters != nil && !filters.IsEmpty() {
+		filter, err = qp.NewSchemaParser(forwardsTableColumns).ParseFilterClauses(*filters)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort, err := qp.NewParser(forwardsTableColumns.Columns()).ParseOrderClauses(order)
+	if err != nil {
+		return nil, err
+	}
+
+	return getForwardsTableData(db, fromTime, toTime, filter, sort)
 }
 
-func getForwardsTableData(db *sqlx.DB, fromTime time.Time, toTime time.Time) (r []*forwardsTableRow, err error) {
+func getForwardsTableData(db *sqlx.DB, fromTime time.Time, toTime time.Time, filter sq.Sqlizer,
+	order []string) (r []*forwardsTableRow, err error) {
 	var sql = `
 select
     coalesce(ne.alias, ce.pub_key, '') as alias,
@@ -107,7 +160,9 @@ select
 
     coalesce(round(fw.amount_out / ce.capacity::numeric, 2), 0) as turnover_out,
     coalesce(round(fw.amount_in / ce.capacity::numeric, 2), 0) as turnover_in,
-    coalesce(round((fw.amount_in + fw.amount_out) / ce.capacity::numeric, 2), 0) as turnover_total
+    coalesce(round((fw.amount_in + fw.amount_out) / ce.capacity::numeric, 2), 0) as turnover_total,
+
+    channel_tags(ce.lnd_short_channel_id) as tags
 
 from channel as c
 left join (
@@ -140,26 +195,32 @@ left join (
         select lnd_outgoing_short_channel_id lnd_short_channel_id,
                floor(sum(outgoing_amount_msat)/1000) as amount,
                floor(sum(fee_msat)/1000) as revenue,
-               count(time) as count
-        from forward, settings
-        where time::timestamp AT TIME ZONE settings.preferred_timezone >= $1::timestamp AT TIME ZONE settings.preferred_timezone
-            and time::timestamp AT TIME ZONE settings.preferred_timezone <= $2::timestamp AT TIME ZONE settings.preferred_timezone
+               sum(count) as count
+        from forwards_between((table fromDate)::timestamp, (table toDate)::timestamp)
         group by lnd_outgoing_short_channel_id
         ) as o
     full outer join (
         select lnd_incoming_short_channel_id as lnd_short_channel_id,
                floor(sum(incoming_amount_msat)/1000) as amount,
                floor(sum(fee_msat)/1000) as revenue,
-               count(time) as count
-        from forward, settings
-        where time::timestamp AT TIME ZONE settings.preferred_timezone >= $1::timestamp AT TIME ZONE settings.preferred_timezone
-            and time::timestamp AT TIME ZONE settings.preferred_timezone <= $2::timestamp AT TIME ZONE settings.preferred_timezone
+               sum(count) as count
+        from forwards_between((table fromDate)::timestamp, (table toDate)::timestamp)
         group by lnd_incoming_short_channel_id) as i
     on i.lnd_short_channel_id = o.lnd_short_channel_id
 ) as fw on fw.lnd_short_channel_id = ce.lnd_short_channel_id
 `
 
-	rows, err := db.Query(sql, fromTime, toTime)
+	qs, args, err := sq.Select("*").
+		From("("+sql+") as forwards_table").
+		Prefix("WITH fromDate AS (VALUES (?)), toDate AS (VALUES (?))", fromTime, toTime).
+		Where(filter).
+		OrderBy(order...).
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "Building aggregated forwards query")
+	}
+
+	rows, err := db.Query(db.Rebind(qs), args...)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Running aggregated forwards query")
 	}
@@ -193,6 +254,8 @@ left join (
 			&c.TurnoverOut,
 			&c.TurnoverIn,
 			&c.TurnoverTotal,
+
+			&c.Tags,
 		)
 		if err != nil {
 			return r, err
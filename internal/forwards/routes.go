@@ -7,4 +7,5 @@ import (
 
 func RegisterForwardsRoutes(r *gin.RouterGroup, db *sqlx.DB) {
 	r.GET("", func(c *gin.Context) { getForwardsTableHandler(c, db) })
+	r.GET("stats", func(c *gin.Context) { getRoutingStatsHandler(c, db) })
 }
@@ -0,0 +1,270 @@
+package forwards
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lncapital/torq/pkg/server_errors"
+)
+
+// The bucket sizes of the routing statistics and the interval passed to time_bucket.
+var statsBuckets = map[string]string{
+	"hour":  "1 hour",
+	"day":   "1 day",
+	"week":  "1 week",
+	"month": "1 month",
+}
+
+// Weekly buckets start on the origin's weekday. These dates are a Saturday, Sunday and Monday.
+var weekOrigins = map[string]string{
+	"saturday": "2000-01-01",
+	"sunday":   "2000-01-02",
+	"monday":   "2000-01-03",
+}
+
+const (
+	groupByNone    = ""
+	groupByChannel = "channel"
+	groupByPeer    = "peer"
+	groupByTag     = "tag"
+)
+
+type statsBucket struct {
+	// Start of the bucket in the preferred timezone
+	Date time.Time `json:"date"`
+	// For the previous period, the start of the bucket it lines up with in the current period
+	AlignedDate *time.Time `json:"aligned_date,omitempty"`
+	// Channel id, public key or tag name depending on group_by. Empty when not grouped.
+	Group string `json:"group"`
+	// Alias or tag name of the group
+	GroupLabel string `json:"group_label"`
+
+	// Number of forwards
+	Count uint64 `json:"count"`
+	// The outgoing amount forwarded in sats (Satoshis)
+	Amount uint64 `json:"amount"`
+	// The fees earned in sats
+	Revenue uint64 `json:"revenue"`
+}
+
+type statsTotals struct {
+	Count   uint64 `json:"count"`
+	Amount  uint64 `json:"amount"`
+	Revenue uint64 `json:"revenue"`
+}
+
+// statsChange is the relative change (in percent) of the current period compared to the previous.
+// A change is nil when the previous period is zero.
+type statsChange struct {
+	Count   *float64 `json:"count"`
+	Amount  *float64 `json:"amount"`
+	Revenue *float64 `json:"revenue"`
+}
+
+type statsPeriod struct {
+	From    time.Time      `json:"from"`
+	To      time.Time      `json:"to"`
+	Buckets []*statsBucket `json:"buckets"`
+	Totals  statsTotals    `json:"totals"`
+}
+
+type routingStats struct {
+	Bucket   string       `json:"bucket"`
+	GroupBy  string       `json:"group_by"`
+	Current  statsPeriod  `json:"current"`
+	Previous *statsPeriod `json:"previous,omitempty"`
+	Change   *statsChange `json:"change,omitempty"`
+}
+
+// getRoutingStatsHandler returns forward count, volume and revenue per time bucket. The from and to
+// dates are inclusive and in the preferred timezone. With compare=true the previous period of equal
+// length is returned as well.
+func getRoutingStatsHandler(c *gin.Context, db *sqlx.DB) {
+	from, err := time.Parse("2006-01-02", c.Query("from"))
+	if err != nil {
+		server_errors.SendBadRequest(c, "from is required (YYYY-MM-DD)")
+		return
+	}
+	to, err := time.Parse("2006-01-02", c.Query("to"))
+	if err != nil {
+		server_errors.SendBadRequest(c, "to is required (YYYY-MM-DD)")
+		return
+	}
+	if to.Before(from) {
+		server_errors.SendBadRequest(c, "to can't be before from")
+		return
+	}
+	// Include the whole last day
+	to = to.AddDate(0, 0, 1)
+
+	bucket := c.DefaultQuery("bucket", "day")
+	if _, ok := statsBuckets[bucket]; !ok {
+		server_errors.SendBadRequest(c, "bucket must be one of hour, day, week or month")
+		return
+	}
+
+	groupBy := c.Query("group_by")
+	switch groupBy {
+	case groupByNone, groupByChannel, groupByPeer, groupByTag:
+		break
+	default:
+		server_errors.SendBadRequest(c, "group_by must be one of channel, peer or tag")
+		return
+	}
+
+	// Forwards are attributed to the outgoing channel, where the fee is earned, unless asked otherwise.
+	direction := c.DefaultQuery("direction", "outgoing")
+	if direction != "outgoing" && direction != "incoming" {
+		server_errors.SendBadRequest(c, "direction must be incoming or outgoing")
+		return
+	}
+
+	r := routingStats{Bucket: bucket, GroupBy: groupBy}
+
+	r.Current, err = getStatsPeriod(db, from, to, bucket, groupBy, direction)
+	if err != nil {
+		server_errors.LogAndSendServerError(c, err)
+		return
+	}
+
+	if c.Query("compare") == "true" {
+		prevFrom, prevTo := previousPeriod(from, to)
+		previous, err := getStatsPeriod(db, prevFrom, prevTo, bucket, groupBy, direction)
+		if err != nil {
+			server_errors.LogAndSendServerError(c, err)
+			return
+		}
+		shift := from.Sub(prevFrom)
+		for _, b := range previous.Buckets {
+			aligned := b.Date.Add(shift)
+			b.AlignedDate = &aligned
+		}
+		r.Previous = &previous
+		r.Change = &statsChange{
+			Count:   percentChange(previous.Totals.Count, r.Current.Totals.Count),
+			Amount:  percentChange(previous.Totals.Amount, r.Current.Totals.Amount),
+			Revenue: percentChange(previous.Totals.Revenue, r.Current.Totals.Revenue),
+		}
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+// previousPeriod returns the period of equal length directly before [from, to).
+func previousPeriod(from time.Time, to time.Time) (time.Time, time.Time) {
+	return from.Add(-to.Sub(from)), from
+}
+
+func percentChange(previous uint64, current uint64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	change := math.Round((float64(current)-float64(previous))/float64(previous)*10000) / 100
+	return &change
+}
+
+func getStatsPeriod(db *sqlx.DB, from time.Time, to time.Time, bucket string, groupBy string,
+	direction string) (p statsPeriod, err error) {
+
+	p = statsPeriod{From: from, To: to, Buckets: make([]*statsBucket, 0)}
+	buckets, err := getRoutingStats(db, from, to, bucket, groupBy, direction)
+	if err != nil {
+		return p, err
+	}
+	p.Buckets = append(p.Buckets, buckets...)
+	for _, b := range p.Buckets {
+		p.Totals.Count += b.Count
+		p.Totals.Amount += b.Amount
+		p.Totals.Revenue += b.Revenue
+	}
+	return p, nil
+}
+
+func getRoutingStats(db *sqlx.DB, from time.Time, to time.Time, bucket string, groupBy string,
+	direction string) (r []*statsBucket, err error) {
+
+	// direction is validated by the handler, so it's safe to use in the query.
+	chanId := fmt.Sprintf("fw.lnd_%s_short_channel_id", direction)
+
+	groupKey, groupLabel, joins := "''", "''", ""
+	alias := fmt.Sprintf("coalesce(ne.alias, c.destination_pub_key, %s::text)", chanId)
+	channelJoins := fmt.Sprintf(`
+		left join channel c on c.lnd_short_channel_id = %s
+		left join (
+			select pub_key, last(alias, timestamp) as alias
+			from node_event
+			group by pub_key
+		) as ne on ne.pub_key = c.destination_pub_key`, chanId)
+
+	switch groupBy {
+	case groupByChannel:
+		groupKey, groupLabel, joins = chanId+"::text", alias, channelJoins
+	case groupByPeer:
+		groupKey, groupLabel, joins = fmt.Sprintf("coalesce(c.destination_pub_key, %s::text)", chanId), alias,
+			channelJoins
+	case groupByTag:
+		// Forwards through untagged channels are left out. A channel with several tags counts for each.
+		groupKey, groupLabel = "ct.tag", "ct.tag"
+		joins = fmt.Sprintf(`
+		join (
+			select lnd_short_channel_id, unnest(channel_tags(lnd_short_channel_id)) as tag
+			from channel
+		) as ct on ct.lnd_short_channel_id = %s`, chanId)
+	}
+
+	origin := "2000-01-01"
+	if bucket == "week" {
+		var weekStartsOn string
+		err = db.Get(&weekStartsOn, "select week_starts_on from settings limit 1;")
+		if err != nil {
+			return nil, errors.Wrap(err, "Getting week start setting")
+		}
+		if o, ok := weekOrigins[weekStartsOn]; ok {
+			origin = o
+		} else {
+			origin = weekOrigins["monday"]
+		}
+	}
+
+	sql := fmt.Sprintf(`
+		WITH tz AS (select preferred_timezone as tz from settings limit 1)
+		select
+			time_bucket(?::interval, fw.time AT TIME ZONE (table tz), ?::timestamp) as date,
+			%[1]s as group_key,
+			%[2]s as group_label,
+			sum(fw.count) as count,
+			floor(sum(fw.outgoing_amount_msat)/1000) as amount,
+			floor(sum(fw.fee_msat)/1000) as revenue
+		from forwards_between(?::timestamp AT TIME ZONE (table tz),
+			(?::timestamp AT TIME ZONE (table tz)) - interval '1 microsecond', (table tz), ?) as fw
+		%[3]s
+		group by 1, 2, 3
+		order by 1, 2;`, groupKey, groupLabel, joins)
+
+	// Weeks and months start at midnight as well, only hourly buckets need the local hours.
+	localUnit := "day"
+	if bucket == "hour" {
+		localUnit = "hour"
+	}
+
+	rows, err := db.Query(db.Rebind(sql), statsBuckets[bucket], origin, from, to, localUnit)
+	if err != nil {
+		return nil, errors.Wrap(err, "Running routing statistics query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		b := &statsBucket{}
+		err = rows.Scan(&b.Date, &b.Group, &b.GroupLabel, &b.Count, &b.Amount, &b.Revenue)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, b)
+	}
+	return r, rows.Err()
+}
@@ -0,0 +1,149 @@
+package forwards
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lncapital/torq/testutil"
+)
+
+func Test_previousPeriod(t *testing.T) {
+	from := time.Date(2022, 10, 10, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2022, 10, 17, 0, 0, 0, 0, time.UTC)
+
+	prevFrom, prevTo := previousPeriod(from, to)
+	if !prevFrom.Equal(time.Date(2022, 10, 3, 0, 0, 0, 0, time.UTC)) || !prevTo.Equal(from) {
+		t.Errorf("unexpected previous period %v - %v", prevFrom, prevTo)
+	}
+}
+
+func Test_percentChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous uint64
+		current  uint64
+		want     *float64
+	}{
+		{"increase", 200, 300, floatPtr(50)},
+		{"decrease", 300, 200, floatPtr(-33.33)},
+		{"no previous", 0, 100, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := percentChange(tt.previous, tt.current)
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("percentChange(%d, %d) = %v, want %v", tt.previous, tt.current, got, tt.want)
+			}
+		})
+	}
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+// The aggregated hours are UTC hours, in India the local days and hours start in the middle of them.
+func TestGetRoutingStatsHalfHourTimeZone(t *testing.T) {
+	srv, err := testutil.InitTestDBConn()
+	if err != nil {
+		panic(err)
+	}
+
+	db, err := srv.NewTestDatabase(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := srv.Cleanup(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	db.MustExec(`UPDATE settings SET preferred_timezone = 'Asia/Kolkata';`)
+	// 17:30 and 23:45 on October 10 and 00:15 on October 11 in India.
+	for _, fw := range []time.Time{
+		time.Date(2022, 10, 10, 12, 0, 0, 0, time.UTC),
+		time.Date(2022, 10, 10, 18, 15, 0, 0, time.UTC),
+		time.Date(2022, 10, 10, 18, 45, 0, 0, time.UTC),
+	} {
+		db.MustExec(`
+			INSERT INTO forward (time, time_ns, fee_msat, lnd_incoming_short_channel_id, lnd_outgoing_short_channel_id,
+				incoming_short_channel_id, outgoing_short_channel_id, incoming_amount_msat, outgoing_amount_msat)
+			VALUES ($1, $2, 1000, 1, 2, '0x0x1', '0x0x2', 101000, 100000);`, fw, fw.UnixNano())
+	}
+	db.MustExec(`CALL refresh_continuous_aggregate('forward_hourly', NULL, NULL);`)
+
+	from := time.Date(2022, 10, 10, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2022, 10, 12, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		bucket string
+		want   map[string]uint64
+	}{
+		{"day", map[string]uint64{"2022-10-10 00:00": 2, "2022-10-11 00:00": 1}},
+		{"hour", map[string]uint64{"2022-10-10 17:00": 1, "2022-10-10 23:00": 1, "2022-10-11 00:00": 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.bucket, func(t *testing.T) {
+			buckets, err := getRoutingStats(db, from, to, test.bucket, groupByNone, "outgoing")
+			if err != nil {
+				t.Fatalf("getRoutingStats() error = %v", err)
+			}
+			got := make(map[string]uint64)
+			for _, b := range buckets {
+				got[b.Date.Format("2006-01-02 15:04")] = b.Count
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("getRoutingStats() counts = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetRoutingStatsDroppedForwards(t *testing.T) {
+	srv, err := testutil.InitTestDBConn()
+	if err != nil {
+		panic(err)
+	}
+
+	db, err := srv.NewTestDatabase(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := srv.Cleanup(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	db.MustExec(`UPDATE settings SET preferred_timezone = 'Asia/Kolkata';`)
+	for _, fw := range []time.Time{
+		time.Date(2022, 10, 10, 12, 0, 0, 0, time.UTC),
+		time.Date(2022, 10, 10, 18, 15, 0, 0, time.UTC),
+		time.Date(2022, 10, 10, 18, 45, 0, 0, time.UTC),
+	} {
+		db.MustExec(`
+			INSERT INTO forward (time, time_ns, fee_msat, lnd_incoming_short_channel_id, lnd_outgoing_short_channel_id,
+				incoming_short_channel_id, outgoing_short_channel_id, incoming_amount_msat, outgoing_amount_msat)
+			VALUES ($1, $2, 1000, 1, 2, '0x0x1', '0x0x2', 101000, 100000);`, fw, fw.UnixNano())
+	}
+	db.MustExec(`CALL refresh_continuous_aggregate('forward_hourly', NULL, NULL);`)
+	// As a retention policy would, drops the forwards and keeps their hourly totals.
+	db.MustExec(`SELECT drop_chunks('forward', older_than => now());`)
+
+	// The hour split by the local day is counted in the day it starts in, the range starts in the middle of an hour.
+	from := time.Date(2022, 10, 10, 11, 30, 0, 0, time.UTC)
+	to := time.Date(2022, 10, 12, 0, 0, 0, 0, time.UTC)
+	buckets, err := getRoutingStats(db, from, to, "day", groupByNone, "outgoing")
+	if err != nil {
+		t.Fatalf("getRoutingStats() error = %v", err)
+	}
+	got := make(map[string]uint64)
+	for _, b := range buckets {
+		got[b.Date.Format("2006-01-02 15:04")] = b.Count
+	}
+	want := map[string]uint64{"2022-10-10 00:00": 3}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getRoutingStats() counts = %v, want %v", got, want)
+	}
+}
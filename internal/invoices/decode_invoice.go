@@ -108,8 +108,8 @@ func constructDecodedInvoice(decodedInvoice *lnrpc.PayReq) *DecodedInvoice {
 	}
 }
 
-// decodeInvoice Decode a lightning invoice
-func decodeInvoice(db *sqlx.DB, invoice string, nodeId int) (*DecodedInvoice, error) {
+// DecodeInvoice Decode a lightning invoice
+func DecodeInvoice(db *sqlx.DB, invoice string, nodeId int) (*DecodedInvoice, error) {
 	//log.Info().Msgf("Decoding invoice: %s", invoice)
 	// Get lnd client
 	connectionDetails, err := settings.GetNodeConnectionDetailsById(db, nodeId)
@@ -161,7 +161,7 @@ func decodeInvoiceHandler(c *gin.Context, db *sqlx.DB) {
 		return
 	}
 
-	di, err := decodeInvoice(db, invoice, nodeId)
+	di, err := DecodeInvoice(db, invoice, nodeId)
 
 	if err != nil {
 		log.Error().Err(err).Msgf("Error decoding invoice: %v", err)
@@ -12,7 +12,7 @@ import (
 	"strconv"
 )
 
-type newInvoiceRequest struct {
+type NewInvoiceRequest struct {
 	NodeId          int     `json:"nodeId"`
 	Memo            *string `json:"memo"`
 	RPreImage       *string `json:"rPreImage"`
@@ -23,12 +23,56 @@ type newInvoiceRequest struct {
 	IsAmp           *bool   `json:"isAmp"`
 }
 
-type newInvoiceResponse struct {
+type NewInvoiceResponse struct {
 	PaymentRequest string `json:"paymentRequest"`
 	AddIndex       uint64 `json:"addIndex"`
 	PaymentAddress string `json:"paymentAddress"`
 }
 
+// invoiceColumns are the columns invoices can be filtered by.
+var invoiceColumns = qp.ColumnSchema{
+	"add_index":           qp.NumberColumn,
+	"creation_date":       qp.DateColumn,
+	"settle_date":         qp.DateColumn,
+	"settle_index":        qp.NumberColumn,
+	"payment_request":     qp.StringColumn,
+	"destination_pub_key": qp.StringColumn,
+	"r_hash":              qp.StringColumn,
+	"r_preimage":          qp.StringColumn,
+	"memo":                qp.StringColumn,
+	"value":               qp.NumberColumn,
+	"amt_paid":            qp.NumberColumn,
+	"invoice_state":       qp.StringColumn,
+	"is_rebalance":        qp.BooleanColumn,
+	"is_keysend":          qp.BooleanColumn,
+	"is_amp":              qp.BooleanColumn,
+	"payment_addr":        qp.StringColumn,
+	"fallback_addr":       qp.StringColumn,
+	"updated_on":          qp.DateColumn,
+	"expiry":              qp.NumberColumn,
+	"cltv_expiry":         qp.NumberColumn,
+	"private":             qp.BooleanColumn,
+	"tags":                qp.ArrayColumn,
+}
+
+// invoiceSortColumns are the columns invoices can be sorted by.
+var invoiceSortColumns = []string{
+	"creation_date",
+	"settle_date",
+	"add_index",
+	"settle_index",
+	"memo",
+	"value",
+	"amt_paid",
+	"invoice_state",
+	"is_rebalance",
+	"is_keysend",
+	"is_amp",
+	"updated_on",
+	"expiry",
+	"private",
+}
+
 func getInvoicesHandler(c *gin.Context, db *sqlx.DB) {
 
 	// Filter parser with whitelisted columns
@@ -36,30 +80,14 @@ func getInvoicesHandler(c *gin.Context, db *sqlx.DB) {
 	filterParam := c.Query("filter")
 	var err error
 	if filterParam != "" {
-		filter, err = qp.ParseFilterParam(filterParam, []string{
-			"add_index",
-			"creation_date",
-			"settle_date",
-			"settle_index",
-			"payment_request",
-			"destination_pub_key",
-			"r_hash",
-			"r_preimage",
-			"memo",
-			"value",
-			"amt_paid",
-			"invoice_state",
-			"is_rebalance",
-			"is_keysend",
-			"is_amp",
-			"payment_addr",
-			"fallback_addr",
-			"updated_on",
-			"expiry",
-			"cltv_expiry",
-			"private",
-		})
-		if err != nil {
+		filter, err = qp.ParseFilterParamWithSchema(filterParam, invoiceColumns)
+		switch e := err.(type) {
+		case nil:
+			break
+		case qp.ErrInvalidFilter:
+			c.JSON(http.StatusBadRequest, gin.H{"Error": e.Error(), "Key": e.Key})
+			return
+		default:
 			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
 			return
 		}
@@ -69,24 +97,7 @@ func getInvoicesHandler(c *gin.Context, db *sqlx.DB) {
 	sortParam := c.Query("order")
 	if sortParam != "" {
 		// Order parser with whitelisted columns
-		sort, err = qp.ParseOrderParams(
-			sortParam,
-			[]string{
-				"creation_date",
-				"settle_date",
-				"add_index",
-				"settle_index",
-				"memo",
-				"value",
-				"amt_paid",
-				"invoice_state",
-				"is_rebalance",
-				"is_keysend",
-				"is_amp",
-				"updated_on",
-				"expiry",
-				"private",
-			})
+		sort, err = qp.ParseOrderParams(sortParam, invoiceSortColumns)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
 			return
@@ -159,7 +170,7 @@ func getInvoiceHandler(c *gin.Context, db *sqlx.DB) {
 
 func newInvoiceHandler(c *gin.Context, db *sqlx.DB) {
 
-	var requestBody newInvoiceRequest
+	var requestBody NewInvoiceRequest
 
 	if err := c.BindJSON(&requestBody); err != nil {
 		log.Error().Msgf("JSON binding the request body")
@@ -167,7 +178,7 @@ func newInvoiceHandler(c *gin.Context, db *sqlx.DB) {
 		return
 	}
 
-	resp, err := newInvoice(db, requestBody)
+	resp, err := NewInvoice(db, requestBody)
 	if err != nil {
 		server_errors.WrapLogAndSendServerError(c, err, "Creating new invoice")
 		return
@@ -181,5 +192,78 @@ func RegisterInvoicesRoutes(r *gin.RouterGroup, db *sqlx.DB) {
 	r.GET("decode/", func(c *gin.Context) { decodeInvoiceHandler(c, db) })
 	r.GET(":identifier", func(c *gin.Context) { getInvoiceHandler(c, db) })
 	r.POST("newinvoice", func(c *gin.Context) { newInvoiceHandler(c, db) })
+	r.POST("hold", func(c *gin.Context) { newHoldInvoiceHandler(c, db) })
+	r.GET("hold", func(c *gin.Context) { getHoldInvoicesHandler(c, db) })
+	r.POST("hold/settle", func(c *gin.Context) { settleHoldInvoiceHandler(c, db) })
+	r.POST("hold/cancel", func(c *gin.Context) { cancelHoldInvoiceHandler(c, db) })
+
+}
+
+func newHoldInvoiceHandler(c *gin.Context, db *sqlx.DB) {
+	var requestBody NewHoldInvoiceRequest
+	if err := c.BindJSON(&requestBody); err != nil {
+		server_errors.WrapLogAndSendServerError(c, err, "JSON binding the request body")
+		return
+	}
+	if _, err := processHoldInvoiceReq(requestBody); err != nil {
+		server_errors.SendBadRequestFromError(c, err)
+		return
+	}
+
+	resp, err := NewHoldInvoice(c.Request.Context(), db, requestBody)
+	if err != nil {
+		server_errors.WrapLogAndSendServerError(c, err, "Creating new hold invoice")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// getHoldInvoicesHandler returns the accepted invoices of a node that wait to be settled or canceled.
+func getHoldInvoicesHandler(c *gin.Context, db *sqlx.DB) {
+	nodeId, err := strconv.Atoi(c.Query("nodeId"))
+	if err != nil {
+		server_errors.SendBadRequest(c, "Node id must be a number")
+		return
+	}
+
+	r, err := ListAcceptedHoldInvoices(c.Request.Context(), db, nodeId)
+	if err != nil {
+		server_errors.WrapLogAndSendServerError(c, err, "Listing hold invoices")
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+func settleHoldInvoiceHandler(c *gin.Context, db *sqlx.DB) {
+	var requestBody SettleHoldInvoiceRequest
+	if err := c.BindJSON(&requestBody); err != nil {
+		server_errors.WrapLogAndSendServerError(c, err, "JSON binding the request body")
+		return
+	}
+
+	state, err := SettleHoldInvoice(c.Request.Context(), db, requestBody)
+	if err != nil {
+		server_errors.WrapLogAndSendServerError(c, err, "Settling hold invoice")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invoiceState": state})
+}
+
+func cancelHoldInvoiceHandler(c *gin.Context, db *sqlx.DB) {
+	var requestBody CancelHoldInvoiceRequest
+	if err := c.BindJSON(&requestBody); err != nil {
+		server_errors.WrapLogAndSendServerError(c, err, "JSON binding the request body")
+		return
+	}
+
+	state, err := CancelHoldInvoice(c.Request.Context(), db, requestBody)
+	if err != nil {
+		server_errors.WrapLogAndSendServerError(c, err, "Canceling hold invoice")
+		return
+	}
 
+	c.JSON(http.StatusOK, gin.H{"invoiceState": state})
 }
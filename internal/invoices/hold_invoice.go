@@ -0,0 +1,411 @@
+package invoices
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/cockroachdb/errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
+	"github.com/lncapital/torq/internal/channels"
+	"github.com/lncapital/torq/internal/settings"
+	"github.com/lncapital/torq/pkg/lnd_connect"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"time"
+)
+
+type lndClientHoldInvoice interface {
+	ListInvoices(ctx context.Context, in *lnrpc.ListInvoiceRequest,
+		opts ...grpc.CallOption) (*lnrpc.ListInvoiceResponse, error)
+	LookupInvoice(ctx context.Context, in *lnrpc.PaymentHash, opts ...grpc.CallOption) (*lnrpc.Invoice, error)
+	GetInfo(ctx context.Context, in *lnrpc.GetInfoRequest, opts ...grpc.CallOption) (*lnrpc.GetInfoResponse, error)
+}
+
+type NewHoldInvoiceRequest struct {
+	NodeId int `json:"nodeId"`
+	// Hash is the hex encoded payment hash. The preimage stays with the caller until the invoice is settled.
+	Hash       string  `json:"hash"`
+	Memo       *string `json:"memo"`
+	ValueMsat  *int64  `json:"valueMsat"`
+	Expiry     *int64  `json:"expiry"`
+	CltvExpiry *uint64 `json:"cltvExpiry"`
+	Private    *bool   `json:"private"`
+	// AutoCancelBlocks cancels the invoice when the first accepted HTLC is this many blocks from expiring.
+	AutoCancelBlocks *int32 `json:"autoCancelBlocks"`
+}
+
+type HoldInvoiceHtlc struct {
+	LNDShortChannelId uint64 `json:"lndShortChannelId"`
+	ShortChannelId    string `json:"shortChannelId"`
+	AmtMsat           uint64 `json:"amtMsat"`
+	AcceptHeight      int32  `json:"acceptHeight"`
+	ExpiryHeight      int32  `json:"expiryHeight"`
+}
+
+// HoldInvoice is an accepted hold invoice waiting to be settled or canceled.
+type HoldInvoice struct {
+	RHash          string            `json:"rHash"`
+	PaymentRequest string            `json:"paymentRequest"`
+	Memo           string            `json:"memo"`
+	ValueMsat      int64             `json:"valueMsat"`
+	AmtPaidMsat    int64             `json:"amtPaidMsat"`
+	State          string            `json:"state"`
+	Htlcs          []HoldInvoiceHtlc `json:"htlcs"`
+	// ExpiryHeight is the height the first HTLC expires at, the invoice has to be settled or canceled before.
+	ExpiryHeight     int32  `json:"expiryHeight"`
+	BlocksLeft       int32  `json:"blocksLeft"`
+	AutoCancelBlocks *int32 `json:"autoCancelBlocks"`
+}
+
+type SettleHoldInvoiceRequest struct {
+	NodeId   int    `json:"nodeId"`
+	Preimage string `json:"preimage"`
+}
+
+type CancelHoldInvoiceRequest struct {
+	NodeId int    `json:"nodeId"`
+	Hash   string `json:"hash"`
+}
+
+func decodeHash(s string, name string) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 32 {
+		return nil, errors.Newf("%s has to be 32 hex encoded bytes", name)
+	}
+	return b, nil
+}
+
+func processHoldInvoiceReq(req NewHoldInvoiceRequest) (inv invoicesrpc.AddHoldInvoiceRequest, err error) {
+	if req.NodeId == 0 {
+		return inv, errors.New("Node id is missing")
+	}
+
+	inv.Hash, err = decodeHash(req.Hash, "Hash")
+	if err != nil {
+		return inv, err
+	}
+
+	if req.Memo != nil {
+		inv.Memo = *req.Memo
+	}
+
+	if req.ValueMsat != nil {
+		inv.ValueMsat = *req.ValueMsat
+	}
+
+	if req.Expiry != nil {
+		inv.Expiry = *req.Expiry
+	}
+
+	if req.CltvExpiry != nil {
+		inv.CltvExpiry = *req.CltvExpiry
+	}
+
+	if req.Private != nil {
+		inv.Private = *req.Private
+	}
+
+	if req.AutoCancelBlocks != nil && *req.AutoCancelBlocks <= 0 {
+		return inv, errors.New("Auto cancel blocks has to be positive")
+	}
+
+	return inv, nil
+}
+
+func connectNode(db *sqlx.DB, nodeId int) (*grpc.ClientConn, error) {
+	connectionDetails, err := settings.GetNodeConnectionDetailsById(db, nodeId)
+	if err != nil {
+		return nil, errors.Wrap(err, "Getting node connection details from the db")
+	}
+	conn, err := lnd_connect.Connect(
+		connectionDetails.GRPCAddress,
+		connectionDetails.TLSFileBytes,
+		connectionDetails.MacaroonFileBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "Connecting to LND")
+	}
+	return conn, nil
+}
+
+func NewHoldInvoice(ctx context.Context, db *sqlx.DB, req NewHoldInvoiceRequest) (r NewInvoiceResponse, err error) {
+	holdInvoiceReq, err := processHoldInvoiceReq(req)
+	if err != nil {
+		return r, err
+	}
+
+	if err = settings.CheckNodePermission(db, req.NodeId, settings.ActionHoldInvoice); err != nil {
+		return r, err
+	}
+	conn, err := connectNode(db, req.NodeId)
+	if err != nil {
+		return r, err
+	}
+	defer conn.Close()
+
+	resp, err := invoicesrpc.NewInvoicesClient(conn).AddHoldInvoice(ctx, &holdInvoiceReq)
+	if err != nil {
+		return r, errors.Wrap(err, "Creating hold invoice on node")
+	}
+
+	_, err = db.Exec(`
+INSERT INTO hold_invoice (r_hash, local_node_id, auto_cancel_blocks, created_on)
+VALUES ($1, $2, $3, $4);`, hex.EncodeToString(holdInvoiceReq.Hash), req.NodeId, req.AutoCancelBlocks, time.Now().UTC())
+	if err != nil {
+		return r, errors.Wrap(err, "Storing hold invoice")
+	}
+
+	r.PaymentRequest = resp.GetPaymentRequest()
+	r.AddIndex = resp.GetAddIndex()
+	r.PaymentAddress = hex.EncodeToString(resp.GetPaymentAddr())
+	return r, nil
+}
+
+// getAutoCancelBlocks returns the auto cancel setting of the hold invoices of a node by payment hash.
+func getAutoCancelBlocks(db *sqlx.DB, nodeId int) (map[string]*int32, error) {
+	rows, err := db.Queryx(`SELECT r_hash, auto_cancel_blocks FROM hold_invoice WHERE local_node_id = $1;`, nodeId)
+	if err != nil {
+		return nil, errors.Wrap(err, "Getting hold invoices")
+	}
+	defer rows.Close()
+
+	r := make(map[string]*int32)
+	for rows.Next() {
+		var hash string
+		var blocks *int32
+		if err = rows.Scan(&hash, &blocks); err != nil {
+			return nil, errors.Wrap(err, "Getting hold invoices")
+		}
+		r[hash] = blocks
+	}
+	return r, rows.Err()
+}
+
+// acceptedHoldInvoices returns the invoices of the node that have accepted HTLCs but are not settled yet.
+func acceptedHoldInvoices(ctx context.Context, client lndClientHoldInvoice,
+	autoCancel map[string]*int32) (r []HoldInvoice, pending []*lnrpc.Invoice, err error) {
+
+	info, err := client.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Getting block height")
+	}
+
+	var offset uint64
+	for {
+		resp, err := client.ListInvoices(ctx, &lnrpc.ListInvoiceRequest{
+			PendingOnly:    true,
+			IndexOffset:    offset,
+			NumMaxInvoices: 1000,
+		})
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Listing pending invoices")
+		}
+		for _, inv := range resp.Invoices {
+			if inv.State != lnrpc.Invoice_ACCEPTED {
+				continue
+			}
+			pending = append(pending, inv)
+			r = append(r, convertHoldInvoice(inv, int32(info.BlockHeight), autoCancel))
+		}
+		if len(resp.Invoices) < 1000 {
+			break
+		}
+		offset = resp.LastIndexOffset
+	}
+	return r, pending, nil
+}
+
+func convertHoldInvoice(inv *lnrpc.Invoice, height int32, autoCancel map[string]*int32) HoldInvoice {
+	h := HoldInvoice{
+		RHash:            hex.EncodeToString(inv.RHash),
+		PaymentRequest:   inv.PaymentRequest,
+		Memo:             inv.Memo,
+		ValueMsat:        inv.ValueMsat,
+		AmtPaidMsat:      inv.AmtPaidMsat,
+		State:            inv.State.String(),
+		AutoCancelBlocks: autoCancel[hex.EncodeToString(inv.RHash)],
+	}
+	for _, htlc := range inv.Htlcs {
+		if htlc.State != lnrpc.InvoiceHTLCState_ACCEPTED {
+			continue
+		}
+		h.Htlcs = append(h.Htlcs, HoldInvoiceHtlc{
+			LNDShortChannelId: htlc.ChanId,
+			ShortChannelId:    channels.ConvertLNDShortChannelID(htlc.ChanId),
+			AmtMsat:           htlc.AmtMsat,
+			AcceptHeight:      htlc.AcceptHeight,
+			ExpiryHeight:      htlc.ExpiryHeight,
+		})
+		if h.ExpiryHeight == 0 || htlc.ExpiryHeight < h.ExpiryHeight {
+			h.ExpiryHeight = htlc.ExpiryHeight
+		}
+	}
+	h.BlocksLeft = h.ExpiryHeight - height
+	return h
+}
+
+// ListAcceptedHoldInvoices only reads the invoices from the node, their states are stored by WatchHoldInvoices.
+func ListAcceptedHoldInvoices(ctx context.Context, db *sqlx.DB, nodeId int) ([]HoldInvoice, error) {
+	autoCancel, err := getAutoCancelBlocks(db, nodeId)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := connectNode(db, nodeId)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	r, _, err := acceptedHoldInvoices(ctx, lnrpc.NewLightningClient(conn), autoCancel)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func SettleHoldInvoice(ctx context.Context, db *sqlx.DB, req SettleHoldInvoiceRequest) (string, error) {
+	if req.NodeId == 0 {
+		return "", errors.New("Node id is missing")
+	}
+	preimage, err := decodeHash(req.Preimage, "Preimage")
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(preimage)
+
+	if err = settings.CheckNodePermission(db, req.NodeId, settings.ActionHoldInvoice); err != nil {
+		return "", err
+	}
+	conn, err := connectNode(db, req.NodeId)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	_, err = invoicesrpc.NewInvoicesClient(conn).SettleInvoice(ctx, &invoicesrpc.SettleInvoiceMsg{Preimage: preimage})
+	if err != nil {
+		return "", errors.Wrap(err, "Settling hold invoice")
+	}
+	return storeInvoiceState(ctx, db, lnrpc.NewLightningClient(conn), hash[:])
+}
+
+func CancelHoldInvoice(ctx context.Context, db *sqlx.DB, req CancelHoldInvoiceRequest) (string, error) {
+	if req.NodeId == 0 {
+		return "", errors.New("Node id is missing")
+	}
+	hash, err := decodeHash(req.Hash, "Hash")
+	if err != nil {
+		return "", err
+	}
+
+	if err = settings.CheckNodePermission(db, req.NodeId, settings.ActionHoldInvoice); err != nil {
+		return "", err
+	}
+	conn, err := connectNode(db, req.NodeId)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	_, err = invoicesrpc.NewInvoicesClient(conn).CancelInvoice(ctx, &invoicesrpc.CancelInvoiceMsg{PaymentHash: hash})
+	if err != nil {
+		return "", errors.Wrap(err, "Canceling hold invoice")
+	}
+	return storeInvoiceState(ctx, db, lnrpc.NewLightningClient(conn), hash)
+}
+
+// storeInvoiceState looks up the invoice after a state change and stores the new state. The invoice
+// subscription only reports added and settled invoices.
+func storeInvoiceState(ctx context.Context, db *sqlx.DB, client lndClientHoldInvoice, hash []byte) (string, error) {
+	inv, err := client.LookupInvoice(ctx, &lnrpc.PaymentHash{RHash: hash})
+	if err != nil {
+		return "", errors.Wrap(err, "Looking up invoice")
+	}
+	if err = updateInvoiceState(db, inv); err != nil {
+		return "", err
+	}
+	return inv.State.String(), nil
+}
+
+func updateInvoiceState(db *sqlx.DB, inv *lnrpc.Invoice) error {
+	htlcJson, err := json.Marshal(inv.Htlcs)
+	if err != nil {
+		return errors.Wrap(err, "JSON marshal htlcs")
+	}
+
+	var settleDate *time.Time
+	if inv.SettleDate != 0 {
+		d := time.Unix(inv.SettleDate, 0).UTC()
+		settleDate = &d
+	}
+
+	_, err = db.Exec(`
+UPDATE invoice SET
+  invoice_state = $1,
+  htlcs = $2,
+  amt_paid_msat = $3,
+  settle_date = coalesce($4, settle_date),
+  settle_index = $5,
+  r_preimage = $6,
+  updated_on = $7
+WHERE r_hash = $8 AND invoice_state IS DISTINCT FROM $1;`,
+		inv.State.String(), htlcJson, inv.AmtPaidMsat, settleDate, inv.SettleIndex,
+		hex.EncodeToString(inv.RPreimage), time.Now().UTC(), hex.EncodeToString(inv.RHash))
+	if err != nil {
+		return errors.Wrap(err, "Updating invoice state")
+	}
+	return nil
+}
+
+// WatchHoldInvoices keeps the state of accepted hold invoices up to date and cancels the ones with auto cancel
+// before their HTLCs expire.
+func WatchHoldInvoices(ctx context.Context, conn *grpc.ClientConn, db *sqlx.DB, localNodeId int) error {
+	client := lnrpc.NewLightningClient(conn)
+	invoicesClient := invoicesrpc.NewInvoicesClient(conn)
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		autoCancel, err := getAutoCancelBlocks(db, localNodeId)
+		if err != nil {
+			log.Error().Err(err).Msg("Watch hold invoices")
+			continue
+		}
+		accepted, pending, err := acceptedHoldInvoices(ctx, client, autoCancel)
+		if err != nil {
+			log.Error().Err(err).Msg("Watch hold invoices")
+			continue
+		}
+
+		for i, h := range accepted {
+			if err := updateInvoiceState(db, pending[i]); err != nil {
+				log.Error().Err(err).Msg("Watch hold invoices")
+			}
+			if !autoCancelDue(h) {
+				continue
+			}
+			log.Info().Msgf("Canceling hold invoice %s, its HTLCs expire in %d blocks", h.RHash, h.BlocksLeft)
+			_, err = invoicesClient.CancelInvoice(ctx, &invoicesrpc.CancelInvoiceMsg{PaymentHash: pending[i].RHash})
+			if err != nil {
+				log.Error().Err(err).Msgf("Canceling hold invoice %s", h.RHash)
+				continue
+			}
+			if _, err = storeInvoiceState(ctx, db, client, pending[i].RHash); err != nil {
+				log.Error().Err(err).Msg("Watch hold invoices")
+			}
+		}
+	}
+}
+
+func autoCancelDue(h HoldInvoice) bool {
+	return h.AutoCancelBlocks != nil && len(h.Htlcs) != 0 && h.BlocksLeft <= *h.AutoCancelBlocks
+}
@@ -0,0 +1,90 @@
+package invoices
+
+import (
+	"context"
+	"encoding/hex"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"google.golang.org/grpc"
+	"testing"
+)
+
+const testHash = "a5b9f2e4b4c4d1c7f4b6b0a8e3e5d9c1b2a3f4e5d6c7b8a9f0e1d2c3b4a5f6e7"
+
+type mockLightningClient_HoldInvoice struct {
+	invoices    []*lnrpc.Invoice
+	blockHeight uint32
+}
+
+func (c *mockLightningClient_HoldInvoice) ListInvoices(ctx context.Context, in *lnrpc.ListInvoiceRequest,
+	opts ...grpc.CallOption) (*lnrpc.ListInvoiceResponse, error) {
+	return &lnrpc.ListInvoiceResponse{Invoices: c.invoices}, nil
+}
+
+func (c *mockLightningClient_HoldInvoice) LookupInvoice(ctx context.Context, in *lnrpc.PaymentHash,
+	opts ...grpc.CallOption) (*lnrpc.Invoice, error) {
+	return c.invoices[0], nil
+}
+
+func (c *mockLightningClient_HoldInvoice) GetInfo(ctx context.Context, in *lnrpc.GetInfoRequest,
+	opts ...grpc.CallOption) (*lnrpc.GetInfoResponse, error) {
+	return &lnrpc.GetInfoResponse{BlockHeight: c.blockHeight}, nil
+}
+
+func Test_processHoldInvoiceReq(t *testing.T) {
+	var blocks int32 = 0
+	tests := []struct {
+		name    string
+		input   NewHoldInvoiceRequest
+		wantErr bool
+	}{
+		{"Node ID missing", NewHoldInvoiceRequest{Hash: testHash}, true},
+		{"Invalid hash", NewHoldInvoiceRequest{NodeId: 1, Hash: "abcd"}, true},
+		{"Invalid auto cancel blocks", NewHoldInvoiceRequest{NodeId: 1, Hash: testHash, AutoCancelBlocks: &blocks},
+			true},
+		{"Valid", NewHoldInvoiceRequest{NodeId: 1, Hash: testHash}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := processHoldInvoiceReq(test.input)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("processHoldInvoiceReq() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if err == nil && hex.EncodeToString(got.Hash) != testHash {
+				t.Errorf("processHoldInvoiceReq() hash = %x, want %s", got.Hash, testHash)
+			}
+		})
+	}
+}
+
+func Test_acceptedHoldInvoices(t *testing.T) {
+	hash, _ := hex.DecodeString(testHash)
+	client := &mockLightningClient_HoldInvoice{
+		blockHeight: 100,
+		invoices: []*lnrpc.Invoice{
+			{RHash: []byte{1}, State: lnrpc.Invoice_OPEN},
+			{RHash: hash, State: lnrpc.Invoice_ACCEPTED, ValueMsat: 1000, Htlcs: []*lnrpc.InvoiceHTLC{
+				{State: lnrpc.InvoiceHTLCState_ACCEPTED, ExpiryHeight: 140, AmtMsat: 500},
+				{State: lnrpc.InvoiceHTLCState_ACCEPTED, ExpiryHeight: 130, AmtMsat: 500},
+				{State: lnrpc.InvoiceHTLCState_CANCELED, ExpiryHeight: 110, AmtMsat: 500},
+			}},
+		},
+	}
+	var blocks int32 = 30
+	r, pending, err := acceptedHoldInvoices(context.Background(), client, map[string]*int32{testHash: &blocks})
+	if err != nil {
+		t.Fatalf("acceptedHoldInvoices() error = %v", err)
+	}
+	if len(r) != 1 || len(pending) != 1 {
+		t.Fatalf("Got %d hold invoices, want 1", len(r))
+	}
+	if r[0].ExpiryHeight != 130 || r[0].BlocksLeft != 30 || len(r[0].Htlcs) != 2 {
+		t.Errorf("Hold invoice = %+v, want the expiry of the first accepted HTLC", r[0])
+	}
+	if !autoCancelDue(r[0]) {
+		t.Errorf("autoCancelDue() = false, want true with %d blocks left", r[0].BlocksLeft)
+	}
+	blocks = 10
+	if autoCancelDue(r[0]) {
+		t.Errorf("autoCancelDue() = true, want false with %d blocks left", r[0].BlocksLeft)
+	}
+}
@@ -5,31 +5,34 @@ import (
 	"encoding/json"
 	sq "github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	qp "github.com/lncapital/torq/internal/query_parser"
 	"time"
 )
 
 type Invoice struct {
-	CreationDate      *time.Time `json:"creation_date" db:"creation_date"`
-	SettleDate        *time.Time `json:"settle_date" db:"settle_date"`
-	AddIndex          uint64     `json:"add_index" db:"add_index"`
-	SettleIndex       *uint64    `json:"settle_index" db:"settle_index"`
-	PaymentRequest    *string    `json:"payment_request" db:"payment_request"`
-	DestinationPubKey *string    `json:"destination_pub_key" db:"destination_pub_key"`
-	RHash             *string    `json:"r_hash" db:"r_hash"`
-	RPreimage         *string    `json:"r_preimage" db:"r_preimage"`
-	Memo              *string    `json:"memo" db:"memo"`
-	Value             *float64   `json:"value" db:"value"`
-	AmountPaid        *float64   `json:"amt_paid" db:"amt_paid"`
-	InvoiceState      *string    `json:"invoice_state" db:"invoice_state"`
-	IsRebalance       *bool      `json:"is_rebalance" db:"is_rebalance"`
-	IsKeysend         *bool      `json:"is_keysend" db:"is_keysend"`
-	IsAmp             *bool      `json:"is_amp" db:"is_amp"`
-	PaymentAddr       *string    `json:"payment_addr" db:"payment_addr"`
-	FallbackAddr      *string    `json:"fallback_addr" db:"fallback_addr"`
-	UpdatedOn         *time.Time `json:"updated_on" db:"updated_on"` // Generated by Torq if the status has changed
-	Expiry            *uint32    `json:"expiry" db:"expiry"`
-	CltvExpiry        *uint32    `json:"cltv_expiry" db:"cltv_expiry"`
-	Private           *bool      `json:"private" db:"private"`
+	CreationDate      *time.Time     `json:"creation_date" db:"creation_date"`
+	SettleDate        *time.Time     `json:"settle_date" db:"settle_date"`
+	AddIndex          uint64         `json:"add_index" db:"add_index"`
+	SettleIndex       *uint64        `json:"settle_index" db:"settle_index"`
+	PaymentRequest    *string        `json:"payment_request" db:"payment_request"`
+	DestinationPubKey *string        `json:"destination_pub_key" db:"destination_pub_key"`
+	RHash             *string        `json:"r_hash" db:"r_hash"`
+	RPreimage         *string        `json:"r_preimage" db:"r_preimage"`
+	Memo              *string        `json:"memo" db:"memo"`
+	Value             *float64       `json:"value" db:"value"`
+	AmountPaid        *float64       `json:"amt_paid" db:"amt_paid"`
+	InvoiceState      *string        `json:"invoice_state" db:"invoice_state"`
+	IsRebalance       *bool          `json:"is_rebalance" db:"is_rebalance"`
+	IsKeysend         *bool          `json:"is_keysend" db:"is_keysend"`
+	IsAmp             *bool          `json:"is_amp" db:"is_amp"`
+	PaymentAddr       *string        `json:"payment_addr" db:"payment_addr"`
+	FallbackAddr      *string        `json:"fallback_addr" db:"fallback_addr"`
+	UpdatedOn         *time.Time     `json:"updated_on" db:"updated_on"` // Generated by Torq if the status has changed
+	Expiry            *uint32        `json:"expiry" db:"expiry"`
+	CltvExpiry        *uint32        `json:"cltv_expiry" db:"cltv_expiry"`
+	Private           *bool          `json:"private" db:"private"`
+	Tags              pq.StringArray `json:"tags" db:"tags"`
 }
 
 func getInvoices(db *sqlx.DB, filter sq.Sqlizer, order []string, limit uint64, offset uint64) (r []*Invoice,
@@ -56,7 +59,8 @@ func getInvoices(db *sqlx.DB, filter sq.Sqlizer, order []string, limit uint64, o
 				invoice.updated_on,
 				expiry,
 				cltv_expiry,
-				private
+				private,
+				pub_key_tags(invoice.destination_pub_key) as tags
 			`).From("invoice").LeftJoin("payment p on (invoice.r_hash = p.payment_hash)"), "subq").
 		PlaceholderFormat(sq.Dollar).
 		Where(filter).
@@ -104,6 +108,7 @@ func getInvoices(db *sqlx.DB, filter sq.Sqlizer, order []string, limit uint64, o
 			&i.Expiry,
 			&i.CltvExpiry,
 			&i.Private,
+			&i.Tags,
 		)
 
 		if err != nil {
@@ -138,7 +143,8 @@ func getInvoices(db *sqlx.DB, filter sq.Sqlizer, order []string, limit uint64, o
 				invoice.updated_on,
 				expiry,
 				cltv_expiry,
-				private
+				private,
+				pub_key_tags(invoice.destination_pub_key) as tags
 			`).From("invoice").LeftJoin("payment p on (invoice.r_hash = p.payment_hash)"), "subquery").
 		Where(filter).
 		Prefix(`WITH
@@ -313,3 +319,25 @@ func getInvoiceDetails(db *sqlx.DB, identifier string) (*InvoiceDetails, error)
 
 	return &i, nil
 }
+
+// QueryInvoices parses the filter clauses and sort order against the invoice columns and runs the
+// query. It is used to run saved table views on the server. Invalid filters and sorting are returned
+// as qp.ErrInvalidFilter and qp.ErrInvalidOrder.
+func QueryInvoices(db *sqlx.DB, filters *qp.FilterClauses, order []qp.Order, limit uint64,
+	offset uint64) (r []*Invoice, total uint64, err error) {
+
+	var filter sq.Sqlizer
+	if filters != nil && !filters.IsEmpty() {
+		filter, err = qp.NewSchemaParser(invoiceColumns).ParseFilterClauses(*filters)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	sort, err := qp.NewParser(invoiceSortColumns).ParseOrderClauses(order)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return getInvoices(db, filter, sort, limit, offset)
+}
@@ -10,12 +10,16 @@ import (
 	"github.com/lncapital/torq/pkg/lnd_connect"
 )
 
-func newInvoice(db *sqlx.DB, req newInvoiceRequest) (r newInvoiceResponse, err error) {
+func NewInvoice(db *sqlx.DB, req NewInvoiceRequest) (r NewInvoiceResponse, err error) {
 	newInvoiceReq, err := processInvoiceReq(req)
 	if err != nil {
 		return r, err
 	}
 
+	if err = settings.CheckNodePermission(db, req.NodeId, settings.ActionCreateInvoice); err != nil {
+		return r, err
+	}
+
 	connectionDetails, err := settings.GetNodeConnectionDetailsById(db, req.NodeId)
 	if err != nil {
 		return r, errors.Wrap(err, "Getting node connection details from the db")
@@ -37,7 +41,7 @@ func newInvoice(db *sqlx.DB, req newInvoiceRequest) (r newInvoiceResponse, err e
 
 	resp, err := client.AddInvoice(ctx, &newInvoiceReq)
 	if err != nil {
-		return newInvoiceResponse{}, errors.Wrap(err, "Creating invoice on node")
+		return NewInvoiceResponse{}, errors.Wrap(err, "Creating invoice on node")
 	}
 
 	//log.Debug().Msgf("Invoice : %v", resp.PaymentRequest)
@@ -49,7 +53,7 @@ func newInvoice(db *sqlx.DB, req newInvoiceRequest) (r newInvoiceResponse, err e
 	return r, nil
 }
 
-func processInvoiceReq(req newInvoiceRequest) (inv lnrpc.Invoice, err error) {
+func processInvoiceReq(req NewInvoiceRequest) (inv lnrpc.Invoice, err error) {
 
 	if req.NodeId == 0 {
 		return inv, errors.New("Node id is missing")
@@ -19,13 +19,13 @@ func Test_processInvoiceReq(t *testing.T) {
 
 	tests := []struct {
 		name    string
-		input   newInvoiceRequest
+		input   NewInvoiceRequest
 		want    lnrpc.Invoice
 		wantErr bool
 	}{
 		{
 			"Node ID missing",
-			newInvoiceRequest{
+			NewInvoiceRequest{
 				ValueMsat: &valueMsat,
 			},
 			lnrpc.Invoice{
@@ -35,7 +35,7 @@ func Test_processInvoiceReq(t *testing.T) {
 		},
 		{
 			"Only ValueMSat provided",
-			newInvoiceRequest{
+			NewInvoiceRequest{
 				NodeId:    1,
 				ValueMsat: &valueMsat,
 			},
@@ -46,7 +46,7 @@ func Test_processInvoiceReq(t *testing.T) {
 		},
 		{
 			"All params provided",
-			newInvoiceRequest{
+			NewInvoiceRequest{
 				NodeId:          1,
 				Memo:            &memo,
 				RPreImage:       &rPreImage,
@@ -13,6 +13,10 @@ func signMessage(db *sqlx.DB, req SignMessageRequest) (r SignMessageResponse, er
 	if req.NodeId == 0 {
 		return SignMessageResponse{}, errors.New("Node Id missing")
 	}
+	if err = settings.CheckNodePermission(db, req.NodeId, settings.ActionSignMessage); err != nil {
+		return SignMessageResponse{}, err
+	}
+
 	connectionDetails, err := settings.GetNodeConnectionDetailsById(db, req.NodeId)
 	if err != nil {
 		return SignMessageResponse{}, errors.Wrap(err, "Getting node connection details from the db")
@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "torq"
+
+// Registry holds all metrics exported on /metrics. A dedicated registry is used so only Torq and Go
+// runtime metrics are exported, not whatever dependencies register on the default registry.
+var Registry = prometheus.NewRegistry()
+
+var (
+	subscriptionEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "subscription_events_total",
+		Help:      "Number of events received from LND per subscription stream.",
+	}, []string{"stream"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Latency of database queries and statements.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"operation"})
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	websocketConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_connections",
+		Help:      "Number of open websocket connections.",
+	})
+
+	websocketMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_messages_total",
+		Help:      "Number of websocket messages by direction (in or out) and request type.",
+	}, []string{"direction", "type"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		subscriptionEvents,
+		dbQueryDuration,
+		httpRequests,
+		httpRequestDuration,
+		websocketConnections,
+		websocketMessages,
+	)
+}
+
+// RegisterNodeCollector adds the per node metrics and the database connection pool statistics. The node
+// metrics are collected from the database and LND when /metrics is scraped.
+func RegisterNodeCollector(db *sqlx.DB) {
+	Registry.MustRegister(
+		newNodeCollector(db),
+		collectors.NewDBStatsCollector(db.DB, "torq"),
+	)
+}
+
+// SubscriptionEvents counts the events received on one of the LND subscription streams.
+func SubscriptionEvents(stream string, count int) {
+	subscriptionEvents.WithLabelValues(stream).Add(float64(count))
+}
+
+// ObserveDBQuery records the duration of a database query. Operation is query or exec.
+func ObserveDBQuery(operation string, start time.Time) {
+	dbQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// WebsocketOpened and WebsocketClosed track the number of open websocket connections.
+func WebsocketOpened() { websocketConnections.Inc() }
+func WebsocketClosed() { websocketConnections.Dec() }
+
+// WebsocketMessage counts a websocket message. Direction is in or out.
+func WebsocketMessage(direction string, messageType string) {
+	websocketMessages.WithLabelValues(direction, messageType).Inc()
+}
+
+// Middleware records the number and latency of HTTP requests. The route template (e.g.
+// /api/channels/:chanIds) is used as label to keep the number of series bounded.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status())).Inc()
+		httpRequestDuration.WithLabelValues(route, c.Request.Method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format behind HTTP basic auth.
+func Handler(user string, password string) gin.HandlerFunc {
+	h := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	return func(c *gin.Context) {
+		u, p, ok := c.Request.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(u), []byte(user)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			c.Header("WWW-Authenticate", `Basic realm="torq metrics"`)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
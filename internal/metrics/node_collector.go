@@ -0,0 +1,211 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lncapital/torq/internal/settings"
+	"github.com/lncapital/torq/pkg/lnd_connect"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+// How long to wait for LND when collecting the metrics of a node.
+const lndCollectTimeout = 10 * time.Second
+
+func nodeDesc(name string, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "node", name), help,
+		append([]string{"local_node_id"}, labels...), nil)
+}
+
+var (
+	nodeUpDesc        = nodeDesc("up", "Whether LND could be reached when collecting metrics.")
+	channelsDesc      = nodeDesc("channels", "Number of channels by state (active, inactive or pending).", "state")
+	localBalanceDesc  = nodeDesc("local_balance_sat", "Sum of the local balance of all open channels.")
+	remoteBalanceDesc = nodeDesc("remote_balance_sat", "Sum of the remote balance of all open channels.")
+	pendingHtlcsDesc  = nodeDesc("pending_htlcs", "Number of pending HTLCs on all open channels.")
+	walletBalanceDesc = nodeDesc("wallet_balance_sat", "On-chain wallet balance by type (confirmed or unconfirmed).", "type")
+	peersDesc         = nodeDesc("peers", "Number of connected peers.")
+	forwardsDesc      = nodeDesc("forwards_total", "Number of forwards, attributed to the node of the outgoing channel.")
+	forwardAmountDesc = nodeDesc("forward_amount_sat_total", "Outgoing amount of all forwards.")
+	forwardFeesDesc   = nodeDesc("forward_fees_sat_total", "Fees earned from all forwards.")
+	htlcFailuresDesc  = nodeDesc("htlc_failures_total", "Number of failed HTLCs by failure reason.", "reason")
+	allNodeDescs      = []*prometheus.Desc{nodeUpDesc, channelsDesc, localBalanceDesc, remoteBalanceDesc,
+		pendingHtlcsDesc, walletBalanceDesc, peersDesc, forwardsDesc, forwardAmountDesc, forwardFeesDesc,
+		htlcFailuresDesc}
+)
+
+// nodeCollector collects the metrics of each local node when /metrics is scraped. Counters are read
+// from the database so that they survive restarts of Torq, the live state is read from LND.
+type nodeCollector struct {
+	db *sqlx.DB
+}
+
+func newNodeCollector(db *sqlx.DB) *nodeCollector {
+	return &nodeCollector{db: db}
+}
+
+func (nc *nodeCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range allNodeDescs {
+		ch <- d
+	}
+}
+
+func (nc *nodeCollector) Collect(ch chan<- prometheus.Metric) {
+	err := nc.collectForwards(ch)
+	if err != nil {
+		log.Error().Err(err).Msg("Collecting forward metrics")
+	}
+
+	err = nc.collectHtlcFailures(ch)
+	if err != nil {
+		log.Error().Err(err).Msg("Collecting HTLC failure metrics")
+	}
+
+	nodes, err := settings.GetActiveNodesConnectionDetails(nc.db)
+	if err != nil {
+		log.Error().Err(err).Msg("Getting node connection details for metrics")
+		return
+	}
+	for _, node := range nodes {
+		nodeId := strconv.Itoa(node.LocalNodeId)
+		err = collectLndMetrics(ch, node, nodeId)
+		if err != nil {
+			log.Error().Err(err).Msgf("Collecting LND metrics for node id: %v", node.LocalNodeId)
+			ch <- prometheus.MustNewConstMetric(nodeUpDesc, prometheus.GaugeValue, 0, nodeId)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(nodeUpDesc, prometheus.GaugeValue, 1, nodeId)
+	}
+}
+
+func (nc *nodeCollector) collectForwards(ch chan<- prometheus.Metric) error {
+	rows, err := nc.db.Query(`
+		select c.local_node_id,
+			coalesce(sum(fw.count), 0),
+			coalesce(floor(sum(fw.outgoing_amount_msat)/1000), 0),
+			coalesce(floor(sum(fw.fee_msat)/1000), 0)
+		from forward_hourly fw
+		join channel c on c.lnd_short_channel_id = fw.lnd_outgoing_short_channel_id
+		group by c.local_node_id;`)
+	if err != nil {
+		return errors.Wrap(err, "Running forward metrics query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var nodeId int
+		var count, amount, fees float64
+		if err = rows.Scan(&nodeId, &count, &amount, &fees); err != nil {
+			return err
+		}
+		id := strconv.Itoa(nodeId)
+		ch <- prometheus.MustNewConstMetric(forwardsDesc, prometheus.CounterValue, count, id)
+		ch <- prometheus.MustNewConstMetric(forwardAmountDesc, prometheus.CounterValue, amount, id)
+		ch <- prometheus.MustNewConstMetric(forwardFeesDesc, prometheus.CounterValue, fees, id)
+	}
+	return rows.Err()
+}
+
+func (nc *nodeCollector) collectHtlcFailures(ch chan<- prometheus.Metric) error {
+	// Link failures carry LND's failure detail. Forward failures happen downstream and have no reason.
+	// Downsampled events are counted from their daily aggregates.
+	rows, err := nc.db.Query(`
+		select c.local_node_id,
+			case when he.event_type = 'LinkFailEvent'
+				then coalesce(nullif(he.lnd_failure_detail, ''), 'UNKNOWN')
+				else 'FORWARD_FAIL' end as reason,
+			sum(he.event_count)
+		from (
+			select event_type, lnd_failure_detail, lnd_outgoing_short_channel_id, lnd_incoming_short_channel_id,
+				1 as event_count
+			from htlc_event
+			union all
+			select event_type, lnd_failure_detail, lnd_outgoing_short_channel_id, lnd_incoming_short_channel_id,
+				event_count
+			from htlc_event_daily
+		) he
+		join channel c on c.lnd_short_channel_id =
+			coalesce(nullif(he.lnd_outgoing_short_channel_id, 0), he.lnd_incoming_short_channel_id)
+		where he.event_type in ('LinkFailEvent', 'ForwardFailEvent')
+		group by 1, 2;`)
+	if err != nil {
+		return errors.Wrap(err, "Running HTLC failure metrics query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var nodeId int
+		var reason string
+		var count float64
+		if err = rows.Scan(&nodeId, &reason, &count); err != nil {
+			return err
+		}
+		ch <- prometheus.MustNewConstMetric(htlcFailuresDesc, prometheus.CounterValue, count,
+			strconv.Itoa(nodeId), reason)
+	}
+	return rows.Err()
+}
+
+func collectLndMetrics(ch chan<- prometheus.Metric, node settings.ConnectionDetails, nodeId string) error {
+	conn, err := lnd_connect.Connect(node.GRPCAddress, node.TLSFileBytes, node.MacaroonFileBytes)
+	if err != nil {
+		return errors.Wrap(err, "Connecting to LND")
+	}
+	defer conn.Close()
+
+	client := lnrpc.NewLightningClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), lndCollectTimeout)
+	defer cancel()
+
+	channels, err := client.ListChannels(ctx, &lnrpc.ListChannelsRequest{})
+	if err != nil {
+		return errors.Wrap(err, "Listing channels")
+	}
+	var active, inactive, local, remote, htlcs float64
+	for _, c := range channels.Channels {
+		if c.Active {
+			active++
+		} else {
+			inactive++
+		}
+		local += float64(c.LocalBalance)
+		remote += float64(c.RemoteBalance)
+		htlcs += float64(len(c.PendingHtlcs))
+	}
+
+	pending, err := client.PendingChannels(ctx, &lnrpc.PendingChannelsRequest{})
+	if err != nil {
+		return errors.Wrap(err, "Listing pending channels")
+	}
+	pendingCount := len(pending.PendingOpenChannels) + len(pending.WaitingCloseChannels) +
+		len(pending.PendingForceClosingChannels)
+
+	wallet, err := client.WalletBalance(ctx, &lnrpc.WalletBalanceRequest{})
+	if err != nil {
+		return errors.Wrap(err, "Getting wallet balance")
+	}
+
+	peers, err := client.ListPeers(ctx, &lnrpc.ListPeersRequest{})
+	if err != nil {
+		return errors.Wrap(err, "Listing peers")
+	}
+
+	ch <- prometheus.MustNewConstMetric(channelsDesc, prometheus.GaugeValue, active, nodeId, "active")
+	ch <- prometheus.MustNewConstMetric(channelsDesc, prometheus.GaugeValue, inactive, nodeId, "inactive")
+	ch <- prometheus.MustNewConstMetric(channelsDesc, prometheus.GaugeValue, float64(pendingCount), nodeId, "pending")
+	ch <- prometheus.MustNewConstMetric(localBalanceDesc, prometheus.GaugeValue, local, nodeId)
+	ch <- prometheus.MustNewConstMetric(remoteBalanceDesc, prometheus.GaugeValue, remote, nodeId)
+	ch <- prometheus.MustNewConstMetric(pendingHtlcsDesc, prometheus.GaugeValue, htlcs, nodeId)
+	ch <- prometheus.MustNewConstMetric(walletBalanceDesc, prometheus.GaugeValue,
+		float64(wallet.ConfirmedBalance), nodeId, "confirmed")
+	ch <- prometheus.MustNewConstMetric(walletBalanceDesc, prometheus.GaugeValue,
+		float64(wallet.UnconfirmedBalance), nodeId, "unconfirmed")
+	ch <- prometheus.MustNewConstMetric(peersDesc, prometheus.GaugeValue, float64(len(peers.Peers)), nodeId)
+
+	return nil
+}
@@ -0,0 +1,319 @@
+package on_chain_tx
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cockroachdb/errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lncapital/torq/internal/settings"
+	"github.com/lncapital/torq/pkg/lnd_connect"
+	"github.com/rs/zerolog/log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CategoryChannelOpen      = "CHANNEL_OPEN"
+	CategoryBatchOpen        = "BATCH_OPEN"
+	CategoryCooperativeClose = "COOPERATIVE_CLOSE"
+	CategoryForceClose       = "FORCE_CLOSE"
+	CategoryForceCloseSweep  = "FORCE_CLOSE_SWEEP"
+	CategoryAnchorCpfp       = "ANCHOR_CPFP"
+	CategoryHtlcSweep        = "HTLC_SWEEP"
+	CategoryDeposit          = "DEPOSIT"
+	CategoryWithdrawal       = "WITHDRAWAL"
+)
+
+// classifyInterval is how often new transactions are categorised.
+const classifyInterval = 5 * time.Minute
+
+type txChannel struct {
+	lndShortChannelId string
+	channelPoint      string
+}
+
+// channelIndex maps transactions to the channels they open, close or sweep.
+type channelIndex struct {
+	// funding maps a funding txid to the channels it opens.
+	funding map[string][]txChannel
+	// closing maps a closing txid to the channel it closes, cooperative marks the cooperative closes.
+	closing     map[string]txChannel
+	cooperative map[string]bool
+	// sweeps maps the sweep txids of the close resolutions to their channel and category.
+	sweeps        map[string]txChannel
+	sweepCategory map[string]string
+}
+
+type TxCategory struct {
+	TxHash             string   `json:"txHash"`
+	Category           string   `json:"category"`
+	LndShortChannelIds []string `json:"lndShortChannelIds"`
+	ChannelPoints      []string `json:"channelPoints"`
+}
+
+func newChannelIndex() channelIndex {
+	return channelIndex{
+		funding:       make(map[string][]txChannel),
+		closing:       make(map[string]txChannel),
+		cooperative:   make(map[string]bool),
+		sweeps:        make(map[string]txChannel),
+		sweepCategory: make(map[string]string),
+	}
+}
+
+func (idx channelIndex) addFunding(c txChannel) {
+	txHash, _, _ := strings.Cut(c.channelPoint, ":")
+	for i, existing := range idx.funding[txHash] {
+		if existing.channelPoint == c.channelPoint {
+			// Pending channels have no short channel id yet.
+			if existing.lndShortChannelId == "0" || existing.lndShortChannelId == "" {
+				idx.funding[txHash][i] = c
+			}
+			return
+		}
+	}
+	idx.funding[txHash] = append(idx.funding[txHash], c)
+}
+
+func (idx channelIndex) addClose(c txChannel, summary *lnrpc.ChannelCloseSummary) {
+	if summary.ClosingTxHash != "" {
+		idx.closing[summary.ClosingTxHash] = c
+		idx.cooperative[summary.ClosingTxHash] = summary.CloseType == lnrpc.ChannelCloseSummary_COOPERATIVE_CLOSE
+	}
+	for _, r := range summary.Resolutions {
+		if r.SweepTxid == "" {
+			continue
+		}
+		idx.sweeps[r.SweepTxid] = c
+		switch r.ResolutionType {
+		case lnrpc.ResolutionType_ANCHOR:
+			idx.sweepCategory[r.SweepTxid] = CategoryAnchorCpfp
+		case lnrpc.ResolutionType_INCOMING_HTLC, lnrpc.ResolutionType_OUTGOING_HTLC:
+			idx.sweepCategory[r.SweepTxid] = CategoryHtlcSweep
+		default:
+			idx.sweepCategory[r.SweepTxid] = CategoryForceCloseSweep
+		}
+	}
+}
+
+func (idx channelIndex) addPendingChannels(pending *lnrpc.PendingChannelsResponse) {
+	for _, c := range pending.PendingOpenChannels {
+		idx.addFunding(txChannel{lndShortChannelId: "0", channelPoint: c.Channel.ChannelPoint})
+	}
+	for _, c := range pending.WaitingCloseChannels {
+		if c.ClosingTxid != "" {
+			if _, ok := idx.closing[c.ClosingTxid]; !ok {
+				idx.closing[c.ClosingTxid] = txChannel{lndShortChannelId: "0", channelPoint: c.Channel.ChannelPoint}
+				idx.cooperative[c.ClosingTxid] = !isCommitmentTx(c.ClosingTxid, c.Commitments)
+			}
+		}
+	}
+	for _, c := range pending.PendingForceClosingChannels {
+		if c.ClosingTxid != "" {
+			if _, ok := idx.closing[c.ClosingTxid]; !ok {
+				idx.closing[c.ClosingTxid] = txChannel{lndShortChannelId: "0", channelPoint: c.Channel.ChannelPoint}
+			}
+		}
+	}
+}
+
+// isCommitmentTx is true when the closing transaction of a channel waiting for its close is one of its commitment
+// transactions. Force closes wait for a commitment transaction to confirm, cooperative closes for another one.
+func isCommitmentTx(txid string, commitments *lnrpc.PendingChannelsResponse_Commitments) bool {
+	return commitments != nil && (txid == commitments.LocalTxid || txid == commitments.RemoteTxid ||
+		txid == commitments.RemotePendingTxid)
+}
+
+func txCategory(txHash string, category string, channels ...txChannel) TxCategory {
+	r := TxCategory{TxHash: txHash, Category: category, LndShortChannelIds: []string{}, ChannelPoints: []string{}}
+	for _, c := range channels {
+		if c.lndShortChannelId != "" && c.lndShortChannelId != "0" {
+			r.LndShortChannelIds = append(r.LndShortChannelIds, c.lndShortChannelId)
+		}
+		r.ChannelPoints = append(r.ChannelPoints, c.channelPoint)
+	}
+	sort.Strings(r.LndShortChannelIds)
+	sort.Strings(r.ChannelPoints)
+	return r
+}
+
+// classifyTx categorises a transaction of the wallet. The closes and sweeps LND reports for closed channels are
+// matched first, then the funding transactions. A transaction spending the output of a force close is a sweep.
+// The remaining transactions are deposits or withdrawals by the sign of their amount.
+func classifyTx(stx storedTx, idx channelIndex) TxCategory {
+	if c, ok := idx.sweeps[stx.TxHash]; ok {
+		return txCategory(stx.TxHash, idx.sweepCategory[stx.TxHash], c)
+	}
+	if c, ok := idx.closing[stx.TxHash]; ok {
+		if idx.cooperative[stx.TxHash] {
+			return txCategory(stx.TxHash, CategoryCooperativeClose, c)
+		}
+		return txCategory(stx.TxHash, CategoryForceClose, c)
+	}
+	if channels, ok := idx.funding[stx.TxHash]; ok {
+		if len(channels) > 1 {
+			return txCategory(stx.TxHash, CategoryBatchOpen, channels...)
+		}
+		return txCategory(stx.TxHash, CategoryChannelOpen, channels...)
+	}
+	if tx, err := decodeRawTx(stx.RawTxHex); err == nil {
+		for _, in := range tx.TxIn {
+			closingTxHash := in.PreviousOutPoint.Hash.String()
+			if c, ok := idx.closing[closingTxHash]; ok && !idx.cooperative[closingTxHash] {
+				return txCategory(stx.TxHash, CategoryForceCloseSweep, c)
+			}
+		}
+	}
+	if stx.AmountSat >= 0 {
+		return txCategory(stx.TxHash, CategoryDeposit)
+	}
+	return txCategory(stx.TxHash, CategoryWithdrawal)
+}
+
+func getChannelIndex(db *sqlx.DB) (channelIndex, error) {
+	idx := newChannelIndex()
+
+	rows, err := db.Queryx(`
+		SELECT DISTINCT coalesce(lnd_short_channel_id, 0), lnd_channel_point
+		FROM channel_event
+		WHERE event_type = $1 AND lnd_channel_point IS NOT NULL;`, int(lnrpc.ChannelEventUpdate_OPEN_CHANNEL))
+	if err != nil {
+		return idx, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	for rows.Next() {
+		var lndShortChannelId uint64
+		var channelPoint string
+		if err = rows.Scan(&lndShortChannelId, &channelPoint); err != nil {
+			rows.Close()
+			return idx, errors.Wrap(err, "Unable to scan SQL row")
+		}
+		idx.addFunding(txChannel{strconv.FormatUint(lndShortChannelId, 10), channelPoint})
+	}
+	rows.Close()
+
+	rows, err = db.Queryx(`
+		SELECT coalesce(lnd_short_channel_id, 0), lnd_channel_point, event
+		FROM channel_event
+		WHERE event_type = $1 AND lnd_channel_point IS NOT NULL;`, int(lnrpc.ChannelEventUpdate_CLOSED_CHANNEL))
+	if err != nil {
+		return idx, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var lndShortChannelId uint64
+		var channelPoint string
+		var event []byte
+		if err = rows.Scan(&lndShortChannelId, &channelPoint, &event); err != nil {
+			return idx, errors.Wrap(err, "Unable to scan SQL row")
+		}
+		var summary lnrpc.ChannelCloseSummary
+		if err = json.Unmarshal(event, &summary); err != nil {
+			log.Error().Err(err).Msgf("Decoding close event of channel %s", channelPoint)
+			continue
+		}
+		c := txChannel{strconv.FormatUint(lndShortChannelId, 10), channelPoint}
+		// A channel funded by the peer is only known from its close.
+		idx.addFunding(c)
+		idx.addClose(c, &summary)
+	}
+	return idx, nil
+}
+
+// getTxsToClassify returns the transactions that have no category yet and the transactions of the last two weeks,
+// as their channels may only have been opened or closed since they were categorised.
+func getTxsToClassify(db *sqlx.DB) (r []storedTx, err error) {
+	err = db.Select(&r, `
+		SELECT DISTINCT ON (tx_hash) timestamp AS date, tx_hash, coalesce(amount, 0) AS amount,
+			coalesce(total_fees, 0) AS total_fees, coalesce(raw_tx_hex, '') AS raw_tx_hex, label
+		FROM tx
+		WHERE timestamp > now() - interval '14 days'
+			OR tx_hash NOT IN (SELECT tx_hash FROM tx_category)
+		ORDER BY tx_hash, timestamp DESC;`)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return r, nil
+}
+
+func storeTxCategory(db *sqlx.DB, c TxCategory) error {
+	_, err := db.Exec(`
+		INSERT INTO tx_category (tx_hash, category, lnd_short_channel_ids, channel_points, updated_on)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (tx_hash) DO UPDATE SET category = EXCLUDED.category,
+			lnd_short_channel_ids = EXCLUDED.lnd_short_channel_ids, channel_points = EXCLUDED.channel_points,
+			updated_on = EXCLUDED.updated_on;`,
+		c.TxHash, c.Category, pq.Array(c.LndShortChannelIds), pq.Array(c.ChannelPoints), time.Now().UTC())
+	if err != nil {
+		return errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return nil
+}
+
+// getPendingChannels returns the pending channels of every active local node.
+func getPendingChannels(ctx context.Context, db *sqlx.DB) ([]*lnrpc.PendingChannelsResponse, error) {
+	nodes, err := settings.GetActiveNodesConnectionDetails(db)
+	if err != nil {
+		return nil, errors.Wrap(err, "Getting the active nodes")
+	}
+	var r []*lnrpc.PendingChannelsResponse
+	for _, node := range nodes {
+		conn, err := lnd_connect.Connect(node.GRPCAddress, node.TLSFileBytes, node.MacaroonFileBytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Connecting to LND of node %d", node.LocalNodeId)
+		}
+		pending, err := lnrpc.NewLightningClient(conn).PendingChannels(ctx, &lnrpc.PendingChannelsRequest{})
+		conn.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Getting pending channels of node %d", node.LocalNodeId)
+		}
+		r = append(r, pending)
+	}
+	return r, nil
+}
+
+func classifyTransactions(db *sqlx.DB, pending []*lnrpc.PendingChannelsResponse) error {
+	idx, err := getChannelIndex(db)
+	if err != nil {
+		return err
+	}
+	for _, p := range pending {
+		idx.addPendingChannels(p)
+	}
+
+	txs, err := getTxsToClassify(db)
+	if err != nil {
+		return err
+	}
+	for _, stx := range txs {
+		if err = storeTxCategory(db, classifyTx(stx, idx)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClassifyTransactions categorises the on-chain transactions until ctx is canceled. The transactions of all local
+// nodes are stored together, so they're categorised in one run with the pending channels of every node. A run is
+// skipped when a node can't be reached, its pending channels would otherwise flip the categories.
+func ClassifyTransactions(ctx context.Context, db *sqlx.DB) {
+	ticker := time.NewTicker(classifyInterval)
+	defer ticker.Stop()
+	for {
+		pending, err := getPendingChannels(ctx, db)
+		if err == nil {
+			err = classifyTransactions(db, pending)
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("Classifying on-chain transactions")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
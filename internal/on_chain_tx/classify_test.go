@@ -0,0 +1,103 @@
+package on_chain_tx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"reflect"
+	"testing"
+)
+
+func rawTxSpending(t *testing.T, txid string, index uint32) string {
+	hash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(hash, index), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, []byte{0}))
+	var buf bytes.Buffer
+	if err = tx.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(buf.Bytes())
+}
+
+func Test_classifyTx(t *testing.T) {
+	const (
+		fundingTx  = "1111111111111111111111111111111111111111111111111111111111111111"
+		batchTx    = "2222222222222222222222222222222222222222222222222222222222222222"
+		coopTx     = "3333333333333333333333333333333333333333333333333333333333333333"
+		forceTx    = "4444444444444444444444444444444444444444444444444444444444444444"
+		anchorTx   = "5555555555555555555555555555555555555555555555555555555555555555"
+		htlcTx     = "6666666666666666666666666666666666666666666666666666666666666666"
+		sweepTx    = "7777777777777777777777777777777777777777777777777777777777777777"
+		pendingTx  = "8888888888888888888888888888888888888888888888888888888888888888"
+		unknownTx  = "9999999999999999999999999999999999999999999999999999999999999999"
+		anotherTx  = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		otherForce = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+		waitCoop   = "cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc"
+		waitForce  = "dddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddd"
+	)
+
+	idx := newChannelIndex()
+	idx.addFunding(txChannel{"100", fundingTx + ":0"})
+	idx.addFunding(txChannel{"200", batchTx + ":0"})
+	idx.addFunding(txChannel{"201", batchTx + ":1"})
+	idx.addClose(txChannel{"100", fundingTx + ":0"}, &lnrpc.ChannelCloseSummary{ClosingTxHash: coopTx})
+	idx.addClose(txChannel{"200", batchTx + ":0"}, &lnrpc.ChannelCloseSummary{
+		ClosingTxHash: forceTx,
+		CloseType:     lnrpc.ChannelCloseSummary_LOCAL_FORCE_CLOSE,
+		Resolutions: []*lnrpc.Resolution{
+			{ResolutionType: lnrpc.ResolutionType_ANCHOR, SweepTxid: anchorTx},
+			{ResolutionType: lnrpc.ResolutionType_OUTGOING_HTLC, SweepTxid: htlcTx},
+		},
+	})
+	idx.addPendingChannels(&lnrpc.PendingChannelsResponse{
+		PendingOpenChannels: []*lnrpc.PendingChannelsResponse_PendingOpenChannel{
+			{Channel: &lnrpc.PendingChannelsResponse_PendingChannel{ChannelPoint: pendingTx + ":1"}},
+		},
+		WaitingCloseChannels: []*lnrpc.PendingChannelsResponse_WaitingCloseChannel{
+			{Channel: &lnrpc.PendingChannelsResponse_PendingChannel{ChannelPoint: anotherTx + ":1"},
+				ClosingTxid: waitCoop, Commitments: &lnrpc.PendingChannelsResponse_Commitments{LocalTxid: unknownTx}},
+			{Channel: &lnrpc.PendingChannelsResponse_PendingChannel{ChannelPoint: anotherTx + ":2"},
+				ClosingTxid: waitForce, Commitments: &lnrpc.PendingChannelsResponse_Commitments{RemoteTxid: waitForce}},
+		},
+		PendingForceClosingChannels: []*lnrpc.PendingChannelsResponse_ForceClosedChannel{
+			{Channel: &lnrpc.PendingChannelsResponse_PendingChannel{ChannelPoint: anotherTx + ":0"},
+				ClosingTxid: otherForce},
+		},
+	})
+
+	tests := []struct {
+		tx           storedTx
+		wantCategory string
+		wantChanIds  []string
+	}{
+		{storedTx{TxHash: fundingTx, AmountSat: -100000}, CategoryChannelOpen, []string{"100"}},
+		{storedTx{TxHash: batchTx, AmountSat: -200000}, CategoryBatchOpen, []string{"200", "201"}},
+		{storedTx{TxHash: coopTx, AmountSat: 90000}, CategoryCooperativeClose, []string{"100"}},
+		{storedTx{TxHash: forceTx}, CategoryForceClose, []string{"200"}},
+		{storedTx{TxHash: anchorTx, AmountSat: -300}, CategoryAnchorCpfp, []string{"200"}},
+		{storedTx{TxHash: htlcTx, AmountSat: 5000}, CategoryHtlcSweep, []string{"200"}},
+		{storedTx{TxHash: sweepTx, AmountSat: 5000, RawTxHex: rawTxSpending(t, forceTx, 1)},
+			CategoryForceCloseSweep, []string{"200"}},
+		{storedTx{TxHash: sweepTx, AmountSat: 5000, RawTxHex: rawTxSpending(t, otherForce, 0)},
+			CategoryForceCloseSweep, []string{}},
+		{storedTx{TxHash: sweepTx, AmountSat: 5000, RawTxHex: rawTxSpending(t, coopTx, 0)},
+			CategoryDeposit, []string{}},
+		{storedTx{TxHash: pendingTx, AmountSat: -50000}, CategoryChannelOpen, []string{}},
+		{storedTx{TxHash: unknownTx, AmountSat: -50000}, CategoryWithdrawal, []string{}},
+		{storedTx{TxHash: waitCoop, AmountSat: 50000}, CategoryCooperativeClose, []string{}},
+		{storedTx{TxHash: waitForce, AmountSat: 50000}, CategoryForceClose, []string{}},
+	}
+	for _, test := range tests {
+		got := classifyTx(test.tx, idx)
+		if got.Category != test.wantCategory || !reflect.DeepEqual(got.LndShortChannelIds, test.wantChanIds) {
+			t.Errorf("classifyTx(%s) = %s %v, want %s %v", test.tx.TxHash[:4], got.Category,
+				got.LndShortChannelIds, test.wantCategory, test.wantChanIds)
+		}
+	}
+}
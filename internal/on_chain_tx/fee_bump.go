@@ -0,0 +1,441 @@
+package on_chain_tx
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/cockroachdb/errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/walletrpc"
+	"github.com/lncapital/torq/internal/settings"
+	"google.golang.org/grpc"
+	"strings"
+	"time"
+)
+
+const (
+	bumpRbf  = "RBF"
+	bumpCpfp = "CPFP"
+)
+
+const (
+	pendingOpen         = "PENDING_OPEN"
+	pendingWaitingClose = "WAITING_CLOSE"
+	pendingForceClose   = "PENDING_FORCE_CLOSE"
+)
+
+type rpcClientBumpFee interface {
+	PendingSweeps(ctx context.Context, in *walletrpc.PendingSweepsRequest,
+		opts ...grpc.CallOption) (*walletrpc.PendingSweepsResponse, error)
+	ListUnspent(ctx context.Context, in *walletrpc.ListUnspentRequest,
+		opts ...grpc.CallOption) (*walletrpc.ListUnspentResponse, error)
+	BumpFee(ctx context.Context, in *walletrpc.BumpFeeRequest,
+		opts ...grpc.CallOption) (*walletrpc.BumpFeeResponse, error)
+}
+
+type TxFeeBump struct {
+	TxFeeBumpId int    `json:"txFeeBumpId" db:"tx_fee_bump_id"`
+	LocalNodeId int    `json:"localNodeId" db:"local_node_id"`
+	TxHash      string `json:"txHash" db:"tx_hash"`
+	Outpoint    string `json:"outpoint" db:"outpoint"`
+	Method      string `json:"method" db:"method"`
+	SatPerVbyte *int64 `json:"satPerVbyte" db:"sat_per_vbyte"`
+	TargetConf  *int32 `json:"targetConf" db:"target_conf"`
+	// ReplacingTxHash is the replacement (RBF) or the child (CPFP) transaction LND created for the bump.
+	ReplacingTxHash *string   `json:"replacingTxHash" db:"replacing_tx_hash"`
+	CreatedOn       time.Time `json:"createdOn" db:"created_on"`
+}
+
+type UnconfirmedTx struct {
+	TxHash       string     `json:"txHash"`
+	Date         *time.Time `json:"date"`
+	AmountSat    int64      `json:"amountSat"`
+	TotalFeesSat int64      `json:"totalFeesSat"`
+	VSize        int64      `json:"vSize"`
+	SatPerVbyte  float64    `json:"satPerVbyte"`
+	Label        *string    `json:"label"`
+	// ChannelPoint and PendingChannelType are set for funding and closing transactions of pending channels.
+	ChannelPoint       *string `json:"channelPoint"`
+	PendingChannelType *string `json:"pendingChannelType"`
+	// BumpFeesSat are the fees paid by the replacements and children of earlier bumps.
+	BumpFeesSat int64       `json:"bumpFeesSat"`
+	Bumps       []TxFeeBump `json:"bumps"`
+}
+
+type BumpFeeRequest struct {
+	NodeId int    `json:"nodeId"`
+	TxHash string `json:"txHash"`
+	// Outpoint overrides the input (RBF) or output (CPFP) Torq selects to bump.
+	Outpoint    *string `json:"outpoint"`
+	SatPerVbyte *uint64 `json:"satPerVbyte"`
+	TargetConf  *uint32 `json:"targetConf"`
+	Force       *bool   `json:"force"`
+}
+
+type storedTx struct {
+	Date         time.Time `db:"date"`
+	TxHash       string    `db:"tx_hash"`
+	AmountSat    int64     `db:"amount"`
+	TotalFeesSat int64     `db:"total_fees"`
+	RawTxHex     string    `db:"raw_tx_hex"`
+	Label        *string   `db:"label"`
+}
+
+func decodeRawTx(rawTxHex string) (*wire.MsgTx, error) {
+	b, err := hex.DecodeString(rawTxHex)
+	if err != nil {
+		return nil, errors.Wrap(err, "Decoding raw transaction hex")
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if err = tx.Deserialize(bytes.NewReader(b)); err != nil {
+		return nil, errors.Wrap(err, "Deserializing raw transaction")
+	}
+	return tx, nil
+}
+
+func spendsOutpoint(tx *wire.MsgTx, outpoint string) bool {
+	for _, in := range tx.TxIn {
+		if in.PreviousOutPoint.String() == outpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// getUnconfirmedStoredTxs returns the transactions that never confirmed. Transactions older than the mempool expiry
+// of two weeks and transactions replaced by an RBF bump are left out.
+func getUnconfirmedStoredTxs(db *sqlx.DB) (r []storedTx, err error) {
+	err = db.Select(&r, `
+		SELECT DISTINCT ON (tx_hash) timestamp AS date, tx_hash, coalesce(amount, 0) AS amount,
+			coalesce(total_fees, 0) AS total_fees, coalesce(raw_tx_hex, '') AS raw_tx_hex, label
+		FROM tx
+		WHERE timestamp > now() - interval '14 days'
+			AND tx_hash NOT IN (SELECT tx_hash FROM tx WHERE num_confirmations > 0)
+			AND tx_hash NOT IN (
+				SELECT tx_hash FROM tx_fee_bump WHERE method = $1 AND replacing_tx_hash IS NOT NULL)
+		ORDER BY tx_hash, timestamp DESC;`, bumpRbf)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return r, nil
+}
+
+func getFeeBumps(db *sqlx.DB, nodeId int) (r []TxFeeBump, err error) {
+	err = db.Select(&r, `SELECT * FROM tx_fee_bump WHERE local_node_id = $1 ORDER BY created_on;`, nodeId)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return r, nil
+}
+
+func insertFeeBump(db *sqlx.DB, bump TxFeeBump) error {
+	_, err := db.Exec(`
+		INSERT INTO tx_fee_bump (local_node_id, tx_hash, outpoint, method, sat_per_vbyte, target_conf, created_on)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);`,
+		bump.LocalNodeId, bump.TxHash, bump.Outpoint, bump.Method, bump.SatPerVbyte, bump.TargetConf, bump.CreatedOn)
+	if err != nil {
+		return errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return nil
+}
+
+// resolveFeeBumps records the transactions LND created for earlier bumps. BumpFee doesn't return the transaction,
+// it's the first transaction after the bump that spends the bumped outpoint.
+func resolveFeeBumps(db *sqlx.DB, bumps []TxFeeBump) error {
+	for i, bump := range bumps {
+		// Bumps that didn't lead to a transaction within the mempool expiry never will.
+		if bump.ReplacingTxHash != nil || time.Since(bump.CreatedOn) > 14*24*time.Hour {
+			continue
+		}
+		var txs []storedTx
+		err := db.Select(&txs, `
+			SELECT DISTINCT ON (tx_hash) timestamp AS date, tx_hash, coalesce(amount, 0) AS amount,
+				coalesce(total_fees, 0) AS total_fees, coalesce(raw_tx_hex, '') AS raw_tx_hex, label
+			FROM tx
+			WHERE timestamp >= $1 - interval '1 minute' AND tx_hash != $2
+			ORDER BY tx_hash, timestamp;`, bump.CreatedOn, bump.TxHash)
+		if err != nil {
+			return errors.Wrap(err, "Unable to execute SQL statement")
+		}
+		for _, stx := range txs {
+			tx, err := decodeRawTx(stx.RawTxHex)
+			if err != nil || !spendsOutpoint(tx, bump.Outpoint) {
+				continue
+			}
+			_, err = db.Exec(`UPDATE tx_fee_bump SET replacing_tx_hash = $1 WHERE tx_fee_bump_id = $2;`,
+				stx.TxHash, bump.TxFeeBumpId)
+			if err != nil {
+				return errors.Wrap(err, "Unable to execute SQL statement")
+			}
+			bumps[i].ReplacingTxHash = &stx.TxHash
+			break
+		}
+	}
+	return nil
+}
+
+func convertStoredTx(stx storedTx) UnconfirmedTx {
+	date := stx.Date
+	r := UnconfirmedTx{
+		TxHash:       stx.TxHash,
+		Date:         &date,
+		AmountSat:    stx.AmountSat,
+		TotalFeesSat: stx.TotalFeesSat,
+		Label:        stx.Label,
+	}
+	if tx, err := decodeRawTx(stx.RawTxHex); err == nil {
+		weight := int64(tx.SerializeSizeStripped()*3 + tx.SerializeSize())
+		r.VSize = (weight + 3) / 4
+		if r.VSize != 0 {
+			r.SatPerVbyte = float64(r.TotalFeesSat) / float64(r.VSize)
+		}
+	}
+	return r
+}
+
+// pendingChannelTxs maps the funding and closing transactions of pending channels to their channel point and type.
+func pendingChannelTxs(pending *lnrpc.PendingChannelsResponse) map[string][2]string {
+	r := make(map[string][2]string)
+	for _, c := range pending.PendingOpenChannels {
+		txHash, _, _ := strings.Cut(c.Channel.ChannelPoint, ":")
+		r[txHash] = [2]string{c.Channel.ChannelPoint, pendingOpen}
+	}
+	for _, c := range pending.WaitingCloseChannels {
+		if c.ClosingTxid != "" {
+			r[c.ClosingTxid] = [2]string{c.Channel.ChannelPoint, pendingWaitingClose}
+		}
+	}
+	for _, c := range pending.PendingForceClosingChannels {
+		if c.ClosingTxid != "" {
+			r[c.ClosingTxid] = [2]string{c.Channel.ChannelPoint, pendingForceClose}
+		}
+	}
+	return r
+}
+
+// mergeUnconfirmedTxs adds the pending channels and the earlier bumps to the unconfirmed transactions.
+func mergeUnconfirmedTxs(stored []storedTx, channelTxs map[string][2]string, bumps []TxFeeBump,
+	bumpFees map[string]int64) []UnconfirmedTx {
+
+	var r []UnconfirmedTx
+	seen := make(map[string]int)
+	for _, stx := range stored {
+		seen[stx.TxHash] = len(r)
+		r = append(r, convertStoredTx(stx))
+	}
+	for txHash, c := range channelTxs {
+		i, ok := seen[txHash]
+		if !ok {
+			// Transactions of the peer, like its commitment transaction after a force close, aren't stored.
+			i = len(r)
+			seen[txHash] = i
+			r = append(r, UnconfirmedTx{TxHash: txHash})
+		}
+		channelPoint, pendingType := c[0], c[1]
+		r[i].ChannelPoint = &channelPoint
+		r[i].PendingChannelType = &pendingType
+	}
+	for _, bump := range bumps {
+		i, ok := seen[bump.TxHash]
+		if !ok {
+			continue
+		}
+		r[i].Bumps = append(r[i].Bumps, bump)
+		if bump.ReplacingTxHash != nil {
+			r[i].BumpFeesSat += bumpFees[*bump.ReplacingTxHash]
+		}
+	}
+	return r
+}
+
+func ListUnconfirmedTxs(ctx context.Context, db *sqlx.DB, nodeId int) ([]UnconfirmedTx, error) {
+	conn, err := connectWallet(db, nodeId)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	pending, err := lnrpc.NewLightningClient(conn).PendingChannels(ctx, &lnrpc.PendingChannelsRequest{})
+	if err != nil {
+		return nil, errors.Wrap(err, "Getting pending channels")
+	}
+	bumps, err := getFeeBumps(db, nodeId)
+	if err != nil {
+		return nil, err
+	}
+	if err = resolveFeeBumps(db, bumps); err != nil {
+		return nil, err
+	}
+	stored, err := getUnconfirmedStoredTxs(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var replacing []string
+	for _, bump := range bumps {
+		if bump.ReplacingTxHash != nil {
+			replacing = append(replacing, *bump.ReplacingTxHash)
+		}
+	}
+	bumpFees := make(map[string]int64)
+	rows, err := db.Queryx(`SELECT DISTINCT tx_hash, coalesce(total_fees, 0) FROM tx WHERE tx_hash = ANY($1);`,
+		pq.Array(replacing))
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var txHash string
+		var fees int64
+		if err = rows.Scan(&txHash, &fees); err != nil {
+			return nil, errors.Wrap(err, "Unable to scan SQL row")
+		}
+		bumpFees[txHash] = fees
+	}
+
+	return mergeUnconfirmedTxs(stored, pendingChannelTxs(pending), bumps, bumpFees), nil
+}
+
+// selectBumpOutpoint selects the outpoint to bump a transaction with. LND bumps inputs, not transactions. When the
+// transaction is a sweep of LND its inputs are swept again at the higher fee rate (RBF). Otherwise an output is
+// spent by a child at the higher fee rate (CPFP), an anchor output LND sweeps or an output of the wallet.
+func selectBumpOutpoint(txHash string, tx *wire.MsgTx, sweeps []*walletrpc.PendingSweep,
+	unspent []*lnrpc.Utxo) (outpoint string, method string, err error) {
+
+	if tx != nil {
+		for _, s := range sweeps {
+			if spendsOutpoint(tx, formatOutpoint(s.Outpoint)) {
+				return formatOutpoint(s.Outpoint), bumpRbf, nil
+			}
+		}
+	}
+	for _, s := range sweeps {
+		o := formatOutpoint(s.Outpoint)
+		if strings.HasPrefix(o, txHash+":") {
+			return o, bumpCpfp, nil
+		}
+	}
+	for _, u := range unspent {
+		o := formatOutpoint(u.Outpoint)
+		if strings.HasPrefix(o, txHash+":") {
+			return o, bumpCpfp, nil
+		}
+	}
+	return "", "", errors.New("The transaction has no input swept by LND and no output of the wallet to bump")
+}
+
+func processBumpFeeRequest(req BumpFeeRequest) (r walletrpc.BumpFeeRequest, err error) {
+	if req.NodeId == 0 {
+		return r, errors.New("Node id is missing")
+	}
+	if _, err = chainhash.NewHashFromStr(req.TxHash); err != nil || len(req.TxHash) != chainhash.MaxHashStringSize {
+		return r, errors.New("Transaction hash is invalid")
+	}
+	if (req.SatPerVbyte == nil) == (req.TargetConf == nil) {
+		return r, errors.New("Either satPerVbyte or targetConf has to be provided")
+	}
+	if req.SatPerVbyte != nil {
+		r.SatPerVbyte = *req.SatPerVbyte
+	}
+	if req.TargetConf != nil {
+		r.TargetConf = *req.TargetConf
+	}
+	if req.Force != nil {
+		r.Force = *req.Force
+	}
+	if req.Outpoint != nil {
+		if r.Outpoint, err = parseOutpoint(*req.Outpoint); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// bumpFee bumps the fee of the transaction and returns the bump to record.
+func bumpFee(ctx context.Context, client rpcClientBumpFee, req BumpFeeRequest, rawTxHex string) (r TxFeeBump,
+	err error) {
+
+	bumpReq, err := processBumpFeeRequest(req)
+	if err != nil {
+		return r, err
+	}
+
+	sweeps, err := client.PendingSweeps(ctx, &walletrpc.PendingSweepsRequest{})
+	if err != nil {
+		return r, errors.Wrap(err, "Getting pending sweeps")
+	}
+	var tx *wire.MsgTx
+	if rawTxHex != "" {
+		if tx, err = decodeRawTx(rawTxHex); err != nil {
+			return r, err
+		}
+	}
+
+	if bumpReq.Outpoint != nil {
+		r.Outpoint = formatOutpoint(bumpReq.Outpoint)
+		r.Method = bumpCpfp
+		if tx != nil && spendsOutpoint(tx, r.Outpoint) {
+			r.Method = bumpRbf
+		}
+	} else {
+		unspent, err := client.ListUnspent(ctx, &walletrpc.ListUnspentRequest{MaxConfs: 0, UnconfirmedOnly: true})
+		if err != nil {
+			return r, errors.Wrap(err, "Listing unspent outputs")
+		}
+		r.Outpoint, r.Method, err = selectBumpOutpoint(req.TxHash, tx, sweeps.PendingSweeps, unspent.Utxos)
+		if err != nil {
+			return r, err
+		}
+		if bumpReq.Outpoint, err = parseOutpoint(r.Outpoint); err != nil {
+			return r, err
+		}
+	}
+
+	if _, err = client.BumpFee(ctx, &bumpReq); err != nil {
+		return r, errors.Wrap(err, "Bumping fee")
+	}
+
+	r.LocalNodeId = req.NodeId
+	r.TxHash = req.TxHash
+	r.CreatedOn = time.Now().UTC()
+	if req.SatPerVbyte != nil {
+		satPerVbyte := int64(*req.SatPerVbyte)
+		r.SatPerVbyte = &satPerVbyte
+	}
+	if req.TargetConf != nil {
+		targetConf := int32(*req.TargetConf)
+		r.TargetConf = &targetConf
+	}
+	return r, nil
+}
+
+// BumpFee bumps the fee of an unconfirmed transaction with RBF or CPFP and records the bump.
+func BumpFee(ctx context.Context, db *sqlx.DB, req BumpFeeRequest) (TxFeeBump, error) {
+	var rawTxHex string
+	err := db.Get(&rawTxHex, `SELECT coalesce(max(raw_tx_hex), '') FROM tx WHERE tx_hash = $1;`, req.TxHash)
+	if err != nil {
+		return TxFeeBump{}, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+
+	if err = settings.CheckNodePermission(db, req.NodeId, settings.ActionSendOnChain); err != nil {
+		return TxFeeBump{}, err
+	}
+	conn, err := connectWallet(db, req.NodeId)
+	if err != nil {
+		return TxFeeBump{}, err
+	}
+	defer conn.Close()
+
+	r, err := bumpFee(ctx, walletrpc.NewWalletKitClient(conn), req, rawTxHex)
+	if err != nil {
+		return r, err
+	}
+	if err = insertFeeBump(db, r); err != nil {
+		return r, err
+	}
+	return r, nil
+}
@@ -0,0 +1,91 @@
+package on_chain_tx
+
+import (
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/walletrpc"
+	"testing"
+	"time"
+)
+
+const testStuckTxid = "b5b9f2e4b4c4d1c7f4b6b0a8e3e5d9c1b2a3f4e5d6c7b8a9f0e1d2c3b4a5f6e7"
+
+func Test_selectBumpOutpoint(t *testing.T) {
+	parent, _ := chainhash.NewHashFromStr(testTxid)
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(parent, 1), nil, nil))
+
+	sweepInput := &walletrpc.PendingSweep{Outpoint: &lnrpc.OutPoint{TxidStr: testTxid, OutputIndex: 1}}
+	anchor := &walletrpc.PendingSweep{Outpoint: &lnrpc.OutPoint{TxidStr: testStuckTxid, OutputIndex: 0}}
+	walletOutput := &lnrpc.Utxo{Outpoint: &lnrpc.OutPoint{TxidStr: testStuckTxid, OutputIndex: 2}}
+
+	tests := []struct {
+		name         string
+		tx           *wire.MsgTx
+		sweeps       []*walletrpc.PendingSweep
+		unspent      []*lnrpc.Utxo
+		wantOutpoint string
+		wantMethod   string
+		wantErr      bool
+	}{
+		{"Sweep replaced", tx, []*walletrpc.PendingSweep{anchor, sweepInput}, []*lnrpc.Utxo{walletOutput},
+			testTxid + ":1", bumpRbf, false},
+		{"Anchor child", nil, []*walletrpc.PendingSweep{sweepInput, anchor}, []*lnrpc.Utxo{walletOutput},
+			testStuckTxid + ":0", bumpCpfp, false},
+		{"Wallet output child", tx, nil, []*lnrpc.Utxo{walletOutput}, testStuckTxid + ":2", bumpCpfp, false},
+		{"Nothing to bump", tx, nil, nil, "", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outpoint, method, err := selectBumpOutpoint(testStuckTxid, test.tx, test.sweeps, test.unspent)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("selectBumpOutpoint() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if outpoint != test.wantOutpoint || method != test.wantMethod {
+				t.Errorf("selectBumpOutpoint() = %s %s, want %s %s", outpoint, method, test.wantOutpoint,
+					test.wantMethod)
+			}
+		})
+	}
+}
+
+func Test_processBumpFeeRequest(t *testing.T) {
+	var satPerVbyte uint64 = 20
+	var targetConf uint32 = 6
+	if _, err := processBumpFeeRequest(BumpFeeRequest{NodeId: 1, TxHash: testStuckTxid}); err == nil {
+		t.Errorf("processBumpFeeRequest() accepted a request without fee rate and conf target")
+	}
+	_, err := processBumpFeeRequest(BumpFeeRequest{NodeId: 1, TxHash: testStuckTxid, SatPerVbyte: &satPerVbyte,
+		TargetConf: &targetConf})
+	if err == nil {
+		t.Errorf("processBumpFeeRequest() accepted both a fee rate and a conf target")
+	}
+	r, err := processBumpFeeRequest(BumpFeeRequest{NodeId: 1, TxHash: testStuckTxid, SatPerVbyte: &satPerVbyte})
+	if err != nil || r.SatPerVbyte != 20 || r.Outpoint != nil {
+		t.Errorf("processBumpFeeRequest() = %v, %v", r, err)
+	}
+}
+
+func Test_mergeUnconfirmedTxs(t *testing.T) {
+	label := "0:openchannel"
+	stored := []storedTx{{Date: time.Now(), TxHash: testStuckTxid, AmountSat: -100000, TotalFeesSat: 300,
+		Label: &label}}
+	channelTxs := map[string][2]string{
+		testStuckTxid: {testStuckTxid + ":0", pendingOpen},
+		testTxid:      {"c5b9:1", pendingForceClose},
+	}
+	child := "child"
+	bumps := []TxFeeBump{{TxHash: testStuckTxid, Method: bumpCpfp, ReplacingTxHash: &child}}
+
+	r := mergeUnconfirmedTxs(stored, channelTxs, bumps, map[string]int64{child: 500})
+	if len(r) != 2 {
+		t.Fatalf("Got %d unconfirmed transactions, want 2", len(r))
+	}
+	if *r[0].PendingChannelType != pendingOpen || r[0].BumpFeesSat != 500 || len(r[0].Bumps) != 1 {
+		t.Errorf("Funding transaction = %+v", r[0])
+	}
+	if r[1].TxHash != testTxid || *r[1].PendingChannelType != pendingForceClose || r[1].Date != nil {
+		t.Errorf("Peer closing transaction = %+v", r[1])
+	}
+}
@@ -22,12 +22,44 @@ type sendCoinsRequest struct {
 	Label            *string `json:"label"`
 	MinConfs         *int32  `json:"minConfs"`
 	SpendUnconfirmed *bool   `json:"spendUnconfirmed"`
+	// Outpoints are the only outputs LND may spend, formatted as txid:index.
+	Outpoints []string `json:"outpoints"`
 }
 
 type sendCoinsResponse struct {
 	TxId string `json:"txId"`
 }
 
+// onChainTxColumns are the columns on-chain transactions can be filtered by.
+var onChainTxColumns = qp.ColumnSchema{
+	"date":                 qp.DateColumn,
+	"dest_addresses":       qp.ArrayColumn,
+	"dest_addresses_count": qp.NumberColumn,
+	"amount":               qp.NumberColumn,
+	"total_fees":           qp.NumberColumn,
+	"label":                qp.StringColumn,
+	"lnd_tx_type_label":    qp.StringColumn,
+	"lnd_short_chan_id":    qp.StringColumn,
+	"tags":                 qp.ArrayColumn,
+	"on_chain_batch_id":    qp.NumberColumn,
+	"category":             qp.StringColumn,
+	"channel_ids":          qp.ArrayColumn,
+}
+
+// onChainTxSortColumns are the columns on-chain transactions can be sorted by.
+var onChainTxSortColumns = []string{
+	"date",
+	"dest_addresses",
+	"dest_addresses_count",
+	"amount",
+	"total_fees",
+	"label",
+	"lnd_tx_type_label",
+	"lnd_short_chan_id",
+	"on_chain_batch_id",
+	"category",
+}
+
 func getOnChainTxsHandler(c *gin.Context, db *sqlx.DB) {
 
 	// Filter parser with whitelisted columns
@@ -35,17 +67,14 @@ func getOnChainTxsHandler(c *gin.Context, db *sqlx.DB) {
 	filterParam := c.Query("filter")
 	var err error
 	if filterParam != "" {
-		filter, err = qp.ParseFilterParam(filterParam, []string{
-			"date",
-			"dest_addresses",
-			"dest_addresses_count",
-			"amount",
-			"total_fees",
-			"label",
-			"lnd_tx_type_label",
-			"lnd_short_chan_id",
-		})
-		if err != nil {
+		filter, err = qp.ParseFilterParamWithSchema(filterParam, onChainTxColumns)
+		switch e := err.(type) {
+		case nil:
+			break
+		case qp.ErrInvalidFilter:
+			c.JSON(http.StatusBadRequest, gin.H{"Error": e.Error(), "Key": e.Key})
+			return
+		default:
 			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
 			return
 		}
@@ -55,18 +84,7 @@ func getOnChainTxsHandler(c *gin.Context, db *sqlx.DB) {
 	sortParam := c.Query("order")
 	if sortParam != "" {
 		// Order parser with whitelisted columns
-		sort, err = qp.ParseOrderParams(
-			sortParam,
-			[]string{
-				"date",
-				"dest_addresses",
-				"dest_addresses_count",
-				"amount",
-				"total_fees",
-				"label",
-				"lnd_tx_type_label",
-				"lnd_short_chan_id",
-			})
+		sort, err = qp.ParseOrderParams(sortParam, onChainTxSortColumns)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
 			return
@@ -157,4 +175,195 @@ func RegisterOnChainTxsRoutes(r *gin.RouterGroup, db *sqlx.DB) {
 	r.GET("", func(c *gin.Context) { getOnChainTxsHandler(c, db) })
 	//r.GET(":identifier", func(c *gin.Context) { getOnChainTxHandler(c, db) })
 	r.POST("sendcoins", func(c *gin.Context) { sendCoinsHandler(c, db) })
+	r.GET("utxos", func(c *gin.Context) { getUtxosHandler(c, db) })
+	r.POST("utxos/lease", func(c *gin.Context) { leaseUtxoHandler(c, db) })
+	r.POST("utxos/release", func(c *gin.Context) { releaseUtxoHandler(c, db) })
+	r.POST("utxos/consolidate", func(c *gin.Context) { consolidateUtxosHandler(c, db) })
+	r.GET("unconfirmed", func(c *gin.Context) { getUnconfirmedTxsHandler(c, db) })
+	r.POST("sendmany", func(c *gin.Context) { sendManyHandler(c, db) })
+	r.POST("sendmany/preview", func(c *gin.Context) { previewSendManyHandler(c, db) })
+	r.GET("batches", func(c *gin.Context) { getBatchesHandler(c, db) })
+	r.GET("batches/:onChainBatchId", func(c *gin.Context) { getBatchHandler(c, db) })
+	r.POST("bumpfee", func(c *gin.Context) { bumpFeeHandler(c, db) })
+}
+
+func getUtxosHandler(c *gin.Context, db *sqlx.DB) {
+	nodeId, err := strconv.Atoi(c.Query("nodeId"))
+	if err != nil {
+		server_errors.SendBadRequest(c, "Node id must be a number")
+		return
+	}
+	var minConfs, maxConfs int64
+	if c.Query("minConfs") != "" {
+		if minConfs, err = strconv.ParseInt(c.Query("minConfs"), 10, 32); err != nil {
+			server_errors.SendBadRequest(c, "Min confs must be a number")
+			return
+		}
+	}
+	if c.Query("maxConfs") != "" {
+		if maxConfs, err = strconv.ParseInt(c.Query("maxConfs"), 10, 32); err != nil {
+			server_errors.SendBadRequest(c, "Max confs must be a number")
+			return
+		}
+	}
+
+	r, err := ListUtxos(c.Request.Context(), db, nodeId, int32(minConfs), int32(maxConfs))
+	if err != nil {
+		server_errors.WrapLogAndSendServerError(c, err, "Listing UTXOs")
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+func leaseUtxoHandler(c *gin.Context, db *sqlx.DB) {
+	var requestBody LeaseUtxoRequest
+	if err := c.BindJSON(&requestBody); err != nil {
+		server_errors.SendBadRequestFromError(c, err)
+		return
+	}
+
+	expiration, err := LeaseUtxo(c.Request.Context(), db, requestBody)
+	if err != nil {
+		server_errors.WrapLogAndSendServerError(c, err, "Leasing UTXO")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"outpoint": requestBody.Outpoint, "leaseExpiration": expiration})
+}
+
+func releaseUtxoHandler(c *gin.Context, db *sqlx.DB) {
+	var requestBody ReleaseUtxoRequest
+	if err := c.BindJSON(&requestBody); err != nil {
+		server_errors.SendBadRequestFromError(c, err)
+		return
+	}
+
+	if err := ReleaseUtxo(c.Request.Context(), db, requestBody); err != nil {
+		server_errors.WrapLogAndSendServerError(c, err, "Releasing UTXO")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"outpoint": requestBody.Outpoint})
+}
+
+func consolidateUtxosHandler(c *gin.Context, db *sqlx.DB) {
+	var requestBody ConsolidateUtxosRequest
+	if err := c.BindJSON(&requestBody); err != nil {
+		server_errors.SendBadRequestFromError(c, err)
+		return
+	}
+
+	r, err := ConsolidateUtxos(c.Request.Context(), db, requestBody)
+	if err != nil {
+		server_errors.WrapLogAndSendServerError(c, err, "Consolidating UTXOs")
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+func getUnconfirmedTxsHandler(c *gin.Context, db *sqlx.DB) {
+	nodeId, err := strconv.Atoi(c.Query("nodeId"))
+	if err != nil {
+		server_errors.SendBadRequest(c, "Node id must be a number")
+		return
+	}
+
+	r, err := ListUnconfirmedTxs(c.Request.Context(), db, nodeId)
+	if err != nil {
+		server_errors.WrapLogAndSendServerError(c, err, "Listing unconfirmed transactions")
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+func bumpFeeHandler(c *gin.Context, db *sqlx.DB) {
+	var requestBody BumpFeeRequest
+	if err := c.BindJSON(&requestBody); err != nil {
+		server_errors.SendBadRequestFromError(c, err)
+		return
+	}
+	if _, err := processBumpFeeRequest(requestBody); err != nil {
+		server_errors.SendUnprocessableEntityFromError(c, err)
+		return
+	}
+
+	r, err := BumpFee(c.Request.Context(), db, requestBody)
+	if err != nil {
+		server_errors.WrapLogAndSendServerError(c, err, "Bumping fee")
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+func sendManyHandler(c *gin.Context, db *sqlx.DB) {
+	var requestBody SendManyRequest
+	if err := c.BindJSON(&requestBody); err != nil {
+		server_errors.SendBadRequestFromError(c, err)
+		return
+	}
+	if _, _, err := processSendManyRequest(requestBody); err != nil {
+		server_errors.SendUnprocessableEntityFromError(c, err)
+		return
+	}
+
+	r, err := SendMany(c.Request.Context(), db, requestBody)
+	if err != nil {
+		server_errors.WrapLogAndSendServerError(c, err, "Sending on-chain batch")
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+func previewSendManyHandler(c *gin.Context, db *sqlx.DB) {
+	var requestBody SendManyRequest
+	if err := c.BindJSON(&requestBody); err != nil {
+		server_errors.SendBadRequestFromError(c, err)
+		return
+	}
+	if _, _, err := processSendManyRequest(requestBody); err != nil {
+		server_errors.SendUnprocessableEntityFromError(c, err)
+		return
+	}
+
+	r, err := PreviewSendMany(c.Request.Context(), db, requestBody)
+	if err != nil {
+		server_errors.WrapLogAndSendServerError(c, err, "Estimating on-chain batch fee")
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+func getBatchesHandler(c *gin.Context, db *sqlx.DB) {
+	r, err := getBatches(db)
+	if err != nil {
+		server_errors.LogAndSendServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+func getBatchHandler(c *gin.Context, db *sqlx.DB) {
+	batchId, err := strconv.Atoi(c.Param("onChainBatchId"))
+	if err != nil {
+		server_errors.SendBadRequest(c, "On-chain batch id must be a number")
+		return
+	}
+	r, err := getBatch(db, batchId)
+	switch err.(type) {
+	case nil:
+		break
+	case ErrOnChainBatchNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"Error": err.Error(), "Identifier": c.Param("onChainBatchId")})
+		return
+	default:
+		server_errors.LogAndSendServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, r)
 }
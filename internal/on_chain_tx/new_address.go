@@ -37,9 +37,10 @@ type rpcClientNewAddress interface {
 }
 
 func NewAddress(
+	ctx context.Context,
 	wChan chan interface{},
 	db *sqlx.DB,
-	context *gin.Context,
+	c *gin.Context,
 	newAddressRequest NewAddressRequest,
 	reqId string,
 ) (err error) {
@@ -48,6 +49,10 @@ func NewAddress(
 		return errors.New("Node id is missing")
 	}
 
+	if err = settings.CheckNodePermission(db, newAddressRequest.NodeId, settings.ActionNewAddress); err != nil {
+		return err
+	}
+
 	connectionDetails, err := settings.GetNodeConnectionDetailsById(db, newAddressRequest.NodeId)
 	if err != nil {
 		return errors.Wrap(err, "Getting node connection details from the db")
@@ -61,7 +66,7 @@ func NewAddress(
 	}
 	defer conn.Close()
 	client := walletrpc.NewWalletKitClient(conn)
-	return newAddress(client, newAddressRequest, wChan, reqId)
+	return newAddress(ctx, client, newAddressRequest, wChan, reqId)
 }
 
 func createLndAddressRequest(newAddressRequest NewAddressRequest) (r walletrpc.AddrRequest, err error) {
@@ -82,14 +87,14 @@ func createLndAddressRequest(newAddressRequest NewAddressRequest) (r walletrpc.A
 	return lndAddressRequest, nil
 }
 
-func newAddress(client rpcClientNewAddress, newAddressRequest NewAddressRequest, wChan chan interface{}, reqId string) (err error) {
+func newAddress(ctx context.Context, client rpcClientNewAddress, newAddressRequest NewAddressRequest,
+	wChan chan interface{}, reqId string) (err error) {
 	// Create and validate payment request details
 	lndAddressRequest, err := createLndAddressRequest(newAddressRequest)
 	if err != nil {
 		return err
 	}
 
-	ctx := context.Background()
 	lndResponse, err := client.NextAddr(ctx, &lndAddressRequest)
 	if err != nil {
 		return errors.Wrap(err, "New address")
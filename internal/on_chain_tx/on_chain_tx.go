@@ -4,6 +4,7 @@ import (
 	sq "github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
+	qp "github.com/lncapital/torq/internal/query_parser"
 	"github.com/rs/zerolog/log"
 	"time"
 )
@@ -18,6 +19,10 @@ type Transaction struct {
 	Label              *string        `json:"label" db:"label"`
 	LndTxTypeLabel     *string        `json:"lnd_tx_type_label" db:"lnd_tx_type_label"`
 	LndShortChannelId  *string        `json:"lnd_short_chan_id" db:"lnd_short_chan_id"`
+	Tags               pq.StringArray `json:"tags" db:"tags"`
+	OnChainBatchId     *int           `json:"on_chain_batch_id" db:"on_chain_batch_id"`
+	Category           *string        `json:"category" db:"category"`
+	ChannelIds         pq.StringArray `json:"channel_ids" db:"channel_ids"`
 	//BlockHash        *string   `json:"block_hash" db:"block_hash"`
 	//BlockHeight      uint64    `json:"block_height" db:"block_height"`
 	//RawTxHex         string    `json:"raw_tx_hex" db:"raw_tx_hex"`
@@ -42,7 +47,11 @@ func getOnChainTxs(db *sqlx.DB, filter sq.Sqlizer, order []string, limit uint64,
 			   total_fees,
 			   label,
 			   (regexp_matches(label, '\d{1,}:(openchannel|closechannel|sweep)|$'))[1] as lnd_tx_type_label,
-       		   (regexp_matches(label, '\d{1,}:(openchannel|closechannel):shortchanid-(\d{18,18})|$') )[2] as lnd_short_chan_id
+       		   (regexp_matches(label, '\d{1,}:(openchannel|closechannel):shortchanid-(\d{18,18})|$') )[2] as lnd_short_chan_id,
+			   channel_tags(substring(label from 'shortchanid-(\d{18,18})')::numeric) as tags,
+			   (select max(on_chain_batch_id) from on_chain_batch b where b.tx_hash = tx.tx_hash) as on_chain_batch_id,
+			   (select category from tx_category c where c.tx_hash = tx.tx_hash) as category,
+			   coalesce((select lnd_short_channel_ids from tx_category c where c.tx_hash = tx.tx_hash), '{}') as channel_ids
 			`).
 				PlaceholderFormat(sq.Dollar).
 				From("tx"),
@@ -79,6 +88,10 @@ func getOnChainTxs(db *sqlx.DB, filter sq.Sqlizer, order []string, limit uint64,
 			&tx.Label,
 			&tx.LndTxTypeLabel,
 			&tx.LndShortChannelId,
+			&tx.Tags,
+			&tx.OnChainBatchId,
+			&tx.Category,
+			&tx.ChannelIds,
 		)
 
 		if err != nil {
@@ -103,7 +116,11 @@ func getOnChainTxs(db *sqlx.DB, filter sq.Sqlizer, order []string, limit uint64,
 			   total_fees,
 			   label,
 			   (regexp_matches(label, '\d{1,}:(openchannel|closechannel|sweep)|$'))[1] as lnd_tx_type_label,
-       		   (regexp_matches(label, '\d{1,}:(openchannel|closechannel):shortchanid-(\d{18,18})|$') )[2] as lnd_short_chan_id
+       		   (regexp_matches(label, '\d{1,}:(openchannel|closechannel):shortchanid-(\d{18,18})|$') )[2] as lnd_short_chan_id,
+			   channel_tags(substring(label from 'shortchanid-(\d{18,18})')::numeric) as tags,
+			   (select max(on_chain_batch_id) from on_chain_batch b where b.tx_hash = tx.tx_hash) as on_chain_batch_id,
+			   (select category from tx_category c where c.tx_hash = tx.tx_hash) as category,
+			   coalesce((select lnd_short_channel_ids from tx_category c where c.tx_hash = tx.tx_hash), '{}') as channel_ids
 			`).
 				PlaceholderFormat(sq.Dollar).
 				From("tx"),
@@ -122,3 +139,25 @@ func getOnChainTxs(db *sqlx.DB, filter sq.Sqlizer, order []string, limit uint64,
 
 	return r, total, nil
 }
+
+// QueryOnChainTxs parses the filter clauses and sort order against the on-chain transaction columns
+// and runs the query. It is used to run saved table views on the server. Invalid filters and sorting
+// are returned as qp.ErrInvalidFilter and qp.ErrInvalidOrder.
+func QueryOnChainTxs(db *sqlx.DB, filters *qp.FilterClauses, order []qp.Order, limit uint64,
+	offset uint64) (r []*Transaction, total uint64, err error) {
+
+	var filter sq.Sqlizer
+	if filters != nil && !filters.IsEmpty() {
+		filter, err = qp.NewSchemaParser(onChainTxColumns).ParseFilterClauses(*filters)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	sort, err := qp.NewParser(onChainTxSortColumns).ParseOrderClauses(order)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return getOnChainTxs(db, filter, sort, limit, offset)
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/cockroachdb/errors"
 	"github.com/jmoiron/sqlx"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/walletrpc"
 	"github.com/lncapital/torq/internal/settings"
 	"github.com/lncapital/torq/pkg/lnd_connect"
 	"github.com/rs/zerolog/log"
@@ -17,6 +18,10 @@ func sendCoins(db *sqlx.DB, req sendCoinsRequest) (r string, err error) {
 		return "", errors.Wrap(err, "Process send request")
 	}
 
+	if err = settings.CheckNodePermission(db, req.NodeId, settings.ActionSendOnChain); err != nil {
+		return "", err
+	}
+
 	connectionDetails, err := settings.GetNodeConnectionDetailsById(db, req.NodeId)
 	if err != nil {
 		return "", errors.New("Error getting node connection details from the db")
@@ -35,6 +40,14 @@ func sendCoins(db *sqlx.DB, req sendCoinsRequest) (r string, err error) {
 	client := lnrpc.NewLightningClient(conn)
 	ctx := context.Background()
 
+	if len(req.Outpoints) != 0 {
+		release, err := LeaseOtherUtxos(ctx, walletrpc.NewWalletKitClient(conn), req.Outpoints)
+		if err != nil {
+			return "", errors.Wrap(err, "Selecting outpoints")
+		}
+		defer release()
+	}
+
 	resp, err := client.SendCoins(ctx, &sendCoinsReq)
 	if err != nil {
 		return "", errors.Wrap(err, "Sending coins")
@@ -64,6 +77,12 @@ func processSendRequest(req sendCoinsRequest) (r lnrpc.SendCoinsRequest, err err
 		return r, errors.New("Either targetConf or satPerVbyte accepted")
 	}
 
+	for _, o := range req.Outpoints {
+		if _, err = parseOutpoint(o); err != nil {
+			return r, err
+		}
+	}
+
 	r.Addr = req.Addr
 	r.Amount = req.AmountSat
 
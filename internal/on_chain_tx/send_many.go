@@ -0,0 +1,400 @@
+package on_chain_tx
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/cockroachdb/errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lightningnetwork/lnd/input"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/walletrpc"
+	"github.com/lightningnetwork/lnd/lnwallet"
+	"github.com/lncapital/torq/internal/settings"
+	"google.golang.org/grpc"
+	"time"
+)
+
+const (
+	batchPending = "PENDING"
+	batchSent    = "SENT"
+	batchFailed  = "FAILED"
+)
+
+type rpcClientSendMany interface {
+	EstimateFee(ctx context.Context, in *lnrpc.EstimateFeeRequest,
+		opts ...grpc.CallOption) (*lnrpc.EstimateFeeResponse, error)
+	SendMany(ctx context.Context, in *lnrpc.SendManyRequest, opts ...grpc.CallOption) (*lnrpc.SendManyResponse, error)
+}
+
+type rpcClientListUnspent interface {
+	ListUnspent(ctx context.Context, in *walletrpc.ListUnspentRequest,
+		opts ...grpc.CallOption) (*walletrpc.ListUnspentResponse, error)
+}
+
+type SendManyOutput struct {
+	Addr      string `json:"addr"`
+	AmountSat int64  `json:"amountSat"`
+}
+
+type SendManyRequest struct {
+	NodeId           int              `json:"nodeId"`
+	Outputs          []SendManyOutput `json:"outputs"`
+	TargetConf       *int32           `json:"targetConf"`
+	SatPerVbyte      *uint64          `json:"satPerVbyte"`
+	Label            *string          `json:"label"`
+	MinConfs         *int32           `json:"minConfs"`
+	SpendUnconfirmed *bool            `json:"spendUnconfirmed"`
+	// Outpoints are the only outputs LND may spend, formatted as txid:index.
+	Outpoints []string `json:"outpoints"`
+}
+
+type SendManyPreview struct {
+	TotalAmountSat int64  `json:"totalAmountSat"`
+	FeeSat         int64  `json:"feeSat"`
+	SatPerVbyte    uint64 `json:"satPerVbyte"`
+}
+
+type OnChainBatch struct {
+	OnChainBatchId int             `json:"onChainBatchId" db:"on_chain_batch_id"`
+	LocalNodeId    int             `json:"localNodeId" db:"local_node_id"`
+	Outputs        json.RawMessage `json:"outputs" db:"outputs"`
+	TotalAmountSat int64           `json:"totalAmountSat" db:"total_amount_sat"`
+	Label          string          `json:"label" db:"label"`
+	Status         string          `json:"status" db:"status"`
+	Error          *string         `json:"error" db:"error"`
+	TxHash         *string         `json:"txHash" db:"tx_hash"`
+	CreatedOn      time.Time       `json:"createdOn" db:"created_on"`
+	UpdatedOn      time.Time       `json:"updatedOn" db:"updated_on"`
+}
+
+type SendManyResponse struct {
+	ReqId string `json:"reqId"`
+	Type  string `json:"type"`
+	OnChainBatch
+}
+
+type ErrOnChainBatchNotFound struct {
+	Identifier int
+}
+
+func (e ErrOnChainBatchNotFound) Error() string {
+	return "On-chain batch not found"
+}
+
+func processSendManyRequest(req SendManyRequest) (r lnrpc.SendManyRequest, total int64, err error) {
+	if req.NodeId == 0 {
+		return r, 0, errors.New("Node id is missing")
+	}
+	if len(req.Outputs) == 0 {
+		return r, 0, errors.New("At least one output has to be provided")
+	}
+	if req.TargetConf != nil && req.SatPerVbyte != nil {
+		return r, 0, errors.New("Either targetConf or satPerVbyte accepted")
+	}
+	for _, o := range req.Outpoints {
+		if _, err = parseOutpoint(o); err != nil {
+			return r, 0, err
+		}
+	}
+
+	r.AddrToAmount = make(map[string]int64)
+	for i, o := range req.Outputs {
+		if o.Addr == "" {
+			return r, 0, errors.Newf("Output %d has no address", i)
+		}
+		if o.AmountSat <= 0 {
+			return r, 0, errors.Newf("Output %d has an invalid amount", i)
+		}
+		if _, ok := r.AddrToAmount[o.Addr]; ok {
+			return r, 0, errors.Newf("Address %s is used by more than one output", o.Addr)
+		}
+		r.AddrToAmount[o.Addr] = o.AmountSat
+		total += o.AmountSat
+	}
+
+	if req.TargetConf != nil {
+		r.TargetConf = *req.TargetConf
+	}
+	if req.SatPerVbyte != nil {
+		r.SatPerVbyte = *req.SatPerVbyte
+	}
+	if req.Label != nil {
+		r.Label = *req.Label
+	}
+	if req.MinConfs != nil {
+		r.MinConfs = *req.MinConfs
+	}
+	if req.SpendUnconfirmed != nil {
+		r.SpendUnconfirmed = *req.SpendUnconfirmed
+	}
+	return r, total, nil
+}
+
+// previewSendMany estimates the fee of the batch. LND estimates for a conf target only, the fee for a requested fee
+// rate is derived from the size of the estimated transaction.
+func previewSendMany(ctx context.Context, client rpcClientSendMany, sendReq *lnrpc.SendManyRequest,
+	total int64) (r SendManyPreview, err error) {
+
+	resp, err := client.EstimateFee(ctx, &lnrpc.EstimateFeeRequest{
+		AddrToAmount:     sendReq.AddrToAmount,
+		TargetConf:       sendReq.TargetConf,
+		MinConfs:         sendReq.MinConfs,
+		SpendUnconfirmed: sendReq.SpendUnconfirmed,
+	})
+	if err != nil {
+		return r, errors.Wrap(err, "Estimating fee")
+	}
+	r.TotalAmountSat = total
+	r.FeeSat = resp.FeeSat
+	r.SatPerVbyte = resp.SatPerVbyte
+	if sendReq.SatPerVbyte != 0 && resp.SatPerVbyte != 0 {
+		r.FeeSat = (resp.FeeSat*int64(sendReq.SatPerVbyte) + int64(resp.SatPerVbyte) - 1) / int64(resp.SatPerVbyte)
+		r.SatPerVbyte = sendReq.SatPerVbyte
+	}
+	return r, nil
+}
+
+// previewSendManyWithOutpoints estimates the fee of a batch spending exactly the selected outpoints. LND only
+// estimates with its own coin selection, which would require leasing the other outputs, so the transaction is sized
+// here. Like LND, the change is paid to a taproot output and dropped when it's dust.
+func previewSendManyWithOutpoints(ctx context.Context, client rpcClientSendMany, walletClient rpcClientListUnspent,
+	sendReq *lnrpc.SendManyRequest, total int64, outpoints []string) (r SendManyPreview, err error) {
+
+	r.TotalAmountSat = total
+	r.SatPerVbyte = sendReq.SatPerVbyte
+	if r.SatPerVbyte == 0 {
+		// Only the fee rate for the conf target is used, the coins LND selects for the estimate don't matter.
+		resp, err := client.EstimateFee(ctx, &lnrpc.EstimateFeeRequest{
+			AddrToAmount:     sendReq.AddrToAmount,
+			TargetConf:       sendReq.TargetConf,
+			MinConfs:         sendReq.MinConfs,
+			SpendUnconfirmed: sendReq.SpendUnconfirmed,
+		})
+		if err != nil {
+			return r, errors.Wrap(err, "Estimating fee rate")
+		}
+		r.SatPerVbyte = resp.SatPerVbyte
+	}
+
+	unspent, err := walletClient.ListUnspent(ctx, &walletrpc.ListUnspentRequest{})
+	if err != nil {
+		return r, errors.Wrap(err, "Listing unspent outputs")
+	}
+	utxos := make(map[string]*lnrpc.Utxo)
+	for _, u := range unspent.Utxos {
+		utxos[formatOutpoint(u.Outpoint)] = u
+	}
+
+	var tx input.TxWeightEstimator
+	var inputSat int64
+	for _, o := range outpoints {
+		op, err := parseOutpoint(o)
+		if err != nil {
+			return r, err
+		}
+		u, ok := utxos[formatOutpoint(op)]
+		if !ok {
+			return r, errors.Newf("Outpoint %s is not an unspent output of the wallet", o)
+		}
+		switch u.AddressType {
+		case lnrpc.AddressType_WITNESS_PUBKEY_HASH:
+			tx.AddP2WKHInput()
+		case lnrpc.AddressType_NESTED_PUBKEY_HASH:
+			tx.AddNestedP2WKHInput()
+		case lnrpc.AddressType_TAPROOT_PUBKEY:
+			tx.AddTaprootKeySpendInput(txscript.SigHashDefault)
+		default:
+			return r, errors.Newf("Outpoint %s has an unsupported address type %s", o, u.AddressType)
+		}
+		inputSat += u.AmountSat
+	}
+
+	for addr, amount := range sendReq.AddrToAmount {
+		pkScript, err := outputScript(addr)
+		if err != nil {
+			return r, err
+		}
+		tx.AddTxOutput(wire.NewTxOut(amount, pkScript))
+	}
+
+	r.FeeSat = int64(tx.VSize()) * int64(r.SatPerVbyte)
+	if inputSat < total+r.FeeSat {
+		return r, errors.Newf("The selected outpoints (%d sat) don't cover the outputs and the fee (%d sat)",
+			inputSat, total+r.FeeSat)
+	}
+	tx.AddP2TROutput()
+	feeWithChange := int64(tx.VSize()) * int64(r.SatPerVbyte)
+	if inputSat-total-feeWithChange >= int64(lnwallet.DustLimitForSize(input.P2TRSize)) {
+		r.FeeSat = feeWithChange
+	} else {
+		// The dust change is left to the miners.
+		r.FeeSat = inputSat - total
+	}
+	return r, nil
+}
+
+// outputScript returns the script paying to addr on any of the networks LND supports.
+func outputScript(addr string) ([]byte, error) {
+	for _, params := range []*chaincfg.Params{&chaincfg.MainNetParams, &chaincfg.TestNet3Params,
+		&chaincfg.RegressionNetParams, &chaincfg.SigNetParams, &chaincfg.SimNetParams} {
+
+		a, err := btcutil.DecodeAddress(addr, params)
+		if err != nil || !a.IsForNet(params) {
+			continue
+		}
+		return txscript.PayToAddrScript(a)
+	}
+	return nil, errors.Newf("Address %s is invalid", addr)
+}
+
+// withCoinControl leases the outputs that are not selected while f runs.
+func withCoinControl(ctx context.Context, conn *grpc.ClientConn, outpoints []string, f func() error) error {
+	if len(outpoints) != 0 {
+		release, err := LeaseOtherUtxos(ctx, walletrpc.NewWalletKitClient(conn), outpoints)
+		if err != nil {
+			return errors.Wrap(err, "Selecting outpoints")
+		}
+		defer release()
+	}
+	return f()
+}
+
+// PreviewSendMany estimates the fee of a batch without changing the state of the wallet, so it's also available in
+// read-only mode.
+func PreviewSendMany(ctx context.Context, db *sqlx.DB, req SendManyRequest) (r SendManyPreview, err error) {
+	sendReq, total, err := processSendManyRequest(req)
+	if err != nil {
+		return r, err
+	}
+	conn, err := connectWallet(db, req.NodeId)
+	if err != nil {
+		return r, err
+	}
+	defer conn.Close()
+
+	if len(req.Outpoints) != 0 {
+		return previewSendManyWithOutpoints(ctx, lnrpc.NewLightningClient(conn), walletrpc.NewWalletKitClient(conn),
+			&sendReq, total, req.Outpoints)
+	}
+	return previewSendMany(ctx, lnrpc.NewLightningClient(conn), &sendReq, total)
+}
+
+// SendMany sends the outputs in a single transaction and records it as a batch. Without a label the transaction is
+// labeled with the batch id.
+func SendMany(ctx context.Context, db *sqlx.DB, req SendManyRequest) (r OnChainBatch, err error) {
+	sendReq, total, err := processSendManyRequest(req)
+	if err != nil {
+		return r, err
+	}
+	outputs, err := json.Marshal(req.Outputs)
+	if err != nil {
+		return r, errors.Wrap(err, "JSON encoding outputs")
+	}
+	if err = settings.CheckNodePermission(db, req.NodeId, settings.ActionSendOnChain); err != nil {
+		return r, err
+	}
+	conn, err := connectWallet(db, req.NodeId)
+	if err != nil {
+		return r, err
+	}
+	defer conn.Close()
+
+	r, err = insertBatch(db, OnChainBatch{
+		LocalNodeId:    req.NodeId,
+		Outputs:        outputs,
+		TotalAmountSat: total,
+		Label:          sendReq.Label,
+		Status:         batchPending,
+	})
+	if err != nil {
+		return r, err
+	}
+	if sendReq.Label == "" {
+		sendReq.Label = fmt.Sprintf("torq:batch-%d", r.OnChainBatchId)
+	}
+
+	var resp *lnrpc.SendManyResponse
+	sendErr := withCoinControl(ctx, conn, req.Outpoints, func() error {
+		resp, err = lnrpc.NewLightningClient(conn).SendMany(ctx, &sendReq)
+		return err
+	})
+	if sendErr != nil {
+		msg := sendErr.Error()
+		r.Status, r.Error = batchFailed, &msg
+	} else {
+		r.Status, r.TxHash = batchSent, &resp.Txid
+	}
+	r.Label = sendReq.Label
+	if err = updateBatch(db, r); err != nil {
+		return r, err
+	}
+	if sendErr != nil {
+		return r, errors.Wrap(sendErr, "Sending coins to many")
+	}
+	return r, nil
+}
+
+// SendManyWs sends the batch for a websocket request and writes the batch to wChan.
+func SendManyWs(ctx context.Context, wChan chan interface{}, db *sqlx.DB, req SendManyRequest, reqId string) error {
+	r, err := SendMany(ctx, db, req)
+	if err != nil {
+		return err
+	}
+	wChan <- SendManyResponse{ReqId: reqId, Type: "sendMany", OnChainBatch: r}
+	return nil
+}
+
+const batchColumns = `on_chain_batch_id, local_node_id, outputs, total_amount_sat, label, status, error, tx_hash,
+  created_on, updated_on`
+
+func insertBatch(db *sqlx.DB, batch OnChainBatch) (OnChainBatch, error) {
+	batch.CreatedOn = time.Now().UTC()
+	batch.UpdatedOn = batch.CreatedOn
+	err := db.QueryRowx(`
+		INSERT INTO on_chain_batch (local_node_id, outputs, total_amount_sat, label, status, created_on, updated_on)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING on_chain_batch_id;`,
+		batch.LocalNodeId, batch.Outputs, batch.TotalAmountSat, batch.Label, batch.Status, batch.CreatedOn,
+		batch.UpdatedOn).Scan(&batch.OnChainBatchId)
+	if err != nil {
+		return batch, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return batch, nil
+}
+
+func updateBatch(db *sqlx.DB, batch OnChainBatch) error {
+	_, err := db.Exec(`
+		UPDATE on_chain_batch SET label = $1, status = $2, error = $3, tx_hash = $4, updated_on = $5
+		WHERE on_chain_batch_id = $6;`,
+		batch.Label, batch.Status, batch.Error, batch.TxHash, time.Now().UTC(), batch.OnChainBatchId)
+	if err != nil {
+		return errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return nil
+}
+
+func getBatches(db *sqlx.DB) (r []OnChainBatch, err error) {
+	err = db.Select(&r, `SELECT `+batchColumns+` FROM on_chain_batch ORDER BY created_on DESC;`)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return r, nil
+}
+
+func getBatch(db *sqlx.DB, batchId int) (r OnChainBatch, err error) {
+	err = db.Get(&r, `SELECT `+batchColumns+` FROM on_chain_batch WHERE on_chain_batch_id = $1;`, batchId)
+	switch err {
+	case nil:
+		return r, nil
+	case sql.ErrNoRows:
+		return r, ErrOnChainBatchNotFound{Identifier: batchId}
+	default:
+		return r, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+}
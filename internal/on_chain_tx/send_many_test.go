@@ -0,0 +1,110 @@
+package on_chain_tx
+
+import (
+	"context"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"google.golang.org/grpc"
+	"testing"
+)
+
+type mockLightningClient_SendMany struct {
+	estimate *lnrpc.EstimateFeeResponse
+}
+
+func (c *mockLightningClient_SendMany) EstimateFee(ctx context.Context, in *lnrpc.EstimateFeeRequest,
+	opts ...grpc.CallOption) (*lnrpc.EstimateFeeResponse, error) {
+	return c.estimate, nil
+}
+
+func (c *mockLightningClient_SendMany) SendMany(ctx context.Context, in *lnrpc.SendManyRequest,
+	opts ...grpc.CallOption) (*lnrpc.SendManyResponse, error) {
+	return &lnrpc.SendManyResponse{Txid: testTxid}, nil
+}
+
+func Test_processSendManyRequest(t *testing.T) {
+	var targetConf int32 = 6
+	var satPerVbyte uint64 = 10
+	outputs := []SendManyOutput{{Addr: "a", AmountSat: 1000}, {Addr: "b", AmountSat: 2000}}
+
+	tests := []struct {
+		name    string
+		input   SendManyRequest
+		wantErr bool
+	}{
+		{"Missing node ID", SendManyRequest{Outputs: outputs}, true},
+		{"No outputs", SendManyRequest{NodeId: 1}, true},
+		{"Duplicate address", SendManyRequest{NodeId: 1,
+			Outputs: append(outputs, SendManyOutput{Addr: "a", AmountSat: 5})}, true},
+		{"Invalid amount", SendManyRequest{NodeId: 1, Outputs: []SendManyOutput{{Addr: "a"}}}, true},
+		{"Both targetconf and satpervbyte provided", SendManyRequest{NodeId: 1, Outputs: outputs,
+			TargetConf: &targetConf, SatPerVbyte: &satPerVbyte}, true},
+		{"Invalid outpoint", SendManyRequest{NodeId: 1, Outputs: outputs, Outpoints: []string{"abc"}}, true},
+		{"Valid", SendManyRequest{NodeId: 1, Outputs: outputs, TargetConf: &targetConf}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, total, err := processSendManyRequest(test.input)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("processSendManyRequest() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if err == nil && (total != 3000 || got.AddrToAmount["b"] != 2000 || got.TargetConf != 6) {
+				t.Errorf("processSendManyRequest() = %v, %d", got, total)
+			}
+		})
+	}
+}
+
+func Test_previewSendMany(t *testing.T) {
+	client := &mockLightningClient_SendMany{estimate: &lnrpc.EstimateFeeResponse{FeeSat: 1410, SatPerVbyte: 10}}
+	sendReq := &lnrpc.SendManyRequest{AddrToAmount: map[string]int64{"a": 1000}}
+
+	r, err := previewSendMany(context.Background(), client, sendReq, 1000)
+	if err != nil || r.FeeSat != 1410 || r.SatPerVbyte != 10 || r.TotalAmountSat != 1000 {
+		t.Errorf("previewSendMany() = %+v, %v", r, err)
+	}
+
+	// The fee for a requested fee rate is scaled from the estimate.
+	sendReq.SatPerVbyte = 25
+	r, err = previewSendMany(context.Background(), client, sendReq, 1000)
+	if err != nil || r.FeeSat != 3525 || r.SatPerVbyte != 25 {
+		t.Errorf("previewSendMany() = %+v, %v", r, err)
+	}
+}
+
+func Test_previewSendManyWithOutpoints(t *testing.T) {
+	const addr = "bcrt1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqdku202"
+	client := &mockLightningClient_SendMany{estimate: &lnrpc.EstimateFeeResponse{FeeSat: 1410, SatPerVbyte: 10}}
+	outpoints := []string{testTxid + ":1", testTxid + ":2"}
+
+	tests := []struct {
+		name      string
+		amountSat int64
+		outpoints []string
+		wantFee   int64
+		wantErr   bool
+	}{
+		// Two P2WKH inputs, the P2WKH output and a taproot change output are 221 vbytes.
+		{"With change", 40000, outpoints, 2210, false},
+		// Without the change output the transaction is 178 vbytes, the dust change is added to the fee.
+		{"Dust change", 49900, outpoints, 2100, false},
+		{"Insufficient inputs", 51000, outpoints, 0, true},
+		{"Unknown outpoint", 1000, []string{testTxid + ":9"}, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			walletClient := &mockWalletKitClient_Utxos{utxos: testUtxos(), leased: make(map[string]bool)}
+			sendReq := &lnrpc.SendManyRequest{AddrToAmount: map[string]int64{addr: test.amountSat}}
+			r, err := previewSendManyWithOutpoints(context.Background(), client, walletClient, sendReq,
+				test.amountSat, test.outpoints)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("previewSendManyWithOutpoints() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if err == nil && (r.FeeSat != test.wantFee || r.SatPerVbyte != 10 || r.TotalAmountSat != test.amountSat) {
+				t.Errorf("previewSendManyWithOutpoints() = %+v, want fee %d", r, test.wantFee)
+			}
+			if len(walletClient.leased) != 0 {
+				t.Errorf("previewSendManyWithOutpoints() leased %v", walletClient.leased)
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package on_chain_tx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/cockroachdb/errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/walletrpc"
+	"github.com/lncapital/torq/internal/settings"
+	"github.com/lncapital/torq/pkg/lnd_connect"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// torqLockId identifies the outputs Torq leases. LND requires each application to lease with its own 32 byte id.
+var torqLockId = func() []byte {
+	id := sha256.Sum256([]byte("torq"))
+	return id[:]
+}()
+
+// coinControlLeaseSecs is how long other outputs stay leased while LND selects the inputs of a transaction. The
+// leases are released right after, it only guards against Torq stopping in between.
+const coinControlLeaseSecs = 600
+
+type rpcClientUtxos interface {
+	ListUnspent(ctx context.Context, in *walletrpc.ListUnspentRequest,
+		opts ...grpc.CallOption) (*walletrpc.ListUnspentResponse, error)
+	LeaseOutput(ctx context.Context, in *walletrpc.LeaseOutputRequest,
+		opts ...grpc.CallOption) (*walletrpc.LeaseOutputResponse, error)
+	ReleaseOutput(ctx context.Context, in *walletrpc.ReleaseOutputRequest,
+		opts ...grpc.CallOption) (*walletrpc.ReleaseOutputResponse, error)
+	ListLeases(ctx context.Context, in *walletrpc.ListLeasesRequest,
+		opts ...grpc.CallOption) (*walletrpc.ListLeasesResponse, error)
+}
+
+type Utxo struct {
+	Outpoint      string  `json:"outpoint"`
+	TxHash        string  `json:"txHash"`
+	OutputIndex   uint32  `json:"outputIndex"`
+	Address       string  `json:"address"`
+	AddressType   string  `json:"addressType"`
+	AmountSat     int64   `json:"amountSat"`
+	Confirmations int64   `json:"confirmations"`
+	Label         *string `json:"label"`
+	// Leased outputs are not listed by LND as unspent, they are added from the leases.
+	Leased          bool       `json:"leased"`
+	LeasedByTorq    bool       `json:"leasedByTorq"`
+	LeaseExpiration *time.Time `json:"leaseExpiration"`
+}
+
+type LeaseUtxoRequest struct {
+	NodeId   int    `json:"nodeId"`
+	Outpoint string `json:"outpoint"`
+	// ExpirationSeconds defaults to the lease duration of LND (10 minutes).
+	ExpirationSeconds uint64 `json:"expirationSeconds"`
+}
+
+type ReleaseUtxoRequest struct {
+	NodeId   int    `json:"nodeId"`
+	Outpoint string `json:"outpoint"`
+}
+
+type ConsolidateUtxosRequest struct {
+	NodeId int `json:"nodeId"`
+	// Outpoints to merge. When empty all confirmed outputs up to MaxAmountSat are merged.
+	Outpoints    []string `json:"outpoints"`
+	MaxAmountSat *int64   `json:"maxAmountSat"`
+	SatPerVbyte  uint64   `json:"satPerVbyte"`
+	// Addr receives the merged output, a new wallet address is used when empty.
+	Addr  *string `json:"addr"`
+	Label *string `json:"label"`
+}
+
+type ConsolidateUtxosResponse struct {
+	TxId      string   `json:"txId"`
+	Addr      string   `json:"addr"`
+	Outpoints []string `json:"outpoints"`
+	AmountSat int64    `json:"amountSat"`
+}
+
+func parseOutpoint(s string) (*lnrpc.OutPoint, error) {
+	txid, index, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, errors.Newf("Outpoint %q has to be formatted as txid:index", s)
+	}
+	hash, err := chainhash.NewHashFromStr(txid)
+	if err != nil || len(txid) != chainhash.MaxHashStringSize {
+		return nil, errors.Newf("Outpoint %q has an invalid txid", s)
+	}
+	i, err := strconv.ParseUint(index, 10, 32)
+	if err != nil {
+		return nil, errors.Newf("Outpoint %q has an invalid output index", s)
+	}
+	return &lnrpc.OutPoint{TxidBytes: hash[:], TxidStr: txid, OutputIndex: uint32(i)}, nil
+}
+
+func formatOutpoint(o *lnrpc.OutPoint) string {
+	txid := o.TxidStr
+	if txid == "" {
+		if hash, err := chainhash.NewHash(o.TxidBytes); err == nil {
+			txid = hash.String()
+		}
+	}
+	return txid + ":" + strconv.FormatUint(uint64(o.OutputIndex), 10)
+}
+
+func connectWallet(db *sqlx.DB, nodeId int) (*grpc.ClientConn, error) {
+	if nodeId == 0 {
+		return nil, errors.New("Node id is missing")
+	}
+	connectionDetails, err := settings.GetNodeConnectionDetailsById(db, nodeId)
+	if err != nil {
+		return nil, errors.Wrap(err, "Getting node connection details from the db")
+	}
+	conn, err := lnd_connect.Connect(
+		connectionDetails.GRPCAddress,
+		connectionDetails.TLSFileBytes,
+		connectionDetails.MacaroonFileBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "Connecting to LND")
+	}
+	return conn, nil
+}
+
+// listUtxos returns the unspent and the leased outputs of the wallet.
+func listUtxos(ctx context.Context, client rpcClientUtxos, minConfs int32, maxConfs int32) (r []Utxo, err error) {
+	unspent, err := client.ListUnspent(ctx, &walletrpc.ListUnspentRequest{MinConfs: minConfs, MaxConfs: maxConfs})
+	if err != nil {
+		return nil, errors.Wrap(err, "Listing unspent outputs")
+	}
+	for _, u := range unspent.Utxos {
+		r = append(r, Utxo{
+			Outpoint:      formatOutpoint(u.Outpoint),
+			TxHash:        u.Outpoint.TxidStr,
+			OutputIndex:   u.Outpoint.OutputIndex,
+			Address:       u.Address,
+			AddressType:   u.AddressType.String(),
+			AmountSat:     u.AmountSat,
+			Confirmations: u.Confirmations,
+		})
+	}
+
+	leases, err := client.ListLeases(ctx, &walletrpc.ListLeasesRequest{})
+	if err != nil {
+		return nil, errors.Wrap(err, "Listing leased outputs")
+	}
+	for _, l := range leases.LockedUtxos {
+		outpoint := formatOutpoint(l.Outpoint)
+		expiration := time.Unix(int64(l.Expiration), 0).UTC()
+		r = append(r, Utxo{
+			Outpoint:        outpoint,
+			TxHash:          strings.Split(outpoint, ":")[0],
+			OutputIndex:     l.Outpoint.OutputIndex,
+			Leased:          true,
+			LeasedByTorq:    hex.EncodeToString(l.Id) == hex.EncodeToString(torqLockId),
+			LeaseExpiration: &expiration,
+		})
+	}
+	return r, nil
+}
+
+// addUtxoLabels adds the labels of the transactions that created the outputs.
+func addUtxoLabels(db *sqlx.DB, utxos []Utxo) error {
+	var hashes []string
+	for _, u := range utxos {
+		hashes = append(hashes, u.TxHash)
+	}
+	rows, err := db.Queryx(`SELECT tx_hash, label FROM tx WHERE tx_hash = ANY($1) AND label != '';`,
+		pq.Array(hashes))
+	if err != nil {
+		return errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	defer rows.Close()
+	labels := make(map[string]string)
+	for rows.Next() {
+		var hash, label string
+		if err = rows.Scan(&hash, &label); err != nil {
+			return errors.Wrap(err, "Unable to scan SQL row")
+		}
+		labels[hash] = label
+	}
+	for i := range utxos {
+		if label, ok := labels[utxos[i].TxHash]; ok {
+			utxos[i].Label = &label
+		}
+	}
+	return nil
+}
+
+func ListUtxos(ctx context.Context, db *sqlx.DB, nodeId int, minConfs int32, maxConfs int32) ([]Utxo, error) {
+	conn, err := connectWallet(db, nodeId)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	r, err := listUtxos(ctx, walletrpc.NewWalletKitClient(conn), minConfs, maxConfs)
+	if err != nil {
+		return nil, err
+	}
+	if err = addUtxoLabels(db, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func LeaseUtxo(ctx context.Context, db *sqlx.DB, req LeaseUtxoRequest) (expiration time.Time, err error) {
+	outpoint, err := parseOutpoint(req.Outpoint)
+	if err != nil {
+		return expiration, err
+	}
+	if err = settings.CheckNodePermission(db, req.NodeId, settings.ActionSendOnChain); err != nil {
+		return expiration, err
+	}
+	conn, err := connectWallet(db, req.NodeId)
+	if err != nil {
+		return expiration, err
+	}
+	defer conn.Close()
+
+	resp, err := walletrpc.NewWalletKitClient(conn).LeaseOutput(ctx, &walletrpc.LeaseOutputRequest{
+		Id:                torqLockId,
+		Outpoint:          outpoint,
+		ExpirationSeconds: req.ExpirationSeconds,
+	})
+	if err != nil {
+		return expiration, errors.Wrap(err, "Leasing output")
+	}
+	return time.Unix(int64(resp.Expiration), 0).UTC(), nil
+}
+
+// ReleaseUtxo releases an output leased by Torq. Outputs leased by other applications can't be released.
+func ReleaseUtxo(ctx context.Context, db *sqlx.DB, req ReleaseUtxoRequest) error {
+	outpoint, err := parseOutpoint(req.Outpoint)
+	if err != nil {
+		return err
+	}
+	if err = settings.CheckNodePermission(db, req.NodeId, settings.ActionSendOnChain); err != nil {
+		return err
+	}
+	conn, err := connectWallet(db, req.NodeId)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = walletrpc.NewWalletKitClient(conn).ReleaseOutput(ctx, &walletrpc.ReleaseOutputRequest{
+		Id:       torqLockId,
+		Outpoint: outpoint,
+	})
+	if err != nil {
+		return errors.Wrap(err, "Releasing output")
+	}
+	return nil
+}
+
+// LeaseOtherUtxos leases every unspent output except the given outpoints, so LND can only select the given outpoints
+// as inputs. LND's SendCoins and OpenChannel don't take inputs, this is how they are chosen. The returned function
+// releases the leases again and has to be called once LND selected the inputs, calling it again does nothing.
+func LeaseOtherUtxos(ctx context.Context, client rpcClientUtxos, outpoints []string) (release func(), err error) {
+	keep := make(map[string]bool)
+	for _, o := range outpoints {
+		op, err := parseOutpoint(o)
+		if err != nil {
+			return nil, err
+		}
+		keep[formatOutpoint(op)] = true
+	}
+
+	unspent, err := client.ListUnspent(ctx, &walletrpc.ListUnspentRequest{})
+	if err != nil {
+		return nil, errors.Wrap(err, "Listing unspent outputs")
+	}
+
+	var leased []*lnrpc.OutPoint
+	release = func() {
+		// The leases have to be released even when ctx is canceled.
+		releaseCtx := context.Background()
+		for _, o := range leased {
+			_, err := client.ReleaseOutput(releaseCtx, &walletrpc.ReleaseOutputRequest{Id: torqLockId, Outpoint: o})
+			if err != nil {
+				log.Error().Err(err).Msgf("Releasing output %s", formatOutpoint(o))
+			}
+		}
+		leased = nil
+	}
+
+	for _, u := range unspent.Utxos {
+		if keep[formatOutpoint(u.Outpoint)] {
+			delete(keep, formatOutpoint(u.Outpoint))
+			continue
+		}
+		_, err = client.LeaseOutput(ctx, &walletrpc.LeaseOutputRequest{
+			Id:                torqLockId,
+			Outpoint:          u.Outpoint,
+			ExpirationSeconds: coinControlLeaseSecs,
+		})
+		if err != nil {
+			release()
+			return nil, errors.Wrapf(err, "Leasing output %s", formatOutpoint(u.Outpoint))
+		}
+		leased = append(leased, u.Outpoint)
+	}
+	for o := range keep {
+		release()
+		return nil, errors.Newf("Outpoint %s is not an unspent output of the wallet", o)
+	}
+	return release, nil
+}
+
+// selectConsolidationUtxos returns the outpoints to merge and their total amount.
+func selectConsolidationUtxos(unspent []*lnrpc.Utxo, req ConsolidateUtxosRequest) (outpoints []string, amount int64,
+	err error) {
+
+	requested := make(map[string]bool)
+	for _, o := range req.Outpoints {
+		op, err := parseOutpoint(o)
+		if err != nil {
+			return nil, 0, err
+		}
+		requested[formatOutpoint(op)] = true
+	}
+	for _, u := range unspent {
+		o := formatOutpoint(u.Outpoint)
+		if len(requested) != 0 && !requested[o] {
+			continue
+		}
+		if len(requested) == 0 && (u.Confirmations == 0 ||
+			(req.MaxAmountSat != nil && u.AmountSat > *req.MaxAmountSat)) {
+			continue
+		}
+		outpoints = append(outpoints, o)
+		amount += u.AmountSat
+	}
+	if len(requested) != 0 && len(outpoints) != len(requested) {
+		return nil, 0, errors.New("Not all outpoints are unspent outputs of the wallet")
+	}
+	if len(outpoints) < 2 {
+		return nil, 0, errors.New("At least two outputs are needed to consolidate")
+	}
+	return outpoints, amount, nil
+}
+
+// ConsolidateUtxos merges small outputs into a single output at the given fee rate.
+func ConsolidateUtxos(ctx context.Context, db *sqlx.DB, req ConsolidateUtxosRequest) (r ConsolidateUtxosResponse,
+	err error) {
+
+	if req.SatPerVbyte == 0 {
+		return r, errors.New("Fee rate is missing")
+	}
+	if len(req.Outpoints) == 0 && req.MaxAmountSat == nil {
+		return r, errors.New("Either outpoints or a maximum amount has to be provided")
+	}
+
+	if err = settings.CheckNodePermission(db, req.NodeId, settings.ActionSendOnChain); err != nil {
+		return r, err
+	}
+	conn, err := connectWallet(db, req.NodeId)
+	if err != nil {
+		return r, err
+	}
+	defer conn.Close()
+	walletClient := walletrpc.NewWalletKitClient(conn)
+
+	unspent, err := walletClient.ListUnspent(ctx, &walletrpc.ListUnspentRequest{})
+	if err != nil {
+		return r, errors.Wrap(err, "Listing unspent outputs")
+	}
+	r.Outpoints, r.AmountSat, err = selectConsolidationUtxos(unspent.Utxos, req)
+	if err != nil {
+		return r, err
+	}
+
+	if req.Addr != nil && *req.Addr != "" {
+		r.Addr = *req.Addr
+	} else {
+		addr, err := walletClient.NextAddr(ctx, &walletrpc.AddrRequest{
+			Type: walletrpc.AddressType_WITNESS_PUBKEY_HASH,
+		})
+		if err != nil {
+			return r, errors.Wrap(err, "Getting new address")
+		}
+		r.Addr = addr.Addr
+	}
+
+	release, err := LeaseOtherUtxos(ctx, walletClient, r.Outpoints)
+	if err != nil {
+		return r, err
+	}
+	defer release()
+
+	sendReq := lnrpc.SendCoinsRequest{Addr: r.Addr, SendAll: true, SatPerVbyte: req.SatPerVbyte}
+	if req.Label != nil {
+		sendReq.Label = *req.Label
+	}
+	resp, err := lnrpc.NewLightningClient(conn).SendCoins(ctx, &sendReq)
+	if err != nil {
+		return r, errors.Wrap(err, "Sending coins")
+	}
+	r.TxId = resp.Txid
+	return r, nil
+}
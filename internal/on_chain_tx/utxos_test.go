@@ -0,0 +1,111 @@
+package on_chain_tx
+
+import (
+	"context"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/walletrpc"
+	"google.golang.org/grpc"
+	"reflect"
+	"testing"
+)
+
+const testTxid = "a5b9f2e4b4c4d1c7f4b6b0a8e3e5d9c1b2a3f4e5d6c7b8a9f0e1d2c3b4a5f6e7"
+
+type mockWalletKitClient_Utxos struct {
+	utxos  []*lnrpc.Utxo
+	leased map[string]bool
+}
+
+func (c *mockWalletKitClient_Utxos) ListUnspent(ctx context.Context, in *walletrpc.ListUnspentRequest,
+	opts ...grpc.CallOption) (*walletrpc.ListUnspentResponse, error) {
+	return &walletrpc.ListUnspentResponse{Utxos: c.utxos}, nil
+}
+
+func (c *mockWalletKitClient_Utxos) LeaseOutput(ctx context.Context, in *walletrpc.LeaseOutputRequest,
+	opts ...grpc.CallOption) (*walletrpc.LeaseOutputResponse, error) {
+	c.leased[formatOutpoint(in.Outpoint)] = true
+	return &walletrpc.LeaseOutputResponse{}, nil
+}
+
+func (c *mockWalletKitClient_Utxos) ReleaseOutput(ctx context.Context, in *walletrpc.ReleaseOutputRequest,
+	opts ...grpc.CallOption) (*walletrpc.ReleaseOutputResponse, error) {
+	delete(c.leased, formatOutpoint(in.Outpoint))
+	return &walletrpc.ReleaseOutputResponse{}, nil
+}
+
+func (c *mockWalletKitClient_Utxos) ListLeases(ctx context.Context, in *walletrpc.ListLeasesRequest,
+	opts ...grpc.CallOption) (*walletrpc.ListLeasesResponse, error) {
+	return &walletrpc.ListLeasesResponse{}, nil
+}
+
+func testUtxos() []*lnrpc.Utxo {
+	var r []*lnrpc.Utxo
+	for i, amount := range []int64{1000, 2000, 50000} {
+		r = append(r, &lnrpc.Utxo{
+			AmountSat:     amount,
+			Confirmations: 6,
+			Outpoint:      &lnrpc.OutPoint{TxidStr: testTxid, OutputIndex: uint32(i)},
+		})
+	}
+	return append(r, &lnrpc.Utxo{AmountSat: 500, Outpoint: &lnrpc.OutPoint{TxidStr: testTxid, OutputIndex: 3}})
+}
+
+func Test_parseOutpoint(t *testing.T) {
+	o, err := parseOutpoint(testTxid + ":2")
+	if err != nil || formatOutpoint(o) != testTxid+":2" {
+		t.Errorf("parseOutpoint() = %v, %v", o, err)
+	}
+	for _, s := range []string{testTxid, "abcd:1", testTxid + ":x"} {
+		if _, err = parseOutpoint(s); err == nil {
+			t.Errorf("parseOutpoint(%q) accepted an invalid outpoint", s)
+		}
+	}
+}
+
+func Test_LeaseOtherUtxos(t *testing.T) {
+	client := &mockWalletKitClient_Utxos{utxos: testUtxos(), leased: make(map[string]bool)}
+	release, err := LeaseOtherUtxos(context.Background(), client, []string{testTxid + ":1"})
+	if err != nil {
+		t.Fatalf("LeaseOtherUtxos() error = %v", err)
+	}
+	want := map[string]bool{testTxid + ":0": true, testTxid + ":2": true, testTxid + ":3": true}
+	if !reflect.DeepEqual(client.leased, want) {
+		t.Errorf("Leased outputs = %v, want %v", client.leased, want)
+	}
+	release()
+	release()
+	if len(client.leased) != 0 {
+		t.Errorf("Outputs %v are still leased after release", client.leased)
+	}
+
+	_, err = LeaseOtherUtxos(context.Background(), client, []string{testTxid + ":9"})
+	if err == nil {
+		t.Errorf("LeaseOtherUtxos() accepted an outpoint that isn't unspent")
+	}
+	if len(client.leased) != 0 {
+		t.Errorf("Outputs %v are still leased after an error", client.leased)
+	}
+}
+
+func Test_selectConsolidationUtxos(t *testing.T) {
+	var maxAmount int64 = 10000
+	outpoints, amount, err := selectConsolidationUtxos(testUtxos(), ConsolidateUtxosRequest{MaxAmountSat: &maxAmount})
+	if err != nil {
+		t.Fatalf("selectConsolidationUtxos() error = %v", err)
+	}
+	// The unconfirmed output is left out.
+	if !reflect.DeepEqual(outpoints, []string{testTxid + ":0", testTxid + ":1"}) || amount != 3000 {
+		t.Errorf("selectConsolidationUtxos() = %v, %d", outpoints, amount)
+	}
+
+	_, amount, err = selectConsolidationUtxos(testUtxos(),
+		ConsolidateUtxosRequest{Outpoints: []string{testTxid + ":2", testTxid + ":3"}})
+	if err != nil || amount != 50500 {
+		t.Errorf("selectConsolidationUtxos() = %d, %v", amount, err)
+	}
+
+	_, _, err = selectConsolidationUtxos(testUtxos(), ConsolidateUtxosRequest{Outpoints: []string{testTxid + ":0"}})
+	if err == nil {
+		t.Errorf("selectConsolidationUtxos() accepted a single output")
+	}
+}
@@ -0,0 +1,259 @@
+package payments
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/cockroachdb/errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"github.com/lncapital/torq/internal/channels"
+	"github.com/lncapital/torq/internal/settings"
+	"github.com/lncapital/torq/pkg/lnd_connect"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"time"
+)
+
+type lndClientQueryRoutes interface {
+	DecodePayReq(ctx context.Context, in *lnrpc.PayReqString, opts ...grpc.CallOption) (*lnrpc.PayReq, error)
+	QueryRoutes(ctx context.Context, in *lnrpc.QueryRoutesRequest, opts ...grpc.CallOption) (*lnrpc.QueryRoutesResponse,
+		error)
+	DeletePayment(ctx context.Context, in *lnrpc.DeletePaymentRequest,
+		opts ...grpc.CallOption) (*lnrpc.DeletePaymentResponse, error)
+}
+
+// recordProbeFunc stores the payment hash of a probe before it's sent, so the payment import skips it.
+type recordProbeFunc func(paymentHash string) error
+
+// ErrEstimateRoute is returned when the payment can't be estimated because of the request or the network. Reason
+// is AMOUNT_REQUIRED, AMOUNT_NOT_ALLOWED or NO_ROUTE.
+type ErrEstimateRoute struct {
+	Reason string
+}
+
+func (e ErrEstimateRoute) Error() string {
+	return e.Reason
+}
+
+type rrpcClientEstimateRoute interface {
+	EstimateRouteFee(ctx context.Context, in *routerrpc.RouteFeeRequest,
+		opts ...grpc.CallOption) (*routerrpc.RouteFeeResponse, error)
+	SendToRouteV2(ctx context.Context, in *routerrpc.SendToRouteRequest,
+		opts ...grpc.CallOption) (*lnrpc.HTLCAttempt, error)
+}
+
+// EstimateRouteRequest describes a payment to estimate, either by invoice or by destination and amount.
+type EstimateRouteRequest struct {
+	NodeId  int     `json:"nodeId"`
+	Invoice *string `json:"invoice"`
+	Dest    *string `json:"dest"`
+	// Required for destinations and invoices without an amount.
+	AmtMSat *int64 `json:"amtMSat"`
+	// Probe sends a payment with a random hash along the route. It can't settle, but tells if the route can
+	// carry the amount right now.
+	Probe bool `json:"probe"`
+}
+
+type probeResult struct {
+	// Reachable is true when the destination rejected the probe for its unknown payment hash, so the HTLC made
+	// it through every channel of the route.
+	Reachable          bool   `json:"reachable"`
+	FailureReason      string `json:"failureReason"`
+	FailureSourceIndex uint32 `json:"failureSourceIndex"`
+}
+
+type EstimateRouteResponse struct {
+	Destination string `json:"destination"`
+	AmountMsat  int64  `json:"amountMsat"`
+	// Fee of the best route found.
+	FeeMsat int64 `json:"feeMsat"`
+	// LND's lower bound of the fee to the destination.
+	RoutingFeeEstimateMsat int64 `json:"routingFeeEstimateMsat"`
+	// Worst case time lock delay of the estimate.
+	TimeLockDelay int64 `json:"timeLockDelay"`
+	// Likelihood of the route succeeding according to LND's mission control, between 0 and 1.
+	SuccessProbability float64 `json:"successProbability"`
+	Route              route   `json:"route"`
+	// FeeLimitMsat is the highest of the fee estimates, usable as feeLimitMsat of the payment.
+	FeeLimitMsat int64        `json:"feeLimitMsat"`
+	Probe        *probeResult `json:"probe,omitempty"`
+}
+
+func validateEstimateRouteRequest(req EstimateRouteRequest) error {
+	if req.NodeId == 0 {
+		return errors.New("Node id is missing")
+	}
+	if (req.Invoice == nil) == (req.Dest == nil) {
+		return errors.New("Either an invoice or a destination is required")
+	}
+	if req.Dest != nil && req.AmtMSat == nil {
+		return errors.New("An amount is required when estimating a payment to a destination")
+	}
+	return nil
+}
+
+// EstimateRoute finds the route and fees of a payment before it's sent, and optionally probes the route.
+func EstimateRoute(ctx context.Context, db *sqlx.DB, req EstimateRouteRequest) (r EstimateRouteResponse, err error) {
+	if err = validateEstimateRouteRequest(req); err != nil {
+		return r, err
+	}
+	if req.Probe {
+		if err = settings.CheckNodePermission(db, req.NodeId, settings.ActionSendPayment); err != nil {
+			return r, err
+		}
+	}
+
+	connectionDetails, err := settings.GetNodeConnectionDetailsById(db, req.NodeId)
+	if err != nil {
+		return r, errors.Wrap(err, "Getting node connection details from the db")
+	}
+	conn, err := lnd_connect.Connect(
+		connectionDetails.GRPCAddress,
+		connectionDetails.TLSFileBytes,
+		connectionDetails.MacaroonFileBytes)
+	if err != nil {
+		return r, errors.Wrap(err, "Connecting to LND")
+	}
+	defer conn.Close()
+
+	recordProbe := func(paymentHash string) error {
+		_, err := db.Exec(`INSERT INTO payment_probe (payment_hash, created_on) VALUES ($1, $2);`,
+			paymentHash, time.Now().UTC())
+		return errors.Wrap(err, "Storing probe payment hash")
+	}
+	return estimateRoute(ctx, lnrpc.NewLightningClient(conn), routerrpc.NewRouterClient(conn), recordProbe, req)
+}
+
+func estimateRoute(ctx context.Context, client lndClientQueryRoutes, router rrpcClientEstimateRoute,
+	recordProbe recordProbeFunc, req EstimateRouteRequest) (r EstimateRouteResponse, err error) {
+
+	qrReq := lnrpc.QueryRoutesRequest{UseMissionControl: true}
+	var paymentAddr []byte
+
+	if req.Invoice != nil {
+		payReq, err := client.DecodePayReq(ctx, &lnrpc.PayReqString{PayReq: *req.Invoice})
+		if err != nil {
+			return r, errors.Wrap(err, "Decoding payment request")
+		}
+		qrReq.PubKey = payReq.Destination
+		qrReq.AmtMsat = payReq.NumMsat
+		qrReq.FinalCltvDelta = int32(payReq.CltvExpiry)
+		qrReq.RouteHints = payReq.RouteHints
+		for bit := range payReq.Features {
+			qrReq.DestFeatures = append(qrReq.DestFeatures, lnrpc.FeatureBit(bit))
+		}
+		paymentAddr = payReq.PaymentAddr
+	} else {
+		qrReq.PubKey = *req.Dest
+	}
+
+	if req.AmtMSat != nil {
+		if qrReq.AmtMsat != 0 && qrReq.AmtMsat != *req.AmtMSat {
+			return r, ErrEstimateRoute{"AMOUNT_NOT_ALLOWED"}
+		}
+		qrReq.AmtMsat = *req.AmtMSat
+	}
+	if qrReq.AmtMsat == 0 {
+		return r, ErrEstimateRoute{"AMOUNT_REQUIRED"}
+	}
+
+	dest, err := hex.DecodeString(qrReq.PubKey)
+	if err != nil {
+		return r, errors.Wrap(err, "Decoding destination public key")
+	}
+
+	routes, err := client.QueryRoutes(ctx, &qrReq)
+	if err != nil {
+		return r, errors.Wrap(err, "Querying routes")
+	}
+	if len(routes.Routes) == 0 {
+		return r, ErrEstimateRoute{"NO_ROUTE"}
+	}
+	best := routes.Routes[0]
+
+	fee, err := router.EstimateRouteFee(ctx, &routerrpc.RouteFeeRequest{Dest: dest, AmtSat: qrReq.AmtMsat / 1000})
+	if err != nil {
+		return r, errors.Wrap(err, "Estimating route fee")
+	}
+
+	r = EstimateRouteResponse{
+		Destination:            qrReq.PubKey,
+		AmountMsat:             qrReq.AmtMsat,
+		FeeMsat:                best.TotalFeesMsat,
+		RoutingFeeEstimateMsat: fee.RoutingFeeMsat,
+		TimeLockDelay:          fee.TimeLockDelay,
+		SuccessProbability:     routes.SuccessProb,
+		Route:                  convertRoute(best),
+		FeeLimitMsat:           best.TotalFeesMsat,
+	}
+	if fee.RoutingFeeMsat > r.FeeLimitMsat {
+		r.FeeLimitMsat = fee.RoutingFeeMsat
+	}
+
+	if req.Probe {
+		r.Probe, err = probeRoute(ctx, client, router, recordProbe, best, paymentAddr)
+		if err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// probeRoute sends an HTLC with a random payment hash along the route. The destination can't know the preimage,
+// so the probe never settles and no funds are moved. LND stores the probe as a failed payment, it's deleted
+// afterwards and the payment import skips the recorded hash.
+func probeRoute(ctx context.Context, client lndClientQueryRoutes, router rrpcClientEstimateRoute,
+	recordProbe recordProbeFunc, rt *lnrpc.Route, paymentAddr []byte) (*probeResult, error) {
+
+	hash := make([]byte, 32)
+	if _, err := rand.Read(hash); err != nil {
+		return nil, errors.Wrap(err, "Generating probe payment hash")
+	}
+	if err := recordProbe(hex.EncodeToString(hash)); err != nil {
+		return nil, err
+	}
+
+	// Invoices with a payment address are rejected without it.
+	if len(paymentAddr) != 0 && len(rt.Hops) != 0 {
+		lastHop := rt.Hops[len(rt.Hops)-1]
+		lastHop.MppRecord = &lnrpc.MPPRecord{PaymentAddr: paymentAddr, TotalAmtMsat: lastHop.AmtToForwardMsat}
+	}
+
+	attempt, err := router.SendToRouteV2(ctx, &routerrpc.SendToRouteRequest{PaymentHash: hash, Route: rt})
+	if err != nil {
+		return nil, errors.Wrap(err, "Sending probe")
+	}
+	_, err = client.DeletePayment(ctx, &lnrpc.DeletePaymentRequest{PaymentHash: hash})
+	if err != nil {
+		log.Warn().Err(err).Msgf("Deleting probe payment %x", hash)
+	}
+	if attempt.Failure == nil {
+		// Nobody knows the preimage of a random hash, this is not expected to happen.
+		return &probeResult{Reachable: true}, nil
+	}
+	return &probeResult{
+		Reachable:          attempt.Failure.Code == lnrpc.Failure_INCORRECT_OR_UNKNOWN_PAYMENT_DETAILS,
+		FailureReason:      attempt.Failure.Code.String(),
+		FailureSourceIndex: attempt.Failure.FailureSourceIndex,
+	}, nil
+}
+
+func convertRoute(rt *lnrpc.Route) (r route) {
+	r.TotalTimeLock = rt.TotalTimeLock
+	r.TotalAmtMsat = rt.TotalAmtMsat
+	for _, hop := range rt.Hops {
+		r.Hops = append(r.Hops, hops{
+			ChanId:           channels.ConvertLNDShortChannelID(hop.ChanId),
+			AmtToForwardMsat: hop.AmtToForwardMsat,
+			Expiry:           hop.Expiry,
+			PubKey:           hop.PubKey,
+			MppRecord: MppRecord{
+				PaymentAddr:  hex.EncodeToString(hop.GetMppRecord().GetPaymentAddr()),
+				TotalAmtMsat: hop.GetMppRecord().GetTotalAmtMsat(),
+			},
+		})
+	}
+	return r
+}
@@ -0,0 +1,143 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"google.golang.org/grpc"
+)
+
+const testDest = "02a5b9f2e4b4c4d1c7f4b6b0a8e3e5d9c1b2a3f4e5d6c7b8a9f0e1d2c3b4a5f6e7"
+
+type mockLightningClient_QueryRoutes struct {
+	payReq   *lnrpc.PayReq
+	routes   *lnrpc.QueryRoutesResponse
+	queryReq *lnrpc.QueryRoutesRequest
+	deleted  []byte
+}
+
+func (c *mockLightningClient_QueryRoutes) DecodePayReq(ctx context.Context, in *lnrpc.PayReqString,
+	opts ...grpc.CallOption) (*lnrpc.PayReq, error) {
+	return c.payReq, nil
+}
+
+func (c *mockLightningClient_QueryRoutes) QueryRoutes(ctx context.Context, in *lnrpc.QueryRoutesRequest,
+	opts ...grpc.CallOption) (*lnrpc.QueryRoutesResponse, error) {
+	c.queryReq = in
+	return c.routes, nil
+}
+
+func (c *mockLightningClient_QueryRoutes) DeletePayment(ctx context.Context, in *lnrpc.DeletePaymentRequest,
+	opts ...grpc.CallOption) (*lnrpc.DeletePaymentResponse, error) {
+	c.deleted = in.PaymentHash
+	return &lnrpc.DeletePaymentResponse{}, nil
+}
+
+func noProbe(paymentHash string) error {
+	return errors.New("unexpected probe")
+}
+
+type mockRouterClient_EstimateRoute struct {
+	fee     *routerrpc.RouteFeeResponse
+	attempt *lnrpc.HTLCAttempt
+	probe   *routerrpc.SendToRouteRequest
+}
+
+func (c *mockRouterClient_EstimateRoute) EstimateRouteFee(ctx context.Context, in *routerrpc.RouteFeeRequest,
+	opts ...grpc.CallOption) (*routerrpc.RouteFeeResponse, error) {
+	return c.fee, nil
+}
+
+func (c *mockRouterClient_EstimateRoute) SendToRouteV2(ctx context.Context, in *routerrpc.SendToRouteRequest,
+	opts ...grpc.CallOption) (*lnrpc.HTLCAttempt, error) {
+	c.probe = in
+	return c.attempt, nil
+}
+
+func Test_estimateRoute(t *testing.T) {
+	invoice := "lnbc1"
+	client := &mockLightningClient_QueryRoutes{
+		payReq: &lnrpc.PayReq{Destination: testDest, NumMsat: 100000, CltvExpiry: 40, PaymentAddr: []byte{1, 2, 3}},
+		routes: &lnrpc.QueryRoutesResponse{
+			SuccessProb: 0.8,
+			Routes: []*lnrpc.Route{{
+				TotalTimeLock: 100,
+				TotalAmtMsat:  101000,
+				TotalFeesMsat: 1000,
+				Hops: []*lnrpc.Hop{
+					{ChanId: 1, AmtToForwardMsat: 100000, PubKey: "peer"},
+					{ChanId: 2, AmtToForwardMsat: 100000, PubKey: testDest},
+				},
+			}},
+		},
+	}
+	router := &mockRouterClient_EstimateRoute{
+		fee:     &routerrpc.RouteFeeResponse{RoutingFeeMsat: 1500, TimeLockDelay: 80},
+		attempt: &lnrpc.HTLCAttempt{Failure: &lnrpc.Failure{Code: lnrpc.Failure_INCORRECT_OR_UNKNOWN_PAYMENT_DETAILS}},
+	}
+
+	var probeHash string
+	recordProbe := func(paymentHash string) error {
+		probeHash = paymentHash
+		return nil
+	}
+
+	r, err := estimateRoute(context.Background(), client, router, recordProbe,
+		EstimateRouteRequest{NodeId: 1, Invoice: &invoice, Probe: true})
+	if err != nil {
+		t.Fatalf("estimateRoute() error = %v", err)
+	}
+
+	if client.queryReq.AmtMsat != 100000 || client.queryReq.FinalCltvDelta != 40 {
+		t.Errorf("QueryRoutes request %v doesn't match the invoice", client.queryReq)
+	}
+	if r.FeeMsat != 1000 || r.RoutingFeeEstimateMsat != 1500 || r.SuccessProbability != 0.8 {
+		t.Errorf("Unexpected estimate %+v", r)
+	}
+	if r.FeeLimitMsat != 1500 {
+		t.Errorf("FeeLimitMsat = %d, want the highest estimate 1500", r.FeeLimitMsat)
+	}
+	if len(r.Route.Hops) != 2 {
+		t.Errorf("Route has %d hops, want 2", len(r.Route.Hops))
+	}
+	if r.Probe == nil || !r.Probe.Reachable {
+		t.Errorf("Probe = %+v, want reachable", r.Probe)
+	}
+	if len(router.probe.PaymentHash) != 32 {
+		t.Errorf("Probe payment hash has %d bytes, want 32", len(router.probe.PaymentHash))
+	}
+	if router.probe.Route.Hops[1].MppRecord.GetTotalAmtMsat() != 100000 {
+		t.Errorf("Probe is missing the payment address record of the invoice")
+	}
+	// The probe is recorded before it's sent and deleted from LND afterwards.
+	if probeHash != hex.EncodeToString(router.probe.PaymentHash) {
+		t.Errorf("Recorded probe hash %s, want %x", probeHash, router.probe.PaymentHash)
+	}
+	if !bytes.Equal(client.deleted, router.probe.PaymentHash) {
+		t.Errorf("Probe payment %x wasn't deleted", router.probe.PaymentHash)
+	}
+}
+
+func Test_estimateRouteAmount(t *testing.T) {
+	amt := int64(2000)
+	invoice := "lnbc1"
+	client := &mockLightningClient_QueryRoutes{payReq: &lnrpc.PayReq{Destination: testDest, NumMsat: 1000}}
+
+	_, err := estimateRoute(context.Background(), client, &mockRouterClient_EstimateRoute{}, noProbe,
+		EstimateRouteRequest{NodeId: 1, Invoice: &invoice, AmtMSat: &amt})
+	if err != (ErrEstimateRoute{"AMOUNT_NOT_ALLOWED"}) {
+		t.Errorf("estimateRoute() error = %v, want AMOUNT_NOT_ALLOWED", err)
+	}
+
+	client.payReq.NumMsat = 0
+	_, err = estimateRoute(context.Background(), client, &mockRouterClient_EstimateRoute{}, noProbe,
+		EstimateRouteRequest{NodeId: 1, Invoice: &invoice})
+	if err != (ErrEstimateRoute{"AMOUNT_REQUIRED"}) {
+		t.Errorf("estimateRoute() error = %v, want AMOUNT_REQUIRED", err)
+	}
+}
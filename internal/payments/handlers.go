@@ -2,15 +2,51 @@ package payments
 
 import (
 	sq "github.com/Masterminds/squirrel"
+	"github.com/cockroachdb/errors"
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 	qp "github.com/lncapital/torq/internal/query_parser"
+	"github.com/lncapital/torq/internal/settings"
 	ah "github.com/lncapital/torq/pkg/api_helpers"
 	"github.com/lncapital/torq/pkg/server_errors"
 	"net/http"
 	"strconv"
 )
 
+// paymentColumns are the columns payments can be filtered by.
+var paymentColumns = qp.ColumnSchema{
+	"date":                      qp.DateColumn,
+	"destination_pub_key":       qp.StringColumn,
+	"status":                    qp.StringColumn,
+	"value":                     qp.NumberColumn,
+	"fee":                       qp.NumberColumn,
+	"ppm":                       qp.NumberColumn,
+	"failure_reason":            qp.StringColumn,
+	"is_rebalance":              qp.BooleanColumn,
+	"is_mpp":                    qp.BooleanColumn,
+	"is_keysend":                qp.BooleanColumn,
+	"is_amp":                    qp.BooleanColumn,
+	"count_successful_attempts": qp.NumberColumn,
+	"count_failed_attempts":     qp.NumberColumn,
+	"seconds_in_flight":         qp.NumberColumn,
+	"payment_hash":              qp.StringColumn,
+	"payment_preimage":          qp.StringColumn,
+	"tags":                      qp.ArrayColumn,
+}
+
+// paymentSortColumns are the columns payments can be sorted by.
+var paymentSortColumns = []string{
+	"date",
+	"status",
+	"value",
+	"fee",
+	"ppm",
+	"failure_reason",
+	"count_successful_attempts",
+	"count_failed_attempts",
+	"seconds_in_flight",
+}
+
 func getPaymentsHandler(c *gin.Context, db *sqlx.DB) {
 
 	// Filter parser with whitelisted columns
@@ -18,23 +54,14 @@ func getPaymentsHandler(c *gin.Context, db *sqlx.DB) {
 	filterParam := c.Query("filter")
 	var err error
 	if filterParam != "" {
-		filter, err = qp.ParseFilterParam(filterParam, []string{
-			"date",
-			"destination_pub_key",
-			"status",
-			"value",
-			"fee",
-			"ppm",
-			"failure_reason",
-			"is_rebalance",
-			"is_mpp",
-			"count_successful_attempts",
-			"count_failed_attempts",
-			"seconds_in_flight",
-			"payment_hash",
-			"payment_preimage",
-		})
-		if err != nil {
+		filter, err = qp.ParseFilterParamWithSchema(filterParam, paymentColumns)
+		switch e := err.(type) {
+		case nil:
+			break
+		case qp.ErrInvalidFilter:
+			c.JSON(http.StatusBadRequest, gin.H{"Error": e.Error(), "Key": e.Key})
+			return
+		default:
 			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
 			return
 		}
@@ -44,19 +71,7 @@ func getPaymentsHandler(c *gin.Context, db *sqlx.DB) {
 	sortParam := c.Query("order")
 	if sortParam != "" {
 		// Order parser with whitelisted columns
-		sort, err = qp.ParseOrderParams(
-			sortParam,
-			[]string{
-				"date",
-				"status",
-				"value",
-				"fee",
-				"ppm",
-				"failure_reason",
-				"count_successful_attempts",
-				"count_failed_attempts",
-				"seconds_in_flight",
-			})
+		sort, err = qp.ParseOrderParams(sortParam, paymentSortColumns)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
 			return
@@ -126,7 +141,57 @@ func getPaymentHandler(c *gin.Context, db *sqlx.DB) {
 	c.JSON(http.StatusOK, r)
 }
 
+// estimateRouteHandler returns the expected fee, route and success probability of a payment without sending it.
+func estimateRouteHandler(c *gin.Context, db *sqlx.DB) {
+	var req EstimateRouteRequest
+	if err := c.BindJSON(&req); err != nil {
+		server_errors.WrapLogAndSendServerError(c, err, "JSON binding the request body")
+		return
+	}
+	if err := validateEstimateRouteRequest(req); err != nil {
+		server_errors.SendBadRequestFromError(c, err)
+		return
+	}
+	// A probe sends an HTLC, the route is only estimated in read-only mode.
+	if req.Probe && settings.IsReadOnly() {
+		server_errors.SendForbidden(c, "Torq is running in read-only mode, routes can't be probed")
+		return
+	}
+
+	r, err := EstimateRoute(c.Request.Context(), db, req)
+	if err != nil {
+		var ere ErrEstimateRoute
+		if errors.As(err, &ere) {
+			server_errors.SendUnprocessableEntityFromError(c, ere)
+			return
+		}
+		server_errors.WrapLogAndSendServerError(c, err, "Estimate route")
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
 func RegisterPaymentsRoutes(r *gin.RouterGroup, db *sqlx.DB) {
 	r.GET("", func(c *gin.Context) { getPaymentsHandler(c, db) })
 	r.GET(":identifier", func(c *gin.Context) { getPaymentHandler(c, db) })
+	r.POST("estimate", func(c *gin.Context) { estimateRouteHandler(c, db) })
+	r.GET("lnurl", func(c *gin.Context) { resolveLnurlHandler(c) })
+}
+
+// resolveLnurlHandler returns the amount range and description of a Lightning Address or LNURL-pay string.
+func resolveLnurlHandler(c *gin.Context) {
+	lnurl := c.Query("lnurl")
+	if lnurl == "" {
+		server_errors.SendBadRequest(c, "lnurl is required")
+		return
+	}
+
+	r, err := ResolveLnurlPay(c.Request.Context(), lnurl)
+	if err != nil {
+		server_errors.SendUnprocessableEntityFromError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
 }
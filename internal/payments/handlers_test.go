@@ -0,0 +1,27 @@
+package payments
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lncapital/torq/internal/settings"
+)
+
+func Test_estimateRouteHandlerReadOnly(t *testing.T) {
+	settings.SetReadOnly(true)
+	defer settings.SetReadOnly(false)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/payments/estimate",
+		strings.NewReader(`{"nodeId": 1, "dest": "02aa", "amtMSat": 1000, "probe": true}`))
+
+	// The probe is refused before the node is looked up.
+	estimateRouteHandler(c, nil)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("estimateRouteHandler() status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,272 @@
+package payments
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lncapital/torq/internal/settings"
+	"github.com/lncapital/torq/pkg/lnd_connect"
+	"google.golang.org/grpc"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// httpClient makes the LNURL requests. It's an interface so the resolution can be tested against a stub server.
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+var lnurlHttpClient httpClient = &http.Client{
+	Timeout: 30 * time.Second,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return checkLnurlUrl(req.URL)
+	},
+}
+
+type lndClientDecodePayReq interface {
+	DecodePayReq(ctx context.Context, in *lnrpc.PayReqString, opts ...grpc.CallOption) (*lnrpc.PayReq, error)
+}
+
+// LnurlPayRequest pays a Lightning Address (user@domain) or an LNURL-pay string (lnurl1...).
+type LnurlPayRequest struct {
+	NodeId       int     `json:"nodeId"`
+	Lnurl        string  `json:"lnurl"`
+	AmtMSat      int64   `json:"amtMSat"`
+	Comment      *string `json:"comment"`
+	TimeOutSecs  int32   `json:"timeoutSecs"`
+	FeeLimitMsat *int64  `json:"feeLimitMsat"`
+}
+
+// LnurlPayParams are the parameters of an LNURL-pay service (LUD-06).
+type LnurlPayParams struct {
+	Callback       string `json:"callback"`
+	MinSendable    int64  `json:"minSendable"`
+	MaxSendable    int64  `json:"maxSendable"`
+	Metadata       string `json:"metadata"`
+	Tag            string `json:"tag"`
+	CommentAllowed int    `json:"commentAllowed"`
+	// Description is the text/plain entry of the metadata.
+	Description string `json:"description"`
+}
+
+type lnurlError struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+type lnurlInvoice struct {
+	lnurlError
+	Pr string `json:"pr"`
+}
+
+// checkLnurlUrl only allows https URLs, and http URLs of onion services (LUD-01). Otherwise an LNURL could make
+// Torq request any URL, e.g. of a service in its own network.
+func checkLnurlUrl(u *url.URL) error {
+	if u.Host == "" {
+		return errors.New("LNURL has no host")
+	}
+	if u.Scheme == "https" || (u.Scheme == "http" && strings.HasSuffix(u.Hostname(), ".onion")) {
+		return nil
+	}
+	return errors.New("LNURL has to be an https URL, or http for onion services")
+}
+
+// lnurlToUrl returns the URL behind a Lightning Address or a bech32 encoded LNURL.
+func lnurlToUrl(lnurl string) (string, error) {
+	lnurl = strings.TrimSpace(lnurl)
+	lnurl = strings.TrimPrefix(strings.TrimPrefix(lnurl, "lightning:"), "LIGHTNING:")
+
+	if user, domain, ok := strings.Cut(lnurl, "@"); ok {
+		if user == "" || domain == "" || strings.ContainsAny(domain, "/?#") {
+			return "", errors.New("INVALID_LIGHTNING_ADDRESS")
+		}
+		scheme := "https"
+		if strings.HasSuffix(domain, ".onion") {
+			scheme = "http"
+		}
+		return scheme + "://" + domain + "/.well-known/lnurlp/" + url.PathEscape(strings.ToLower(user)), nil
+	}
+
+	// LNURLs are longer than the 90 characters bech32 normally allows.
+	hrp, data, err := bech32.DecodeNoLimit(strings.ToLower(lnurl))
+	if err != nil || hrp != "lnurl" {
+		return "", errors.New("INVALID_LNURL")
+	}
+	b, err := bech32.ConvertBits(data, 5, 8, false)
+	if err != nil {
+		return "", errors.New("INVALID_LNURL")
+	}
+	u, err := url.Parse(string(b))
+	if err != nil || checkLnurlUrl(u) != nil {
+		return "", errors.New("INVALID_LNURL")
+	}
+	return string(b), nil
+}
+
+func lnurlGet(ctx context.Context, client httpClient, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return errors.Wrap(err, "Creating LNURL request")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Requesting LNURL")
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return errors.Wrap(err, "Reading LNURL response")
+	}
+	var lnErr lnurlError
+	if json.Unmarshal(body, &lnErr) == nil && strings.EqualFold(lnErr.Status, "ERROR") {
+		return errors.Newf("LNURL service error: %s", lnErr.Reason)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Newf("LNURL service responded with status %d", resp.StatusCode)
+	}
+	if err = json.Unmarshal(body, v); err != nil {
+		return errors.Wrap(err, "Decoding LNURL response")
+	}
+	return nil
+}
+
+// resolveLnurlPay fetches the pay parameters of a Lightning Address or LNURL.
+func resolveLnurlPay(ctx context.Context, client httpClient, lnurl string) (p LnurlPayParams, err error) {
+	u, err := lnurlToUrl(lnurl)
+	if err != nil {
+		return p, err
+	}
+	if err = lnurlGet(ctx, client, u, &p); err != nil {
+		return p, err
+	}
+	if p.Tag != "payRequest" {
+		return p, errors.New("LNURL is not a pay request")
+	}
+	if p.Callback == "" || p.MinSendable <= 0 || p.MaxSendable < p.MinSendable {
+		return p, errors.New("LNURL pay request has an invalid callback or amount range")
+	}
+
+	var metadata [][]string
+	if err = json.Unmarshal([]byte(p.Metadata), &metadata); err != nil {
+		return p, errors.Wrap(err, "Decoding LNURL metadata")
+	}
+	for _, m := range metadata {
+		if len(m) == 2 && m[0] == "text/plain" {
+			p.Description = m[1]
+		}
+	}
+	return p, nil
+}
+
+// fetchLnurlInvoice gets the invoice for the amount from the callback and checks it's the invoice described by
+// the pay parameters.
+func fetchLnurlInvoice(ctx context.Context, client httpClient, lnd lndClientDecodePayReq, p LnurlPayParams,
+	req LnurlPayRequest) (string, error) {
+
+	if req.AmtMSat < p.MinSendable || req.AmtMSat > p.MaxSendable {
+		return "", errors.Newf("Amount has to be between %d and %d msat", p.MinSendable, p.MaxSendable)
+	}
+
+	callback, err := url.Parse(p.Callback)
+	if err != nil {
+		return "", errors.Wrap(err, "Parsing LNURL callback")
+	}
+	if err = checkLnurlUrl(callback); err != nil {
+		return "", errors.Wrap(err, "Checking LNURL callback")
+	}
+	q := callback.Query()
+	q.Set("amount", strconv.FormatInt(req.AmtMSat, 10))
+	if req.Comment != nil && *req.Comment != "" {
+		// commentAllowed is the number of characters (LUD-12).
+		if utf8.RuneCountInString(*req.Comment) > p.CommentAllowed {
+			return "", errors.Newf("Comment can be at most %d characters", p.CommentAllowed)
+		}
+		q.Set("comment", *req.Comment)
+	}
+	callback.RawQuery = q.Encode()
+
+	var inv lnurlInvoice
+	if err = lnurlGet(ctx, client, callback.String(), &inv); err != nil {
+		return "", err
+	}
+	if inv.Pr == "" {
+		return "", errors.New("LNURL callback returned no invoice")
+	}
+
+	payReq, err := lnd.DecodePayReq(ctx, &lnrpc.PayReqString{PayReq: inv.Pr})
+	if err != nil {
+		return "", errors.Wrap(err, "Decoding payment request")
+	}
+	if payReq.NumMsat != req.AmtMSat {
+		return "", errors.Newf("LNURL invoice is for %d msat instead of %d msat", payReq.NumMsat, req.AmtMSat)
+	}
+	hash := sha256.Sum256([]byte(p.Metadata))
+	if payReq.DescriptionHash != hex.EncodeToString(hash[:]) {
+		return "", errors.New("LNURL invoice description hash doesn't match the metadata")
+	}
+	return inv.Pr, nil
+}
+
+// ResolveLnurlPay returns the pay parameters of a Lightning Address or LNURL, to show before paying.
+func ResolveLnurlPay(ctx context.Context, lnurl string) (LnurlPayParams, error) {
+	return resolveLnurlPay(ctx, lnurlHttpClient, lnurl)
+}
+
+// PayLnurl resolves a Lightning Address or LNURL to an invoice and pays it with SendNewPayment.
+func PayLnurl(
+	ctx context.Context,
+	wChan chan interface{},
+	db *sqlx.DB,
+	c *gin.Context,
+	req LnurlPayRequest,
+	reqId string,
+) error {
+	if req.NodeId == 0 {
+		return errors.New("Node id is missing")
+	}
+
+	p, err := resolveLnurlPay(ctx, lnurlHttpClient, req.Lnurl)
+	if err != nil {
+		return err
+	}
+
+	if err = settings.CheckNodePermission(db, req.NodeId, settings.ActionSendPayment); err != nil {
+		return err
+	}
+
+	connectionDetails, err := settings.GetNodeConnectionDetailsById(db, req.NodeId)
+	if err != nil {
+		return errors.Wrap(err, "Getting node connection details from the db")
+	}
+	conn, err := lnd_connect.Connect(
+		connectionDetails.GRPCAddress,
+		connectionDetails.TLSFileBytes,
+		connectionDetails.MacaroonFileBytes)
+	if err != nil {
+		return errors.Wrap(err, "Connecting to LND")
+	}
+	invoice, err := fetchLnurlInvoice(ctx, lnurlHttpClient, lnrpc.NewLightningClient(conn), p, req)
+	conn.Close()
+	if err != nil {
+		return err
+	}
+
+	return SendNewPayment(ctx, wChan, db, c, NewPaymentRequest{
+		NodeId:       req.NodeId,
+		Invoice:      &invoice,
+		TimeOutSecs:  req.TimeOutSecs,
+		FeeLimitMsat: req.FeeLimitMsat,
+	}, reqId)
+}
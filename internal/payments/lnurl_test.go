@@ -0,0 +1,147 @@
+package payments
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"google.golang.org/grpc"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+const testLnurlMetadata = `[["text/plain","Tips for alice"],["text/identifier","alice@example.com"]]`
+
+type mockLightningClient_DecodePayReq struct {
+	payReq *lnrpc.PayReq
+}
+
+func (c *mockLightningClient_DecodePayReq) DecodePayReq(ctx context.Context, in *lnrpc.PayReqString,
+	opts ...grpc.CallOption) (*lnrpc.PayReq, error) {
+	return c.payReq, nil
+}
+
+func newLnurlStubServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("/.well-known/lnurlp/alice", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"callback":       server.URL + "/callback",
+			"minSendable":    1000,
+			"maxSendable":    1000000,
+			"metadata":       testLnurlMetadata,
+			"tag":            "payRequest",
+			"commentAllowed": 10,
+		})
+	})
+	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := strconv.ParseInt(r.URL.Query().Get("amount"), 10, 64); err != nil {
+			json.NewEncoder(w).Encode(map[string]string{"status": "ERROR", "reason": "Missing amount"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"pr": "lnbc1", "routes": []string{}})
+	})
+	server = httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func encodeLnurl(t *testing.T, u string) string {
+	data, err := bech32.ConvertBits([]byte(u), 8, 5, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lnurl, err := bech32.Encode("lnurl", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lnurl
+}
+
+func Test_lnurlToUrl(t *testing.T) {
+	u, err := lnurlToUrl("Alice@example.com")
+	if err != nil || u != "https://example.com/.well-known/lnurlp/alice" {
+		t.Errorf("lnurlToUrl() = %q, %v", u, err)
+	}
+
+	lnurl := encodeLnurl(t, "https://example.com/lnurlp/alice?q=1")
+	u, err = lnurlToUrl("lightning:" + lnurl)
+	if err != nil || u != "https://example.com/lnurlp/alice?q=1" {
+		t.Errorf("lnurlToUrl() = %q, %v", u, err)
+	}
+
+	if _, err = lnurlToUrl("lnbc1"); err == nil {
+		t.Errorf("lnurlToUrl() accepted an invoice")
+	}
+
+	onion := "http://alice2bkgvvdq2yf3gvzxgxaeqzqahzh5hv7nlw5mkvkvaaecxv6csid.onion/lnurlp/alice"
+	u, err = lnurlToUrl(encodeLnurl(t, onion))
+	if err != nil || u != onion {
+		t.Errorf("lnurlToUrl() = %q, %v", u, err)
+	}
+
+	for _, internal := range []string{"http://127.0.0.1:8080/api", "file:///etc/passwd", "https:///path"} {
+		if _, err = lnurlToUrl(encodeLnurl(t, internal)); err == nil {
+			t.Errorf("lnurlToUrl() accepted %s", internal)
+		}
+	}
+}
+
+func Test_lnurlPay(t *testing.T) {
+	server := newLnurlStubServer(t)
+	ctx := context.Background()
+
+	p, err := resolveLnurlPay(ctx, server.Client(), encodeLnurl(t, server.URL+"/.well-known/lnurlp/alice"))
+	if err != nil {
+		t.Fatalf("resolveLnurlPay() error = %v", err)
+	}
+	if p.MinSendable != 1000 || p.MaxSendable != 1000000 || p.Description != "Tips for alice" {
+		t.Errorf("Unexpected pay parameters %+v", p)
+	}
+
+	hash := sha256.Sum256([]byte(testLnurlMetadata))
+	lnd := &mockLightningClient_DecodePayReq{
+		payReq: &lnrpc.PayReq{NumMsat: 5000, DescriptionHash: hex.EncodeToString(hash[:])},
+	}
+	comment := "thanks"
+	invoice, err := fetchLnurlInvoice(ctx, server.Client(), lnd, p,
+		LnurlPayRequest{AmtMSat: 5000, Comment: &comment})
+	if err != nil || invoice != "lnbc1" {
+		t.Errorf("fetchLnurlInvoice() = %q, %v", invoice, err)
+	}
+
+	_, err = fetchLnurlInvoice(ctx, server.Client(), lnd, p, LnurlPayRequest{AmtMSat: 500})
+	if err == nil {
+		t.Errorf("fetchLnurlInvoice() accepted an amount below minSendable")
+	}
+
+	_, err = fetchLnurlInvoice(ctx, server.Client(), lnd, p, LnurlPayRequest{AmtMSat: 6000})
+	if err == nil {
+		t.Errorf("fetchLnurlInvoice() accepted an invoice for another amount")
+	}
+
+	// Two characters, but more than two bytes.
+	comment = "éé"
+	p.CommentAllowed = 2
+	_, err = fetchLnurlInvoice(ctx, server.Client(), lnd, p, LnurlPayRequest{AmtMSat: 5000, Comment: &comment})
+	if err != nil {
+		t.Errorf("fetchLnurlInvoice() error = %v, want a comment of commentAllowed characters", err)
+	}
+
+	plainCallback := p
+	plainCallback.Callback = "http://127.0.0.1:8080/callback"
+	_, err = fetchLnurlInvoice(ctx, server.Client(), lnd, plainCallback, LnurlPayRequest{AmtMSat: 5000})
+	if err == nil {
+		t.Errorf("fetchLnurlInvoice() accepted an http callback")
+	}
+
+	lnd.payReq.DescriptionHash = "00"
+	_, err = fetchLnurlInvoice(ctx, server.Client(), lnd, p, LnurlPayRequest{AmtMSat: 5000})
+	if err == nil {
+		t.Errorf("fetchLnurlInvoice() accepted an invoice with another description hash")
+	}
+}
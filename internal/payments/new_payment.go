@@ -2,12 +2,15 @@ package payments
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"github.com/cockroachdb/errors"
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"github.com/lightningnetwork/lnd/record"
 	"github.com/lncapital/torq/internal/channels"
 	"github.com/lncapital/torq/internal/settings"
 	"github.com/lncapital/torq/pkg/lnd_connect"
@@ -32,8 +35,42 @@ type NewPaymentRequest struct {
 	AmtMSat          *int64  `json:"amtMSat"`
 	FeeLimitMsat     *int64  `json:"feeLimitMsat"`
 	AllowSelfPayment *bool   `json:"allowSelfPayment"`
+	// CustomRecords are TLV records sent to the destination, hex encoded values by record type. Types have to be
+	// in the custom range (65536 and up).
+	CustomRecords map[uint64]string `json:"customRecords"`
+	// Message is sent as a text message record, the record type used by most wallets for keysend messages.
+	Message *string `json:"message"`
+	// Amp pays the destination (or an AMP invoice) with an atomic multi-path payment instead of keysend.
+	Amp *bool `json:"amp"`
+	// OutgoingChanIds restricts the first hop to these channels (LND short channel ids).
+	OutgoingChanIds []uint64 `json:"outgoingChanIds"`
+	// LastHopPubkey is the pubkey of the node the payment has to reach the destination through.
+	LastHopPubkey    *string `json:"lastHopPubkey"`
+	MaxParts         *uint32 `json:"maxParts"`
+	MaxShardSizeMsat *uint64 `json:"maxShardSizeMsat"`
+	CltvLimit        *int32  `json:"cltvLimit"`
+	// FeeLimitPpm sets the fee limit relative to the amount, it's ignored when feeLimitMsat is set.
+	FeeLimitPpm *int64 `json:"feeLimitPpm"`
+	// TimePref between -1 and 1 prefers cheaper routes (-1) or routes that are more likely to succeed (1).
+	TimePref *float64     `json:"timePref"`
+	Retry    *RetryPolicy `json:"retry"`
+	// KeysendPreimage is the hex encoded preimage of a keysend payment, a random one is used when it's not set. It
+	// lets callers store the payment hash before the payment is sent.
+	KeysendPreimage *string `json:"-"`
 }
 
+// RetryPolicy retries payments that failed to find a route, raising the fee limit on every retry.
+type RetryPolicy struct {
+	MaxRetries int `json:"maxRetries"`
+	// FeeLimitStepMsat is added to the fee limit for every retry.
+	FeeLimitStepMsat int64 `json:"feeLimitStepMsat"`
+	// MaxFeeLimitMsat caps the fee limit, retries stop once it's reached.
+	MaxFeeLimitMsat int64 `json:"maxFeeLimitMsat"`
+}
+
+// messageRecordType is the TLV type of keysend text messages.
+const messageRecordType = 34349334
+
 type MppRecord struct {
 	PaymentAddr  string
 	TotalAmtMsat int64
@@ -78,9 +115,12 @@ type NewPaymentResponse struct {
 	Preimage       string    `json:"preimage"`
 	PaymentRequest string    `json:"paymentRequest"`
 	AmountMsat     int64     `json:"amountMsat"`
+	FeeMsat        int64     `json:"feeMsat"`
 	FeeLimitMsat   int64     `json:"feeLimitMsat"`
 	CreationDate   time.Time `json:"creationDate"`
 	Attempt        attempt   `json:"path"`
+	// Retry counts the retries of the payment, 0 for the first try.
+	Retry int `json:"retry"`
 }
 
 type paymentComplete struct {
@@ -95,7 +135,9 @@ type paymentComplete struct {
 // amt and amt_msat are mutually exclusive
 // payments hash - the hash to use within the payment's HTLC
 // timeout seconds is mandatory
+// The payment stream is closed when ctx is canceled, LND keeps trying to complete the payment.
 func SendNewPayment(
+	ctx context.Context,
 	wChan chan interface{},
 	db *sqlx.DB,
 	c *gin.Context,
@@ -107,6 +149,10 @@ func SendNewPayment(
 		return errors.New("Node id is missing")
 	}
 
+	if err = settings.CheckNodePermission(db, npReq.NodeId, settings.ActionSendPayment); err != nil {
+		return err
+	}
+
 	connectionDetails, err := settings.GetNodeConnectionDetailsById(db, npReq.NodeId)
 	if err != nil {
 		return errors.Wrap(err, "Getting node connection details from the db")
@@ -119,8 +165,19 @@ func SendNewPayment(
 		return errors.Wrap(err, "Getting node connection details from the db")
 	}
 	defer conn.Close()
+
+	// The fee limit in ppm needs the amount of the invoice when it's not given.
+	if npReq.FeeLimitPpm != nil && npReq.FeeLimitMsat == nil && npReq.AmtMSat == nil && npReq.Invoice != nil {
+		payReq, err := lnrpc.NewLightningClient(conn).DecodePayReq(ctx, &lnrpc.PayReqString{PayReq: *npReq.Invoice})
+		if err != nil {
+			return errors.Wrap(err, "Decoding payment request")
+		}
+		feeLimitMsat := feeLimitFromPpm(payReq.NumMsat, *npReq.FeeLimitPpm)
+		npReq.FeeLimitMsat = &feeLimitMsat
+	}
+
 	client := routerrpc.NewRouterClient(conn)
-	return sendPayment(client, npReq, wChan, reqId)
+	return sendPayment(ctx, client, npReq, wChan, reqId)
 }
 
 func newSendPaymentRequest(npReq NewPaymentRequest) (r routerrpc.SendPaymentRequest, err error) {
@@ -134,6 +191,11 @@ func newSendPaymentRequest(npReq NewPaymentRequest) (r routerrpc.SendPaymentRequ
 
 	if npReq.FeeLimitMsat != nil {
 		newPayReq.FeeLimitMsat = *npReq.FeeLimitMsat
+	} else if npReq.FeeLimitPpm != nil {
+		if npReq.AmtMSat == nil {
+			return r, errors.New("An amount is required to set the fee limit in ppm")
+		}
+		newPayReq.FeeLimitMsat = feeLimitFromPpm(*npReq.AmtMSat, *npReq.FeeLimitPpm)
 	}
 
 	if npReq.AmtMSat != nil {
@@ -144,21 +206,120 @@ func newSendPaymentRequest(npReq NewPaymentRequest) (r routerrpc.SendPaymentRequ
 		newPayReq.AllowSelfPayment = *npReq.AllowSelfPayment
 	}
 
-	// TODO: Add support for Keysend, needs to solve issue related to payment hash generation
-	//if npReq.Dest != nil {
-	//	fmt.Println("It was a keysend")
-	//	destHex, err := hex.DecodeString(*npReq.Dest)
-	//	if err != nil {
-	//		return r, errors.New("Could not decode destination pubkey (keysend)")
-	//	}
-	//	newPayReq.Dest = destHex
-	// //	newPayReq.PaymentHash = make([]byte, 32)
-	//}
+	if npReq.Amp != nil {
+		newPayReq.Amp = *npReq.Amp
+	}
+
+	newPayReq.OutgoingChanIds = npReq.OutgoingChanIds
+
+	if npReq.LastHopPubkey != nil {
+		lastHop, err := hex.DecodeString(*npReq.LastHopPubkey)
+		if err != nil {
+			return r, errors.New("Could not decode last hop pubkey")
+		}
+		newPayReq.LastHopPubkey = lastHop
+	}
+
+	if npReq.MaxParts != nil {
+		newPayReq.MaxParts = *npReq.MaxParts
+	}
+
+	if npReq.MaxShardSizeMsat != nil {
+		newPayReq.MaxShardSizeMsat = *npReq.MaxShardSizeMsat
+	}
+
+	if npReq.CltvLimit != nil {
+		newPayReq.CltvLimit = *npReq.CltvLimit
+	}
+
+	if npReq.TimePref != nil {
+		if *npReq.TimePref < -1 || *npReq.TimePref > 1 {
+			return r, errors.New("Time preference has to be between -1 and 1")
+		}
+		newPayReq.TimePref = *npReq.TimePref
+	}
+
+	if len(npReq.CustomRecords) != 0 || npReq.Message != nil {
+		newPayReq.DestCustomRecords = make(map[uint64][]byte)
+	}
+	for recordType, value := range npReq.CustomRecords {
+		if recordType < record.CustomTypeStart {
+			return r, errors.Newf("Custom record type %d is below the custom range starting at %d", recordType,
+				record.CustomTypeStart)
+		}
+		v, err := hex.DecodeString(value)
+		if err != nil {
+			return r, errors.Wrapf(err, "Decoding custom record %d", recordType)
+		}
+		newPayReq.DestCustomRecords[recordType] = v
+	}
+	if npReq.Message != nil {
+		newPayReq.DestCustomRecords[messageRecordType] = []byte(*npReq.Message)
+	}
+
+	if npReq.Dest != nil {
+		if npReq.Invoice != nil {
+			return r, errors.New("Either an invoice or a destination can be paid, not both")
+		}
+		if npReq.AmtMSat == nil {
+			return r, errors.New("An amount is required when paying a destination")
+		}
+		destHex, err := hex.DecodeString(*npReq.Dest)
+		if err != nil {
+			return r, errors.New("Could not decode destination pubkey (keysend)")
+		}
+		newPayReq.Dest = destHex
+
+		// AMP payments derive their hashes from shares LND generates, keysend payments carry the preimage in
+		// a record so the destination can settle without an invoice.
+		if !newPayReq.Amp {
+			preimage := make([]byte, 32)
+			if npReq.KeysendPreimage != nil {
+				preimage, err = hex.DecodeString(*npReq.KeysendPreimage)
+				if err != nil || len(preimage) != 32 {
+					return r, errors.New("Keysend preimage has to be 32 hex encoded bytes")
+				}
+			} else if _, err := rand.Read(preimage); err != nil {
+				return r, errors.Wrap(err, "Generating keysend preimage")
+			}
+			hash := sha256.Sum256(preimage)
+			newPayReq.PaymentHash = hash[:]
+			if newPayReq.DestCustomRecords == nil {
+				newPayReq.DestCustomRecords = make(map[uint64][]byte)
+			}
+			newPayReq.DestCustomRecords[record.KeySendType] = preimage
+		}
+	}
 
 	return newPayReq, nil
 }
 
-func sendPayment(client rrpcClientSendPayment, npReq NewPaymentRequest, wChan chan interface{}, reqId string) (err error) {
+func feeLimitFromPpm(amtMsat int64, ppm int64) int64 {
+	return amtMsat * ppm / 1000000
+}
+
+// nextFeeLimit returns the fee limit of the next retry, and false when the payment shouldn't be retried.
+func nextFeeLimit(retryPolicy *RetryPolicy, retry int, feeLimitMsat int64, p *lnrpc.Payment) (int64, bool) {
+	if retryPolicy == nil || retry >= retryPolicy.MaxRetries || p == nil || p.Status != lnrpc.Payment_FAILED {
+		return 0, false
+	}
+	// Only a higher fee limit can help payments that didn't find a route in time.
+	if p.FailureReason != lnrpc.PaymentFailureReason_FAILURE_REASON_NO_ROUTE &&
+		p.FailureReason != lnrpc.PaymentFailureReason_FAILURE_REASON_TIMEOUT {
+		return 0, false
+	}
+	next := feeLimitMsat + retryPolicy.FeeLimitStepMsat
+	if next > retryPolicy.MaxFeeLimitMsat {
+		next = retryPolicy.MaxFeeLimitMsat
+	}
+	if next <= feeLimitMsat {
+		return 0, false
+	}
+	return next, true
+}
+
+func sendPayment(ctx context.Context, client rrpcClientSendPayment, npReq NewPaymentRequest, wChan chan interface{},
+	reqId string) (err error) {
 
 	// Create and validate payment request details
 	newPayReq, err := newSendPaymentRequest(npReq)
@@ -166,16 +327,33 @@ func sendPayment(client rrpcClientSendPayment, npReq NewPaymentRequest, wChan ch
 		return err
 	}
 
-	ctx := context.Background()
-	req, err := client.SendPaymentV2(ctx, &newPayReq)
+	// Retries reuse the request, keysend payments keep their preimage.
+	for retry := 0; ; retry++ {
+		last, err := sendPaymentAttempt(ctx, client, &newPayReq, wChan, reqId, retry)
+		if err != nil {
+			return err
+		}
+		feeLimitMsat, ok := nextFeeLimit(npReq.Retry, retry, newPayReq.FeeLimitMsat, last)
+		if !ok {
+			return nil
+		}
+		newPayReq.FeeLimitMsat = feeLimitMsat
+	}
+}
+
+// sendPaymentAttempt sends the payment and streams its updates. It returns the last update received.
+func sendPaymentAttempt(ctx context.Context, client rrpcClientSendPayment, newPayReq *routerrpc.SendPaymentRequest,
+	wChan chan interface{}, reqId string, retry int) (last *lnrpc.Payment, err error) {
+
+	req, err := client.SendPaymentV2(ctx, newPayReq)
 	if err != nil {
-		return errors.Wrap(err, "Sending payment")
+		return nil, errors.Wrap(err, "Sending payment")
 	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			return nil
+			return nil, nil
 		default:
 		}
 
@@ -184,29 +362,33 @@ func sendPayment(client rrpcClientSendPayment, npReq NewPaymentRequest, wChan ch
 		case err == nil:
 			break
 		case err == io.EOF:
-			return nil
+			return last, nil
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
 		case err != nil && strings.Contains(err.Error(), "AlreadyExists"):
-			return errors.New("ALREADY_PAID")
+			return nil, errors.New("ALREADY_PAID")
 		case err != nil && strings.Contains(err.Error(), "UnknownPaymentHash"):
-			return errors.New("INVALID_HASH")
+			return nil, errors.New("INVALID_HASH")
 		case err != nil && strings.Contains(err.Error(), "InvalidPaymentRequest"):
-			return errors.New("INVALID_PAYMENT_REQUEST")
+			return nil, errors.New("INVALID_PAYMENT_REQUEST")
 		case err != nil && strings.Contains(err.Error(), "checksum failed"):
-			return errors.New("CHECKSUM_FAILED")
+			return nil, errors.New("CHECKSUM_FAILED")
 		case err != nil && strings.Contains(err.Error(), "amount must be specified when paying a zero amount invoice"):
-			return errors.New("AMOUNT_REQUIRED")
+			return nil, errors.New("AMOUNT_REQUIRED")
 		case err != nil && strings.Contains(err.Error(), "amount must not be specified when paying a non-zero  amount invoice"):
-			return errors.New("AMOUNT_NOT_ALLOWED")
+			return nil, errors.New("AMOUNT_NOT_ALLOWED")
 		default:
 			log.Error().Msgf("Unknown payment error %v", err)
-			return errors.New("UNKNOWN_ERROR")
+			return nil, errors.New("UNKNOWN_ERROR")
 		}
 
 		// Write the payment status to the client
-		wChan <- processResponse(resp, reqId)
-		break
+		r := processResponse(resp, reqId)
+		r.FeeLimitMsat = newPayReq.FeeLimitMsat
+		r.Retry = retry
+		wChan <- r
+		last = resp
 	}
-	return
 }
 
 func processResponse(p *lnrpc.Payment, reqId string) (r NewPaymentResponse) {
@@ -216,6 +398,7 @@ func processResponse(p *lnrpc.Payment, reqId string) (r NewPaymentResponse) {
 	r.Hash = p.PaymentHash
 	r.Preimage = p.PaymentPreimage
 	r.AmountMsat = p.ValueMsat
+	r.FeeMsat = p.FeeMsat
 	r.CreationDate = time.Unix(0, p.CreationTimeNs)
 	r.FailureReason = p.FailureReason.String()
 
@@ -232,21 +415,21 @@ func processResponse(p *lnrpc.Payment, reqId string) (r NewPaymentResponse) {
 			r.Attempt.Failure.Height = attempt.Failure.Height
 		}
 
-		for _, hop := range attempt.Route.Hops {
+		for _, hop := range attempt.GetRoute().GetHops() {
 			r.Attempt.Route.Hops = append(r.Attempt.Route.Hops, hops{
 				ChanId:           channels.ConvertLNDShortChannelID(hop.ChanId),
 				AmtToForwardMsat: hop.AmtToForwardMsat,
 				Expiry:           hop.Expiry,
 				PubKey:           hop.PubKey,
 				MppRecord: MppRecord{
-					PaymentAddr:  hex.EncodeToString(hop.MppRecord.PaymentAddr),
-					TotalAmtMsat: hop.MppRecord.TotalAmtMsat,
+					PaymentAddr:  hex.EncodeToString(hop.GetMppRecord().GetPaymentAddr()),
+					TotalAmtMsat: hop.GetMppRecord().GetTotalAmtMsat(),
 				},
 			})
 		}
 
-		r.Attempt.Route.TotalTimeLock = attempt.Route.TotalTimeLock
-		r.Attempt.Route.TotalAmtMsat = attempt.Route.TotalAmtMsat
+		r.Attempt.Route.TotalTimeLock = attempt.GetRoute().GetTotalTimeLock()
+		r.Attempt.Route.TotalAmtMsat = attempt.GetRoute().GetTotalAmtMsat()
 	}
 	return r
 }
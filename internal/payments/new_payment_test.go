@@ -1,8 +1,15 @@
 package payments
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"github.com/lightningnetwork/lnd/record"
+	"google.golang.org/grpc"
+	"io"
 	"reflect"
 	"testing"
 	"time"
@@ -71,6 +78,7 @@ func Test_processResponse(t *testing.T) {
 			Preimage:       "fee347b7a00b3247b48312b0a16ad4ab46de2ba30bb61269caeff43c0798e87e",
 			PaymentRequest: "",
 			AmountMsat:     12000,
+			FeeMsat:        100,
 			CreationDate:   time.Unix(1661252258, 0),
 			Attempt: attempt{
 				AttemptId: 1234,
@@ -155,6 +163,7 @@ func Test_processResponse(t *testing.T) {
 				Preimage:       "00000",
 				PaymentRequest: "",
 				AmountMsat:     12000,
+				FeeMsat:        100,
 				CreationDate:   time.Unix(1661252258, 0),
 				Attempt: attempt{
 					AttemptId: 12345,
@@ -253,3 +262,120 @@ func Test_newSendPaymentRequest(t *testing.T) {
 		})
 	}
 }
+
+func Test_newSendPaymentRequestKeysend(t *testing.T) {
+	var amount int64 = 2000
+	message := "Hello"
+	dest := testDest
+	npReq := NewPaymentRequest{
+		TimeOutSecs:   3600,
+		Dest:          &dest,
+		AmtMSat:       &amount,
+		CustomRecords: map[uint64]string{65537: "0102"},
+		Message:       &message,
+	}
+
+	got, err := newSendPaymentRequest(npReq)
+	if err != nil {
+		t.Fatalf("newSendPaymentRequest() error = %v", err)
+	}
+	if hex.EncodeToString(got.Dest) != testDest || got.AmtMsat != amount {
+		t.Errorf("Destination %x and amount %d don't match the request", got.Dest, got.AmtMsat)
+	}
+	preimage := got.DestCustomRecords[record.KeySendType]
+	hash := sha256.Sum256(preimage)
+	if len(preimage) != 32 || !bytes.Equal(hash[:], got.PaymentHash) {
+		t.Errorf("Payment hash %x is not the hash of the keysend preimage %x", got.PaymentHash, preimage)
+	}
+	if !bytes.Equal(got.DestCustomRecords[65537], []byte{1, 2}) {
+		t.Errorf("Custom record 65537 = %x, want 0102", got.DestCustomRecords[65537])
+	}
+	if string(got.DestCustomRecords[messageRecordType]) != message {
+		t.Errorf("Message record = %q, want %q", got.DestCustomRecords[messageRecordType], message)
+	}
+
+	given := "0101010101010101010101010101010101010101010101010101010101010101"
+	npReq.KeysendPreimage = &given
+	got, err = newSendPaymentRequest(npReq)
+	if err != nil {
+		t.Fatalf("newSendPaymentRequest() error = %v", err)
+	}
+	if hex.EncodeToString(got.DestCustomRecords[record.KeySendType]) != given {
+		t.Errorf("Keysend preimage = %x, want the given preimage %s", got.DestCustomRecords[record.KeySendType], given)
+	}
+	npReq.KeysendPreimage = nil
+
+	amp := true
+	npReq.Amp = &amp
+	got, err = newSendPaymentRequest(npReq)
+	if err != nil {
+		t.Fatalf("newSendPaymentRequest() error = %v", err)
+	}
+	if !got.Amp || got.PaymentHash != nil || got.DestCustomRecords[record.KeySendType] != nil {
+		t.Errorf("AMP payment should leave the payment hash to LND, got %+v", got)
+	}
+
+	npReq.CustomRecords = map[uint64]string{100: "01"}
+	if _, err = newSendPaymentRequest(npReq); err == nil {
+		t.Errorf("newSendPaymentRequest() accepted a custom record type below the custom range")
+	}
+}
+
+type mockSendPaymentV2Client struct {
+	grpc.ClientStream
+	updates []*lnrpc.Payment
+}
+
+func (c *mockSendPaymentV2Client) Recv() (*lnrpc.Payment, error) {
+	if len(c.updates) == 0 {
+		return nil, io.EOF
+	}
+	p := c.updates[0]
+	c.updates = c.updates[1:]
+	return p, nil
+}
+
+type mockRouterClient_SendPayment struct {
+	feeLimits []int64
+}
+
+func (c *mockRouterClient_SendPayment) SendPaymentV2(ctx context.Context, in *routerrpc.SendPaymentRequest,
+	opts ...grpc.CallOption) (routerrpc.Router_SendPaymentV2Client, error) {
+	c.feeLimits = append(c.feeLimits, in.FeeLimitMsat)
+	return &mockSendPaymentV2Client{updates: []*lnrpc.Payment{
+		{Status: lnrpc.Payment_IN_FLIGHT},
+		{Status: lnrpc.Payment_FAILED, FailureReason: lnrpc.PaymentFailureReason_FAILURE_REASON_NO_ROUTE},
+	}}, nil
+}
+
+func Test_sendPaymentRetry(t *testing.T) {
+	invoice := "lnbc1"
+	var feeLimitMsat int64 = 1000
+	client := &mockRouterClient_SendPayment{}
+	wChan := make(chan interface{}, 100)
+
+	err := sendPayment(context.Background(), client, NewPaymentRequest{
+		Invoice:      &invoice,
+		FeeLimitMsat: &feeLimitMsat,
+		Retry:        &RetryPolicy{MaxRetries: 5, FeeLimitStepMsat: 1000, MaxFeeLimitMsat: 2500},
+	}, wChan, "id")
+	if err != nil {
+		t.Fatalf("sendPayment() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(client.feeLimits, []int64{1000, 2000, 2500}) {
+		t.Errorf("Fee limits of the attempts = %v, want [1000 2000 2500]", client.feeLimits)
+	}
+	close(wChan)
+	var updates []NewPaymentResponse
+	for u := range wChan {
+		updates = append(updates, u.(NewPaymentResponse))
+	}
+	if len(updates) != 6 {
+		t.Fatalf("Got %d payment updates, want 2 for each of the 3 attempts", len(updates))
+	}
+	last := updates[len(updates)-1]
+	if last.Retry != 2 || last.FeeLimitMsat != 2500 || last.Status != "FAILED" {
+		t.Errorf("Last update = %+v, want the failed second retry with a fee limit of 2500", last)
+	}
+}
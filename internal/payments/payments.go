@@ -5,27 +5,34 @@ import (
 	"encoding/json"
 	sq "github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	qp "github.com/lncapital/torq/internal/query_parser"
 	"github.com/rs/zerolog/log"
 	"time"
 )
 
 type Payment struct {
-	PaymentIndex            uint64    `json:"payment_index" db:"payment_index"`
-	Date                    time.Time `json:"date" db:"date"`
-	DestinationPubKey       *string   `json:"destination_pub_key" db:"destination_pub_key"`
-	Status                  string    `json:"status" db:"status"`
-	Value                   float64   `json:"value" db:"value"`
-	Fee                     float64   `json:"fee" db:"fee"`
-	PPM                     float64   `json:"ppm" db:"ppm"`
-	FailureReason           string    `json:"failure_reason" db:"failure_reason"`
-	PaymentHash             string    `json:"payment_hash" db:"payment_hash"`
-	PaymentPreimage         string    `json:"payment_preimage" db:"payment_preimage"`
-	PaymentRequest          *string   `json:"payment_request" db:"payment_request"`
-	IsRebalance             *bool     `json:"is_rebalance" db:"is_rebalance"`
-	IsMPP                   bool      `json:"is_mpp" db:"is_mpp"`
-	CountSuccessfulAttempts int       `json:"count_successful_attempts" db:"count_successful_attempts"`
-	CountFailedAttempts     int       `json:"count_failed_attempts" db:"count_failed_attempts"`
-	SecondsInFlight         *float32  `json:"seconds_in_flight" db:"seconds_in_flight"`
+	PaymentIndex      uint64    `json:"payment_index" db:"payment_index"`
+	Date              time.Time `json:"date" db:"date"`
+	DestinationPubKey *string   `json:"destination_pub_key" db:"destination_pub_key"`
+	Status            string    `json:"status" db:"status"`
+	Value             float64   `json:"value" db:"value"`
+	Fee               float64   `json:"fee" db:"fee"`
+	PPM               float64   `json:"ppm" db:"ppm"`
+	FailureReason     string    `json:"failure_reason" db:"failure_reason"`
+	PaymentHash       string    `json:"payment_hash" db:"payment_hash"`
+	PaymentPreimage   string    `json:"payment_preimage" db:"payment_preimage"`
+	PaymentRequest    *string   `json:"payment_request" db:"payment_request"`
+	IsRebalance       *bool     `json:"is_rebalance" db:"is_rebalance"`
+	IsMPP             bool      `json:"is_mpp" db:"is_mpp"`
+	IsKeysend         bool      `json:"is_keysend" db:"is_keysend"`
+	IsAmp             bool      `json:"is_amp" db:"is_amp"`
+	// CustomRecords are the TLV records sent to the destination, base64 encoded values by record type.
+	CustomRecords           json.RawMessage `json:"custom_records" db:"custom_records"`
+	CountSuccessfulAttempts int             `json:"count_successful_attempts" db:"count_successful_attempts"`
+	CountFailedAttempts     int             `json:"count_failed_attempts" db:"count_failed_attempts"`
+	SecondsInFlight         *float32        `json:"seconds_in_flight" db:"seconds_in_flight"`
+	Tags                    pq.StringArray  `json:"tags" db:"tags"`
 }
 
 type Hop struct {
@@ -80,9 +87,13 @@ func getPayments(db *sqlx.DB, filter sq.Sqlizer, order []string, limit uint64, o
 				payment_request,
 				destination_pub_key = ANY(ARRAY[(table pub_keys)]) as is_rebalance,
 				is_mpp,
+				is_keysend,
+				is_amp,
+				coalesce(custom_records, '{}'::jsonb) as custom_records,
 				count_successful_attempts,
 				count_failed_attempts,
-				extract(epoch from (to_timestamp(coalesce(NULLIF(resolved_ns, 0)/1000000000, 0))-creation_timestamp))::numeric as seconds_in_flight
+				extract(epoch from (to_timestamp(coalesce(NULLIF(resolved_ns, 0)/1000000000, 0))-creation_timestamp))::numeric as seconds_in_flight,
+				pub_key_tags(destination_pub_key) as tags
 			`).
 				PlaceholderFormat(sq.Dollar).
 				From("payment"),
@@ -129,9 +140,13 @@ func getPayments(db *sqlx.DB, filter sq.Sqlizer, order []string, limit uint64, o
 			&p.PaymentRequest,
 			&p.IsRebalance,
 			&p.IsMPP,
+			&p.IsKeysend,
+			&p.IsAmp,
+			&p.CustomRecords,
 			&p.CountSuccessfulAttempts,
 			&p.CountFailedAttempts,
 			&p.SecondsInFlight,
+			&p.Tags,
 		)
 
 		if err != nil {
@@ -159,9 +174,13 @@ func getPayments(db *sqlx.DB, filter sq.Sqlizer, order []string, limit uint64, o
 				payment_request,
 				destination_pub_key = ANY(ARRAY[(table pub_keys)]) as is_rebalance,
 				is_mpp,
+				is_keysend,
+				is_amp,
+				coalesce(custom_records, '{}'::jsonb) as custom_records,
 				count_successful_attempts,
 				count_failed_attempts,
-				extract(epoch from (to_timestamp(coalesce(NULLIF(resolved_ns, 0)/1000000000, 0))-creation_timestamp))::numeric as seconds_in_flight
+				extract(epoch from (to_timestamp(coalesce(NULLIF(resolved_ns, 0)/1000000000, 0))-creation_timestamp))::numeric as seconds_in_flight,
+				pub_key_tags(destination_pub_key) as tags
 			`).
 				PlaceholderFormat(sq.Dollar).
 				From("payment"),
@@ -210,9 +229,13 @@ func getPaymentDetails(db *sqlx.DB, identifier string) (*PaymentDetails, error)
 				payment_request,
 				destination_pub_key = ANY(ARRAY[(table pub_keys)]) as is_rebalance,
 				is_mpp,
+				is_keysend,
+				is_amp,
+				coalesce(custom_records, '{}'::jsonb) as custom_records,
 				count_successful_attempts,
 				count_failed_attempts,
 				extract(epoch from (to_timestamp(coalesce(NULLIF(resolved_ns, 0)/1000000000,0))-creation_timestamp))::numeric as seconds_in_flight,
+				pub_key_tags(destination_pub_key) as tags,
 				successful_routes,
 				failed_routes
 			`).
@@ -247,9 +270,13 @@ func getPaymentDetails(db *sqlx.DB, identifier string) (*PaymentDetails, error)
 		&r.PaymentRequest,
 		&r.IsRebalance,
 		&r.IsMPP,
+		&r.IsKeysend,
+		&r.IsAmp,
+		&r.CustomRecords,
 		&r.CountSuccessfulAttempts,
 		&r.CountFailedAttempts,
 		&r.SecondsInFlight,
+		&r.Tags,
 		&sr,
 		&fr,
 	)
@@ -277,3 +304,25 @@ func getPaymentDetails(db *sqlx.DB, identifier string) (*PaymentDetails, error)
 
 	return &r, nil
 }
+
+// QueryPayments parses the filter clauses and sort order against the payment columns and runs the
+// query. It is used to run saved table views on the server. Invalid filters and sorting are returned
+// as qp.ErrInvalidFilter and qp.ErrInvalidOrder.
+func QueryPayments(db *sqlx.DB, filters *qp.FilterClauses, order []qp.Order, limit uint64,
+	offset uint64) (r []*Payment, total uint64, err error) {
+
+	var filter sq.Sqlizer
+	if filters != nil && !filters.IsEmpty() {
+		filter, err = qp.NewSchemaParser(paymentColumns).ParseFilterClauses(*filters)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	sort, err := qp.NewParser(paymentSortColumns).ParseOrderClauses(order)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return getPayments(db, filter, sort, limit, offset)
+}
@@ -0,0 +1,77 @@
+package payments
+
+import (
+	"context"
+	"encoding/hex"
+	"github.com/cockroachdb/errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"github.com/lncapital/torq/internal/settings"
+	"github.com/lncapital/torq/pkg/lnd_connect"
+	"google.golang.org/grpc"
+	"io"
+	"strings"
+)
+
+type rrpcClientTrackPayment interface {
+	TrackPaymentV2(ctx context.Context, in *routerrpc.TrackPaymentRequest,
+		opts ...grpc.CallOption) (routerrpc.Router_TrackPaymentV2Client, error)
+}
+
+// ErrPaymentNotInitiated is returned by TrackPayment when LND doesn't know the payment hash, the payment was never
+// sent.
+type ErrPaymentNotInitiated struct {
+	PaymentHash string
+}
+
+func (e ErrPaymentNotInitiated) Error() string {
+	return "PAYMENT_NOT_INITIATED"
+}
+
+// TrackPayment waits until the payment with the hash succeeded or failed and returns its final status.
+func TrackPayment(ctx context.Context, db *sqlx.DB, nodeId int, paymentHash string) (NewPaymentResponse, error) {
+	connectionDetails, err := settings.GetNodeConnectionDetailsById(db, nodeId)
+	if err != nil {
+		return NewPaymentResponse{}, errors.Wrap(err, "Getting node connection details from the db")
+	}
+	conn, err := lnd_connect.Connect(
+		connectionDetails.GRPCAddress,
+		connectionDetails.TLSFileBytes,
+		connectionDetails.MacaroonFileBytes)
+	if err != nil {
+		return NewPaymentResponse{}, errors.Wrap(err, "Connecting to LND")
+	}
+	defer conn.Close()
+
+	return trackPayment(ctx, routerrpc.NewRouterClient(conn), paymentHash)
+}
+
+func trackPayment(ctx context.Context, client rrpcClientTrackPayment, paymentHash string) (NewPaymentResponse,
+	error) {
+
+	hash, err := hex.DecodeString(paymentHash)
+	if err != nil {
+		return NewPaymentResponse{}, errors.Wrap(err, "Decoding payment hash")
+	}
+	stream, err := client.TrackPaymentV2(ctx, &routerrpc.TrackPaymentRequest{PaymentHash: hash,
+		NoInflightUpdates: true})
+	if err != nil {
+		return NewPaymentResponse{}, errors.Wrap(err, "Tracking payment")
+	}
+
+	for {
+		p, err := stream.Recv()
+		switch {
+		case err == io.EOF:
+			return NewPaymentResponse{}, errors.New("Payment stream ended before the payment")
+		case err != nil && strings.Contains(err.Error(), "payment isn't initiated"):
+			return NewPaymentResponse{}, ErrPaymentNotInitiated{PaymentHash: paymentHash}
+		case err != nil:
+			return NewPaymentResponse{}, errors.Wrap(err, "Tracking payment")
+		}
+		if p.Status == lnrpc.Payment_SUCCEEDED || p.Status == lnrpc.Payment_FAILED {
+			return processResponse(p, ""), nil
+		}
+	}
+}
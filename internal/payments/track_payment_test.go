@@ -0,0 +1,74 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"google.golang.org/grpc"
+	"io"
+	"testing"
+)
+
+type mockTrackPaymentV2Client struct {
+	grpc.ClientStream
+	updates []*lnrpc.Payment
+	err     error
+}
+
+func (c *mockTrackPaymentV2Client) Recv() (*lnrpc.Payment, error) {
+	if len(c.updates) == 0 {
+		if c.err != nil {
+			return nil, c.err
+		}
+		return nil, io.EOF
+	}
+	p := c.updates[0]
+	c.updates = c.updates[1:]
+	return p, nil
+}
+
+type mockRouterClient_TrackPayment struct {
+	stream *mockTrackPaymentV2Client
+}
+
+func (c *mockRouterClient_TrackPayment) TrackPaymentV2(ctx context.Context, in *routerrpc.TrackPaymentRequest,
+	opts ...grpc.CallOption) (routerrpc.Router_TrackPaymentV2Client, error) {
+	return c.stream, nil
+}
+
+func Test_trackPayment(t *testing.T) {
+	tests := []struct {
+		name       string
+		stream     *mockTrackPaymentV2Client
+		wantStatus string
+		wantErr    error
+	}{
+		{
+			"Succeeded",
+			&mockTrackPaymentV2Client{updates: []*lnrpc.Payment{
+				{Status: lnrpc.Payment_IN_FLIGHT},
+				{Status: lnrpc.Payment_SUCCEEDED, FeeMsat: 10},
+			}},
+			"SUCCEEDED",
+			nil,
+		},
+		{
+			"Not initiated",
+			&mockTrackPaymentV2Client{err: errors.New("rpc error: code = Unknown desc = payment isn't initiated")},
+			"",
+			ErrPaymentNotInitiated{PaymentHash: "00"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := trackPayment(context.Background(), &mockRouterClient_TrackPayment{test.stream}, "00")
+			if err != test.wantErr {
+				t.Fatalf("trackPayment() error = %v, want %v", err, test.wantErr)
+			}
+			if r.Status != test.wantStatus {
+				t.Errorf("trackPayment() status = %s, want %s", r.Status, test.wantStatus)
+			}
+		})
+	}
+}
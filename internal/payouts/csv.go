@@ -0,0 +1,100 @@
+package payouts
+
+import (
+	"encoding/csv"
+	"github.com/cockroachdb/errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// parseItemsCsv reads payout items from CSV with a header row. The columns are invoice, dest and amt_msat, in any
+// order, and only the columns in use have to be present.
+func parseItemsCsv(r io.Reader) ([]PayoutItemRequest, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "Reading CSV header")
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	_, hasInvoice := columns["invoice"]
+	_, hasDest := columns["dest"]
+	if !hasInvoice && !hasDest {
+		return nil, errors.New("CSV needs an invoice or a dest column")
+	}
+
+	var items []PayoutItemRequest
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Reading CSV line %d", line)
+		}
+
+		field := func(name string) *string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) || strings.TrimSpace(record[i]) == "" {
+				return nil
+			}
+			v := strings.TrimSpace(record[i])
+			return &v
+		}
+		item := PayoutItemRequest{Invoice: field("invoice"), Dest: field("dest")}
+		if amt := field("amt_msat"); amt != nil {
+			amtMsat, err := strconv.ParseInt(*amt, 10, 64)
+			if err != nil {
+				return nil, errors.Newf("Invalid amt_msat on CSV line %d", line)
+			}
+			item.AmtMSat = &amtMsat
+		}
+		items = append(items, item)
+	}
+}
+
+var reportHeader = []string{"payout_item_id", "invoice", "destination_pub_key", "amount_msat", "status",
+	"fee_msat", "payment_hash", "payment_preimage", "failure_reason", "validation_error"}
+
+// writeReport writes the outcome of every item of the job as CSV.
+func writeReport(w io.Writer, job PayoutJob) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(reportHeader); err != nil {
+		return err
+	}
+	str := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	for _, item := range job.Items {
+		fee := ""
+		if item.FeeMsat != nil {
+			fee = strconv.FormatInt(*item.FeeMsat, 10)
+		}
+		err := cw.Write([]string{
+			strconv.Itoa(item.PayoutItemId),
+			str(item.Invoice),
+			str(item.DestinationPubKey),
+			strconv.FormatInt(item.AmountMsat, 10),
+			item.Status,
+			fee,
+			str(item.PaymentHash),
+			str(item.PaymentPreimage),
+			str(item.FailureReason),
+			str(item.ValidationError),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
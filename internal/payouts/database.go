@@ -0,0 +1,171 @@
+package payouts
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"time"
+)
+
+type ErrPayoutJobNotFound struct {
+	Identifier int
+}
+
+func (e ErrPayoutJobNotFound) Error() string {
+	return "Payout job not found"
+}
+
+const jobColumns = `payout_job_id, local_node_id, status, max_concurrency, fee_budget_msat, timeout_secs,
+  total_amount_msat, estimated_fee_msat, fee_msat, created_on, updated_on`
+
+const itemColumns = `payout_item_id, payout_job_id, invoice, destination_pub_key, amt_msat, amount_msat,
+  estimated_fee_msat, validation_error, status, payment_hash, payment_preimage, fee_msat, failure_reason,
+  created_on, updated_on`
+
+func insertJob(db *sqlx.DB, job PayoutJob) (r PayoutJob, err error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return PayoutJob{}, errors.Wrap(err, "Unable to start transaction")
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	err = tx.Get(&r, `
+INSERT INTO payout_job (
+  local_node_id,
+  status,
+  max_concurrency,
+  fee_budget_msat,
+  timeout_secs,
+  total_amount_msat,
+  estimated_fee_msat,
+  created_on
+) values ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING `+jobColumns+`;`,
+		job.LocalNodeId, job.Status, job.MaxConcurrency, job.FeeBudgetMsat, job.TimeoutSecs, job.TotalAmountMsat,
+		job.EstimatedFeeMsat, now)
+	if err != nil {
+		return PayoutJob{}, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+
+	for _, item := range job.Items {
+		var i PayoutItem
+		err = tx.Get(&i, `
+INSERT INTO payout_item (
+  payout_job_id,
+  invoice,
+  destination_pub_key,
+  amt_msat,
+  amount_msat,
+  estimated_fee_msat,
+  validation_error,
+  status,
+  payment_hash,
+  created_on
+) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+RETURNING `+itemColumns+`;`,
+			r.PayoutJobId, item.Invoice, item.DestinationPubKey, item.AmtMSat, item.AmountMsat,
+			item.EstimatedFeeMsat, item.ValidationError, item.Status, item.PaymentHash, now)
+		if err != nil {
+			return PayoutJob{}, errors.Wrap(err, "Unable to execute SQL statement")
+		}
+		r.Items = append(r.Items, i)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return PayoutJob{}, errors.Wrap(err, "Unable to commit transaction")
+	}
+	return r, nil
+}
+
+func getJobs(db *sqlx.DB) (jobs []PayoutJob, err error) {
+	err = db.Select(&jobs, `SELECT `+jobColumns+` FROM payout_job ORDER BY payout_job_id DESC;`)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return make([]PayoutJob, 0), nil
+		}
+		return nil, errors.Wrap(err, "Unable to execute SQL query")
+	}
+	return jobs, nil
+}
+
+func getJobIdsWithStatus(db *sqlx.DB, status string) (ids []int, err error) {
+	err = db.Select(&ids, `SELECT payout_job_id FROM payout_job WHERE status = $1 ORDER BY payout_job_id;`, status)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to execute SQL query")
+	}
+	return ids, nil
+}
+
+func getJob(db *sqlx.DB, jobId int) (job PayoutJob, err error) {
+	err = db.Get(&job, `SELECT `+jobColumns+` FROM payout_job WHERE payout_job_id = $1;`, jobId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return PayoutJob{}, ErrPayoutJobNotFound{jobId}
+		}
+		return PayoutJob{}, errors.Wrap(err, "Unable to execute SQL query")
+	}
+
+	err = db.Select(&job.Items, `
+SELECT `+itemColumns+`
+FROM payout_item
+WHERE payout_job_id = $1
+ORDER BY payout_item_id;`, jobId)
+	if err != nil {
+		return PayoutJob{}, errors.Wrap(err, "Unable to execute SQL query")
+	}
+	return job, nil
+}
+
+// setJobStatus changes the status of the job when it still has the expected status, so a job can only be
+// confirmed once.
+func setJobStatus(db *sqlx.DB, jobId int, from string, to string) (PayoutJob, error) {
+	res, err := db.Exec(`
+UPDATE payout_job SET
+  status = $1,
+  updated_on = $2
+WHERE payout_job_id = $3 AND status = $4;`, to, time.Now().UTC(), jobId, from)
+	if err != nil {
+		return PayoutJob{}, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return PayoutJob{}, errors.Wrap(err, "Unable to get the updated rows")
+	}
+	if n == 0 {
+		return PayoutJob{}, ErrJobNotConfirmable{fmt.Sprintf("Payout job %d is no longer %s", jobId, from)}
+	}
+	return getJob(db, jobId)
+}
+
+func updateItem(db *sqlx.DB, item PayoutItem) error {
+	_, err := db.Exec(`
+UPDATE payout_item SET
+  status = $1,
+  payment_hash = $2,
+  payment_preimage = $3,
+  fee_msat = $4,
+  failure_reason = $5,
+  updated_on = $6
+WHERE payout_item_id = $7;`,
+		item.Status, item.PaymentHash, item.PaymentPreimage, item.FeeMsat, item.FailureReason, time.Now().UTC(),
+		item.PayoutItemId)
+	if err != nil {
+		return errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return nil
+}
+
+func completeJob(db *sqlx.DB, jobId int) error {
+	_, err := db.Exec(`
+UPDATE payout_job SET
+  status = $1,
+  fee_msat = (SELECT coalesce(sum(fee_msat), 0) FROM payout_item WHERE payout_job_id = $2),
+  updated_on = $3
+WHERE payout_job_id = $2;`, jobCompleted, jobId, time.Now().UTC())
+	if err != nil {
+		return errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return nil
+}
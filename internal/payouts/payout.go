@@ -0,0 +1,564 @@
+package payouts
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/cockroachdb/errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lncapital/torq/internal/invoices"
+	"github.com/lncapital/torq/internal/payments"
+	"github.com/lncapital/torq/internal/settings"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v4"
+	"sync"
+	"time"
+)
+
+// Payout job statuses. A job waits for confirmation after it's been validated and runs once confirmed.
+const (
+	jobPendingConfirmation = "PENDING_CONFIRMATION"
+	jobRunning             = "RUNNING"
+	jobCompleted           = "COMPLETED"
+)
+
+// Payout item statuses.
+const (
+	itemInvalid   = "INVALID"
+	itemPending   = "PENDING"
+	itemInFlight  = "IN_FLIGHT"
+	itemSucceeded = "SUCCEEDED"
+	itemFailed    = "FAILED"
+	itemSkipped   = "SKIPPED"
+)
+
+const defaultMaxConcurrency = 5
+const defaultTimeoutSecs = 60
+
+type PayoutJob struct {
+	PayoutJobId      int          `json:"payoutJobId" db:"payout_job_id"`
+	LocalNodeId      int          `json:"localNodeId" db:"local_node_id"`
+	Status           string       `json:"status" db:"status"`
+	MaxConcurrency   int          `json:"maxConcurrency" db:"max_concurrency"`
+	FeeBudgetMsat    int64        `json:"feeBudgetMsat" db:"fee_budget_msat"`
+	TimeoutSecs      int32        `json:"timeoutSecs" db:"timeout_secs"`
+	TotalAmountMsat  int64        `json:"totalAmountMsat" db:"total_amount_msat"`
+	EstimatedFeeMsat int64        `json:"estimatedFeeMsat" db:"estimated_fee_msat"`
+	FeeMsat          int64        `json:"feeMsat" db:"fee_msat"`
+	CreatedOn        time.Time    `json:"createdOn" db:"created_on"`
+	UpdateOn         null.Time    `json:"updatedOn" db:"updated_on"`
+	Items            []PayoutItem `json:"items,omitempty"`
+}
+
+type PayoutItem struct {
+	PayoutItemId      int     `json:"payoutItemId" db:"payout_item_id"`
+	PayoutJobId       int     `json:"payoutJobId" db:"payout_job_id"`
+	Invoice           *string `json:"invoice" db:"invoice"`
+	DestinationPubKey *string `json:"destinationPubKey" db:"destination_pub_key"`
+	// AmtMSat is the requested amount, AmountMsat the amount paid which can come from the invoice.
+	AmtMSat          *int64    `json:"amtMSat" db:"amt_msat"`
+	AmountMsat       int64     `json:"amountMsat" db:"amount_msat"`
+	EstimatedFeeMsat int64     `json:"estimatedFeeMsat" db:"estimated_fee_msat"`
+	ValidationError  *string   `json:"validationError" db:"validation_error"`
+	Status           string    `json:"status" db:"status"`
+	PaymentHash      *string   `json:"paymentHash" db:"payment_hash"`
+	PaymentPreimage  *string   `json:"paymentPreimage" db:"payment_preimage"`
+	FeeMsat          *int64    `json:"feeMsat" db:"fee_msat"`
+	FailureReason    *string   `json:"failureReason" db:"failure_reason"`
+	CreatedOn        time.Time `json:"createdOn" db:"created_on"`
+	UpdateOn         null.Time `json:"updatedOn" db:"updated_on"`
+}
+
+// PayoutItemRequest is either an invoice or a destination (pubkey) with an amount, which is paid with keysend.
+type PayoutItemRequest struct {
+	Invoice *string `json:"invoice"`
+	Dest    *string `json:"dest"`
+	// Required for destinations and invoices without an amount.
+	AmtMSat *int64 `json:"amtMSat"`
+}
+
+type PayoutJobRequest struct {
+	NodeId int                 `json:"nodeId"`
+	Items  []PayoutItemRequest `json:"items"`
+	// FeeBudgetMsat is the most all payments of the job can spend on fees together, it has to cover the estimated
+	// fees.
+	FeeBudgetMsat  int64 `json:"feeBudgetMsat"`
+	MaxConcurrency int   `json:"maxConcurrency"`
+	TimeoutSecs    int32 `json:"timeoutSecs"`
+}
+
+// ErrFeeBudgetTooLow is returned when the fee budget of a job doesn't cover the estimated fees of its payments.
+type ErrFeeBudgetTooLow struct {
+	FeeBudgetMsat    int64
+	EstimatedFeeMsat int64
+}
+
+func (e ErrFeeBudgetTooLow) Error() string {
+	return fmt.Sprintf("The fee budget of %d msat is below the estimated fees of %d msat", e.FeeBudgetMsat,
+		e.EstimatedFeeMsat)
+}
+
+// checkFeeBudget checks that the fee budget covers the estimated fees, otherwise payments would be skipped for the
+// used up budget.
+func checkFeeBudget(job PayoutJob) error {
+	if job.FeeBudgetMsat < job.EstimatedFeeMsat {
+		return ErrFeeBudgetTooLow{FeeBudgetMsat: job.FeeBudgetMsat, EstimatedFeeMsat: job.EstimatedFeeMsat}
+	}
+	return nil
+}
+
+// ErrJobNotConfirmable is returned when a job can't be confirmed because of its status or its items.
+type ErrJobNotConfirmable struct {
+	Reason string
+}
+
+func (e ErrJobNotConfirmable) Error() string {
+	return e.Reason
+}
+
+type decodeFunc func(invoice string) (*invoices.DecodedInvoice, error)
+type estimateFunc func(req payments.EstimateRouteRequest) (payments.EstimateRouteResponse, error)
+type payFunc func(ctx context.Context, npReq payments.NewPaymentRequest) (payments.NewPaymentResponse, error)
+type trackFunc func(ctx context.Context, paymentHash string) (payments.NewPaymentResponse, error)
+type saveFunc func(item PayoutItem) error
+
+func validateJobRequest(req PayoutJobRequest) error {
+	if req.NodeId == 0 {
+		return errors.New("Node id is missing")
+	}
+	if len(req.Items) == 0 {
+		return errors.New("A payout job needs at least one invoice or destination")
+	}
+	if req.FeeBudgetMsat < 0 {
+		return errors.New("Fee budget can't be negative")
+	}
+	if req.MaxConcurrency < 0 {
+		return errors.New("Max concurrency can't be negative")
+	}
+	return nil
+}
+
+// planItems decodes the invoices and estimates the fee of every item. Items that can't be paid get a validation
+// error instead of failing the job, so all problems are reported at once.
+func planItems(items []PayoutItemRequest, nodeId int, decode decodeFunc, estimate estimateFunc,
+	now time.Time) []PayoutItem {
+
+	r := make([]PayoutItem, 0, len(items))
+	hashes := make(map[string]bool)
+	for _, req := range items {
+		item := PayoutItem{Invoice: req.Invoice, DestinationPubKey: req.Dest, AmtMSat: req.AmtMSat,
+			Status: itemPending}
+		if req.AmtMSat != nil {
+			item.AmountMsat = *req.AmtMSat
+		}
+		validationError := planItem(&item, req, nodeId, decode, estimate, hashes, now)
+		if validationError != "" {
+			item.Status = itemInvalid
+			item.ValidationError = &validationError
+		}
+		r = append(r, item)
+	}
+	return r
+}
+
+func planItem(item *PayoutItem, req PayoutItemRequest, nodeId int, decode decodeFunc, estimate estimateFunc,
+	hashes map[string]bool, now time.Time) string {
+
+	if (req.Invoice == nil) == (req.Dest == nil) {
+		return "Either an invoice or a destination is required"
+	}
+	if req.AmtMSat != nil && *req.AmtMSat <= 0 {
+		return "Amount has to be positive"
+	}
+
+	if req.Invoice != nil {
+		di, err := decode(*req.Invoice)
+		if err != nil {
+			return "COULD_NOT_DECODE_INVOICE"
+		}
+		if time.Unix(di.CreatedAt+di.Expiry, 0).Before(now) {
+			return "INVOICE_EXPIRED"
+		}
+		if hashes[di.RHash] {
+			return "DUPLICATE_INVOICE"
+		}
+		hashes[di.RHash] = true
+		paymentHash := di.RHash
+		item.PaymentHash = &paymentHash
+		item.DestinationPubKey = &di.DestinationPubKey
+		if di.ValueMsat != 0 {
+			if req.AmtMSat != nil && *req.AmtMSat != di.ValueMsat {
+				return "AMOUNT_NOT_ALLOWED"
+			}
+			item.AmountMsat = di.ValueMsat
+		}
+	} else {
+		pubKey, err := hex.DecodeString(*req.Dest)
+		if err != nil || len(pubKey) != 33 {
+			return "Destination is not a valid public key"
+		}
+	}
+	if item.AmountMsat == 0 {
+		return "AMOUNT_REQUIRED"
+	}
+
+	estimateReq := payments.EstimateRouteRequest{NodeId: nodeId, Invoice: req.Invoice, Dest: req.Dest,
+		AmtMSat: req.AmtMSat}
+	e, err := estimate(estimateReq)
+	if err != nil {
+		return errors.Cause(err).Error()
+	}
+	item.EstimatedFeeMsat = e.FeeLimitMsat
+	return ""
+}
+
+// CreateJob validates and estimates all items of the job and stores it to wait for confirmation.
+func CreateJob(ctx context.Context, db *sqlx.DB, req PayoutJobRequest) (PayoutJob, error) {
+	if err := validateJobRequest(req); err != nil {
+		return PayoutJob{}, err
+	}
+
+	decode := func(invoice string) (*invoices.DecodedInvoice, error) {
+		return invoices.DecodeInvoice(db, invoice, req.NodeId)
+	}
+	estimate := func(er payments.EstimateRouteRequest) (payments.EstimateRouteResponse, error) {
+		return payments.EstimateRoute(ctx, db, er)
+	}
+
+	job := PayoutJob{
+		LocalNodeId:    req.NodeId,
+		Status:         jobPendingConfirmation,
+		MaxConcurrency: req.MaxConcurrency,
+		FeeBudgetMsat:  req.FeeBudgetMsat,
+		TimeoutSecs:    req.TimeoutSecs,
+		Items:          planItems(req.Items, req.NodeId, decode, estimate, time.Now()),
+	}
+	if job.MaxConcurrency == 0 {
+		job.MaxConcurrency = defaultMaxConcurrency
+	}
+	if job.TimeoutSecs == 0 {
+		job.TimeoutSecs = defaultTimeoutSecs
+	}
+	for _, item := range job.Items {
+		job.TotalAmountMsat += item.AmountMsat
+		job.EstimatedFeeMsat += item.EstimatedFeeMsat
+	}
+	if err := checkFeeBudget(job); err != nil {
+		return PayoutJob{}, err
+	}
+
+	return insertJob(db, job)
+}
+
+// ConfirmJob starts paying a job that's waiting for confirmation. The payments run in the background, their
+// progress is stored with the items of the job.
+func ConfirmJob(db *sqlx.DB, jobId int) (PayoutJob, error) {
+	job, err := getJob(db, jobId)
+	if err != nil {
+		return PayoutJob{}, err
+	}
+	if job.Status != jobPendingConfirmation {
+		return PayoutJob{}, ErrJobNotConfirmable{fmt.Sprintf("Payout job is %s and can't be confirmed", job.Status)}
+	}
+	for _, item := range job.Items {
+		if item.Status == itemInvalid {
+			return PayoutJob{}, ErrJobNotConfirmable{"Payout job has invalid items, remove them and create a new job"}
+		}
+	}
+	if err := checkFeeBudget(job); err != nil {
+		return PayoutJob{}, err
+	}
+
+	job, err = setJobStatus(db, jobId, jobPendingConfirmation, jobRunning)
+	if err != nil {
+		return PayoutJob{}, err
+	}
+
+	pay := func(ctx context.Context, npReq payments.NewPaymentRequest) (payments.NewPaymentResponse, error) {
+		return sendPayment(ctx, db, npReq)
+	}
+	track := func(ctx context.Context, paymentHash string) (payments.NewPaymentResponse, error) {
+		return payments.TrackPayment(ctx, db, job.LocalNodeId, paymentHash)
+	}
+	go func() {
+		save := func(item PayoutItem) error { return updateItem(db, item) }
+		err := runJob(context.Background(), job, pay, track, save)
+		if err != nil {
+			// Items that couldn't be saved or followed to the end stay in flight, the job is finished when Torq
+			// starts again.
+			log.Error().Err(err).Msgf("Running payout job %d", job.PayoutJobId)
+			return
+		}
+		if err := completeJob(db, job.PayoutJobId); err != nil {
+			log.Error().Err(err).Msgf("Completing payout job %d", job.PayoutJobId)
+		}
+	}()
+	return job, nil
+}
+
+// ResumeJobs finishes the jobs that were running when Torq stopped. The items that were in flight are looked up by
+// their payment hash before the pending items are paid. In read-only mode the jobs are left for the next start.
+func ResumeJobs(ctx context.Context, db *sqlx.DB) {
+	ids, err := getJobIdsWithStatus(db, jobRunning)
+	if err != nil {
+		log.Error().Err(err).Msg("Getting the running payout jobs")
+		return
+	}
+	if len(ids) != 0 && settings.IsReadOnly() {
+		log.Warn().Msgf("Torq is running in read-only mode, %d payout jobs aren't resumed", len(ids))
+		return
+	}
+
+	save := func(item PayoutItem) error { return updateItem(db, item) }
+	for _, id := range ids {
+		job, err := getJob(db, id)
+		if err != nil {
+			log.Error().Err(err).Msgf("Getting payout job %d", id)
+			continue
+		}
+		pay := func(ctx context.Context, npReq payments.NewPaymentRequest) (payments.NewPaymentResponse, error) {
+			return sendPayment(ctx, db, npReq)
+		}
+		track := func(ctx context.Context, paymentHash string) (payments.NewPaymentResponse, error) {
+			return payments.TrackPayment(ctx, db, job.LocalNodeId, paymentHash)
+		}
+		go func(job PayoutJob) {
+			log.Info().Msgf("Resuming payout job %d", job.PayoutJobId)
+			if err := resumeJob(ctx, job, pay, track, save); err != nil {
+				log.Error().Err(err).Msgf("Resuming payout job %d", job.PayoutJobId)
+				return
+			}
+			if err := completeJob(db, job.PayoutJobId); err != nil {
+				log.Error().Err(err).Msgf("Completing payout job %d", job.PayoutJobId)
+			}
+		}(job)
+	}
+}
+
+// resumeJob sets the items that were in flight to the final status of their payment and pays the pending items.
+// Items whose payment never reached LND are pending again.
+func resumeJob(ctx context.Context, job PayoutJob, pay payFunc, track trackFunc, save saveFunc) error {
+	for i, item := range job.Items {
+		if item.Status != itemInFlight {
+			continue
+		}
+		if item.PaymentHash == nil {
+			// Only jobs of older versions of Torq have items in flight without a payment hash.
+			item.Status = itemFailed
+			reason := "PAYMENT_HASH_UNKNOWN"
+			item.FailureReason = &reason
+		} else {
+			r, err := track(ctx, *item.PaymentHash)
+			switch err.(type) {
+			case nil:
+				setItemResult(&item, r, nil)
+			case payments.ErrPaymentNotInitiated:
+				item.Status = itemPending
+			default:
+				return errors.Wrapf(err, "Tracking the payment of payout item %d", item.PayoutItemId)
+			}
+		}
+		if err := save(item); err != nil {
+			return err
+		}
+		job.Items[i] = item
+	}
+	return runJob(ctx, job, pay, track, save)
+}
+
+// sendPayment pays and returns the last status of the payment.
+func sendPayment(ctx context.Context, db *sqlx.DB,
+	npReq payments.NewPaymentRequest) (last payments.NewPaymentResponse, err error) {
+
+	wChan := make(chan interface{})
+	done := make(chan struct{})
+	go func() {
+		for msg := range wChan {
+			if r, ok := msg.(payments.NewPaymentResponse); ok {
+				last = r
+			}
+		}
+		close(done)
+	}()
+	err = payments.SendNewPayment(ctx, wChan, db, nil, npReq, "")
+	close(wChan)
+	<-done
+	return last, err
+}
+
+// feeBudget hands out fee limits so that the payments of a job together never spend more than the budget. The
+// estimated fees of the payments that haven't started are kept aside, the rest of the budget is the limit of the
+// next payment. So a payment whose fee went up since the job was created can still use the unused budget.
+type feeBudget struct {
+	mu        sync.Mutex
+	remaining int64
+	// planned is the sum of the estimated fees of the payments that haven't started.
+	planned int64
+}
+
+// reserve returns the fee limit for a payment with the estimated fee. It's false when the budget is used up.
+func (b *feeBudget) reserve(estimate int64) (int64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.planned -= estimate
+	limit := b.remaining - b.planned
+	// When earlier payments used the estimates of later ones, the payment gets what's left up to its estimate.
+	if limit < estimate {
+		limit = estimate
+		if limit > b.remaining {
+			limit = b.remaining
+		}
+	}
+	if limit <= 0 && estimate > 0 {
+		return 0, false
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	b.remaining -= limit
+	return limit, true
+}
+
+// release returns what's left of a reservation once the payment is done.
+func (b *feeBudget) release(reserved int64, spent int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remaining += reserved - spent
+}
+
+// runJob pays the pending items of the job with at most MaxConcurrency payments in flight.
+func runJob(ctx context.Context, job PayoutJob, pay payFunc, track trackFunc, save saveFunc) error {
+	budget := &feeBudget{remaining: job.FeeBudgetMsat}
+	for _, item := range job.Items {
+		if item.FeeMsat != nil {
+			budget.remaining -= *item.FeeMsat
+		}
+		if item.Status == itemPending {
+			budget.planned += item.EstimatedFeeMsat
+		}
+	}
+	sem := make(chan struct{}, job.MaxConcurrency)
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	var saveErr error
+
+	for _, item := range job.Items {
+		if item.Status != itemPending {
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(item PayoutItem) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := payItem(ctx, job, item, budget, pay, track, save); err != nil {
+				errMu.Lock()
+				saveErr = err
+				errMu.Unlock()
+			}
+		}(item)
+	}
+	wg.Wait()
+	return saveErr
+}
+
+func payItem(ctx context.Context, job PayoutJob, item PayoutItem, budget *feeBudget, pay payFunc, track trackFunc,
+	save saveFunc) error {
+
+	feeLimitMsat, ok := budget.reserve(item.EstimatedFeeMsat)
+	if !ok {
+		item.Status = itemSkipped
+		reason := "FEE_BUDGET_EXHAUSTED"
+		item.FailureReason = &reason
+		return save(item)
+	}
+
+	npReq := payments.NewPaymentRequest{
+		NodeId:       job.LocalNodeId,
+		TimeOutSecs:  job.TimeoutSecs,
+		FeeLimitMsat: &feeLimitMsat,
+	}
+	if item.Invoice != nil {
+		npReq.Invoice = item.Invoice
+		npReq.AmtMSat = item.AmtMSat
+	} else {
+		npReq.Dest = item.DestinationPubKey
+		npReq.AmtMSat = &item.AmountMsat
+		// The hash is stored with the item before the payment is sent, so the payment can always be looked up.
+		preimage, hash, err := newKeysendPreimage()
+		if err != nil {
+			budget.release(feeLimitMsat, 0)
+			return err
+		}
+		npReq.KeysendPreimage = &preimage
+		item.PaymentHash = &hash
+	}
+
+	item.Status = itemInFlight
+	if err := save(item); err != nil {
+		budget.release(feeLimitMsat, 0)
+		return err
+	}
+
+	r, err := pay(ctx, npReq)
+	if item.PaymentHash == nil && r.Hash != "" {
+		item.PaymentHash = &r.Hash
+	}
+	if (err != nil || r.Status == "IN_FLIGHT") && item.PaymentHash != nil {
+		// The payment stream ended before the payment, e.g. because the connection to LND was lost. The payment
+		// can still succeed, so the item stays in flight and keeps its fee reservation until it's done.
+		tracked, trackErr := track(ctx, *item.PaymentHash)
+		switch trackErr.(type) {
+		case nil:
+			r, err = tracked, nil
+		case payments.ErrPaymentNotInitiated:
+			if err == nil {
+				err = trackErr
+			}
+		default:
+			return errors.Wrapf(trackErr, "Tracking the payment of payout item %d", item.PayoutItemId)
+		}
+	}
+
+	spent := setItemResult(&item, r, err)
+	budget.release(feeLimitMsat, spent)
+	return save(item)
+}
+
+// setItemResult sets the status of the item from the final status of its payment and returns the fee spent.
+func setItemResult(item *PayoutItem, r payments.NewPaymentResponse, err error) (spent int64) {
+	switch {
+	case err != nil:
+		item.Status = itemFailed
+		reason := err.Error()
+		item.FailureReason = &reason
+	case r.Status == "SUCCEEDED":
+		item.Status = itemSucceeded
+		spent = r.FeeMsat
+		item.FeeMsat = &spent
+	default:
+		item.Status = itemFailed
+		item.FailureReason = &r.FailureReason
+	}
+	if r.Hash != "" {
+		item.PaymentHash = &r.Hash
+	}
+	if r.Preimage != "" && item.Status == itemSucceeded {
+		item.PaymentPreimage = &r.Preimage
+	}
+	return spent
+}
+
+// newKeysendPreimage returns a random hex encoded preimage and its hash.
+func newKeysendPreimage() (preimage string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", errors.Wrap(err, "Generating keysend preimage")
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(b), hex.EncodeToString(h[:]), nil
+}
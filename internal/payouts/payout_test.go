@@ -0,0 +1,317 @@
+package payouts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/cockroachdb/errors"
+	"github.com/lncapital/torq/internal/invoices"
+	"github.com/lncapital/torq/internal/payments"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testDest = "02a5b9f2e4b4c4d1c7f4b6b0a8e3e5d9c1b2a3f4e5d6c7b8a9f0e1d2c3b4a5f6e7"
+
+func noTrack(ctx context.Context, paymentHash string) (payments.NewPaymentResponse, error) {
+	return payments.NewPaymentResponse{}, errors.New("No payment is in flight")
+}
+
+func Test_planItems(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	decoded := map[string]*invoices.DecodedInvoice{
+		"lnbc1": {DestinationPubKey: testDest, RHash: "a", ValueMsat: 1000, CreatedAt: now.Unix(), Expiry: 3600},
+		"lnbc2": {DestinationPubKey: testDest, RHash: "b", CreatedAt: now.Unix(), Expiry: 3600},
+		"lnbc3": {DestinationPubKey: testDest, RHash: "c", ValueMsat: 1000, CreatedAt: now.Unix() - 7200,
+			Expiry: 3600},
+	}
+	decode := func(invoice string) (*invoices.DecodedInvoice, error) {
+		if di, ok := decoded[invoice]; ok {
+			return di, nil
+		}
+		return nil, errors.New("checksum failed")
+	}
+	estimate := func(req payments.EstimateRouteRequest) (payments.EstimateRouteResponse, error) {
+		return payments.EstimateRouteResponse{FeeLimitMsat: 10}, nil
+	}
+
+	str := func(s string) *string { return &s }
+	amt := func(a int64) *int64 { return &a }
+	items := planItems([]PayoutItemRequest{
+		{Invoice: str("lnbc1")},
+		{Invoice: str("lnbc1")},
+		{Invoice: str("lnbc2")},
+		{Invoice: str("lnbc2"), AmtMSat: amt(500)},
+		{Invoice: str("lnbc3")},
+		{Invoice: str("bad")},
+		{Dest: str(testDest), AmtMSat: amt(2000)},
+		{Dest: str("abcd"), AmtMSat: amt(2000)},
+	}, 1, decode, estimate, now)
+
+	want := []string{"", "DUPLICATE_INVOICE", "AMOUNT_REQUIRED", "DUPLICATE_INVOICE", "INVOICE_EXPIRED",
+		"COULD_NOT_DECODE_INVOICE", "", "Destination is not a valid public key"}
+	for i, item := range items {
+		got := ""
+		if item.ValidationError != nil {
+			got = *item.ValidationError
+		}
+		if got != want[i] {
+			t.Errorf("Item %d validation error = %q, want %q", i, got, want[i])
+		}
+	}
+	if items[0].AmountMsat != 1000 || items[0].EstimatedFeeMsat != 10 || items[0].Status != itemPending ||
+		items[0].PaymentHash == nil || *items[0].PaymentHash != "a" {
+		t.Errorf("Invoice item = %+v, want the amount and hash of the invoice and the estimated fee", items[0])
+	}
+	if items[6].AmountMsat != 2000 || *items[6].DestinationPubKey != testDest {
+		t.Errorf("Keysend item = %+v, want the requested amount and destination", items[6])
+	}
+}
+
+func Test_runJobFeeBudget(t *testing.T) {
+	dest := testDest
+	job := PayoutJob{LocalNodeId: 1, MaxConcurrency: 2, FeeBudgetMsat: 25}
+	for i := 0; i < 4; i++ {
+		job.Items = append(job.Items, PayoutItem{PayoutItemId: i + 1, DestinationPubKey: &dest, AmountMsat: 1000,
+			EstimatedFeeMsat: 10, Status: itemPending})
+	}
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	pay := func(ctx context.Context, npReq payments.NewPaymentRequest) (payments.NewPaymentResponse, error) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return payments.NewPaymentResponse{Status: "SUCCEEDED", FeeMsat: *npReq.FeeLimitMsat, Hash: "hash"}, nil
+	}
+
+	saved := make(map[int]PayoutItem)
+	err := runJob(context.Background(), job, pay, noTrack, func(item PayoutItem) error {
+		mu.Lock()
+		defer mu.Unlock()
+		saved[item.PayoutItemId] = item
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("runJob() error = %v", err)
+	}
+
+	if maxInFlight > job.MaxConcurrency {
+		t.Errorf("%d payments were in flight, want at most %d", maxInFlight, job.MaxConcurrency)
+	}
+	var spent int64
+	statuses := make(map[string]int)
+	for _, item := range saved {
+		statuses[item.Status]++
+		if item.FeeMsat != nil {
+			spent += *item.FeeMsat
+		}
+	}
+	if spent > job.FeeBudgetMsat {
+		t.Errorf("Payments spent %d msat on fees, over the budget of %d", spent, job.FeeBudgetMsat)
+	}
+	if statuses[itemSucceeded] != 3 || statuses[itemSkipped] != 1 {
+		t.Errorf("Item statuses = %v, want 3 succeeded and 1 skipped for the used up budget", statuses)
+	}
+}
+
+func Test_runJobFeeLimits(t *testing.T) {
+	// The first payment can use the budget that isn't needed for the estimates of the other payments, the
+	// second what's left after the first one.
+	dest := testDest
+	job := PayoutJob{LocalNodeId: 1, MaxConcurrency: 1, FeeBudgetMsat: 100}
+	for i := 0; i < 2; i++ {
+		job.Items = append(job.Items, PayoutItem{PayoutItemId: i + 1, DestinationPubKey: &dest, AmountMsat: 1000,
+			EstimatedFeeMsat: 10, Status: itemPending})
+	}
+
+	var limits []int64
+	pay := func(ctx context.Context, npReq payments.NewPaymentRequest) (payments.NewPaymentResponse, error) {
+		limits = append(limits, *npReq.FeeLimitMsat)
+		// The fee went up since the estimate.
+		return payments.NewPaymentResponse{Status: "SUCCEEDED", FeeMsat: 30, Hash: "hash"}, nil
+	}
+	err := runJob(context.Background(), job, pay, noTrack, func(item PayoutItem) error { return nil })
+	if err != nil {
+		t.Fatalf("runJob() error = %v", err)
+	}
+	if !reflect.DeepEqual(limits, []int64{90, 70}) {
+		t.Errorf("Fee limits = %v, want [90 70]", limits)
+	}
+}
+
+func Test_payItemInFlight(t *testing.T) {
+	dest := testDest
+	job := PayoutJob{LocalNodeId: 1, FeeBudgetMsat: 100}
+	item := PayoutItem{PayoutItemId: 1, DestinationPubKey: &dest, AmountMsat: 1000, EstimatedFeeMsat: 10,
+		Status: itemPending}
+
+	var preimage string
+	// The payment stream ends while the payment is in flight.
+	pay := func(ctx context.Context, npReq payments.NewPaymentRequest) (payments.NewPaymentResponse, error) {
+		preimage = *npReq.KeysendPreimage
+		return payments.NewPaymentResponse{Status: "IN_FLIGHT"}, errors.New("UNKNOWN_ERROR")
+	}
+
+	tests := []struct {
+		name          string
+		track         trackFunc
+		wantErr       bool
+		wantStatus    string
+		wantRemaining int64
+	}{
+		{
+			"Succeeds later",
+			func(ctx context.Context, paymentHash string) (payments.NewPaymentResponse, error) {
+				return payments.NewPaymentResponse{Status: "SUCCEEDED", FeeMsat: 30, Hash: paymentHash}, nil
+			},
+			false, itemSucceeded, 70,
+		},
+		{
+			"Never reached LND",
+			func(ctx context.Context, paymentHash string) (payments.NewPaymentResponse, error) {
+				return payments.NewPaymentResponse{}, payments.ErrPaymentNotInitiated{PaymentHash: paymentHash}
+			},
+			false, itemFailed, 100,
+		},
+		{
+			// The fee limit of the payment stays reserved, it can still be spent.
+			"Can't be followed",
+			func(ctx context.Context, paymentHash string) (payments.NewPaymentResponse, error) {
+				return payments.NewPaymentResponse{}, errors.New("connection refused")
+			},
+			true, itemInFlight, 0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			budget := &feeBudget{remaining: job.FeeBudgetMsat, planned: item.EstimatedFeeMsat}
+			var saved []PayoutItem
+			save := func(item PayoutItem) error {
+				saved = append(saved, item)
+				return nil
+			}
+			err := payItem(context.Background(), job, item, budget, pay, test.track, save)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("payItem() error = %v, wantErr %v", err, test.wantErr)
+			}
+
+			if saved[0].Status != itemInFlight || saved[0].PaymentHash == nil {
+				t.Fatalf("First saved item = %+v, want in flight with the payment hash", saved[0])
+			}
+			b, _ := hex.DecodeString(preimage)
+			hash := sha256.Sum256(b)
+			if *saved[0].PaymentHash != hex.EncodeToString(hash[:]) {
+				t.Errorf("Payment hash %s is not the hash of the keysend preimage %s", *saved[0].PaymentHash,
+					preimage)
+			}
+			if last := saved[len(saved)-1]; last.Status != test.wantStatus {
+				t.Errorf("Item status = %s, want %s", last.Status, test.wantStatus)
+			}
+			if budget.remaining != test.wantRemaining {
+				t.Errorf("Remaining budget = %d, want %d", budget.remaining, test.wantRemaining)
+			}
+		})
+	}
+}
+
+func Test_resumeJob(t *testing.T) {
+	dest := testDest
+	str := func(s string) *string { return &s }
+	fee := func(f int64) *int64 { return &f }
+	job := PayoutJob{LocalNodeId: 1, MaxConcurrency: 1, FeeBudgetMsat: 100, Items: []PayoutItem{
+		{PayoutItemId: 1, Invoice: str("lnbc1"), PaymentHash: str("settled"), EstimatedFeeMsat: 10,
+			Status: itemInFlight},
+		{PayoutItemId: 2, Invoice: str("lnbc2"), PaymentHash: str("unknown"), EstimatedFeeMsat: 10,
+			Status: itemInFlight},
+		{PayoutItemId: 3, DestinationPubKey: &dest, AmountMsat: 1000, EstimatedFeeMsat: 10, Status: itemInFlight},
+		{PayoutItemId: 4, DestinationPubKey: &dest, AmountMsat: 1000, EstimatedFeeMsat: 10, Status: itemPending},
+		{PayoutItemId: 5, Invoice: str("lnbc5"), PaymentHash: str("paid"), FeeMsat: fee(20),
+			Status: itemSucceeded},
+	}}
+
+	track := func(ctx context.Context, paymentHash string) (payments.NewPaymentResponse, error) {
+		if paymentHash == "settled" {
+			return payments.NewPaymentResponse{Status: "SUCCEEDED", FeeMsat: 30, Hash: paymentHash}, nil
+		}
+		return payments.NewPaymentResponse{}, payments.ErrPaymentNotInitiated{PaymentHash: paymentHash}
+	}
+	var limits []int64
+	pay := func(ctx context.Context, npReq payments.NewPaymentRequest) (payments.NewPaymentResponse, error) {
+		limits = append(limits, *npReq.FeeLimitMsat)
+		return payments.NewPaymentResponse{Status: "SUCCEEDED", FeeMsat: 5}, nil
+	}
+	saved := make(map[int]PayoutItem)
+	save := func(item PayoutItem) error {
+		saved[item.PayoutItemId] = item
+		return nil
+	}
+
+	if err := resumeJob(context.Background(), job, pay, track, save); err != nil {
+		t.Fatalf("resumeJob() error = %v", err)
+	}
+
+	want := map[int]string{1: itemSucceeded, 2: itemSucceeded, 3: itemFailed, 4: itemSucceeded}
+	for id, status := range want {
+		if saved[id].Status != status {
+			t.Errorf("Item %d status = %s, want %s", id, saved[id].Status, status)
+		}
+	}
+	if _, ok := saved[5]; ok {
+		t.Errorf("Item 5 was already paid and shouldn't be saved again")
+	}
+	// The fees of the settled payments (20 and 30) are taken from the budget before the pending items are paid.
+	if !reflect.DeepEqual(limits, []int64{40, 45}) {
+		t.Errorf("Fee limits = %v, want [40 45]", limits)
+	}
+}
+
+func Test_checkFeeBudget(t *testing.T) {
+	tests := []struct {
+		name    string
+		job     PayoutJob
+		wantErr bool
+	}{
+		{"No budget", PayoutJob{EstimatedFeeMsat: 10}, true},
+		{"Budget below the estimate", PayoutJob{FeeBudgetMsat: 9, EstimatedFeeMsat: 10}, true},
+		{"Budget covers the estimate", PayoutJob{FeeBudgetMsat: 10, EstimatedFeeMsat: 10}, false},
+		{"No fees", PayoutJob{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := checkFeeBudget(test.job); (err != nil) != test.wantErr {
+				t.Errorf("checkFeeBudget() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func Test_parseItemsCsv(t *testing.T) {
+	items, err := parseItemsCsv(strings.NewReader("invoice,dest,amt_msat\nlnbc1,,\n," + testDest + ",2000\n"))
+	if err != nil {
+		t.Fatalf("parseItemsCsv() error = %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Got %d items, want 2", len(items))
+	}
+	if *items[0].Invoice != "lnbc1" || items[0].Dest != nil || items[0].AmtMSat != nil {
+		t.Errorf("Invoice item = %+v", items[0])
+	}
+	if items[1].Invoice != nil || *items[1].Dest != testDest || *items[1].AmtMSat != 2000 {
+		t.Errorf("Keysend item = %+v", items[1])
+	}
+
+	if _, err = parseItemsCsv(strings.NewReader("amount\n1000\n")); err == nil {
+		t.Errorf("parseItemsCsv() accepted CSV without invoice or dest column")
+	}
+}
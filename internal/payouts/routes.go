@@ -0,0 +1,136 @@
+package payouts
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lncapital/torq/pkg/server_errors"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"strconv"
+)
+
+func RegisterPayoutRoutes(r *gin.RouterGroup, db *sqlx.DB) {
+	r.GET("", func(c *gin.Context) { getJobsHandler(c, db) })
+	r.POST("", func(c *gin.Context) { postJobHandler(c, db) })
+	r.GET(":payoutJobId", func(c *gin.Context) { getJobHandler(c, db) })
+	r.POST(":payoutJobId/confirm", func(c *gin.Context) { confirmJobHandler(c, db) })
+	r.GET(":payoutJobId/report", func(c *gin.Context) { getReportHandler(c, db) })
+}
+
+func getJobsHandler(c *gin.Context, db *sqlx.DB) {
+	jobs, err := getJobs(db)
+	if err != nil {
+		server_errors.LogAndSendServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, jobs)
+}
+
+// postJobHandler validates a new payout job. The items are either part of the JSON body or a CSV body, in which
+// case the other job settings are query parameters.
+func postJobHandler(c *gin.Context, db *sqlx.DB) {
+	var req PayoutJobRequest
+	if c.ContentType() == "text/csv" {
+		var err error
+		req.Items, err = parseItemsCsv(c.Request.Body)
+		if err != nil {
+			server_errors.SendBadRequestFromError(c, err)
+			return
+		}
+		req.NodeId, _ = strconv.Atoi(c.Query("nodeId"))
+		req.MaxConcurrency, _ = strconv.Atoi(c.Query("maxConcurrency"))
+		req.FeeBudgetMsat, _ = strconv.ParseInt(c.Query("feeBudgetMsat"), 10, 64)
+		timeoutSecs, _ := strconv.ParseInt(c.Query("timeoutSecs"), 10, 32)
+		req.TimeoutSecs = int32(timeoutSecs)
+	} else if err := c.BindJSON(&req); err != nil {
+		server_errors.SendBadRequestFromError(c, err)
+		return
+	}
+
+	if err := validateJobRequest(req); err != nil {
+		server_errors.SendUnprocessableEntityFromError(c, err)
+		return
+	}
+	job, err := CreateJob(c.Request.Context(), db, req)
+	switch err.(type) {
+	case nil:
+		break
+	case ErrFeeBudgetTooLow:
+		server_errors.SendUnprocessableEntityFromError(c, err)
+		return
+	default:
+		server_errors.LogAndSendServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+func getJobHandler(c *gin.Context, db *sqlx.DB) {
+	jobId, err := strconv.Atoi(c.Param("payoutJobId"))
+	if err != nil {
+		server_errors.SendBadRequest(c, "Payout job id must be a number")
+		return
+	}
+	job, err := getJob(db, jobId)
+	switch err.(type) {
+	case nil:
+		break
+	case ErrPayoutJobNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"Error": err.Error(), "Identifier": c.Param("payoutJobId")})
+		return
+	default:
+		server_errors.LogAndSendServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+func confirmJobHandler(c *gin.Context, db *sqlx.DB) {
+	jobId, err := strconv.Atoi(c.Param("payoutJobId"))
+	if err != nil {
+		server_errors.SendBadRequest(c, "Payout job id must be a number")
+		return
+	}
+	job, err := ConfirmJob(db, jobId)
+	switch err.(type) {
+	case nil:
+		break
+	case ErrPayoutJobNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"Error": err.Error(), "Identifier": c.Param("payoutJobId")})
+		return
+	case ErrJobNotConfirmable, ErrFeeBudgetTooLow:
+		server_errors.SendUnprocessableEntityFromError(c, err)
+		return
+	default:
+		server_errors.LogAndSendServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+func getReportHandler(c *gin.Context, db *sqlx.DB) {
+	jobId, err := strconv.Atoi(c.Param("payoutJobId"))
+	if err != nil {
+		server_errors.SendBadRequest(c, "Payout job id must be a number")
+		return
+	}
+	job, err := getJob(db, jobId)
+	switch err.(type) {
+	case nil:
+		break
+	case ErrPayoutJobNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"Error": err.Error(), "Identifier": c.Param("payoutJobId")})
+		return
+	default:
+		server_errors.LogAndSendServerError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=payout-%d.csv", jobId))
+	c.Header("Content-Type", "text/csv")
+	c.Status(http.StatusOK)
+	if err := writeReport(c.Writer, job); err != nil {
+		log.Error().Err(err).Msgf("Writing report of payout job %d", jobId)
+	}
+}
@@ -0,0 +1,123 @@
+package pubsub
+
+import (
+	"sync"
+)
+
+// The topics events are published on.
+const (
+	TopicForwards      = "forwards"
+	TopicHtlcEvents    = "htlcEvents"
+	TopicChannelEvents = "channelEvents"
+	TopicInvoices      = "invoices"
+	TopicPayments      = "payments"
+	TopicTransactions  = "transactions"
+	TopicPolicyUpdates = "policyUpdates"
+)
+
+// IsValidTopic returns true when events are published on the topic.
+func IsValidTopic(topic string) bool {
+	switch topic {
+	case TopicForwards, TopicHtlcEvents, TopicChannelEvents, TopicInvoices, TopicPayments,
+		TopicTransactions, TopicPolicyUpdates:
+		return true
+	default:
+		return false
+	}
+}
+
+// Event is published after the data has been stored in the database.
+type Event struct {
+	Topic       string `json:"topic"`
+	LocalNodeId int    `json:"localNodeId"`
+	// The LND short channel ids the event relates to, used for filtering. Empty when the event is not
+	// related to a channel, e.g. on-chain transactions.
+	ChannelIds []uint64    `json:"channelIds,omitempty"`
+	Data       interface{} `json:"data"`
+}
+
+// Filter selects the events of a subscription. A zero LocalNodeId or ChannelId matches all nodes or
+// channels.
+type Filter struct {
+	Topic       string `json:"topic"`
+	LocalNodeId int    `json:"localNodeId"`
+	ChannelId   uint64 `json:"channelId"`
+}
+
+func (f Filter) matches(e Event) bool {
+	if f.Topic != e.Topic {
+		return false
+	}
+	if f.LocalNodeId != 0 && f.LocalNodeId != e.LocalNodeId {
+		return false
+	}
+	if f.ChannelId == 0 {
+		return true
+	}
+	for _, chanId := range e.ChannelIds {
+		if chanId == f.ChannelId {
+			return true
+		}
+	}
+	return false
+}
+
+type Subscription struct {
+	Filter Filter
+	// Events receives the matching events. It's closed when the subscription is removed.
+	Events chan Event
+}
+
+// Bus fans out published events to the subscriptions with a matching filter.
+type Bus struct {
+	mu            sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{subscriptions: make(map[*Subscription]struct{})}
+}
+
+// Subscribe adds a subscription. Up to buffer events are queued for a subscriber that's not keeping up,
+// after that events are dropped for that subscriber so that storing data is never blocked.
+func (b *Bus) Subscribe(filter Filter, buffer int) *Subscription {
+	s := &Subscription{Filter: filter, Events: make(chan Event, buffer)}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions[s] = struct{}{}
+	return s
+}
+
+// Unsubscribe removes the subscription and closes its events channel. Removing a subscription twice
+// is a no-op.
+func (b *Bus) Unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, exists := b.subscriptions[s]; !exists {
+		return
+	}
+	delete(b.subscriptions, s)
+	close(s.Events)
+}
+
+func (b *Bus) Publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subscriptions {
+		if !s.Filter.matches(e) {
+			continue
+		}
+		select {
+		case s.Events <- e:
+		default:
+		}
+	}
+}
+
+// DefaultBus is the bus the LND subscriptions publish on.
+var DefaultBus = NewBus()
+
+// Publish publishes an event on the default bus.
+func Publish(e Event) {
+	DefaultBus.Publish(e)
+}
@@ -0,0 +1,52 @@
+package pubsub
+
+import (
+	"testing"
+)
+
+func TestBus(t *testing.T) {
+	b := NewBus()
+
+	all := b.Subscribe(Filter{Topic: TopicForwards}, 10)
+	node := b.Subscribe(Filter{Topic: TopicForwards, LocalNodeId: 2}, 10)
+	channel := b.Subscribe(Filter{Topic: TopicForwards, ChannelId: 42}, 10)
+	invoices := b.Subscribe(Filter{Topic: TopicInvoices}, 10)
+
+	b.Publish(Event{Topic: TopicForwards, LocalNodeId: 1, ChannelIds: []uint64{41, 42}})
+	b.Publish(Event{Topic: TopicForwards, LocalNodeId: 2, ChannelIds: []uint64{43, 44}})
+
+	tests := []struct {
+		name string
+		sub  *Subscription
+		want int
+	}{
+		{"all forwards", all, 2},
+		{"node filter", node, 1},
+		{"channel filter", channel, 1},
+		{"other topic", invoices, 0},
+	}
+	for _, tt := range tests {
+		if got := len(tt.sub.Events); got != tt.want {
+			t.Errorf("%s: got %d events, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	b.Unsubscribe(all)
+	for range all.Events {
+		// Drain the queued events, the loop ends when the channel is closed.
+	}
+	// Unsubscribing twice must not panic on closing the channel again.
+	b.Unsubscribe(all)
+}
+
+func TestBusDropsWhenFull(t *testing.T) {
+	b := NewBus()
+	s := b.Subscribe(Filter{Topic: TopicPayments}, 1)
+
+	b.Publish(Event{Topic: TopicPayments})
+	b.Publish(Event{Topic: TopicPayments})
+
+	if got := len(s.Events); got != 1 {
+		t.Errorf("got %d queued events, want 1", got)
+	}
+}
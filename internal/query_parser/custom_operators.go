@@ -2,6 +2,8 @@ package query_parser
 
 import (
 	"fmt"
+	"regexp"
+
 	sq "github.com/Masterminds/squirrel"
 )
 
@@ -39,3 +41,79 @@ func Overlap(param interface{}, key string, notEq bool) (r sq.Sqlizer, err error
 			"float or an array of string or float", param)
 	}
 }
+
+// Between checks if the value of a column is within an inclusive range. The parameter must be a list
+// of exactly two values.
+func Between(param interface{}, key string) (r sq.Sqlizer, err error) {
+	l, ok := param.([]interface{})
+	if !ok || len(l) != 2 {
+		return r, ErrInvalidFilter{Key: key, Reason: "between requires a list of exactly two values"}
+	}
+	return sq.Expr(fmt.Sprintf("%s BETWEEN ? AND ?", key), l[0], l[1]), nil
+}
+
+// Regex is a case-sensitive POSIX regular expression match (SQL operator ~). The pattern is checked with
+// the Go regexp syntax, which matches the Postgres syntax apart from back references and lookaheads.
+func Regex(param interface{}, key string, notMatch bool) (r sq.Sqlizer, err error) {
+	s, ok := param.(string)
+	if !ok {
+		return r, ErrInvalidFilter{Key: key, Reason: "regex requires a string parameter"}
+	}
+	if _, err = regexp.Compile(s); err != nil {
+		return r, ErrInvalidFilter{Key: key, Reason: fmt.Sprintf("invalid regular expression: %v", err)}
+	}
+	if notMatch {
+		return sq.Expr(fmt.Sprintf("%s !~ ?", key), s), nil
+	}
+	return sq.Expr(fmt.Sprintf("%s ~ ?", key), s), nil
+}
+
+var relativeDateUnits = map[string]bool{
+	"minutes": true,
+	"hours":   true,
+	"days":    true,
+	"weeks":   true,
+	"months":  true,
+}
+
+// parseRelativeDate reads a parameter on the form {"value": 7, "unit": "days"}.
+func parseRelativeDate(param interface{}) (value int, unit string, err error) {
+	m, ok := param.(map[string]interface{})
+	if !ok {
+		return 0, "", fmt.Errorf(`relative dates require a parameter like {"value": 7, "unit": "days"}`)
+	}
+	v, ok := m["value"].(float64)
+	if !ok || v <= 0 || v != float64(int(v)) {
+		return 0, "", fmt.Errorf("relative date value must be a positive whole number")
+	}
+	unit, ok = m["unit"].(string)
+	if !ok || !relativeDateUnits[unit] {
+		return 0, "", fmt.Errorf("relative date unit must be one of minutes, hours, days, weeks or months")
+	}
+	return int(v), unit, nil
+}
+
+// WithinLast checks if a date column is within the last N minutes, hours, days, weeks or months.
+// Minutes and hours are rolling windows from now. Days, weeks and months are counted from the start
+// of the current day in the preferred timezone from the settings, so "within last 7 days" includes
+// today and the 7 whole days before it.
+func WithinLast(param interface{}, key string, notWithin bool) (r sq.Sqlizer, err error) {
+	value, unit, err := parseRelativeDate(param)
+	if err != nil {
+		return r, ErrInvalidFilter{Key: key, Reason: err.Error()}
+	}
+
+	var opr = ">="
+	if notWithin {
+		opr = "<"
+	}
+
+	interval := fmt.Sprintf("%d %s", value, unit)
+
+	if unit == "minutes" || unit == "hours" {
+		return sq.Expr(fmt.Sprintf("%s %s (now() - ?::interval)", key, opr), interval), nil
+	}
+
+	return sq.Expr(fmt.Sprintf(`%s %s ((date_trunc('day', now() AT TIME ZONE (select preferred_timezone from settings limit 1))
+		- ?::interval) AT TIME ZONE (select preferred_timezone from settings limit 1))`, key, opr), interval), nil
+}
@@ -35,6 +35,12 @@ import (
 //    {"$filter":{"funcName":"lt","key":"amount_msat","parameter":1000}}
 //   ]}
 // ]}
+//
+// Example 5 (relative date, using the preferred timezone from the settings):
+// {"$filter":{"funcName":"withinLast","key":"date","parameter":{"value":7,"unit":"days"}}}
+//
+// Example 6:
+// {"$filter":{"funcName":"between","key":"amount_msat","parameter":[1000, 2000]}}
 
 func ParseFilterParam(params string, allowedColumns []string) (f sq.Sqlizer, err error) {
 
@@ -55,11 +61,37 @@ func ParseFilterParam(params string, allowedColumns []string) (f sq.Sqlizer, err
 	return f, nil
 }
 
+// ParseFilterParamWithSchema works like ParseFilterParam, but also validates that the filter
+// functions and parameters match the type of each column. Invalid filters are returned as
+// ErrInvalidFilter, so that they can be reported as a bad request instead of failing in SQL.
+func ParseFilterParamWithSchema(params string, schema ColumnSchema) (f sq.Sqlizer, err error) {
+
+	filters := FilterClauses{}
+	err = json.Unmarshal([]byte(params), &filters)
+	if err != nil {
+		return f, err
+	}
+
+	qp := NewSchemaParser(schema)
+	f, err = qp.ParseFilterClauses(filters)
+	if err != nil {
+		return f, err
+	}
+
+	return f, nil
+}
+
 type FilterClauses struct {
 	And    []FilterClauses `json:"$and"`
 	Or     []FilterClauses `json:"$or"`
 	Filter Filter          `json:"$filter"`
 }
+
+// IsEmpty is true when the clauses don't contain any filter, e.g. {"$and":[]}.
+func (f FilterClauses) IsEmpty() bool {
+	return len(f.And) == 0 && len(f.Or) == 0 && f.Filter.Key == ""
+}
+
 type Parameter string
 
 type Filter struct {
@@ -71,11 +103,35 @@ type Filter struct {
 func (qp *QueryParser) ParseFilter(f Filter) (r sq.Sqlizer, err error) {
 
 	if !qp.IsAllowed(f.Key) {
-		return r,
-			fmt.Errorf("filtering by %s is not allwed. Try one of: %v",
+		return r, ErrInvalidFilter{
+			Key: f.Key,
+			Reason: fmt.Sprintf("filtering by %s is not allwed. Try one of: %v",
 				f.Key,
 				strings.Join(qp.AllowedColumns, ", "),
-			)
+			),
+		}
+	}
+
+	// Validate the function and parameter against the column type when a schema is provided.
+	if qp.Schema != nil {
+		err = validateFilter(f, qp.Schema[f.Key])
+		if err != nil {
+			return r, err
+		}
+	}
+
+	// Functions that don't use the parameter, or need it in its original JSON form.
+	switch f.FuncName {
+	case "isNull":
+		return sq.Eq{f.Key: nil}, nil
+	case "isNotNull":
+		return sq.NotEq{f.Key: nil}, nil
+	case "between":
+		return Between(f.Parameter, f.Key)
+	case "withinLast":
+		return WithinLast(f.Parameter, f.Key, false)
+	case "notWithinLast":
+		return WithinLast(f.Parameter, f.Key, true)
 	}
 
 	param := f.Parameter
@@ -96,7 +152,7 @@ func (qp *QueryParser) ParseFilter(f Filter) (r sq.Sqlizer, err error) {
 		param = paramList
 		break
 	default:
-		return r, fmt.Errorf("unsupported parameter type: %T", f.Parameter)
+		return r, ErrInvalidFilter{Key: f.Key, Reason: fmt.Sprintf("unsupported parameter type: %T", f.Parameter)}
 	}
 
 	switch f.FuncName {
@@ -116,12 +172,26 @@ func (qp *QueryParser) ParseFilter(f Filter) (r sq.Sqlizer, err error) {
 		return sq.ILike{f.Key: "%" + fmt.Sprintf("%v", param) + "%"}, nil
 	case "notLike":
 		return sq.NotILike{f.Key: "%" + fmt.Sprintf("%v", param) + "%"}, nil
+	case "regex":
+		return Regex(param, f.Key, false)
+	case "notRegex":
+		return Regex(param, f.Key, true)
+	case "in":
+		if _, ok := param.([]string); !ok {
+			return r, ErrInvalidFilter{Key: f.Key, Reason: "in requires a list of values"}
+		}
+		return sq.Eq{f.Key: param}, nil
+	case "notIn":
+		if _, ok := param.([]string); !ok {
+			return r, ErrInvalidFilter{Key: f.Key, Reason: "notIn requires a list of values"}
+		}
+		return sq.NotEq{f.Key: param}, nil
 	case "any":
 		return Overlap(param, f.Key, false)
 	case "notAny":
 		return Overlap(param, f.Key, true)
 	default:
-		return r, fmt.Errorf("%s is not a valid filter function", f.FuncName)
+		return r, ErrInvalidFilter{Key: f.Key, Reason: fmt.Sprintf("%s is not a valid filter function", f.FuncName)}
 	}
 }
 
@@ -0,0 +1,192 @@
+package query_parser
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+var testSchema = ColumnSchema{
+	"date":           DateColumn,
+	"amount_msat":    NumberColumn,
+	"status":         StringColumn,
+	"is_rebalance":   BooleanColumn,
+	"dest_addresses": ArrayColumn,
+}
+
+func TestParseFilterParamWithSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		wantSql  string
+		wantArgs []interface{}
+		wantKey  string
+	}{
+		{
+			name:     "between",
+			input:    `{"$filter":{"funcName":"between","key":"amount_msat","parameter":[1000, 2000]}}`,
+			wantSql:  "amount_msat BETWEEN ? AND ?",
+			wantArgs: []interface{}{float64(1000), float64(2000)},
+		},
+		{
+			name:     "in",
+			input:    `{"$filter":{"funcName":"in","key":"status","parameter":["SUCCEEDED", "FAILED"]}}`,
+			wantSql:  "status IN (?,?)",
+			wantArgs: []interface{}{"SUCCEEDED", "FAILED"},
+		},
+		{
+			name:     "not in",
+			input:    `{"$filter":{"funcName":"notIn","key":"amount_msat","parameter":[1, 2]}}`,
+			wantSql:  "amount_msat NOT IN (?,?)",
+			wantArgs: []interface{}{"1", "2"},
+		},
+		{
+			name:    "is null",
+			input:   `{"$filter":{"funcName":"isNull","key":"is_rebalance"}}`,
+			wantSql: "is_rebalance IS NULL",
+		},
+		{
+			name:    "is not null",
+			input:   `{"$filter":{"funcName":"isNotNull","key":"date"}}`,
+			wantSql: "date IS NOT NULL",
+		},
+		{
+			name:     "regex",
+			input:    `{"$filter":{"funcName":"regex","key":"status","parameter":"^SUC"}}`,
+			wantSql:  "status ~ ?",
+			wantArgs: []interface{}{"^SUC"},
+		},
+		{
+			name:     "within last hours",
+			input:    `{"$filter":{"funcName":"withinLast","key":"date","parameter":{"value":12,"unit":"hours"}}}`,
+			wantSql:  "date >= (now() - ?::interval)",
+			wantArgs: []interface{}{"12 hours"},
+		},
+		{
+			name: "and",
+			input: `{"$and":[
+				{"$filter":{"funcName":"eq","key":"status","parameter":"SUCCEEDED"}},
+				{"$filter":{"funcName":"gte","key":"amount_msat","parameter":2000}}
+			]}`,
+			wantSql:  "(status = ? AND amount_msat >= ?)",
+			wantArgs: []interface{}{"SUCCEEDED", float64(2000)},
+		},
+		{
+			name:    "unknown column",
+			input:   `{"$filter":{"funcName":"eq","key":"fee","parameter":1}}`,
+			wantKey: "fee",
+		},
+		{
+			name:    "wrong parameter type",
+			input:   `{"$filter":{"funcName":"gt","key":"amount_msat","parameter":"abc"}}`,
+			wantKey: "amount_msat",
+		},
+		{
+			name:    "function not allowed for column type",
+			input:   `{"$filter":{"funcName":"like","key":"is_rebalance","parameter":"true"}}`,
+			wantKey: "is_rebalance",
+		},
+		{
+			name:    "between with one value",
+			input:   `{"$filter":{"funcName":"between","key":"amount_msat","parameter":[1000]}}`,
+			wantKey: "amount_msat",
+		},
+		{
+			name:    "invalid date",
+			input:   `{"$filter":{"funcName":"gte","key":"date","parameter":"yesterday"}}`,
+			wantKey: "date",
+		},
+		{
+			name:    "invalid regex",
+			input:   `{"$filter":{"funcName":"notRegex","key":"status","parameter":"(SUC"}}`,
+			wantKey: "status",
+		},
+		{
+			name:    "invalid relative date unit",
+			input:   `{"$filter":{"funcName":"withinLast","key":"date","parameter":{"value":7,"unit":"fortnights"}}}`,
+			wantKey: "date",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := ParseFilterParamWithSchema(test.input, testSchema)
+
+			if test.wantKey != "" {
+				e, ok := err.(ErrInvalidFilter)
+				if !ok {
+					t.Fatalf("expected ErrInvalidFilter, got %v", err)
+				}
+				if e.Key != test.wantKey {
+					t.Errorf("expected key %s, got %s", test.wantKey, e.Key)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got, args, err := f.ToSql()
+			if err != nil {
+				t.Fatalf("ToSql: %v", err)
+			}
+			if got != test.wantSql {
+				t.Errorf("\nGot:\n%s\nWant:\n%s\n", got, test.wantSql)
+			}
+			if len(args) != 0 || len(test.wantArgs) != 0 {
+				if !reflect.DeepEqual(args, test.wantArgs) {
+					t.Errorf("\nGot args:\n%v\nWant args:\n%v\n", args, test.wantArgs)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFilterWithoutSchema(t *testing.T) {
+	// Parsers without a schema keep accepting any function on allowed columns.
+	filters := FilterClauses{}
+	err := json.Unmarshal([]byte(`{"$filter":{"funcName":"like","key":"status","parameter":"SUC"}}`), &filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewParser([]string{"status"}).ParseFilterClauses(filters)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(f, sq.ILike{"status": "%SUC%"}) {
+		t.Errorf("unexpected filter: %v", f)
+	}
+}
+
+func TestParseFilterWithoutSchemaInvalid(t *testing.T) {
+	// Invalid parameters are reported with the key even when there is no schema to validate against.
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"between", `{"$filter":{"funcName":"between","key":"status","parameter":["a"]}}`},
+		{"regex", `{"$filter":{"funcName":"regex","key":"status","parameter":"[SUC"}}`},
+		{"withinLast", `{"$filter":{"funcName":"withinLast","key":"status","parameter":{"value":-1,"unit":"days"}}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filters := FilterClauses{}
+			if err := json.Unmarshal([]byte(test.input), &filters); err != nil {
+				t.Fatal(err)
+			}
+			_, err := NewParser([]string{"status"}).ParseFilterClauses(filters)
+			e, ok := err.(ErrInvalidFilter)
+			if !ok {
+				t.Fatalf("expected ErrInvalidFilter, got %v", err)
+			}
+			if e.Key != "status" {
+				t.Errorf("expected key status, got %s", e.Key)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package query_parser
 
 type QueryParser struct {
 	AllowedColumns []string
+	// Schema is optional. When set it is used to validate filters against the column types.
+	Schema ColumnSchema
 }
 
 func NewParser(allowedColumns []string) *QueryParser {
@@ -10,6 +12,13 @@ func NewParser(allowedColumns []string) *QueryParser {
 	}
 }
 
+func NewSchemaParser(schema ColumnSchema) *QueryParser {
+	return &QueryParser{
+		AllowedColumns: schema.Columns(),
+		Schema:         schema,
+	}
+}
+
 func (qp *QueryParser) IsAllowed(c string) bool {
 	for _, ac := range qp.AllowedColumns {
 		if ac == c {
@@ -0,0 +1,168 @@
+package query_parser
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ColumnType describes the type of value stored in a filterable column. It is used to validate
+// filter functions and parameters before they are turned into SQL.
+type ColumnType int
+
+const (
+	StringColumn ColumnType = iota
+	NumberColumn
+	BooleanColumn
+	DateColumn
+	ArrayColumn
+)
+
+func (ct ColumnType) String() string {
+	switch ct {
+	case StringColumn:
+		return "string"
+	case NumberColumn:
+		return "number"
+	case BooleanColumn:
+		return "boolean"
+	case DateColumn:
+		return "date"
+	case ArrayColumn:
+		return "array"
+	default:
+		return "unknown"
+	}
+}
+
+// ColumnSchema maps the filterable columns of a table to their type.
+type ColumnSchema map[string]ColumnType
+
+// Columns returns the (sorted) names of all the columns in the schema.
+func (s ColumnSchema) Columns() []string {
+	var columns []string
+	for c := range s {
+		columns = append(columns, c)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// ErrInvalidFilter is returned when a filter can't be applied to a column, either because the
+// column is unknown or because the function or parameter does not match the column type.
+type ErrInvalidFilter struct {
+	Key    string
+	Reason string
+}
+
+func (e ErrInvalidFilter) Error() string {
+	return fmt.Sprintf("invalid filter on %s: %s", e.Key, e.Reason)
+}
+
+// allowedFunctions lists which filter functions can be used on each column type.
+var allowedFunctions = map[ColumnType][]string{
+	StringColumn:  {"eq", "neq", "like", "notLike", "regex", "notRegex", "in", "notIn", "isNull", "isNotNull"},
+	NumberColumn:  {"eq", "neq", "gt", "gte", "lt", "lte", "between", "in", "notIn", "isNull", "isNotNull"},
+	BooleanColumn: {"eq", "neq", "isNull", "isNotNull"},
+	DateColumn: {"eq", "neq", "gt", "gte", "lt", "lte", "between", "withinLast", "notWithinLast",
+		"isNull", "isNotNull"},
+	ArrayColumn: {"any", "notAny", "isNull", "isNotNull"},
+}
+
+// validateFilter checks the filter function and parameter against the column type.
+func validateFilter(f Filter, ct ColumnType) error {
+
+	allowed := false
+	for _, fn := range allowedFunctions[ct] {
+		if fn == f.FuncName {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return ErrInvalidFilter{Key: f.Key,
+			Reason: fmt.Sprintf("%s can't be used on a %s column", f.FuncName, ct)}
+	}
+
+	switch f.FuncName {
+	case "isNull", "isNotNull":
+		return nil
+	case "withinLast", "notWithinLast":
+		if _, _, err := parseRelativeDate(f.Parameter); err != nil {
+			return ErrInvalidFilter{Key: f.Key, Reason: err.Error()}
+		}
+		return nil
+	case "between":
+		l, ok := f.Parameter.([]interface{})
+		if !ok || len(l) != 2 {
+			return ErrInvalidFilter{Key: f.Key, Reason: "between requires a list of exactly two values"}
+		}
+		for _, v := range l {
+			if err := validateValue(v, ct); err != nil {
+				return ErrInvalidFilter{Key: f.Key, Reason: err.Error()}
+			}
+		}
+		return nil
+	case "in", "notIn":
+		l, ok := f.Parameter.([]interface{})
+		if !ok || len(l) == 0 {
+			return ErrInvalidFilter{Key: f.Key, Reason: f.FuncName + " requires a non empty list of values"}
+		}
+		for _, v := range l {
+			if err := validateValue(v, ct); err != nil {
+				return ErrInvalidFilter{Key: f.Key, Reason: err.Error()}
+			}
+		}
+		return nil
+	case "any", "notAny":
+		switch p := f.Parameter.(type) {
+		case string, float64:
+			return nil
+		case []interface{}:
+			for _, v := range p {
+				switch v.(type) {
+				case string, float64:
+				default:
+					return ErrInvalidFilter{Key: f.Key, Reason: fmt.Sprintf("unsupported list value type %T", v)}
+				}
+			}
+			return nil
+		default:
+			return ErrInvalidFilter{Key: f.Key, Reason: fmt.Sprintf("unsupported parameter type %T", p)}
+		}
+	}
+
+	if err := validateValue(f.Parameter, ct); err != nil {
+		return ErrInvalidFilter{Key: f.Key, Reason: err.Error()}
+	}
+	return nil
+}
+
+// validateValue checks that a single (JSON decoded) value matches the column type.
+func validateValue(v interface{}, ct ColumnType) error {
+	switch ct {
+	case NumberColumn:
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf("expected a number, got %T", v)
+		}
+	case BooleanColumn:
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("expected a boolean, got %T", v)
+		}
+	case StringColumn:
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("expected a string, got %T", v)
+		}
+	case DateColumn:
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("expected a date string, got %T", v)
+		}
+		if _, err := time.Parse(time.RFC3339, s); err != nil {
+			if _, err := time.Parse("2006-01-02", s); err != nil {
+				return fmt.Errorf("%s is not a valid date, use YYYY-MM-DD or RFC3339", s)
+			}
+		}
+	}
+	return nil
+}
@@ -14,6 +14,16 @@ type Order struct {
 	Direction string `json:"direction"`
 }
 
+// ErrInvalidOrder is returned when sorting by a column that is not allowed or in an unknown direction.
+type ErrInvalidOrder struct {
+	Key    string
+	Reason string
+}
+
+func (e ErrInvalidOrder) Error() string {
+	return e.Reason
+}
+
 func ParseOrderParams(params string, allowedColumns []string) ([]string, error) {
 	var sort []Order
 	err := json.Unmarshal([]byte(params), &sort)
@@ -37,16 +47,21 @@ func (qp *QueryParser) ParseOrder(s Order) (r string, err error) {
 
 	// Prevents SQL injection by only allowing whitelisted column names.
 	if !qp.IsAllowed(s.Key) {
-		return r,
-			fmt.Errorf("sorting by %s is not allwed. Try one of: %v",
+		return r, ErrInvalidOrder{
+			Key: s.Key,
+			Reason: fmt.Sprintf("sorting by %s is not allwed. Try one of: %v",
 				s.Key,
 				strings.Join(qp.AllowedColumns, ", "),
-			)
+			),
+		}
 	}
 
 	// Prevent SQL injection by only allowing asc and desc as directions.
 	if !(s.Direction == "asc" || s.Direction == "desc") {
-		return r, fmt.Errorf("%s is not a valid sort direction. Should be either asc or desc", s.Direction)
+		return r, ErrInvalidOrder{
+			Key:    s.Key,
+			Reason: fmt.Sprintf("%s is not a valid sort direction. Should be either asc or desc", s.Direction),
+		}
 	}
 
 	return fmt.Sprintf("%s %s", s.Key, s.Direction), nil
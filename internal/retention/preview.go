@@ -0,0 +1,183 @@
+package retention
+
+import (
+	"fmt"
+	"github.com/cockroachdb/errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	actionDrop       = "DROP"
+	actionCompress   = "COMPRESS"
+	actionStripData  = "STRIP_DATA"
+	actionDownsample = "DOWNSAMPLE"
+)
+
+// PolicyPreview is what enforcing a policy would reclaim now. Bytes is an estimate, it's nil when it can't be
+// estimated, e.g. for compression before any chunk of the table was compressed.
+type PolicyPreview struct {
+	TableName string `json:"tableName"`
+	Action    string `json:"action"`
+	Rows      int64  `json:"rows"`
+	Bytes     *int64 `json:"bytes"`
+}
+
+// avgRowBytes is the average size of a row of the hypertable, including its indexes.
+func avgRowBytes(db *sqlx.DB, table string) (float64, error) {
+	var r float64
+	err := db.Get(&r, `
+		SELECT coalesce(hypertable_size($1)::float8 / nullif(approximate_row_count($1), 0), 0);`, table)
+	if err != nil {
+		return 0, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return r, nil
+}
+
+func countRowsBeforeStatement(table string, days int) statement {
+	return statement{fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s < $1;`, pq.QuoteIdentifier(table),
+		pq.QuoteIdentifier(timeColumns[table])), []interface{}{cutoff(days)}}
+}
+
+// uncompressedBytesStatement sums the chunks a compression policy would compress, the chunks that ended before the
+// cutoff.
+func uncompressedBytesStatement(table string, days int) statement {
+	return statement{`
+		SELECT coalesce(sum(d.total_bytes), 0)
+		FROM chunks_detailed_size($1) d
+		JOIN timescaledb_information.chunks c ON c.chunk_schema = d.chunk_schema AND c.chunk_name = d.chunk_name
+		WHERE c.hypertable_name = $1 AND NOT c.is_compressed AND c.range_end < now() - make_interval(days => $2);`,
+		[]interface{}{table, days}}
+}
+
+func countRowsBefore(db *sqlx.DB, table string, days int) (int64, error) {
+	var r int64
+	count := countRowsBeforeStatement(table, days)
+	err := db.Get(&r, count.query, count.args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return r, nil
+}
+
+func estimate(rows int64, avg float64) *int64 {
+	bytes := int64(float64(rows) * avg)
+	return &bytes
+}
+
+func previewStripData(db *sqlx.DB, days int) (PolicyPreview, error) {
+	r := PolicyPreview{TableName: "htlc_event", Action: actionStripData}
+	var bytes int64
+	row := db.QueryRowx(`
+		SELECT count(*), coalesce(sum(pg_column_size(data)), 0)
+		FROM htlc_event
+		WHERE time < $1 AND data IS NOT NULL;`, cutoff(days))
+	if err := row.Scan(&r.Rows, &bytes); err != nil {
+		return r, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	r.Bytes = &bytes
+	return r, nil
+}
+
+// previewDownsample counts the events replaced by a daily aggregate, the rows reclaimed are the events minus the
+// aggregate rows they're replaced by.
+func previewDownsample(db *sqlx.DB, days int, avg float64) (PolicyPreview, error) {
+	r := PolicyPreview{TableName: "htlc_event", Action: actionDownsample}
+	var events, aggregates int64
+	row := db.QueryRowx(`
+		SELECT count(*), count(DISTINCT ((time AT TIME ZONE 'UTC')::date, event_origin, event_type,
+			lnd_outgoing_short_channel_id, lnd_incoming_short_channel_id, bolt_failure_code, lnd_failure_detail))
+		FROM htlc_event
+		WHERE time < $1;`, dayCutoff(days))
+	if err := row.Scan(&events, &aggregates); err != nil {
+		return r, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	r.Rows = events - aggregates
+	r.Bytes = estimate(r.Rows, avg)
+	return r, nil
+}
+
+// previewDrop estimates from the rows older than the policy, drop_chunks only drops whole chunks so the rows of
+// the chunk that spans the cutoff are dropped later.
+func previewDrop(db *sqlx.DB, table string, days int, avg float64) (PolicyPreview, error) {
+	r := PolicyPreview{TableName: table, Action: actionDrop}
+	rows, err := countRowsBefore(db, table, days)
+	if err != nil {
+		return r, err
+	}
+	r.Rows = rows
+	r.Bytes = estimate(rows, avg)
+	return r, nil
+}
+
+// previewCompress estimates from the uncompressed chunks the policy would compress and the compression ratio of
+// the chunks that are already compressed.
+func previewCompress(db *sqlx.DB, table string, days int) (PolicyPreview, error) {
+	r := PolicyPreview{TableName: table, Action: actionCompress}
+	rows, err := countRowsBefore(db, table, days)
+	if err != nil {
+		return r, err
+	}
+	r.Rows = rows
+
+	var uncompressed int64
+	chunks := uncompressedBytesStatement(table, days)
+	err = db.Get(&uncompressed, chunks.query, chunks.args...)
+	if err != nil {
+		return r, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+
+	var ratio *float64
+	err = db.Get(&ratio, `
+		SELECT sum(after_compression_total_bytes)::float8 / nullif(sum(before_compression_total_bytes), 0)
+		FROM hypertable_compression_stats($1);`, table)
+	if err != nil {
+		// The stats are only available once compression is enabled on the table.
+		ratio = nil
+	}
+	if ratio != nil {
+		bytes := int64(float64(uncompressed) * (1 - *ratio))
+		r.Bytes = &bytes
+	}
+	return r, nil
+}
+
+// Preview returns what each action of the policy would reclaim if it was enforced now.
+func Preview(db *sqlx.DB, p Policy) (r []PolicyPreview, err error) {
+	if err = validatePolicy(p); err != nil {
+		return nil, err
+	}
+	avg, err := avgRowBytes(db, p.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	add := func(preview PolicyPreview, err error) error {
+		if err != nil {
+			return err
+		}
+		r = append(r, preview)
+		return nil
+	}
+	if p.StripDataAfterDays != nil {
+		if err = add(previewStripData(db, *p.StripDataAfterDays)); err != nil {
+			return nil, err
+		}
+	}
+	if p.DownsampleAfterDays != nil {
+		if err = add(previewDownsample(db, *p.DownsampleAfterDays, avg)); err != nil {
+			return nil, err
+		}
+	}
+	if p.CompressAfterDays != nil {
+		if err = add(previewCompress(db, p.TableName, *p.CompressAfterDays)); err != nil {
+			return nil, err
+		}
+	}
+	if p.DropAfterDays != nil {
+		if err = add(previewDrop(db, p.TableName, *p.DropAfterDays, avg)); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,45 @@
+package retention
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_countRowsBeforeStatement(t *testing.T) {
+	tests := map[string]string{
+		"htlc_event": `SELECT count(*) FROM "htlc_event" WHERE "time" < $1;`,
+		"forward":    `SELECT count(*) FROM "forward" WHERE "time" < $1;`,
+		"payment":    `SELECT count(*) FROM "payment" WHERE "creation_timestamp" < $1;`,
+		"node_event": `SELECT count(*) FROM "node_event" WHERE "timestamp" < $1;`,
+	}
+	if len(tests) != len(timeColumns) {
+		t.Fatalf("Test_countRowsBeforeStatement() covers %d of %d tables", len(tests), len(timeColumns))
+	}
+	for table, want := range tests {
+		t.Run(table, func(t *testing.T) {
+			count := countRowsBeforeStatement(table, 30)
+			if count.query != want {
+				t.Errorf("countRowsBeforeStatement() = %v, want %v", count.query, want)
+			}
+			// The preview counts the rows before the same cutoff the chunks are dropped at.
+			if len(count.args) != 1 || !withinSecond(count.args[0], cutoff(30)) {
+				t.Errorf("countRowsBeforeStatement() args = %v", count.args)
+			}
+		})
+	}
+}
+
+func Test_uncompressedBytesStatement(t *testing.T) {
+	for table := range timeColumns {
+		t.Run(table, func(t *testing.T) {
+			chunks := uncompressedBytesStatement(table, 60)
+			if !reflect.DeepEqual(chunks.args, []interface{}{table, 60}) {
+				t.Errorf("uncompressedBytesStatement() args = %v", chunks.args)
+			}
+			if !strings.Contains(chunks.query, "c.range_end < now() - make_interval(days => $2)") {
+				t.Errorf("uncompressedBytesStatement() = %v", chunks.query)
+			}
+		})
+	}
+}
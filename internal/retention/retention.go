@@ -0,0 +1,300 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"github.com/cockroachdb/errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// retentionInterval is how often the retention policies are enforced.
+const retentionInterval = time.Hour
+
+// minCompressAfterDays keeps recent chunks uncompressed, payments are still updated while they're in flight.
+const minCompressAfterDays = 7
+
+// timeColumns are the tables a retention policy can be set for, with the time column of the hypertable. Dropping
+// forwards keeps their totals in forward_hourly, the statistics read the hours without forwards from the aggregate.
+var timeColumns = map[string]string{
+	"htlc_event": "time",
+	"forward":    "time",
+	"payment":    "creation_timestamp",
+	"node_event": "timestamp",
+}
+
+type Policy struct {
+	TableName         string `json:"tableName" db:"table_name"`
+	DropAfterDays     *int   `json:"dropAfterDays" db:"drop_after_days"`
+	CompressAfterDays *int   `json:"compressAfterDays" db:"compress_after_days"`
+	// StripDataAfterDays and DownsampleAfterDays only apply to htlc_event.
+	StripDataAfterDays  *int       `json:"stripDataAfterDays" db:"strip_data_after_days"`
+	DownsampleAfterDays *int       `json:"downsampleAfterDays" db:"downsample_after_days"`
+	UpdatedOn           *time.Time `json:"updatedOn" db:"updated_on"`
+}
+
+// validatePolicy checks the policy can be enforced. Compressed chunks can't be updated, so the HTLC data has to be
+// stripped and downsampled before the chunk is compressed. Raw HTLC events have to be downsampled before they're
+// dropped.
+func validatePolicy(p Policy) error {
+	if _, ok := timeColumns[p.TableName]; !ok {
+		return errors.Newf("Retention policies aren't supported for %s", p.TableName)
+	}
+	for name, days := range map[string]*int{"dropAfterDays": p.DropAfterDays, "compressAfterDays": p.CompressAfterDays,
+		"stripDataAfterDays": p.StripDataAfterDays, "downsampleAfterDays": p.DownsampleAfterDays} {
+		if days != nil && *days < 1 {
+			return errors.Newf("%s must be at least 1 day", name)
+		}
+	}
+	if p.TableName != "htlc_event" && (p.StripDataAfterDays != nil || p.DownsampleAfterDays != nil) {
+		return errors.New("Only HTLC events can be stripped and downsampled")
+	}
+	if p.CompressAfterDays != nil && *p.CompressAfterDays < minCompressAfterDays {
+		return errors.Newf("compressAfterDays must be at least %d days", minCompressAfterDays)
+	}
+	if p.CompressAfterDays != nil && p.StripDataAfterDays != nil && *p.StripDataAfterDays >= *p.CompressAfterDays {
+		return errors.New("HTLC data has to be stripped before the events are compressed")
+	}
+	if p.CompressAfterDays != nil && p.DownsampleAfterDays != nil && *p.DownsampleAfterDays >= *p.CompressAfterDays {
+		return errors.New("HTLC events have to be downsampled before they're compressed")
+	}
+	if p.DropAfterDays != nil && p.DownsampleAfterDays != nil && *p.DownsampleAfterDays >= *p.DropAfterDays {
+		return errors.New("HTLC events have to be downsampled before they're dropped")
+	}
+	return nil
+}
+
+func cutoff(days int) time.Time {
+	return time.Now().UTC().AddDate(0, 0, -days)
+}
+
+// dayCutoff is the start of the day the given number of days ago, downsampling only aggregates complete days.
+func dayCutoff(days int) time.Time {
+	return cutoff(days).Truncate(24 * time.Hour)
+}
+
+// statement is a SQL statement with its arguments. The statements of a policy are built apart from running them, so
+// the tables and cutoffs they use can be tested without a database.
+type statement struct {
+	query string
+	args  []interface{}
+}
+
+func stripDataStatement(days int) statement {
+	return statement{`UPDATE htlc_event SET data = NULL WHERE time < $1 AND data IS NOT NULL;`,
+		[]interface{}{cutoff(days)}}
+}
+
+// downsampleStatements aggregates and deletes the HTLC events before the same cutoff, so no event is deleted without
+// being aggregated.
+func downsampleStatements(days int) (aggregate statement, remove statement) {
+	dc := dayCutoff(days)
+	aggregate = statement{`
+		INSERT INTO htlc_event_daily (day, event_origin, event_type, lnd_outgoing_short_channel_id,
+			lnd_incoming_short_channel_id, outgoing_short_channel_id, incoming_short_channel_id, bolt_failure_code,
+			lnd_failure_detail, event_count, incoming_amt_msat, outgoing_amt_msat)
+		SELECT (time AT TIME ZONE 'UTC')::date, coalesce(event_origin, ''), coalesce(event_type, ''),
+			coalesce(lnd_outgoing_short_channel_id, 0), coalesce(lnd_incoming_short_channel_id, 0),
+			min(outgoing_short_channel_id), min(incoming_short_channel_id), coalesce(bolt_failure_code, ''),
+			coalesce(lnd_failure_detail, ''), count(*), coalesce(sum(incoming_amt_msat), 0),
+			coalesce(sum(outgoing_amt_msat), 0)
+		FROM htlc_event
+		WHERE time < $1
+		GROUP BY 1, 2, 3, 4, 5, 8, 9
+		ON CONFLICT (day, event_origin, event_type, lnd_outgoing_short_channel_id, lnd_incoming_short_channel_id,
+			bolt_failure_code, lnd_failure_detail)
+		DO UPDATE SET event_count = htlc_event_daily.event_count + EXCLUDED.event_count,
+			incoming_amt_msat = htlc_event_daily.incoming_amt_msat + EXCLUDED.incoming_amt_msat,
+			outgoing_amt_msat = htlc_event_daily.outgoing_amt_msat + EXCLUDED.outgoing_amt_msat;`,
+		[]interface{}{dc}}
+	remove = statement{`DELETE FROM htlc_event WHERE time < $1;`, []interface{}{dc}}
+	return aggregate, remove
+}
+
+// dropChunksStatement drops the chunks of the hypertable that only hold rows older than the given number of days.
+func dropChunksStatement(table string, days int) statement {
+	return statement{`SELECT drop_chunks($1, older_than => make_interval(days => $2));`, []interface{}{table, days}}
+}
+
+// compressSettingsStatement enables compression of the table, ordered by its time column.
+func compressSettingsStatement(table string) statement {
+	return statement{fmt.Sprintf(`
+		ALTER TABLE %s SET (timescaledb.compress, timescaledb.compress_orderby = '%s DESC');`,
+		pq.QuoteIdentifier(table), pq.QuoteIdentifier(timeColumns[table])), nil}
+}
+
+func compressionPolicyStatement(table string, days int) statement {
+	return statement{`SELECT add_compression_policy($1, make_interval(days => $2));`, []interface{}{table, days}}
+}
+
+func stripHtlcData(db *sqlx.DB, days int) (int64, error) {
+	strip := stripDataStatement(days)
+	res, err := db.Exec(strip.query, strip.args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return res.RowsAffected()
+}
+
+// downsampleHtlcEvents adds the HTLC events before the cutoff to the daily aggregates and removes them.
+func downsampleHtlcEvents(db *sqlx.DB, days int) (int64, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return 0, errors.Wrap(err, "Unable to start transaction")
+	}
+	defer tx.Rollback()
+
+	aggregate, remove := downsampleStatements(days)
+	_, err = tx.Exec(aggregate.query, aggregate.args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	res, err := tx.Exec(remove.query, remove.args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "Unable to commit transaction")
+	}
+	return res.RowsAffected()
+}
+
+func dropChunks(db *sqlx.DB, table string, days int) error {
+	drop := dropChunksStatement(table, days)
+	_, err := db.Exec(drop.query, drop.args...)
+	if err != nil {
+		return errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return nil
+}
+
+// applyCompressionPolicy replaces the TimescaleDB compression policy of the table. Chunks compressed before a
+// policy is removed stay compressed.
+func applyCompressionPolicy(db *sqlx.DB, p Policy) error {
+	_, err := db.Exec(`SELECT remove_compression_policy($1, if_exists => true);`, p.TableName)
+	if err != nil {
+		return errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	if p.CompressAfterDays == nil {
+		return nil
+	}
+
+	var compressionEnabled bool
+	err = db.Get(&compressionEnabled, `
+		SELECT compression_enabled FROM timescaledb_information.hypertables WHERE hypertable_name = $1;`,
+		p.TableName)
+	if err != nil {
+		return errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	if !compressionEnabled {
+		settings := compressSettingsStatement(p.TableName)
+		if _, err = db.Exec(settings.query, settings.args...); err != nil {
+			return errors.Wrap(err, "Unable to execute SQL statement")
+		}
+	}
+	policy := compressionPolicyStatement(p.TableName, *p.CompressAfterDays)
+	_, err = db.Exec(policy.query, policy.args...)
+	if err != nil {
+		return errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return nil
+}
+
+func getPolicies(db *sqlx.DB) (r []Policy, err error) {
+	err = db.Select(&r, `
+		SELECT table_name, drop_after_days, compress_after_days, strip_data_after_days, downsample_after_days,
+			updated_on
+		FROM retention_policy
+		ORDER BY table_name;`)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return r, nil
+}
+
+func updatePolicy(db *sqlx.DB, p Policy) error {
+	_, err := db.Exec(`
+		INSERT INTO retention_policy (table_name, drop_after_days, compress_after_days, strip_data_after_days,
+			downsample_after_days, updated_on)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (table_name) DO UPDATE SET drop_after_days = EXCLUDED.drop_after_days,
+			compress_after_days = EXCLUDED.compress_after_days, strip_data_after_days = EXCLUDED.strip_data_after_days,
+			downsample_after_days = EXCLUDED.downsample_after_days, updated_on = EXCLUDED.updated_on;`,
+		p.TableName, p.DropAfterDays, p.CompressAfterDays, p.StripDataAfterDays, p.DownsampleAfterDays,
+		time.Now().UTC())
+	if err != nil {
+		return errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return nil
+}
+
+// SetPolicy validates and stores the policy of a table and applies its compression policy.
+func SetPolicy(db *sqlx.DB, p Policy) error {
+	if err := validatePolicy(p); err != nil {
+		return err
+	}
+	if err := updatePolicy(db, p); err != nil {
+		return err
+	}
+	return applyCompressionPolicy(db, p)
+}
+
+// enforcePolicy strips and downsamples the HTLC events before the chunks are dropped, so dropped events are
+// already part of the daily aggregates.
+func enforcePolicy(db *sqlx.DB, p Policy) error {
+	if p.StripDataAfterDays != nil {
+		n, err := stripHtlcData(db, *p.StripDataAfterDays)
+		if err != nil {
+			return errors.Wrap(err, "Stripping HTLC data")
+		}
+		log.Debug().Msgf("Stripped the data of %d HTLC events", n)
+	}
+	if p.DownsampleAfterDays != nil {
+		n, err := downsampleHtlcEvents(db, *p.DownsampleAfterDays)
+		if err != nil {
+			return errors.Wrap(err, "Downsampling HTLC events")
+		}
+		log.Debug().Msgf("Downsampled %d HTLC events", n)
+	}
+	if p.DropAfterDays != nil {
+		if err := dropChunks(db, p.TableName, *p.DropAfterDays); err != nil {
+			return errors.Wrapf(err, "Dropping chunks of %s", p.TableName)
+		}
+	}
+	return nil
+}
+
+// Start enforces the retention policies until ctx is canceled. Compression is done by TimescaleDB jobs, they're
+// (re)created on start to match the stored policies.
+func Start(ctx context.Context, db *sqlx.DB) {
+	policies, err := getPolicies(db)
+	if err != nil {
+		log.Error().Err(err).Msg("Getting retention policies")
+	}
+	for _, p := range policies {
+		if err = applyCompressionPolicy(db, p); err != nil {
+			log.Error().Err(err).Msgf("Applying compression policy of %s", p.TableName)
+		}
+	}
+
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		policies, err := getPolicies(db)
+		if err != nil {
+			log.Error().Err(err).Msg("Getting retention policies")
+		}
+		for _, p := range policies {
+			if err = enforcePolicy(db, p); err != nil {
+				log.Error().Err(err).Msgf("Enforcing retention policy of %s", p.TableName)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
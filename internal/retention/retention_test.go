@@ -0,0 +1,113 @@
+package retention
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func days(d int) *int {
+	return &d
+}
+
+func Test_validatePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		wantErr bool
+	}{
+		{"Disabled", Policy{TableName: "forward"}, false},
+		{"Unknown table", Policy{TableName: "channel", DropAfterDays: days(30)}, true},
+		{"Zero days", Policy{TableName: "forward", DropAfterDays: days(0)}, true},
+		{"Strip data of forwards", Policy{TableName: "forward", StripDataAfterDays: days(30)}, true},
+		{"Compress too early", Policy{TableName: "payment", CompressAfterDays: days(1)}, true},
+		{"Strip after compressing", Policy{TableName: "htlc_event", StripDataAfterDays: days(30),
+			CompressAfterDays: days(30)}, true},
+		{"Downsample after compressing", Policy{TableName: "htlc_event", DownsampleAfterDays: days(60),
+			CompressAfterDays: days(30)}, true},
+		{"Drop before downsampling", Policy{TableName: "htlc_event", DownsampleAfterDays: days(90),
+			DropAfterDays: days(60)}, true},
+		{"Valid", Policy{TableName: "htlc_event", StripDataAfterDays: days(7), DownsampleAfterDays: days(30),
+			CompressAfterDays: days(60), DropAfterDays: days(365)}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := validatePolicy(test.policy); (err != nil) != test.wantErr {
+				t.Errorf("validatePolicy() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func Test_dayCutoff(t *testing.T) {
+	got := dayCutoff(30)
+	if !got.Equal(got.Truncate(24*time.Hour)) || time.Since(got) < 30*24*time.Hour ||
+		time.Since(got) > 31*24*time.Hour {
+		t.Errorf("dayCutoff() = %v", got)
+	}
+}
+
+// withinSecond is true when the cutoff was taken at most a second before the test checks it.
+func withinSecond(got interface{}, want time.Time) bool {
+	cutoff, ok := got.(time.Time)
+	return ok && !cutoff.After(want) && want.Sub(cutoff) < time.Second
+}
+
+func Test_dropChunksStatement(t *testing.T) {
+	for table := range timeColumns {
+		t.Run(table, func(t *testing.T) {
+			drop := dropChunksStatement(table, 30)
+			if !reflect.DeepEqual(drop.args, []interface{}{table, 30}) {
+				t.Errorf("dropChunksStatement() args = %v", drop.args)
+			}
+			if !strings.Contains(drop.query, "drop_chunks($1, older_than => make_interval(days => $2))") {
+				t.Errorf("dropChunksStatement() = %v", drop.query)
+			}
+		})
+	}
+}
+
+func Test_compressSettingsStatement(t *testing.T) {
+	tests := map[string]string{
+		"htlc_event": `ALTER TABLE "htlc_event" SET (timescaledb.compress, ` +
+			`timescaledb.compress_orderby = '"time" DESC');`,
+		"forward": `ALTER TABLE "forward" SET (timescaledb.compress, ` +
+			`timescaledb.compress_orderby = '"time" DESC');`,
+		"payment": `ALTER TABLE "payment" SET (timescaledb.compress, ` +
+			`timescaledb.compress_orderby = '"creation_timestamp" DESC');`,
+		"node_event": `ALTER TABLE "node_event" SET (timescaledb.compress, ` +
+			`timescaledb.compress_orderby = '"timestamp" DESC');`,
+	}
+	if len(tests) != len(timeColumns) {
+		t.Fatalf("Test_compressSettingsStatement() covers %d of %d tables", len(tests), len(timeColumns))
+	}
+	for table, want := range tests {
+		t.Run(table, func(t *testing.T) {
+			if got := strings.TrimSpace(compressSettingsStatement(table).query); got != want {
+				t.Errorf("compressSettingsStatement() = %v, want %v", got, want)
+			}
+			policy := compressionPolicyStatement(table, 60)
+			if !reflect.DeepEqual(policy.args, []interface{}{table, 60}) {
+				t.Errorf("compressionPolicyStatement() args = %v", policy.args)
+			}
+		})
+	}
+}
+
+func Test_htlcEventStatements(t *testing.T) {
+	strip := stripDataStatement(7)
+	if len(strip.args) != 1 || !withinSecond(strip.args[0], cutoff(7)) {
+		t.Errorf("stripDataStatement() args = %v", strip.args)
+	}
+
+	// Every deleted event has to be aggregated first.
+	aggregate, remove := downsampleStatements(30)
+	if len(aggregate.args) != 1 || !reflect.DeepEqual(aggregate.args, remove.args) ||
+		aggregate.args[0] != dayCutoff(30) {
+		t.Errorf("downsampleStatements() args = %v, %v", aggregate.args, remove.args)
+	}
+	if !strings.Contains(aggregate.query, "WHERE time < $1") || !strings.Contains(remove.query, "WHERE time < $1") {
+		t.Errorf("downsampleStatements() = %v, %v", aggregate.query, remove.query)
+	}
+}
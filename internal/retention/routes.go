@@ -0,0 +1,60 @@
+package retention
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lncapital/torq/pkg/server_errors"
+	"net/http"
+)
+
+func RegisterRetentionRoutes(r *gin.RouterGroup, db *sqlx.DB) {
+	r.GET("retention", func(c *gin.Context) { getPoliciesHandler(c, db) })
+	r.PUT("retention", func(c *gin.Context) { updatePolicyHandler(c, db) })
+	r.POST("retention/preview", func(c *gin.Context) { previewPolicyHandler(c, db) })
+}
+
+func getPoliciesHandler(c *gin.Context, db *sqlx.DB) {
+	r, err := getPolicies(db)
+	if err != nil {
+		server_errors.LogAndSendServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+func updatePolicyHandler(c *gin.Context, db *sqlx.DB) {
+	var p Policy
+	if err := c.BindJSON(&p); err != nil {
+		server_errors.SendBadRequestFromError(c, err)
+		return
+	}
+	if err := validatePolicy(p); err != nil {
+		server_errors.SendUnprocessableEntityFromError(c, err)
+		return
+	}
+	if err := SetPolicy(db, p); err != nil {
+		server_errors.WrapLogAndSendServerError(c, err, "Setting retention policy")
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// previewPolicyHandler previews the policy in the request body, so the effect of a change is shown before it's
+// saved.
+func previewPolicyHandler(c *gin.Context, db *sqlx.DB) {
+	var p Policy
+	if err := c.BindJSON(&p); err != nil {
+		server_errors.SendBadRequestFromError(c, err)
+		return
+	}
+	if err := validatePolicy(p); err != nil {
+		server_errors.SendUnprocessableEntityFromError(c, err)
+		return
+	}
+	r, err := Preview(db, p)
+	if err != nil {
+		server_errors.WrapLogAndSendServerError(c, err, "Previewing retention policy")
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
@@ -64,6 +64,33 @@ FROM local_node WHERE local_node_id = $1;`, localNodeId)
 	return localNodeData, nil
 }
 
+// LocalNode is a local node without its connection credentials.
+type LocalNode struct {
+	LocalNodeId    int
+	Implementation string
+	GRPCAddress    *string
+	PubKey         *string
+	Disabled       bool
+}
+
+// GetLocalNodes returns the local nodes that are not deleted.
+func GetLocalNodes(db *sqlx.DB) (r []LocalNode, err error) {
+	nodes, err := getLocalNodes(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range nodes {
+		r = append(r, LocalNode{
+			LocalNodeId:    n.LocalNodeId,
+			Implementation: n.Implementation,
+			GRPCAddress:    n.GRPCAddress,
+			PubKey:         n.PubKey,
+			Disabled:       n.Disabled,
+		})
+	}
+	return r, nil
+}
+
 func getLocalNodes(db *sqlx.DB) (localNodeData []localNode, err error) {
 	err = db.Select(&localNodeData, `
 SELECT
@@ -84,5 +84,6 @@ func UpdateNodeFiles(db *sqlx.DB, nodeConnectionDetails ConnectionDetails) error
 	if err != nil {
 		return errors.Wrap(err, "Updating local node Macaroon file")
 	}
+	clearNodePermissions(nodeConnectionDetails.LocalNodeId)
 	return nil
 }
@@ -0,0 +1,279 @@
+package settings
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lncapital/torq/pkg/lnd_connect"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// NodeAction is an action Torq takes on a node, it's only enabled when the macaroon of the node allows all LND
+// methods the action uses.
+type NodeAction string
+
+const (
+	ActionOpenChannel    NodeAction = "openChannel"
+	ActionCloseChannel   NodeAction = "closeChannel"
+	ActionUpdateChannel  NodeAction = "updateChannel"
+	ActionSendPayment    NodeAction = "sendPayment"
+	ActionCreateInvoice  NodeAction = "createInvoice"
+	ActionHoldInvoice    NodeAction = "holdInvoice"
+	ActionSendOnChain    NodeAction = "sendOnChain"
+	ActionNewAddress     NodeAction = "newAddress"
+	ActionSignMessage    NodeAction = "signMessage"
+	ActionBackupChannels NodeAction = "backupChannels"
+)
+
+var actionMethods = map[NodeAction][]string{
+	ActionOpenChannel:   {"/lnrpc.Lightning/OpenChannel", "/lnrpc.Lightning/BatchOpenChannel"},
+	ActionCloseChannel:  {"/lnrpc.Lightning/CloseChannel"},
+	ActionUpdateChannel: {"/lnrpc.Lightning/UpdateChannelPolicy"},
+	ActionSendPayment:   {"/routerrpc.Router/SendPaymentV2"},
+	ActionCreateInvoice: {"/lnrpc.Lightning/AddInvoice"},
+	ActionHoldInvoice: {"/invoicesrpc.Invoices/AddHoldInvoice", "/invoicesrpc.Invoices/SettleInvoice",
+		"/invoicesrpc.Invoices/CancelInvoice"},
+	ActionSendOnChain: {"/lnrpc.Lightning/SendCoins", "/lnrpc.Lightning/SendMany", "/walletrpc.WalletKit/BumpFee",
+		"/walletrpc.WalletKit/LeaseOutput", "/walletrpc.WalletKit/ReleaseOutput"},
+	ActionNewAddress:  {"/walletrpc.WalletKit/NextAddr"},
+	ActionSignMessage: {"/lnrpc.Lightning/SignMessage"},
+	ActionBackupChannels: {"/lnrpc.Lightning/ExportAllChannelBackups", "/lnrpc.Lightning/SubscribeChannelBackups",
+		"/lnrpc.Lightning/VerifyChanBackup"},
+}
+
+// readPermissions are what Torq needs to store the data of a node. macaroon:read is needed to detect the
+// permissions of the macaroon.
+var readPermissions = []*lnrpc.MacaroonPermission{
+	{Entity: "info", Action: "read"},
+	{Entity: "offchain", Action: "read"},
+	{Entity: "onchain", Action: "read"},
+	{Entity: "invoices", Action: "read"},
+	{Entity: "peers", Action: "read"},
+	{Entity: "address", Action: "read"},
+	{Entity: "message", Action: "read"},
+	{Entity: "macaroon", Action: "read"},
+}
+
+// macaroonProfiles are the macaroons Torq can bake. The operator profile allows all actions, it can't bake
+// macaroons or use the signer.
+var macaroonProfiles = map[string][]*lnrpc.MacaroonPermission{
+	"read-only": readPermissions,
+	"operator": append(append([]*lnrpc.MacaroonPermission{}, readPermissions...),
+		&lnrpc.MacaroonPermission{Entity: "offchain", Action: "write"},
+		&lnrpc.MacaroonPermission{Entity: "onchain", Action: "write"},
+		&lnrpc.MacaroonPermission{Entity: "invoices", Action: "write"},
+		&lnrpc.MacaroonPermission{Entity: "peers", Action: "write"},
+		&lnrpc.MacaroonPermission{Entity: "address", Action: "write"},
+		&lnrpc.MacaroonPermission{Entity: "message", Action: "write"},
+	),
+}
+
+// failedDetectionTTL is how long a failed detection is cached, so an unreachable node doesn't slow down every
+// action.
+const failedDetectionTTL = time.Minute
+
+type NodePermissions struct {
+	LocalNodeId int `json:"localNodeId"`
+	// Detected is false when the permissions couldn't be checked, e.g. when the macaroon doesn't have the
+	// macaroon:read permission. All actions are attempted then.
+	Detected  bool                `json:"detected"`
+	Error     *string             `json:"error"`
+	Actions   map[NodeAction]bool `json:"actions"`
+	ReadOnly  bool                `json:"readOnly"`
+	CheckedOn time.Time           `json:"checkedOn"`
+}
+
+type ErrActionNotPermitted struct {
+	LocalNodeId int
+	Action      NodeAction
+}
+
+func (e ErrActionNotPermitted) Error() string {
+	return fmt.Sprintf("The macaroon of node %d doesn't allow %s, upload a macaroon with the operator "+
+		"permissions to enable it", e.LocalNodeId, e.Action)
+}
+
+// Forbidden makes the API respond with 403 Forbidden instead of a server error.
+func (e ErrActionNotPermitted) Forbidden() bool {
+	return true
+}
+
+type rpcClientPermissions interface {
+	ListPermissions(ctx context.Context, in *lnrpc.ListPermissionsRequest,
+		opts ...grpc.CallOption) (*lnrpc.ListPermissionsResponse, error)
+	CheckMacaroonPermissions(ctx context.Context, in *lnrpc.CheckMacPermRequest,
+		opts ...grpc.CallOption) (*lnrpc.CheckMacPermResponse, error)
+}
+
+var nodePermissions = struct {
+	mu sync.Mutex
+	m  map[int]NodePermissions
+}{m: make(map[int]NodePermissions)}
+
+var readOnly bool
+
+// SetReadOnly sets whether Torq refuses all actions that change the state of Torq or the nodes.
+func SetReadOnly(ro bool) {
+	readOnly = ro
+}
+
+func IsReadOnly() bool {
+	return readOnly
+}
+
+// checkMethod checks whether the macaroon allows the LND method. LND responds with InvalidArgument when it
+// doesn't.
+func checkMethod(ctx context.Context, client rpcClientPermissions, macaroon []byte, method string,
+	perms []*lnrpc.MacaroonPermission) (bool, error) {
+	resp, err := client.CheckMacaroonPermissions(ctx, &lnrpc.CheckMacPermRequest{
+		Macaroon:    macaroon,
+		Permissions: perms,
+		FullMethod:  method,
+	})
+	if status.Code(err) == codes.InvalidArgument {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "Checking macaroon permissions")
+	}
+	return resp.Valid, nil
+}
+
+// detectPermissions checks for each action whether the macaroon allows all methods it uses. An action that
+// uses a subserver which isn't enabled on the node isn't allowed either.
+func detectPermissions(ctx context.Context, client rpcClientPermissions,
+	macaroon []byte) (map[NodeAction]bool, error) {
+	resp, err := client.ListPermissions(ctx, &lnrpc.ListPermissionsRequest{})
+	if err != nil {
+		return nil, errors.Wrap(err, "Listing LND method permissions")
+	}
+
+	r := make(map[NodeAction]bool, len(actionMethods))
+	for action, methods := range actionMethods {
+		allowed := true
+		for _, method := range methods {
+			perms, exists := resp.MethodPermissions[method]
+			if !exists {
+				allowed = false
+				break
+			}
+			allowed, err = checkMethod(ctx, client, macaroon, method, perms.Permissions)
+			if err != nil {
+				return nil, err
+			}
+			if !allowed {
+				break
+			}
+		}
+		r[action] = allowed
+	}
+	return r, nil
+}
+
+func detectNodePermissions(ctx context.Context, node ConnectionDetails) NodePermissions {
+	r := NodePermissions{LocalNodeId: node.LocalNodeId, CheckedOn: time.Now().UTC()}
+
+	conn, err := lnd_connect.Connect(node.GRPCAddress, node.TLSFileBytes, node.MacaroonFileBytes)
+	if err == nil {
+		defer conn.Close()
+		r.Actions, err = detectPermissions(ctx, lnrpc.NewLightningClient(conn), node.MacaroonFileBytes)
+	}
+	if err != nil {
+		log.Warn().Err(err).Msgf("Detecting the macaroon permissions of node %d", node.LocalNodeId)
+		msg := err.Error()
+		r.Error = &msg
+		return r
+	}
+	r.Detected = true
+	return r
+}
+
+// GetNodePermissions returns the actions the macaroon of the node allows. Detected permissions are cached until
+// the macaroon of the node changes.
+func GetNodePermissions(ctx context.Context, db *sqlx.DB, localNodeId int) (NodePermissions, error) {
+	nodePermissions.mu.Lock()
+	p, exists := nodePermissions.m[localNodeId]
+	nodePermissions.mu.Unlock()
+	if exists && (p.Detected || time.Since(p.CheckedOn) < failedDetectionTTL) {
+		p.ReadOnly = IsReadOnly()
+		return p, nil
+	}
+
+	node, err := GetNodeConnectionDetailsById(db, localNodeId)
+	if err != nil {
+		return NodePermissions{}, errors.Wrap(err, "Getting node connection details from the db")
+	}
+	p = detectNodePermissions(ctx, node)
+
+	nodePermissions.mu.Lock()
+	nodePermissions.m[localNodeId] = p
+	nodePermissions.mu.Unlock()
+
+	p.ReadOnly = IsReadOnly()
+	return p, nil
+}
+
+func clearNodePermissions(localNodeId int) {
+	nodePermissions.mu.Lock()
+	defer nodePermissions.mu.Unlock()
+	delete(nodePermissions.m, localNodeId)
+}
+
+// CheckNodePermission returns ErrActionNotPermitted when the macaroon of the node doesn't allow the action.
+// When the permissions can't be detected the action is attempted, LND still refuses it if it isn't allowed.
+func CheckNodePermission(db *sqlx.DB, localNodeId int, action NodeAction) error {
+	p, err := GetNodePermissions(context.Background(), db, localNodeId)
+	if err != nil {
+		return err
+	}
+	if p.Detected && !p.Actions[action] {
+		return ErrActionNotPermitted{LocalNodeId: localNodeId, Action: action}
+	}
+	return nil
+}
+
+type MacaroonProfile struct {
+	Name        string                      `json:"name"`
+	Permissions []*lnrpc.MacaroonPermission `json:"permissions"`
+}
+
+func getMacaroonProfiles() (r []MacaroonProfile) {
+	for name, perms := range macaroonProfiles {
+		r = append(r, MacaroonProfile{Name: name, Permissions: perms})
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Name > r[j].Name })
+	return r
+}
+
+type rpcClientBakeMacaroon interface {
+	BakeMacaroon(ctx context.Context, in *lnrpc.BakeMacaroonRequest,
+		opts ...grpc.CallOption) (*lnrpc.BakeMacaroonResponse, error)
+}
+
+// bakeMacaroon bakes a macaroon with the permissions of the profile, the macaroon used to connect needs the
+// macaroon:generate permission.
+func bakeMacaroon(ctx context.Context, client rpcClientBakeMacaroon, profile string) ([]byte, error) {
+	perms, exists := macaroonProfiles[profile]
+	if !exists {
+		return nil, errors.Newf("Unknown macaroon profile %s", profile)
+	}
+	resp, err := client.BakeMacaroon(ctx, &lnrpc.BakeMacaroonRequest{Permissions: perms})
+	if err != nil {
+		return nil, errors.Wrap(err, "Baking macaroon")
+	}
+	mac, err := hex.DecodeString(resp.Macaroon)
+	if err != nil {
+		return nil, errors.Wrap(err, "Decoding baked macaroon")
+	}
+	return mac, nil
+}
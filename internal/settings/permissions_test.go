@@ -0,0 +1,120 @@
+package settings
+
+import (
+	"context"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type mockLightningClient_Permissions struct {
+	// granted are the methods the macaroon allows.
+	granted map[string]bool
+	// missing are the methods of subservers that aren't enabled.
+	missing  map[string]bool
+	checkErr error
+	baked    *lnrpc.BakeMacaroonRequest
+}
+
+func (c *mockLightningClient_Permissions) ListPermissions(ctx context.Context, in *lnrpc.ListPermissionsRequest,
+	opts ...grpc.CallOption) (*lnrpc.ListPermissionsResponse, error) {
+	r := &lnrpc.ListPermissionsResponse{MethodPermissions: make(map[string]*lnrpc.MacaroonPermissionList)}
+	for _, methods := range actionMethods {
+		for _, method := range methods {
+			if !c.missing[method] {
+				r.MethodPermissions[method] = &lnrpc.MacaroonPermissionList{
+					Permissions: []*lnrpc.MacaroonPermission{{Entity: "offchain", Action: "write"}},
+				}
+			}
+		}
+	}
+	return r, nil
+}
+
+func (c *mockLightningClient_Permissions) CheckMacaroonPermissions(ctx context.Context,
+	in *lnrpc.CheckMacPermRequest, opts ...grpc.CallOption) (*lnrpc.CheckMacPermResponse, error) {
+	if c.checkErr != nil {
+		return nil, c.checkErr
+	}
+	if !c.granted[in.FullMethod] {
+		return nil, status.Error(codes.InvalidArgument, "permission denied")
+	}
+	return &lnrpc.CheckMacPermResponse{Valid: true}, nil
+}
+
+func (c *mockLightningClient_Permissions) BakeMacaroon(ctx context.Context, in *lnrpc.BakeMacaroonRequest,
+	opts ...grpc.CallOption) (*lnrpc.BakeMacaroonResponse, error) {
+	c.baked = in
+	return &lnrpc.BakeMacaroonResponse{Macaroon: "0201"}, nil
+}
+
+func Test_detectPermissions(t *testing.T) {
+	client := &mockLightningClient_Permissions{
+		granted: map[string]bool{
+			"/lnrpc.Lightning/AddInvoice":              true,
+			"/lnrpc.Lightning/OpenChannel":             true,
+			"/lnrpc.Lightning/BatchOpenChannel":        true,
+			"/walletrpc.WalletKit/NextAddr":            true,
+			"/invoicesrpc.Invoices/AddHoldInvoice":     true,
+			"/invoicesrpc.Invoices/SettleInvoice":      true,
+			"/invoicesrpc.Invoices/CancelInvoice":      true,
+			"/lnrpc.Lightning/ExportAllChannelBackups": true,
+			"/lnrpc.Lightning/SubscribeChannelBackups": true,
+		},
+		missing: map[string]bool{"/walletrpc.WalletKit/NextAddr": true},
+	}
+
+	got, err := detectPermissions(context.Background(), client, []byte{2, 1})
+	if err != nil {
+		t.Fatalf("detectPermissions() error = %v", err)
+	}
+	want := map[NodeAction]bool{
+		ActionOpenChannel:   true,
+		ActionCloseChannel:  false,
+		ActionUpdateChannel: false,
+		ActionSendPayment:   false,
+		ActionCreateInvoice: true,
+		ActionHoldInvoice:   true,
+		ActionSendOnChain:   false,
+		// Granted, but the wallet subserver isn't enabled.
+		ActionNewAddress:  false,
+		ActionSignMessage: false,
+		// One of the methods isn't granted.
+		ActionBackupChannels: false,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("detectPermissions() = %v, want %v", got, want)
+	}
+}
+
+func Test_detectPermissionsCheckFailed(t *testing.T) {
+	client := &mockLightningClient_Permissions{checkErr: status.Error(codes.Unknown, "permission denied")}
+	if _, err := detectPermissions(context.Background(), client, []byte{2, 1}); err == nil {
+		t.Errorf("detectPermissions() expected an error when the permissions can't be checked")
+	}
+}
+
+func Test_bakeMacaroon(t *testing.T) {
+	client := &mockLightningClient_Permissions{}
+	got, err := bakeMacaroon(context.Background(), client, "read-only")
+	if err != nil {
+		t.Fatalf("bakeMacaroon() error = %v", err)
+	}
+	if hex.EncodeToString(got) != "0201" {
+		t.Errorf("bakeMacaroon() = %x, want 0201", got)
+	}
+	for _, p := range client.baked.Permissions {
+		if p.Action != "read" {
+			t.Errorf("read-only macaroon has permission %s:%s", p.Entity, p.Action)
+		}
+	}
+
+	if _, err = bakeMacaroon(context.Background(), client, "admin"); err == nil {
+		t.Errorf("bakeMacaroon() expected an error for an unknown profile")
+	}
+}
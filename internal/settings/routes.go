@@ -2,6 +2,7 @@ package settings
 
 import (
 	"context"
+	"encoding/hex"
 	"io"
 	"mime/multipart"
 	"net/http"
@@ -37,6 +38,9 @@ func RegisterSettingRoutes(r *gin.RouterGroup, db *sqlx.DB, restartLNDSub func()
 	r.PUT("local-nodes/:nodeId", func(c *gin.Context) { updateLocalNodeHandler(c, db, restartLNDSub) })
 	r.DELETE("local-nodes/:nodeId", func(c *gin.Context) { updateLocalNodeDeletedHandler(c, db, restartLNDSub) })
 	r.PUT("local-nodes/:nodeId/set-disabled", func(c *gin.Context) { updateLocalNodeDisabledHandler(c, db, restartLNDSub) })
+	r.GET("local-nodes/:nodeId/permissions", func(c *gin.Context) { getLocalNodePermissionsHandler(c, db) })
+	r.POST("local-nodes/:nodeId/bake-macaroon", func(c *gin.Context) { bakeMacaroonHandler(c, db, restartLNDSub) })
+	r.GET("macaroon-profiles", func(c *gin.Context) { c.JSON(http.StatusOK, getMacaroonProfiles()) })
 }
 func RegisterUnauthenticatedRoutes(r *gin.RouterGroup, db *sqlx.DB) {
 	r.GET("timezones", func(c *gin.Context) { getTimeZonesHandler(c, db) })
@@ -292,6 +296,7 @@ func updateLocalNodeHandler(c *gin.Context, db *sqlx.DB, restartLNDSub func() er
 		server_errors.LogAndSendServerError(c, err)
 		return
 	}
+	clearNodePermissions(nodeId)
 
 	maxTries := 30
 	attempts := 0
@@ -420,6 +425,7 @@ func updateLocalNodeDeletedHandler(c *gin.Context, db *sqlx.DB, restartLNDSub fu
 		server_errors.LogAndSendServerError(c, err)
 		return
 	}
+	clearNodePermissions(nodeId)
 
 	go func() {
 		if err := restartLNDSub(); err != nil {
@@ -429,3 +435,95 @@ func updateLocalNodeDeletedHandler(c *gin.Context, db *sqlx.DB, restartLNDSub fu
 
 	c.Status(http.StatusOK)
 }
+
+func getLocalNodePermissionsHandler(c *gin.Context, db *sqlx.DB) {
+	nodeId, err := strconv.Atoi(c.Param("nodeId"))
+	if err != nil {
+		server_errors.SendBadRequest(c, "Node id must be a number")
+		return
+	}
+	if c.Query("refresh") == "true" {
+		clearNodePermissions(nodeId)
+	}
+	r, err := GetNodePermissions(c.Request.Context(), db, nodeId)
+	if err != nil {
+		server_errors.LogAndSendServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+type bakeMacaroonRequest struct {
+	Profile string `json:"profile"`
+	// Replace stores the baked macaroon as the macaroon of the node, so Torq stops using the macaroon it was
+	// baked with.
+	Replace bool `json:"replace"`
+}
+
+type bakedMacaroon struct {
+	LocalNodeId int    `json:"localNodeId"`
+	Profile     string `json:"profile"`
+	Macaroon    string `json:"macaroon"`
+	Replaced    bool   `json:"replaced"`
+}
+
+// bakeMacaroonHandler bakes a macaroon with the least permissions Torq needs, using the stored macaroon of the
+// node. That macaroon needs the macaroon:generate permission.
+func bakeMacaroonHandler(c *gin.Context, db *sqlx.DB, restartLNDSub func() error) {
+	nodeId, err := strconv.Atoi(c.Param("nodeId"))
+	if err != nil {
+		server_errors.SendBadRequest(c, "Node id must be a number")
+		return
+	}
+	var req bakeMacaroonRequest
+	if err := c.BindJSON(&req); err != nil {
+		server_errors.SendBadRequestFromError(c, err)
+		return
+	}
+	if _, exists := macaroonProfiles[req.Profile]; !exists {
+		server_errors.SendUnprocessableEntity(c, "Unknown macaroon profile "+req.Profile)
+		return
+	}
+
+	node, err := GetNodeConnectionDetailsById(db, nodeId)
+	if err != nil {
+		server_errors.LogAndSendServerError(c, err)
+		return
+	}
+	conn, err := lnd_connect.Connect(node.GRPCAddress, node.TLSFileBytes, node.MacaroonFileBytes)
+	if err != nil {
+		server_errors.WrapLogAndSendServerError(c, err, "Connecting to LND")
+		return
+	}
+	defer conn.Close()
+
+	mac, err := bakeMacaroon(c.Request.Context(), lnrpc.NewLightningClient(conn), req.Profile)
+	if err != nil {
+		server_errors.LogAndSendServerError(c, err)
+		return
+	}
+	r := bakedMacaroon{LocalNodeId: nodeId, Profile: req.Profile, Macaroon: hex.EncodeToString(mac)}
+
+	if req.Replace {
+		macaroonFileName := "torq-" + req.Profile + ".macaroon"
+		err = updateLocalNodeMacaroon(db, localNode{
+			LocalNodeId:       nodeId,
+			MacaroonFileName:  &macaroonFileName,
+			MacaroonDataBytes: mac,
+		})
+		if err != nil {
+			server_errors.LogAndSendServerError(c, err)
+			return
+		}
+		clearNodePermissions(nodeId)
+		r.Replaced = true
+
+		go func() {
+			if err := restartLNDSub(); err != nil {
+				log.Warn().Msg("Already restarting subscriptions, discarding restart request")
+			}
+		}()
+	}
+
+	c.JSON(http.StatusOK, r)
+}
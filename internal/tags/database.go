@@ -3,40 +3,207 @@ package tags
 import (
 	"database/sql"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
+	"strconv"
 	"time"
 )
 
-func getTags(db *sqlx.DB, channelDBID int) (tags []tag, err error) {
-	err = db.Select(&tags, "SELECT * FROM channel_tag WHERE channel_db_id = $1;", channelDBID)
+type ErrTagNotFound struct {
+	Identifier string
+}
+
+func (e ErrTagNotFound) Error() string {
+	return "Tag not found"
+}
+
+type ErrTagExists struct {
+	Name string
+}
+
+func (e ErrTagExists) Error() string {
+	return "A tag named " + e.Name + " already exists"
+}
+
+type ErrEntityAlreadyTagged struct {
+	TagId int
+}
+
+func (e ErrEntityAlreadyTagged) Error() string {
+	return "The tag is already added"
+}
+
+// ErrTaggedEntityNotFound is returned when the channel or local node to tag doesn't exist.
+type ErrTaggedEntityNotFound struct {
+	Constraint string
+}
+
+func (e ErrTaggedEntityNotFound) Error() string {
+	return "The channel or node to tag doesn't exist"
+}
+
+// isUniqueViolation is true when the statement failed on a unique constraint.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// foreignKeyViolation returns the name of the foreign key constraint the statement failed on, or an empty string
+// when it didn't fail on a foreign key.
+func foreignKeyViolation(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		return pqErr.Constraint
+	}
+	return ""
+}
+
+func getTags(db *sqlx.DB, category string) (tags []Tag, err error) {
+	err = db.Select(&tags, `
+SELECT tag_id, name, colour, category, created_on, updated_on
+FROM tag
+WHERE ($1 = '' OR category = $1)
+ORDER BY name;`, category)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return make([]tag, 0), nil
+			return make([]Tag, 0), nil
 		}
 		return nil, errors.Wrap(err, "Unable to execute SQL query")
 	}
 	return tags, nil
 }
 
-func insertTag(db *sqlx.DB, tag tag) (tagID int, err error) {
-	err = db.QueryRowx(`
-INSERT INTO channel_tag (
-  channel_db_id,
-  tag,
+func getTagByName(db *sqlx.DB, name string) (tag Tag, err error) {
+	err = db.Get(&tag, `
+SELECT tag_id, name, colour, category, created_on, updated_on
+FROM tag
+WHERE name = $1;`, name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Tag{}, ErrTagNotFound{name}
+		}
+		return Tag{}, errors.Wrap(err, "Unable to execute SQL query")
+	}
+	return tag, nil
+}
+
+func insertTag(db *sqlx.DB, tag Tag) (r Tag, err error) {
+	err = db.Get(&r, `
+INSERT INTO tag (
+  name,
+  colour,
+  category,
   created_on
-) values ($1, $2, $3)
-RETURNING tag_id;`, tag.ChannelDBID, tag.Tag, time.Now().UTC()).Scan(&tagID)
+) values ($1, $2, $3, $4)
+RETURNING tag_id, name, colour, category, created_on, updated_on;`,
+		tag.Name, tag.Colour, tag.Category, time.Now().UTC())
+	if err != nil {
+		if isUniqueViolation(err) {
+			return Tag{}, ErrTagExists{tag.Name}
+		}
+		return Tag{}, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return r, nil
+}
+
+func updateTag(db *sqlx.DB, tag Tag) (r Tag, err error) {
+	err = db.Get(&r, `
+UPDATE tag SET
+  name = $1,
+  colour = $2,
+  category = $3,
+  updated_on = $4
+WHERE tag_id = $5
+RETURNING tag_id, name, colour, category, created_on, updated_on;`,
+		tag.Name, tag.Colour, tag.Category, time.Now().UTC(), tag.TagId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Tag{}, ErrTagNotFound{tag.Name}
+		}
+		if isUniqueViolation(err) {
+			return Tag{}, ErrTagExists{tag.Name}
+		}
+		return Tag{}, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return r, nil
+}
+
+func deleteTag(db *sqlx.DB, tagId int) error {
+	_, err := db.Exec("DELETE FROM tag WHERE tag_id = $1;", tagId)
 	if err != nil {
-		return 0, errors.Wrap(err, "Unable to execute SQL statement")
+		return errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return nil
+}
+
+func getTaggedEntities(db *sqlx.DB, tagId int) (entities []TaggedEntity, err error) {
+	err = db.Select(&entities, `
+SELECT tagged_entity_id, tag_id, channel_db_id, pub_key, local_node_id, created_on
+FROM tagged_entity
+WHERE tag_id = $1
+ORDER BY tagged_entity_id;`, tagId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return make([]TaggedEntity, 0), nil
+		}
+		return nil, errors.Wrap(err, "Unable to execute SQL query")
 	}
+	return entities, nil
+}
 
-	return tagID, nil
+func insertTaggedEntity(db *sqlx.DB, entity TaggedEntity) (r TaggedEntity, err error) {
+	err = db.Get(&r, `
+INSERT INTO tagged_entity (
+  tag_id,
+  channel_db_id,
+  pub_key,
+  local_node_id,
+  created_on
+) values ($1, $2, $3, $4, $5)
+RETURNING tagged_entity_id, tag_id, channel_db_id, pub_key, local_node_id, created_on;`,
+		entity.TagId, entity.ChannelDBId, entity.PubKey, entity.LocalNodeId, time.Now().UTC())
+	if err != nil {
+		if isUniqueViolation(err) {
+			return TaggedEntity{}, ErrEntityAlreadyTagged{entity.TagId}
+		}
+		switch constraint := foreignKeyViolation(err); constraint {
+		case "":
+			break
+		case "tagged_entity_tag_id_fkey":
+			return TaggedEntity{}, ErrTagNotFound{strconv.Itoa(entity.TagId)}
+		default:
+			return TaggedEntity{}, ErrTaggedEntityNotFound{constraint}
+		}
+		return TaggedEntity{}, errors.Wrap(err, "Unable to execute SQL statement")
+	}
+	return r, nil
 }
 
-func deleteTag(db *sqlx.DB, channelDBID int, tagID int) error {
-	_, err := db.Exec("DELETE FROM channel_tag WHERE channel_db_id = $1 AND tag_id = $2;", channelDBID, tagID)
+func deleteTaggedEntity(db *sqlx.DB, tagId int, taggedEntityId int) error {
+	_, err := db.Exec("DELETE FROM tagged_entity WHERE tag_id = $1 AND tagged_entity_id = $2;", tagId, taggedEntityId)
 	if err != nil {
 		return errors.Wrap(err, "Unable to execute SQL statement")
 	}
 	return nil
 }
+
+// GetTagChannelIds returns the LND short channel ids of all channels a tag applies to. That is
+// channels tagged directly, channels with a tagged peer and channels of a tagged local node.
+func GetTagChannelIds(db *sqlx.DB, name string) (chanIds []string, err error) {
+	tag, err := getTagByName(db, name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Select(&chanIds, `
+SELECT DISTINCT c.lnd_short_channel_id::text
+FROM channel c
+JOIN tagged_entity te ON te.channel_db_id = c.channel_db_id
+  OR te.pub_key = c.destination_pub_key
+  OR te.local_node_id = c.local_node_id
+WHERE te.tag_id = $1;`, tag.TagId)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to execute SQL query")
+	}
+	return chanIds, nil
+}
@@ -0,0 +1,150 @@
+package tags
+
+import (
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/lncapital/torq/testutil"
+	"github.com/pkg/errors"
+)
+
+func TestTags(t *testing.T) {
+	srv, err := testutil.InitTestDBConn()
+	if err != nil {
+		panic(err)
+	}
+
+	db, err := srv.NewTestDatabase(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := srv.Cleanup(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	var localNodeId int
+	err = db.Get(&localNodeId, "SELECT local_node_id FROM local_node LIMIT 1;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tag Tag
+	t.Run("Insert tag", func(t *testing.T) {
+		tag, err = insertTag(db, Tag{Name: "sink"})
+		if err != nil {
+			t.Fatalf("insertTag() error = %v", err)
+		}
+		if tag.TagId == 0 || tag.Name != "sink" {
+			t.Errorf("insertTag() = %v", tag)
+		}
+	})
+
+	t.Run("Duplicate tag name", func(t *testing.T) {
+		_, err := insertTag(db, Tag{Name: "sink"})
+		if _, ok := err.(ErrTagExists); !ok {
+			t.Errorf("insertTag() expected ErrTagExists, got %v", err)
+		}
+
+		other, err := insertTag(db, Tag{Name: "source"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		other.Name = "sink"
+		_, err = updateTag(db, other)
+		if _, ok := err.(ErrTagExists); !ok {
+			t.Errorf("updateTag() expected ErrTagExists, got %v", err)
+		}
+	})
+
+	var entity TaggedEntity
+	t.Run("Insert tagged entity", func(t *testing.T) {
+		entity, err = insertTaggedEntity(db, TaggedEntity{TagId: tag.TagId, LocalNodeId: &localNodeId})
+		if err != nil {
+			t.Fatalf("insertTaggedEntity() error = %v", err)
+		}
+		entities, err := getTaggedEntities(db, tag.TagId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entities) != 1 || entities[0].TaggedEntityId != entity.TaggedEntityId {
+			t.Errorf("getTaggedEntities() = %v", entities)
+		}
+	})
+
+	t.Run("Duplicate tagged entity", func(t *testing.T) {
+		_, err := insertTaggedEntity(db, TaggedEntity{TagId: tag.TagId, LocalNodeId: &localNodeId})
+		if _, ok := err.(ErrEntityAlreadyTagged); !ok {
+			t.Errorf("insertTaggedEntity() expected ErrEntityAlreadyTagged, got %v", err)
+		}
+
+		pubKey := "02aaaa"
+		_, err = insertTaggedEntity(db, TaggedEntity{TagId: tag.TagId, PubKey: &pubKey})
+		if err != nil {
+			t.Errorf("insertTaggedEntity() error = %v", err)
+		}
+	})
+
+	t.Run("Tagged entity that doesn't exist", func(t *testing.T) {
+		_, err := insertTaggedEntity(db, TaggedEntity{TagId: tag.TagId + 1000, LocalNodeId: &localNodeId})
+		if _, ok := err.(ErrTagNotFound); !ok {
+			t.Errorf("insertTaggedEntity() expected ErrTagNotFound, got %v", err)
+		}
+
+		unknownNodeId := localNodeId + 1000
+		_, err = insertTaggedEntity(db, TaggedEntity{TagId: tag.TagId, LocalNodeId: &unknownNodeId})
+		if _, ok := err.(ErrTaggedEntityNotFound); !ok {
+			t.Errorf("insertTaggedEntity() expected ErrTaggedEntityNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Delete tagged entity", func(t *testing.T) {
+		if err := deleteTaggedEntity(db, tag.TagId, entity.TaggedEntityId); err != nil {
+			t.Fatalf("deleteTaggedEntity() error = %v", err)
+		}
+		entities, err := getTaggedEntities(db, tag.TagId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entities) != 1 || entities[0].PubKey == nil {
+			t.Errorf("getTaggedEntities() = %v", entities)
+		}
+	})
+
+	t.Run("Delete tag", func(t *testing.T) {
+		if err := deleteTag(db, tag.TagId); err != nil {
+			t.Fatalf("deleteTag() error = %v", err)
+		}
+		if _, err := getTagByName(db, "sink"); err == nil {
+			t.Errorf("getTagByName() expected ErrTagNotFound after delete")
+		}
+		// Deleting a tag removes it from all entities.
+		entities, err := getTaggedEntities(db, tag.TagId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entities) != 0 {
+			t.Errorf("getTaggedEntities() = %v, expected none", entities)
+		}
+	})
+}
+
+func Test_isUniqueViolation(t *testing.T) {
+	if !isUniqueViolation(errors.Wrap(&pq.Error{Code: "23505"}, "insert")) {
+		t.Errorf("isUniqueViolation() = false for a unique violation")
+	}
+	if isUniqueViolation(&pq.Error{Code: "23503"}) {
+		t.Errorf("isUniqueViolation() = true for a foreign key violation")
+	}
+}
+
+func Test_foreignKeyViolation(t *testing.T) {
+	err := errors.Wrap(&pq.Error{Code: "23503", Constraint: "tagged_entity_tag_id_fkey"}, "insert")
+	if got := foreignKeyViolation(err); got != "tagged_entity_tag_id_fkey" {
+		t.Errorf("foreignKeyViolation() = %q, want tagged_entity_tag_id_fkey", got)
+	}
+	if got := foreignKeyViolation(&pq.Error{Code: "23505", Constraint: "tagged_entity_channel_idx"}); got != "" {
+		t.Errorf("foreignKeyViolation() = %q for a unique violation", got)
+	}
+}
@@ -6,64 +6,178 @@ import (
 	"github.com/lncapital/torq/pkg/server_errors"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 func RegisterTagRoutes(r *gin.RouterGroup, db *sqlx.DB) {
 	r.GET("", func(c *gin.Context) { getTagsHandler(c, db) })
 	r.POST("", func(c *gin.Context) { postTagHandler(c, db) })
+	r.PUT(":tagId", func(c *gin.Context) { putTagHandler(c, db) })
 	r.DELETE(":tagId", func(c *gin.Context) { deleteTagHandler(c, db) })
+	r.GET(":tagId/entities", func(c *gin.Context) { getTaggedEntitiesHandler(c, db) })
+	r.POST(":tagId/entities", func(c *gin.Context) { postTaggedEntityHandler(c, db) })
+	r.DELETE(":tagId/entities/:taggedEntityId", func(c *gin.Context) { deleteTaggedEntityHandler(c, db) })
 }
 
 func getTagsHandler(c *gin.Context, db *sqlx.DB) {
-	channelDBID, err := strconv.Atoi(c.Param("channelDbId"))
+	tags, err := getTags(db, c.Query("category"))
 	if err != nil {
 		server_errors.LogAndSendServerError(c, err)
 		return
 	}
-	tags, err := getTags(db, channelDBID)
-	if err != nil {
+	c.JSON(http.StatusOK, tags)
+}
+
+func postTagHandler(c *gin.Context, db *sqlx.DB) {
+	var tag Tag
+	if err := c.BindJSON(&tag); err != nil {
+		server_errors.SendBadRequestFromError(c, err)
+		return
+	}
+	tag.Name = strings.TrimSpace(tag.Name)
+	if tag.Name == "" {
+		server_errors.SendUnprocessableEntity(c, "Tag name is required")
+		return
+	}
+	r, err := insertTag(db, tag)
+	switch err.(type) {
+	case nil:
+		break
+	case ErrTagExists:
+		server_errors.SendConflictFromError(c, err)
+		return
+	default:
 		server_errors.LogAndSendServerError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, tags)
+	c.JSON(http.StatusOK, r)
 }
 
-func postTagHandler(c *gin.Context, db *sqlx.DB) {
-	channelDBID, err := strconv.Atoi(c.Param("channelDbId"))
+func putTagHandler(c *gin.Context, db *sqlx.DB) {
+	tagId, err := strconv.Atoi(c.Param("tagId"))
 	if err != nil {
-		server_errors.LogAndSendServerError(c, err)
+		server_errors.SendBadRequest(c, "Tag id must be a number")
 		return
 	}
-	var tag tag
+	var tag Tag
 	if err := c.BindJSON(&tag); err != nil {
+		server_errors.SendBadRequestFromError(c, err)
+		return
+	}
+	tag.TagId = tagId
+	tag.Name = strings.TrimSpace(tag.Name)
+	if tag.Name == "" {
+		server_errors.SendUnprocessableEntity(c, "Tag name is required")
+		return
+	}
+	r, err := updateTag(db, tag)
+	switch err.(type) {
+	case nil:
+		break
+	case ErrTagNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"Error": err.Error(), "Identifier": c.Param("tagId")})
+		return
+	case ErrTagExists:
+		server_errors.SendConflictFromError(c, err)
+		return
+	default:
 		server_errors.LogAndSendServerError(c, err)
 		return
 	}
-	tag.ChannelDBID = channelDBID
-	tagID, err := insertTag(db, tag)
+	c.JSON(http.StatusOK, r)
+}
+
+func deleteTagHandler(c *gin.Context, db *sqlx.DB) {
+	tagId, err := strconv.Atoi(c.Param("tagId"))
+	if err != nil {
+		server_errors.SendBadRequest(c, "Tag id must be a number")
+		return
+	}
+	err = deleteTag(db, tagId)
 	if err != nil {
 		server_errors.LogAndSendServerError(c, err)
 		return
 	}
-
-	c.JSON(http.StatusOK, map[string]interface{}{"tagId": tagID})
+	c.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully deleted tag"})
 }
 
-func deleteTagHandler(c *gin.Context, db *sqlx.DB) {
-	channelDBID, err := strconv.Atoi(c.Param("channelDbId"))
+func getTaggedEntitiesHandler(c *gin.Context, db *sqlx.DB) {
+	tagId, err := strconv.Atoi(c.Param("tagId"))
+	if err != nil {
+		server_errors.SendBadRequest(c, "Tag id must be a number")
+		return
+	}
+	entities, err := getTaggedEntities(db, tagId)
 	if err != nil {
 		server_errors.LogAndSendServerError(c, err)
 		return
 	}
-	tagID, err := strconv.Atoi(c.Param("tagId"))
+	c.JSON(http.StatusOK, entities)
+}
+
+func postTaggedEntityHandler(c *gin.Context, db *sqlx.DB) {
+	tagId, err := strconv.Atoi(c.Param("tagId"))
 	if err != nil {
+		server_errors.SendBadRequest(c, "Tag id must be a number")
+		return
+	}
+	var entity TaggedEntity
+	if err := c.BindJSON(&entity); err != nil {
+		server_errors.SendBadRequestFromError(c, err)
+		return
+	}
+	entity.TagId = tagId
+
+	targets := 0
+	if entity.ChannelDBId != nil {
+		targets++
+	}
+	if entity.PubKey != nil {
+		targets++
+	}
+	if entity.LocalNodeId != nil {
+		targets++
+	}
+	if targets != 1 {
+		server_errors.SendUnprocessableEntity(c, "Exactly one of channelDbId, pubKey or localNodeId is required")
+		return
+	}
+
+	r, err := insertTaggedEntity(db, entity)
+	switch err.(type) {
+	case nil:
+		break
+	case ErrEntityAlreadyTagged:
+		server_errors.SendConflictFromError(c, err)
+		return
+	case ErrTagNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"Error": err.Error(), "Identifier": c.Param("tagId")})
+		return
+	case ErrTaggedEntityNotFound:
+		server_errors.SendBadRequestFromError(c, err)
+		return
+	default:
 		server_errors.LogAndSendServerError(c, err)
 		return
 	}
-	err = deleteTag(db, channelDBID, tagID)
+	c.JSON(http.StatusOK, r)
+}
+
+func deleteTaggedEntityHandler(c *gin.Context, db *sqlx.DB) {
+	tagId, err := strconv.Atoi(c.Param("tagId"))
+	if err != nil {
+		server_errors.SendBadRequest(c, "Tag id must be a number")
+		return
+	}
+	taggedEntityId, err := strconv.Atoi(c.Param("taggedEntityId"))
+	if err != nil {
+		server_errors.SendBadRequest(c, "Tagged entity id must be a number")
+		return
+	}
+	err = deleteTaggedEntity(db, tagId, taggedEntityId)
 	if err != nil {
 		server_errors.LogAndSendServerError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully deleted tag"})
+	c.JSON(http.StatusOK, map[string]interface{}{"message": "Successfully removed tag"})
 }
@@ -5,10 +5,21 @@ import (
 	"time"
 )
 
-type tag struct {
-	TagID       int       `json:"tagId" db:"tag_id"`
-	ChannelDBID int       `json:"channelDBId" db:"channel_db_id"`
-	Tag         string    `json:"tag" db:"tag"`
-	CreatedOn   time.Time `json:"createdOn" db:"created_on"`
-	UpdateOn    null.Time `json:"updatedOn" db:"updated_on"`
+type Tag struct {
+	TagId     int       `json:"tagId" db:"tag_id"`
+	Name      string    `json:"name" db:"name"`
+	Colour    *string   `json:"colour" db:"colour"`
+	Category  *string   `json:"category" db:"category"`
+	CreatedOn time.Time `json:"createdOn" db:"created_on"`
+	UpdateOn  null.Time `json:"updatedOn" db:"updated_on"`
+}
+
+// TaggedEntity links a tag to exactly one of a channel, a peer (public key) or a local node.
+type TaggedEntity struct {
+	TaggedEntityId int       `json:"taggedEntityId" db:"tagged_entity_id"`
+	TagId          int       `json:"tagId" db:"tag_id"`
+	ChannelDBId    *int      `json:"channelDbId" db:"channel_db_id"`
+	PubKey         *string   `json:"pubKey" db:"pub_key"`
+	LocalNodeId    *int      `json:"localNodeId" db:"local_node_id"`
+	CreatedOn      time.Time `json:"createdOn" db:"created_on"`
 }
@@ -0,0 +1,126 @@
+package views
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lncapital/torq/internal/forwards"
+	"github.com/lncapital/torq/internal/invoices"
+	"github.com/lncapital/torq/internal/on_chain_tx"
+	"github.com/lncapital/torq/internal/payments"
+	qp "github.com/lncapital/torq/internal/query_parser"
+	ah "github.com/lncapital/torq/pkg/api_helpers"
+	"github.com/lncapital/torq/pkg/server_errors"
+)
+
+// getTableViewDataHandler runs the filter and sort of a saved view on the server and returns the
+// rows of the table the view belongs to. This allows scripts and exports to reuse a view by its id.
+func getTableViewDataHandler(c *gin.Context, db *sqlx.DB) {
+
+	id, err := strconv.Atoi(c.Param("viewId"))
+	if err != nil {
+		server_errors.SendBadRequest(c, "View id must be a number")
+		return
+	}
+
+	view, err := getTableView(db, id)
+	switch err.(type) {
+	case nil:
+		break
+	case ErrTableViewNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"Error": err.Error(), "Identifier": c.Param("viewId")})
+		return
+	default:
+		server_errors.LogAndSendServerError(c, err)
+		return
+	}
+
+	def, err := parseViewDefinition(view.View)
+	if err != nil {
+		server_errors.SendUnprocessableEntity(c, err.Error())
+		return
+	}
+
+	var limit uint64
+	if c.Query("limit") != "" {
+		limit, err = strconv.ParseUint(c.Query("limit"), 10, 64)
+		if err != nil || limit == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Limit must be a positive number"})
+			return
+		}
+	}
+
+	var offset uint64
+	if c.Query("offset") != "" {
+		offset, err = strconv.ParseUint(c.Query("offset"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Offset must be a positive number"})
+			return
+		}
+	}
+
+	var data interface{}
+	var total uint64
+
+	switch view.Page {
+	case PaymentsPage:
+		data, total, err = payments.QueryPayments(db, def.Filters, def.Order(), limit, offset)
+	case InvoicesPage:
+		data, total, err = invoices.QueryInvoices(db, def.Filters, def.Order(), limit, offset)
+	case OnChainPage:
+		data, total, err = on_chain_tx.QueryOnChainTxs(db, def.Filters, def.Order(), limit, offset)
+	case ForwardsPage:
+		// The forwards table is aggregated over a date range and is not paginated.
+		from, err := time.Parse("2006-01-02", c.Query("from"))
+		if err != nil {
+			server_errors.SendBadRequest(c, "from is required for forwards views (YYYY-MM-DD)")
+			return
+		}
+		to, err := time.Parse("2006-01-02", c.Query("to"))
+		if err != nil {
+			server_errors.SendBadRequest(c, "to is required for forwards views (YYYY-MM-DD)")
+			return
+		}
+		r, err := forwards.QueryForwards(db, from, to, def.Filters, def.Order())
+		if err != nil {
+			sendViewDataError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, ah.ApiResponse{
+			Data: r, Pagination: ah.Pagination{
+				Total: uint64(len(r)),
+			}})
+		return
+	default:
+		server_errors.SendUnprocessableEntity(c, "Unknown page: "+view.Page)
+		return
+	}
+
+	if err != nil {
+		sendViewDataError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ah.ApiResponse{
+		Data: data, Pagination: ah.Pagination{
+			Total:  total,
+			Limit:  limit,
+			Offset: offset,
+		}})
+}
+
+// sendViewDataError reports invalid saved filters and sorting as a bad request and everything else as
+// a server error.
+func sendViewDataError(c *gin.Context, err error) {
+	switch e := err.(type) {
+	case qp.ErrInvalidFilter:
+		c.JSON(http.StatusBadRequest, gin.H{"Error": e.Error(), "Key": e.Key})
+	case qp.ErrInvalidOrder:
+		c.JSON(http.StatusBadRequest, gin.H{"Error": e.Error(), "Key": e.Key})
+	default:
+		server_errors.LogAndSendServerError(c, err)
+	}
+}
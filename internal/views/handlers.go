@@ -1,6 +1,7 @@
 package views
 
 import (
+	"database/sql"
 	"github.com/cockroachdb/errors"
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
@@ -13,12 +14,19 @@ import (
 
 type TableView struct {
 	Id   int            `json:"id" db:"id"`
+	Page string         `json:"page" db:"page"`
 	View types.JSONText `json:"view" db:"view"`
 }
 
 func getTableViewsHandler(c *gin.Context, db *sqlx.DB) {
 
-	r, err := getTableViews(db)
+	page := c.Query("page")
+	if page != "" && !isValidPage(page) {
+		server_errors.SendBadRequest(c, "Unknown page: "+page)
+		return
+	}
+
+	r, err := getTableViews(db, page)
 	if err != nil {
 		server_errors.LogAndSendServerError(c, err)
 		return
@@ -26,10 +34,11 @@ func getTableViewsHandler(c *gin.Context, db *sqlx.DB) {
 	c.JSON(http.StatusOK, r)
 }
 
-func getTableViews(db *sqlx.DB) (r []*TableView, err error) {
-	sql := `Select id, view from table_view order by view_order;`
+// getTableViews returns all views, or only the views of a page when page is not empty.
+func getTableViews(db *sqlx.DB, page string) (r []*TableView, err error) {
+	sql := `Select id, page, view from table_view where ($1 = '' or page = $1) order by view_order;`
 
-	rows, err := db.Query(sql)
+	rows, err := db.Query(sql, page)
 	if err != nil {
 		return nil, err
 	}
@@ -37,7 +46,7 @@ func getTableViews(db *sqlx.DB) (r []*TableView, err error) {
 	for rows.Next() {
 		v := &TableView{}
 
-		err = rows.Scan(&v.Id, &v.View)
+		err = rows.Scan(&v.Id, &v.Page, &v.View)
 		if err != nil {
 			return r, err
 		}
@@ -48,7 +57,28 @@ func getTableViews(db *sqlx.DB) (r []*TableView, err error) {
 	return r, nil
 }
 
+type ErrTableViewNotFound struct {
+	Id int
+}
+
+func (e ErrTableViewNotFound) Error() string {
+	return "Table view not found"
+}
+
+func getTableView(db *sqlx.DB, id int) (r TableView, err error) {
+	err = db.QueryRowx(`Select id, page, view from table_view where id = $1;`, id).Scan(&r.Id, &r.Page, &r.View)
+	switch err {
+	case nil:
+		return r, nil
+	case sql.ErrNoRows:
+		return r, ErrTableViewNotFound{id}
+	default:
+		return r, errors.Wrap(err, "Unable to get view. SQL statement error")
+	}
+}
+
 type NewTableView struct {
+	Page string         `json:"page" db:"page"`
 	View types.JSONText `json:"view" db:"view"`
 }
 
@@ -61,6 +91,19 @@ func insertTableViewsHandler(c *gin.Context, db *sqlx.DB) {
 		return
 	}
 
+	if view.Page == "" {
+		view.Page = ForwardsPage
+	}
+	if !isValidPage(view.Page) {
+		server_errors.SendBadRequest(c, "Unknown page: "+view.Page)
+		return
+	}
+	err = validateViewDefinition(view.Page, view.View)
+	if err != nil {
+		server_errors.SendBadRequestFromError(c, err)
+		return
+	}
+
 	r, err := insertTableView(db, view)
 	if err != nil {
 		server_errors.LogAndSendServerError(c, err)
@@ -72,11 +115,11 @@ func insertTableViewsHandler(c *gin.Context, db *sqlx.DB) {
 func insertTableView(db *sqlx.DB, view *NewTableView) (r TableView, err error) {
 
 	sql := `
-		INSERT INTO table_view (view, created_on) values ($1, $2)
-		RETURNING id, view;
+		INSERT INTO table_view (page, view, created_on) values ($1, $2, $3)
+		RETURNING id, page, view;
 	`
 
-	err = db.QueryRowx(sql, &view.View, time.Now().UTC()).Scan(&r.Id, &r.View)
+	err = db.QueryRowx(sql, view.Page, &view.View, time.Now().UTC()).Scan(&r.Id, &r.Page, &r.View)
 	if err != nil {
 		return TableView{}, errors.Wrap(err, "Unable to create view. SQL statement error")
 	}
@@ -93,6 +136,24 @@ func updateTableViewHandler(c *gin.Context, db *sqlx.DB) {
 		return
 	}
 
+	// The page of a view can't be changed, the stored view tells which page the new definition is for.
+	stored, err := getTableView(db, view.Id)
+	switch err.(type) {
+	case nil:
+		break
+	case ErrTableViewNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"Error": err.Error(), "Identifier": view.Id})
+		return
+	default:
+		server_errors.LogAndSendServerError(c, err)
+		return
+	}
+	err = validateViewDefinition(stored.Page, view.View)
+	if err != nil {
+		server_errors.SendBadRequestFromError(c, err)
+		return
+	}
+
 	r, err := updateTableView(db, view)
 	if err != nil {
 		server_errors.LogAndSendServerError(c, err)
@@ -103,9 +164,9 @@ func updateTableViewHandler(c *gin.Context, db *sqlx.DB) {
 
 func updateTableView(db *sqlx.DB, view *TableView) (TableView, error) {
 
-	sql := `UPDATE table_view SET view = $1, updated_on = $2 WHERE id = $3;`
+	sql := `UPDATE table_view SET view = $1, updated_on = $2 WHERE id = $3 RETURNING page;`
 
-	_, err := db.Exec(sql, &view.View, time.Now().UTC(), &view.Id)
+	err := db.QueryRowx(sql, &view.View, time.Now().UTC(), view.Id).Scan(&view.Page)
 	if err != nil {
 		return TableView{}, errors.Wrap(err, "Unable to create view. SQL statement error")
 	}
@@ -11,4 +11,5 @@ func RegisterTableViewRoutes(r *gin.RouterGroup, db *sqlx.DB) {
 	r.PUT("", func(c *gin.Context) { updateTableViewHandler(c, db) }) // TODO: Change to PATCH
 	r.PATCH("/order", func(c *gin.Context) { updateTableViewOrderHandler(c, db) })
 	r.DELETE(":viewId", func(c *gin.Context) { deleteTableViewsHandler(c, db) })
+	r.GET(":viewId/data", func(c *gin.Context) { getTableViewDataHandler(c, db) })
 }
@@ -0,0 +1,142 @@
+package views
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jmoiron/sqlx/types"
+	qp "github.com/lncapital/torq/internal/query_parser"
+)
+
+// The pages (tables) a view can be created for.
+const (
+	ForwardsPage = "forwards"
+	PaymentsPage = "payments"
+	InvoicesPage = "invoices"
+	OnChainPage  = "onChain"
+)
+
+func isValidPage(page string) bool {
+	switch page {
+	case ForwardsPage, PaymentsPage, InvoicesPage, OnChainPage:
+		return true
+	default:
+		return false
+	}
+}
+
+// How the rows of a forwards view are grouped.
+const (
+	GroupByChannels = "channels"
+	GroupByPeers    = "peers"
+)
+
+// ViewColumn is a column shown in the table of a view.
+type ViewColumn struct {
+	Heading   string  `json:"heading"`
+	Key       string  `json:"key"`
+	Type      string  `json:"type,omitempty"`
+	Width     float64 `json:"width,omitempty"`
+	Locked    bool    `json:"locked,omitempty"`
+	ValueType string  `json:"valueType"`
+}
+
+type ViewSortBy struct {
+	// The column to sort by
+	Value     string `json:"value"`
+	Label     string `json:"label"`
+	Direction string `json:"direction"`
+}
+
+// ViewDefinition is the part of a table view the server uses to query the table of the view. Views are
+// stored as the frontend sends them, so fields only the frontend uses (filter categories, column totals, etc.)
+// are kept.
+type ViewDefinition struct {
+	Columns []ViewColumn      `json:"columns"`
+	Filters *qp.FilterClauses `json:"filters,omitempty"`
+	SortBy  []ViewSortBy      `json:"sortBy"`
+	GroupBy string            `json:"groupBy,omitempty"`
+}
+
+// ErrInvalidView is returned when the columns, filters, sorting or grouping of a view can't be read.
+type ErrInvalidView struct {
+	Reason string
+}
+
+func (e ErrInvalidView) Error() string {
+	return "Invalid view: " + e.Reason
+}
+
+func parseViewDefinition(view types.JSONText) (r ViewDefinition, err error) {
+	err = json.Unmarshal(view, &r)
+	if err != nil {
+		return ViewDefinition{}, ErrInvalidView{Reason: err.Error()}
+	}
+	return r, nil
+}
+
+// validateViewDefinition returns an ErrInvalidView when the view can't be used on the page.
+func validateViewDefinition(page string, view types.JSONText) error {
+	def, err := parseViewDefinition(view)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]bool)
+	for _, c := range def.Columns {
+		if c.Key == "" {
+			return ErrInvalidView{Reason: "a column has no key"}
+		}
+		if keys[c.Key] {
+			return ErrInvalidView{Reason: fmt.Sprintf("the column %s is shown twice", c.Key)}
+		}
+		keys[c.Key] = true
+	}
+
+	for _, s := range def.SortBy {
+		if s.Value == "" {
+			return ErrInvalidView{Reason: "a sort has no column"}
+		}
+		if s.Direction != "asc" && s.Direction != "desc" {
+			return ErrInvalidView{Reason: fmt.Sprintf("%s is not a valid sort direction", s.Direction)}
+		}
+	}
+
+	switch def.GroupBy {
+	case "":
+		break
+	case GroupByChannels, GroupByPeers:
+		if page != ForwardsPage {
+			return ErrInvalidView{Reason: "only forwards views can be grouped"}
+		}
+	default:
+		return ErrInvalidView{Reason: fmt.Sprintf("%s is not a valid grouping", def.GroupBy)}
+	}
+
+	if def.Filters != nil && !def.Filters.IsEmpty() {
+		// The columns are checked when the view is used, here only the functions and parameters are checked.
+		_, err = qp.NewParser(filterKeys(*def.Filters, nil)).ParseFilterClauses(*def.Filters)
+		if err != nil {
+			return ErrInvalidView{Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+func filterKeys(f qp.FilterClauses, keys []string) []string {
+	for _, c := range append(f.And, f.Or...) {
+		keys = filterKeys(c, keys)
+	}
+	if f.Filter.Key != "" {
+		keys = append(keys, f.Filter.Key)
+	}
+	return keys
+}
+
+// Order returns the sort order of the view in the format used by the query parser.
+func (v ViewDefinition) Order() (order []qp.Order) {
+	for _, s := range v.SortBy {
+		order = append(order, qp.Order{Key: s.Value, Direction: s.Direction})
+	}
+	return order
+}
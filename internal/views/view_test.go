@@ -0,0 +1,118 @@
+package views
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	qp "github.com/lncapital/torq/internal/query_parser"
+)
+
+// frontendView is a forwards view as the frontend saves it, including the fields only the frontend uses.
+const frontendView = `{
+	"title": "Default View",
+	"saved": true,
+	"columns": [
+		{"heading": "Name", "type": "AliasCell", "key": "alias", "locked": true, "valueType": "string"},
+		{"heading": "Revenue", "type": "BarCell", "key": "revenue_out", "valueType": "number", "total": 1200,
+			"max": 800}
+	],
+	"filters": {"$and": [
+		{"$filter": {"funcName": "gt", "category": "number", "key": "amount_total", "parameter": 0}},
+		{"$or": [
+			{"$filter": {"funcName": "eq", "category": "string", "key": "alias", "parameter": "bob",
+				"selectOptions": [{"value": "bob", "label": "bob"}], "value": "bob", "label": "Name"}}
+		]}
+	]},
+	"sortBy": [{"value": "revenue_out", "label": "Revenue", "direction": "desc"}]
+}`
+
+func Test_viewRoundTrip(t *testing.T) {
+	v := NewTableView{}
+	err := json.Unmarshal([]byte(`{"page": "forwards", "view": `+frontendView+`}`), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(TableView{Id: 1, Page: v.Page, View: v.View})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := TableView{}
+	if err = json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	var want, gotView interface{}
+	if err = json.Unmarshal([]byte(frontendView), &want); err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(got.View, &gotView); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotView, want) {
+		t.Errorf("view changed in round trip\nGot:\n%s\nWant:\n%s", got.View, frontendView)
+	}
+}
+
+func Test_parseViewDefinition(t *testing.T) {
+	def, err := parseViewDefinition([]byte(frontendView))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantOrder := []qp.Order{{Key: "revenue_out", Direction: "desc"}}
+	if !reflect.DeepEqual(def.Order(), wantOrder) {
+		t.Errorf("Order() = %v, want %v", def.Order(), wantOrder)
+	}
+
+	f, err := qp.NewParser([]string{"amount_total", "alias"}).ParseFilterClauses(*def.Filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, args, err := f.ToSql()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sql != "(amount_total > ? AND (alias = ?))" || !reflect.DeepEqual(args, []interface{}{float64(0), "bob"}) {
+		t.Errorf("filter = %s %v", sql, args)
+	}
+
+	if _, err = parseViewDefinition([]byte(`{"filters": []}`)); err == nil {
+		t.Errorf("parseViewDefinition() expected an error for invalid filters")
+	}
+}
+
+func Test_validateViewDefinition(t *testing.T) {
+	tests := []struct {
+		name    string
+		page    string
+		view    string
+		wantErr bool
+	}{
+		{"frontend view", ForwardsPage, frontendView, false},
+		{"grouped by peers", ForwardsPage, `{"groupBy": "peers"}`, false},
+		{"empty filters", PaymentsPage, `{"filters": {"$and": []}}`, false},
+		{"not json", ForwardsPage, `[1]`, true},
+		{"column without key", ForwardsPage, `{"columns": [{"heading": "Name", "valueType": "string"}]}`, true},
+		{"column twice", ForwardsPage, `{"columns": [{"key": "alias"}, {"key": "alias"}]}`, true},
+		{"column as string", ForwardsPage, `{"columns": ["alias"]}`, true},
+		{"sort direction", ForwardsPage, `{"sortBy": [{"value": "alias", "direction": "up"}]}`, true},
+		{"sort without column", ForwardsPage, `{"sortBy": [{"direction": "asc"}]}`, true},
+		{"unknown grouping", ForwardsPage, `{"groupBy": "nodes"}`, true},
+		{"grouped payments", PaymentsPage, `{"groupBy": "channels"}`, true},
+		{"filter function", InvoicesPage, `{"filters": {"$filter": {"funcName": "near", "key": "value"}}}`, true},
+		{"filter without key", InvoicesPage, `{"filters": {"$and": [{"$filter": {"funcName": "eq"}}]}}`, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateViewDefinition(test.page, []byte(test.view))
+			if (err != nil) != test.wantErr {
+				t.Errorf("validateViewDefinition() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if _, ok := err.(ErrInvalidView); err != nil && !ok {
+				t.Errorf("validateViewDefinition() error = %T, want ErrInvalidView", err)
+			}
+		})
+	}
+}
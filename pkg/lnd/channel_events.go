@@ -10,6 +10,8 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/lncapital/torq/internal/channels"
+	"github.com/lncapital/torq/internal/metrics"
+	"github.com/lncapital/torq/internal/pubsub"
 	// "github.com/rs/zerolog/log"
 	"go.uber.org/ratelimit"
 	"google.golang.org/grpc"
@@ -227,6 +229,8 @@ func SubscribeAndStoreChannelEvents(ctx context.Context, client lndClientSubscri
 			continue
 		}
 
+		metrics.SubscriptionEvents("channel_events", 1)
+
 		err = storeChannelEvent(db, chanEvent, localNodeId)
 		if err != nil {
 			fmt.Printf("Subscribe channel events store event error: %v", err)
@@ -235,11 +239,30 @@ func SubscribeAndStoreChannelEvents(ctx context.Context, client lndClientSubscri
 			continue
 		}
 
+		pubsub.Publish(pubsub.Event{
+			Topic:       pubsub.TopicChannelEvents,
+			LocalNodeId: localNodeId,
+			ChannelIds:  channelEventChanIds(chanEvent),
+			Data:        chanEvent,
+		})
 	}
 
 	return nil
 }
 
+// channelEventChanIds returns the channel id of open and close events. Other channel events only
+// contain the channel point.
+func channelEventChanIds(ce *lnrpc.ChannelEventUpdate) []uint64 {
+	switch {
+	case ce.GetOpenChannel() != nil:
+		return []uint64{ce.GetOpenChannel().ChanId}
+	case ce.GetClosedChannel() != nil:
+		return []uint64{ce.GetClosedChannel().ChanId}
+	default:
+		return nil
+	}
+}
+
 func ImportChannelList(t lnrpc.ChannelEventUpdate_UpdateType, db *sqlx.DB, client lnrpc.LightningClient, localNodeId int) error {
 
 	ctx := context.Background()
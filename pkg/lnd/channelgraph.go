@@ -8,6 +8,8 @@ import (
 	"github.com/lib/pq"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/lncapital/torq/internal/channels"
+	"github.com/lncapital/torq/internal/metrics"
+	"github.com/lncapital/torq/internal/pubsub"
 	"github.com/rs/zerolog/log"
 	"go.uber.org/ratelimit"
 	"golang.org/x/exp/slices"
@@ -21,7 +23,8 @@ type subscribeChannelGrpahClient interface {
 }
 
 // SubscribeAndStoreChannelGraph Subscribes to channel updates
-func SubscribeAndStoreChannelGraph(ctx context.Context, client subscribeChannelGrpahClient, db *sqlx.DB, ourNodePubKeys []string) error {
+func SubscribeAndStoreChannelGraph(ctx context.Context, client subscribeChannelGrpahClient, db *sqlx.DB,
+	ourNodePubKeys []string, localNodeId int) error {
 
 	req := lnrpc.GraphTopologySubscription{}
 	stream, err := client.SubscribeChannelGraph(ctx, &req)
@@ -61,12 +64,14 @@ func SubscribeAndStoreChannelGraph(ctx context.Context, client subscribeChannelG
 			continue
 		}
 
+		metrics.SubscriptionEvents("channel_graph", len(gpu.NodeUpdates)+len(gpu.ChannelUpdates))
+
 		err = processNodeUpdates(gpu.NodeUpdates, db, ourNodePubKeys)
 		if err != nil {
 			return errors.Wrap(err, "Process node updates")
 		}
 
-		err = processChannelUpdates(gpu.ChannelUpdates, db, ourNodePubKeys)
+		err = processChannelUpdates(gpu.ChannelUpdates, db, ourNodePubKeys, localNodeId)
 		if err != nil {
 			return errors.Wrap(err, "Process channel updates")
 		}
@@ -97,7 +102,8 @@ func processNodeUpdates(nus []*lnrpc.NodeUpdate, db *sqlx.DB, ourNodePubKeys []s
 	return nil
 }
 
-func processChannelUpdates(cus []*lnrpc.ChannelEdgeUpdate, db *sqlx.DB, ourNodePubKeys []string) error {
+func processChannelUpdates(cus []*lnrpc.ChannelEdgeUpdate, db *sqlx.DB, ourNodePubKeys []string,
+	localNodeId int) error {
 	for _, cu := range cus {
 		// Check if this channel update is relevant to one of our channels
 		// And if one of our nodes is advertising the channel update (meaning
@@ -118,6 +124,13 @@ func processChannelUpdates(cus []*lnrpc.ChannelEdgeUpdate, db *sqlx.DB, ourNodeP
 				return errors.Wrapf(err, "SubscribeChannelEvents ->insertRoutingPolicy(%v, %s, %t, %v)",
 					db, ts, ourNode, cu)
 			}
+
+			pubsub.Publish(pubsub.Event{
+				Topic:       pubsub.TopicPolicyUpdates,
+				LocalNodeId: localNodeId,
+				ChannelIds:  []uint64{cu.ChanId},
+				Data:        cu,
+			})
 		}
 
 	}
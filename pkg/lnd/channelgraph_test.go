@@ -287,7 +287,7 @@ func simulateChannelGraphUpdate(t *testing.T, db *sqlx.DB, client *stubLNDSubscr
 	ourNodePubKeys := []string{"ourNodePubkey"}
 
 	errs.Go(func() error {
-		err := SubscribeAndStoreChannelGraph(ctx, client, db, ourNodePubKeys)
+		err := SubscribeAndStoreChannelGraph(ctx, client, db, ourNodePubKeys, 1)
 		if err != nil {
 			t.Fatalf("Problem subscribing to channel graph: %v", err)
 		}
@@ -11,6 +11,8 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/lncapital/torq/internal/channels"
+	"github.com/lncapital/torq/internal/metrics"
+	"github.com/lncapital/torq/internal/pubsub"
 	"go.uber.org/ratelimit"
 	"google.golang.org/grpc"
 )
@@ -47,8 +49,8 @@ func convMicro(ns uint64) time.Time {
 	return time.Unix(0, int64(ns)).Round(time.Microsecond).UTC()
 }
 
-// storeForwardingHistory
-func storeForwardingHistory(db *sqlx.DB, fwh []*lnrpc.ForwardingEvent) error {
+// storeForwardingHistory stores the forwards and publishes the ones that were not stored before.
+func storeForwardingHistory(db *sqlx.DB, fwh []*lnrpc.ForwardingEvent, localNodeId int) error {
 
 	const querySfwh = `INSERT INTO forward(time, time_ns, fee_msat,
 		lnd_incoming_short_channel_id, lnd_outgoing_short_channel_id,
@@ -60,22 +62,36 @@ func storeForwardingHistory(db *sqlx.DB, fwh []*lnrpc.ForwardingEvent) error {
 	if len(fwh) > 0 {
 		tx := db.MustBegin()
 
+		var stored []*lnrpc.ForwardingEvent
 		for _, event := range fwh {
 
 			incomingShortChannelId := channels.ConvertLNDShortChannelID(event.ChanIdIn)
 			outgoingShortChannelId := channels.ConvertLNDShortChannelID(event.ChanIdOut)
 
-			if _, err := tx.Exec(querySfwh, convMicro(event.TimestampNs), event.TimestampNs,
+			res, err := tx.Exec(querySfwh, convMicro(event.TimestampNs), event.TimestampNs,
 				event.FeeMsat, event.ChanIdIn, event.ChanIdOut, incomingShortChannelId, outgoingShortChannelId, event.AmtInMsat,
-				event.AmtOutMsat); err != nil {
+				event.AmtOutMsat)
+			if err != nil {
 				return errors.Wrapf(err, "storeForwardingHistory->tx.Exec(%v)",
 					querySfwh)
 			}
+			if n, err := res.RowsAffected(); err == nil && n > 0 {
+				stored = append(stored, event)
+			}
 		}
 		err := tx.Commit()
 		if err != nil {
 			return err
 		}
+
+		for _, event := range stored {
+			pubsub.Publish(pubsub.Event{
+				Topic:       pubsub.TopicForwards,
+				LocalNodeId: localNodeId,
+				ChannelIds:  []uint64{event.ChanIdIn, event.ChanIdOut},
+				Data:        event,
+			})
+		}
 	}
 
 	return nil
@@ -139,7 +155,7 @@ type FwhOptions struct {
 // SubscribeForwardingEvents repeatedly requests forwarding history starting after the last
 // forwarding stored in the database and stores new forwards.
 func SubscribeForwardingEvents(ctx context.Context, client lightningClientForwardingHistory,
-	db *sqlx.DB, opt *FwhOptions) error {
+	db *sqlx.DB, localNodeId int, opt *FwhOptions) error {
 
 	me := MAXEVENTS
 
@@ -186,8 +202,10 @@ func SubscribeForwardingEvents(ctx context.Context, client lightningClientForwar
 					continue
 				}
 
+				metrics.SubscriptionEvents("forwards", len(fwh.ForwardingEvents))
+
 				// Store the forwarding history
-				err = storeForwardingHistory(db, fwh.ForwardingEvents)
+				err = storeForwardingHistory(db, fwh.ForwardingEvents, localNodeId)
 				if err != nil {
 					log.Printf("Subscribe forwarding events: %v\n", err)
 				}
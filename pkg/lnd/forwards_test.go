@@ -150,7 +150,7 @@ func TestSubscribeForwardingEvents(t *testing.T) {
 	// Start subscribing in a goroutine to allow the test to continue simulating time through the
 	// mocked time object.
 	errs.Go(func() error {
-		err := SubscribeForwardingEvents(ctx, &mclient, db, &opt)
+		err := SubscribeForwardingEvents(ctx, &mclient, db, 1, &opt)
 		if err != nil {
 			t.Fatal(errors.Wrapf(err, "SubscribeForwardingEvents(%v, %v, %v, %v)", ctx,
 				mclient, db, &opt))
@@ -8,6 +8,8 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
 	"github.com/lncapital/torq/internal/channels"
+	"github.com/lncapital/torq/internal/metrics"
+	"github.com/lncapital/torq/internal/pubsub"
 	"github.com/rs/zerolog/log"
 	"go.uber.org/ratelimit"
 	"time"
@@ -243,7 +245,8 @@ func storeForwardEvent(db *sqlx.DB, h *routerrpc.HtlcEvent, fwe *routerrpc.Forwa
 // SubscribeAndStoreHtlcEvents subscribes to HTLC events from LND and stores them in the database as time series.
 // NB: LND has marked HTLC event streaming as experimental. Delivery is not guaranteed, so dataset might not be complete
 // HTLC events is primarily used to diagnose how good a channel / node is. And if the channel allocation should change.
-func SubscribeAndStoreHtlcEvents(ctx context.Context, router routerrpc.RouterClient, db *sqlx.DB) error {
+func SubscribeAndStoreHtlcEvents(ctx context.Context, router routerrpc.RouterClient, db *sqlx.DB,
+	localNodeId int) error {
 
 	htlcStream, err := router.SubscribeHtlcEvents(ctx, &routerrpc.SubscribeHtlcEventsRequest{})
 	if err != nil {
@@ -283,6 +286,8 @@ func SubscribeAndStoreHtlcEvents(ctx context.Context, router routerrpc.RouterCli
 			continue
 		}
 
+		metrics.SubscriptionEvents("htlc_events", 1)
+
 		switch htlcEvent.Event.(type) {
 		case *routerrpc.HtlcEvent_ForwardEvent:
 			err = storeForwardEvent(db, htlcEvent, htlcEvent.GetForwardEvent())
@@ -312,6 +317,18 @@ func SubscribeAndStoreHtlcEvents(ctx context.Context, router routerrpc.RouterCli
 				// rate limit for caution but hopefully not needed
 				rl.Take()
 			}
+		default:
+			// Other events are not stored
+			continue
+		}
+
+		if err == nil {
+			pubsub.Publish(pubsub.Event{
+				Topic:       pubsub.TopicHtlcEvents,
+				LocalNodeId: localNodeId,
+				ChannelIds:  []uint64{htlcEvent.IncomingChannelId, htlcEvent.OutgoingChannelId},
+				Data:        htlcEvent,
+			})
 		}
 
 	}
@@ -10,6 +10,8 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/lightningnetwork/lnd/zpay32"
+	"github.com/lncapital/torq/internal/metrics"
+	"github.com/lncapital/torq/internal/pubsub"
 	"github.com/rs/zerolog/log"
 	"go.uber.org/ratelimit"
 	"google.golang.org/grpc"
@@ -189,7 +191,7 @@ func fetchLastInvoiceIndexes(db *sqlx.DB) (addIndex uint64, settleIndex uint64,
 	return addIndex, settleIndex, nil
 }
 
-func SubscribeAndStoreInvoices(ctx context.Context, client invoicesClient, db *sqlx.DB) error {
+func SubscribeAndStoreInvoices(ctx context.Context, client invoicesClient, db *sqlx.DB, localNodeId int) error {
 
 	// Get the latest settle and add index to prevent duplicate entries.
 	addIndex, settleIndex, err := fetchLastInvoiceIndexes(db)
@@ -241,6 +243,8 @@ func SubscribeAndStoreInvoices(ctx context.Context, client invoicesClient, db *s
 			continue
 		}
 
+		metrics.SubscriptionEvents("invoices", 1)
+
 		var destinationPublicKey = ""
 		// if empty payment request invoice is likely keysend
 		if invoice.PaymentRequest != "" {
@@ -260,7 +264,20 @@ func SubscribeAndStoreInvoices(ctx context.Context, client invoicesClient, db *s
 			log.Error().Msgf("Subscribe and store invoices: %v", err)
 			// rate limit for caution but hopefully not needed
 			rl.Take()
+			continue
+		}
+
+		// The channels the invoice was paid through
+		var chanIds []uint64
+		for _, htlc := range invoice.Htlcs {
+			chanIds = append(chanIds, htlc.ChanId)
 		}
+		pubsub.Publish(pubsub.Event{
+			Topic:       pubsub.TopicInvoices,
+			LocalNodeId: localNodeId,
+			ChannelIds:  chanIds,
+			Data:        invoice,
+		})
 	}
 
 	return nil
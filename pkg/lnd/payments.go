@@ -7,8 +7,11 @@ import (
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/cockroachdb/errors"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/lightningnetwork/lnd/zpay32"
+	"github.com/lncapital/torq/internal/metrics"
+	"github.com/lncapital/torq/internal/pubsub"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
 	"time"
@@ -26,7 +29,8 @@ type PayOptions struct {
 	Tick <-chan time.Time
 }
 
-func SubscribeAndStorePayments(ctx context.Context, client lightningClient_ListPayments, db *sqlx.DB, opt *PayOptions) error {
+func SubscribeAndStorePayments(ctx context.Context, client lightningClient_ListPayments, db *sqlx.DB,
+	localNodeId int, opt *PayOptions) error {
 
 	// Create the default ticker used to fetch forwards at a set interval
 	c := clock.New()
@@ -67,12 +71,15 @@ func SubscribeAndStorePayments(ctx context.Context, client lightningClient_ListP
 
 				last = p.LastIndexOffset
 
+				metrics.SubscriptionEvents("payments", len(p.Payments))
+
 				// Store the payments
 				err = storePayments(db, p.Payments)
 				if err != nil {
 					log.Printf("Store payments: %v\n", err)
 					break
 				}
+				publishPayments(p.Payments, localNodeId)
 
 				// Stop fetching if there are fewer forwards than max requested
 				// (indicates that we have the last forwarding record)
@@ -84,6 +91,24 @@ func SubscribeAndStorePayments(ctx context.Context, client lightningClient_ListP
 	}
 }
 
+// publishPayments publishes the stored payments. The channel ids are the first hops of the attempted routes.
+func publishPayments(payments []*lnrpc.Payment, localNodeId int) {
+	for _, payment := range payments {
+		var chanIds []uint64
+		for _, htlc := range payment.Htlcs {
+			if htlc.Route != nil && len(htlc.Route.Hops) > 0 {
+				chanIds = append(chanIds, htlc.Route.Hops[0].ChanId)
+			}
+		}
+		pubsub.Publish(pubsub.Event{
+			Topic:       pubsub.TopicPayments,
+			LocalNodeId: localNodeId,
+			ChannelIds:  chanIds,
+			Data:        payment,
+		})
+	}
+}
+
 func fetchLastPaymentIndex(db *sqlx.DB) (uint64, error) {
 	var last uint64
 
@@ -117,6 +142,25 @@ func fetchPayments(ctx context.Context, client lightningClient_ListPayments, las
 	return r, nil
 }
 
+// fetchProbeHashes returns the payment hashes of the payments that are probes sent by Torq.
+func fetchProbeHashes(db *sqlx.DB, p []*lnrpc.Payment) (map[string]bool, error) {
+	var hashes []string
+	for _, payment := range p {
+		hashes = append(hashes, payment.PaymentHash)
+	}
+	var probes []string
+	err := db.Select(&probes, `SELECT payment_hash FROM payment_probe WHERE payment_hash = ANY($1);`,
+		pq.Array(hashes))
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching probe payment hashes")
+	}
+	r := make(map[string]bool, len(probes))
+	for _, h := range probes {
+		r[h] = true
+	}
+	return r, nil
+}
+
 func storePayments(db *sqlx.DB, p []*lnrpc.Payment) error {
 
 	const q = `INSERT INTO payment(
@@ -136,9 +180,18 @@ func storePayments(db *sqlx.DB, p []*lnrpc.Payment) error {
 			  ON CONFLICT (creation_timestamp, payment_index) DO NOTHING;`
 
 	if len(p) > 0 {
+		// Probes are failed payments in LND, they're not stored.
+		probes, err := fetchProbeHashes(db, p)
+		if err != nil {
+			return err
+		}
+
 		tx := db.MustBegin()
 
 		for _, payment := range p {
+			if probes[payment.PaymentHash] {
+				continue
+			}
 
 			htlcJson, err := json.Marshal(payment.Htlcs)
 			if err != nil {
@@ -162,7 +215,7 @@ func storePayments(db *sqlx.DB, p []*lnrpc.Payment) error {
 				return errors.Wrapf(err, "store payments: db exec")
 			}
 		}
-		err := tx.Commit()
+		err = tx.Commit()
 		if err != nil {
 			return err
 		}
@@ -171,7 +224,8 @@ func storePayments(db *sqlx.DB, p []*lnrpc.Payment) error {
 	return nil
 }
 
-func SubscribeAndUpdatePayments(ctx context.Context, client lightningClient_ListPayments, db *sqlx.DB, opt *PayOptions) error {
+func SubscribeAndUpdatePayments(ctx context.Context, client lightningClient_ListPayments, db *sqlx.DB,
+	localNodeId int, opt *PayOptions) error {
 
 	// Create the default ticker used to fetch forwards at a set interval
 	c := clock.New()
@@ -212,12 +266,15 @@ func SubscribeAndUpdatePayments(ctx context.Context, client lightningClient_List
 					continue
 				}
 
+				metrics.SubscriptionEvents("payment_updates", len(p.Payments))
+
 				// Store the payments
 				err = updatePayments(db, p.Payments)
 				if err != nil {
 					log.Printf("Subscribe and update payments: %v\n", err)
 					continue
 				}
+				publishPayments(p.Payments, localNodeId)
 			}
 		}
 	}
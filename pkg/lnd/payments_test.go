@@ -194,7 +194,7 @@ func TestSubscribePayments(t *testing.T) {
 	// Start subscribing in a goroutine to allow the test to continue simulating time through the
 	// mocked time object.
 	errs.Go(func() error {
-		err := SubscribeAndStorePayments(ctx, &mclient, db, &opt)
+		err := SubscribeAndStorePayments(ctx, &mclient, db, 1, &opt)
 		if err != nil {
 			t.Fatal(errors.Wrapf(err, "SubscribeAndStorePayments(%v, %v, %v, %v)", ctx, mclient, db, &opt))
 		}
@@ -327,7 +327,7 @@ func TestSubscribePayments(t *testing.T) {
 	}
 
 	errs.Go(func() error {
-		err := SubscribeAndUpdatePayments(ctx, &mclientUpdate, db, &opt)
+		err := SubscribeAndUpdatePayments(ctx, &mclientUpdate, db, 1, &opt)
 		if err != nil {
 			t.Fatal(errors.Wrapf(err, "SubscribeAndUpdatePayments(%v, %v, %v, %v)", ctx, mclientUpdate, db, &opt))
 		}
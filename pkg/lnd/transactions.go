@@ -7,6 +7,8 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lncapital/torq/internal/metrics"
+	"github.com/lncapital/torq/internal/pubsub"
 	"go.uber.org/ratelimit"
 	"log"
 	"time"
@@ -53,7 +55,8 @@ func ImportTransactions(ctx context.Context, client lnrpc.LightningClient, db *s
 
 // SubscribeAndStoreTransactions Subscribes to on-chain transaction events from LND and stores them in the
 // database as a time series. It will also import unregistered transactions on startup.
-func SubscribeAndStoreTransactions(ctx context.Context, client lnrpc.LightningClient, db *sqlx.DB) error {
+func SubscribeAndStoreTransactions(ctx context.Context, client lnrpc.LightningClient, db *sqlx.DB,
+	localNodeId int) error {
 
 	// Imports transactions not captured on the stream
 	err := ImportTransactions(ctx, client, db)
@@ -96,6 +99,8 @@ func SubscribeAndStoreTransactions(ctx context.Context, client lnrpc.LightningCl
 				continue
 			}
 
+			metrics.SubscriptionEvents("transactions", 1)
+
 			err = storeTransaction(db, tx)
 			if err != nil {
 				fmt.Printf("Subscribe transaction events store transaction error: %v", err)
@@ -103,6 +108,12 @@ func SubscribeAndStoreTransactions(ctx context.Context, client lnrpc.LightningCl
 				rl.Take()
 				continue
 			}
+
+			pubsub.Publish(pubsub.Event{
+				Topic:       pubsub.TopicTransactions,
+				LocalNodeId: localNodeId,
+				Data:        tx,
+			})
 		}
 	}
 
@@ -110,7 +121,8 @@ func SubscribeAndStoreTransactions(ctx context.Context, client lnrpc.LightningCl
 
 var insertTx = `INSERT INTO tx (timestamp, tx_hash, amount, num_confirmations, block_hash, block_height,
                 total_fees, dest_addresses, raw_tx_hex, label) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-                ON CONFLICT (timestamp, tx_hash) DO NOTHING;`
+                ON CONFLICT (timestamp, tx_hash) DO UPDATE SET num_confirmations = EXCLUDED.num_confirmations,
+                block_hash = EXCLUDED.block_hash, block_height = EXCLUDED.block_height;`
 
 func storeTransaction(db *sqlx.DB, tx *lnrpc.Transaction) error {
 
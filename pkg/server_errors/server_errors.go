@@ -58,12 +58,31 @@ func SingleFieldError(field string, fieldError string) *ServerError {
 	return serverError
 }
 
+// forbiddenError is implemented by errors caused by missing permissions, e.g. of the macaroon of a node. They're
+// sent as 403 Forbidden instead of a server error.
+type forbiddenError interface {
+	Forbidden() bool
+}
+
+func isForbidden(err error) bool {
+	var fe forbiddenError
+	return errors.As(err, &fe) && fe.Forbidden()
+}
+
 func LogAndSendServerError(c *gin.Context, err error) {
+	if isForbidden(err) {
+		SendForbiddenFromError(c, err)
+		return
+	}
 	log.Error().Err(err).Send()
 	c.JSON(http.StatusInternalServerError, SingleServerError(err.Error()))
 }
 
 func WrapLogAndSendServerError(c *gin.Context, err error, message string) {
+	if isForbidden(err) {
+		SendForbiddenFromError(c, err)
+		return
+	}
 	err = errors.Wrap(err, message)
 	log.Error().Err(err).Send()
 	c.JSON(http.StatusInternalServerError, SingleServerError(err.Error()))
@@ -84,3 +103,15 @@ func SendBadRequestFromError(c *gin.Context, err error) {
 func SendUnprocessableEntityFromError(c *gin.Context, err error) {
 	c.JSON(http.StatusUnprocessableEntity, SingleServerError(err.Error()))
 }
+
+func SendForbidden(c *gin.Context, message string) {
+	c.JSON(http.StatusForbidden, SingleServerError(message))
+}
+
+func SendForbiddenFromError(c *gin.Context, err error) {
+	c.JSON(http.StatusForbidden, SingleServerError(err.Error()))
+}
+
+func SendConflictFromError(c *gin.Context, err error) {
+	c.JSON(http.StatusConflict, SingleServerError(err.Error()))
+}
@@ -0,0 +1,6 @@
+#!/bin/sh
+# Generates the Go code of torq.proto. Requires protoc, protoc-gen-go and protoc-gen-go-grpc.
+cd "$(dirname "$0")"
+protoc --go_out=. --go_opt=paths=source_relative \
+  --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+  torq.proto
@@ -27,6 +27,8 @@ export const AllPaymentsColumns: Array<ColumnMetaData> = [
   { key: "seconds_in_flight", heading: "Seconds In Flight", type: "DurationCell", valueType: "duration" },
   { key: "failure_reason", heading: "Failure Reason", type: "TextCell", valueType: "array" },
   { key: "is_mpp", heading: "MPP", type: "BooleanCell", valueType: "boolean" },
+  { key: "is_keysend", heading: "Keysend", type: "BooleanCell", valueType: "boolean" },
+  { key: "is_amp", heading: "AMP", type: "BooleanCell", valueType: "boolean" },
   { key: "count_failed_attempts", heading: "Failed Attempts", type: "NumericCell", valueType: "number" },
   { key: "count_successful_attempts", heading: "Successful Attempts", type: "NumericCell", valueType: "number" },
   { key: "destination_pub_key", heading: "Destination", type: "TextCell", valueType: "string" },